@@ -0,0 +1,590 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gorm.io/gorm/clause"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/core"
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+	"github.com/pulak-ranjan/kumomta-ui/internal/store"
+)
+
+// ---------------------------------
+// TOML shapes of the KumoMTA policy files
+// ---------------------------------
+
+type sourceEntry struct {
+	SourceAddress string `toml:"source_address"`
+	EHLODomain    string `toml:"ehlo_domain"`
+}
+
+type poolEntry struct {
+	Entries []struct {
+		Name   string `toml:"name"`
+		Weight int    `toml:"weight"`
+	} `toml:"entries"`
+}
+
+type queueEntry struct {
+	EgressPool       string `toml:"egress_pool"`
+	RetryInterval    string `toml:"retry_interval"`
+	MaxRetryInterval string `toml:"max_retry_interval"`
+	MaxAge           string `toml:"max_age"`
+	MaxMessageRate   string `toml:"max_message_rate"`
+}
+
+type dkimDomain struct {
+	Selector string `toml:"selector"`
+	Filename string `toml:"filename"`
+	Policy   []struct {
+		Selector    string `toml:"selector"`
+		Filename    string `toml:"filename"`
+		MatchSender string `toml:"match_sender"`
+	} `toml:"policy"`
+}
+
+type listenerDomain struct {
+	RelayTo bool `toml:"relay_to"`
+}
+
+// kumoConfig is everything we read from the policy directory.
+type kumoConfig struct {
+	Sources         map[string]sourceEntry
+	Pools           map[string]poolEntry
+	Queues          map[string]queueEntry
+	DKIM            map[string]dkimDomain
+	Auth            map[string]interface{}
+	ListenerDomains map[string]listenerDomain
+}
+
+// loadKumoConfig parses the policy files in dir. Missing files are
+// skipped; malformed ones are an error.
+func loadKumoConfig(dir string) (*kumoConfig, error) {
+	cfg := &kumoConfig{
+		Sources:         map[string]sourceEntry{},
+		Pools:           map[string]poolEntry{},
+		Queues:          map[string]queueEntry{},
+		DKIM:            map[string]dkimDomain{},
+		Auth:            map[string]interface{}{},
+		ListenerDomains: map[string]listenerDomain{},
+	}
+
+	// sources.toml mixes source tables with a [pools] table
+	var rawSources map[string]toml.Primitive
+	md, err := decodeFile(filepath.Join(dir, "sources.toml"), &rawSources)
+	if err != nil {
+		return nil, err
+	}
+	for name, prim := range rawSources {
+		if name == "pools" {
+			if err := md.PrimitiveDecode(prim, &cfg.Pools); err != nil {
+				return nil, fmt.Errorf("sources.toml [pools]: %w", err)
+			}
+			continue
+		}
+		var src sourceEntry
+		if err := md.PrimitiveDecode(prim, &src); err != nil {
+			return nil, fmt.Errorf("sources.toml [%s]: %w", name, err)
+		}
+		cfg.Sources[name] = src
+	}
+
+	if _, err := decodeFile(filepath.Join(dir, "queues.toml"), &cfg.Queues); err != nil {
+		return nil, err
+	}
+
+	var dkim struct {
+		Domain map[string]dkimDomain `toml:"domain"`
+	}
+	if _, err := decodeFile(filepath.Join(dir, "dkim_data.toml"), &dkim); err != nil {
+		return nil, err
+	}
+	if dkim.Domain != nil {
+		cfg.DKIM = dkim.Domain
+	}
+
+	if _, err := decodeFile(filepath.Join(dir, "auth.toml"), &cfg.Auth); err != nil {
+		return nil, err
+	}
+	if _, err := decodeFile(filepath.Join(dir, "listener_domains.toml"), &cfg.ListenerDomains); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func decodeFile(path string, v interface{}) (toml.MetaData, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return toml.MetaData{}, nil
+	}
+	md, err := toml.DecodeFile(path, v)
+	if err != nil {
+		return md, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return md, nil
+}
+
+// ---------------------------------
+// Import plan (pure, so it can be reported before anything is written)
+// ---------------------------------
+
+type plannedSender struct {
+	Domain       string
+	LocalPart    string
+	Email        string
+	IP           string
+	EHLO         string // ehlo_domain of the single-IP source
+	Pool         string // shared pool name, "" = single IP
+	DKIMSelector string
+	DKIMKeyPath  string
+	MessageRate  string
+	SMTPPassword string
+	QueuePolicy  models.QueuePolicy
+}
+
+type plannedMember struct {
+	IP     string
+	EHLO   string
+	Weight int
+}
+
+type plannedPool struct {
+	Name    string
+	Members []plannedMember
+}
+
+type plannedCampaign struct {
+	Email       string
+	Campaign    string
+	QueuePolicy models.QueuePolicy
+}
+
+type importPlan struct {
+	Domains   []string
+	IPs       []string
+	Senders   []plannedSender
+	Pools     []plannedPool
+	Campaigns []plannedCampaign
+	Unmapped  []string // sources not tied to any sender or pool
+	Warnings  []string
+}
+
+var invalidPoolChars = regexp.MustCompile(`[^a-zA-Z0-9.-]+`)
+
+// splitTenant splits "domain__localpart" (domains never contain "__").
+func splitTenant(name string) (domain, local string, ok bool) {
+	i := strings.Index(name, "__")
+	if i <= 0 || i+2 >= len(name) || !strings.Contains(name[:i], ".") {
+		return "", "", false
+	}
+	return strings.ToLower(name[:i]), name[i+2:], true
+}
+
+// queuePolicyOf keeps only the queue settings that differ from the panel defaults.
+func queuePolicyOf(q queueEntry) models.QueuePolicy {
+	p := models.QueuePolicy{MaxRetryInterval: q.MaxRetryInterval}
+	if q.RetryInterval != core.DefaultRetryInterval {
+		p.RetryInterval = q.RetryInterval
+	}
+	if q.MaxAge != core.DefaultMaxAge {
+		p.MaxAge = q.MaxAge
+	}
+	return p
+}
+
+func buildPlan(cfg *kumoConfig) *importPlan {
+	plan := &importPlan{}
+	senders := map[string]*plannedSender{} // by "domain__local"
+	domains := map[string]bool{}
+	usedSources := map[string]bool{}
+
+	get := func(domain, local string) *plannedSender {
+		key := domain + "__" + local
+		if s, ok := senders[key]; ok {
+			return s
+		}
+		s := &plannedSender{Domain: domain, LocalPart: local, Email: local + "@" + domain}
+		senders[key] = s
+		domains[domain] = true
+		return s
+	}
+	fromEmail := func(email string) *plannedSender {
+		at := strings.LastIndex(email, "@")
+		if at <= 0 || at == len(email)-1 {
+			return nil
+		}
+		return get(strings.ToLower(email[at+1:]), email[:at])
+	}
+
+	// 0. EHLO names go into sources.toml as-is, so a malformed one is dropped
+	// here rather than re-emitted on every apply
+	sources := make(map[string]sourceEntry, len(cfg.Sources))
+	for name, src := range cfg.Sources {
+		ehlo, err := core.ValidateEHLODomain(src.EHLODomain)
+		if err != nil {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("sources.toml [%s]: invalid ehlo_domain %q dropped", name, src.EHLODomain))
+		}
+		src.EHLODomain = ehlo
+		sources[name] = src
+	}
+
+	// 1. DKIM identities (selector + key per sender)
+	for domain, dd := range cfg.DKIM {
+		domains[strings.ToLower(domain)] = true
+		for _, p := range dd.Policy {
+			s := fromEmail(p.MatchSender)
+			if s == nil {
+				plan.Warnings = append(plan.Warnings, fmt.Sprintf("dkim_data.toml: unusable match_sender %q", p.MatchSender))
+				continue
+			}
+			s.DKIMSelector = p.Selector
+			if s.DKIMSelector == "" {
+				s.DKIMSelector = dd.Selector
+			}
+			s.DKIMKeyPath = p.Filename
+			if s.DKIMKeyPath == "" {
+				s.DKIMKeyPath = dd.Filename
+			}
+		}
+	}
+
+	// 2. SMTP credentials
+	for user, v := range cfg.Auth {
+		// A panel-generated auth.toml only lists usernames (user = true)
+		pass, ok := v.(string)
+		if !ok {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("auth.toml: user %q has no plaintext password, rotate it in the panel", user))
+			continue
+		}
+		if s := fromEmail(user); s != nil {
+			s.SMTPPassword = pass
+		} else {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("auth.toml: user %q is not an email address, skipped", user))
+		}
+	}
+
+	// 3. Shared pools (weighted source lists)
+	poolNames := map[string]string{} // kumo pool name -> panel pool name
+	for name, pe := range cfg.Pools {
+		pp := plannedPool{Name: invalidPoolChars.ReplaceAllString(strings.TrimPrefix(name, "pool__"), "-")}
+		for _, e := range pe.Entries {
+			src, ok := sources[e.Name]
+			if !ok || src.SourceAddress == "" {
+				plan.Warnings = append(plan.Warnings, fmt.Sprintf("pool %s: source %s has no address, skipped", name, e.Name))
+				continue
+			}
+			usedSources[e.Name] = true
+			pp.Members = append(pp.Members, plannedMember{IP: src.SourceAddress, EHLO: src.EHLODomain, Weight: e.Weight})
+		}
+		poolNames[name] = pp.Name
+		plan.Pools = append(plan.Pools, pp)
+	}
+
+	// 4. Tenants and campaign overrides from queues.toml
+	for key, q := range cfg.Queues {
+		switch {
+		case strings.HasPrefix(key, "tenant:"):
+			domain, local, ok := splitTenant(strings.TrimPrefix(key, "tenant:"))
+			if !ok {
+				plan.Warnings = append(plan.Warnings, fmt.Sprintf("queues.toml: cannot map %q to a sender", key))
+				continue
+			}
+			s := get(domain, local)
+			s.QueuePolicy = queuePolicyOf(q)
+			s.MessageRate = q.MaxMessageRate
+			if pool, ok := poolNames[q.EgressPool]; ok {
+				s.Pool = pool
+			} else if src, ok := sources[q.EgressPool]; ok {
+				s.IP, s.EHLO = src.SourceAddress, src.EHLODomain
+				usedSources[q.EgressPool] = true
+			}
+		case strings.HasPrefix(key, "campaign:"):
+			rest := strings.TrimPrefix(key, "campaign:")
+			i := strings.LastIndex(rest, ":")
+			if i < 0 {
+				continue
+			}
+			domain, local, ok := splitTenant(rest[:i])
+			if !ok {
+				plan.Warnings = append(plan.Warnings, fmt.Sprintf("queues.toml: cannot map %q to a sender", key))
+				continue
+			}
+			s := get(domain, local)
+			plan.Campaigns = append(plan.Campaigns, plannedCampaign{
+				Email:    s.Email,
+				Campaign: rest[i+1:],
+				// Campaign entries only carry the fields they override
+				QueuePolicy: models.QueuePolicy{
+					RetryInterval:    q.RetryInterval,
+					MaxRetryInterval: q.MaxRetryInterval,
+					MaxAge:           q.MaxAge,
+				},
+			})
+		}
+	}
+
+	// 5. Single-IP sources named "domain__localpart"
+	for name, src := range sources {
+		domain, local, ok := splitTenant(name)
+		if !ok || strings.HasPrefix(name, "pool__") {
+			continue
+		}
+		s := get(domain, local)
+		if s.IP == "" && s.Pool == "" {
+			s.IP, s.EHLO = src.SourceAddress, src.EHLODomain
+		}
+		usedSources[name] = true
+	}
+
+	// 6. Domains that only relay
+	for domain := range cfg.ListenerDomains {
+		domains[strings.ToLower(domain)] = true
+	}
+
+	// Collect, sorted for a stable report
+	ipSet := map[string]bool{}
+	for name, src := range sources {
+		if src.SourceAddress != "" {
+			ipSet[src.SourceAddress] = true
+		}
+		if !usedSources[name] {
+			plan.Unmapped = append(plan.Unmapped, fmt.Sprintf("%s (%s)", name, src.SourceAddress))
+		}
+	}
+	for ip := range ipSet {
+		plan.IPs = append(plan.IPs, ip)
+	}
+	for d := range domains {
+		plan.Domains = append(plan.Domains, d)
+	}
+	for _, s := range senders {
+		if s.IP == "" && s.Pool == "" {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("%s: no egress source found, IP left empty", s.Email))
+		}
+		plan.Senders = append(plan.Senders, *s)
+	}
+
+	sort.Strings(plan.IPs)
+	sort.Strings(plan.Domains)
+	sort.Strings(plan.Unmapped)
+	sort.Strings(plan.Warnings)
+	sort.Slice(plan.Senders, func(i, j int) bool { return plan.Senders[i].Email < plan.Senders[j].Email })
+	sort.Slice(plan.Pools, func(i, j int) bool { return plan.Pools[i].Name < plan.Pools[j].Name })
+	sort.Slice(plan.Campaigns, func(i, j int) bool {
+		if plan.Campaigns[i].Email != plan.Campaigns[j].Email {
+			return plan.Campaigns[i].Email < plan.Campaigns[j].Email
+		}
+		return plan.Campaigns[i].Campaign < plan.Campaigns[j].Campaign
+	})
+	return plan
+}
+
+// ---------------------------------
+// Report & apply
+// ---------------------------------
+
+func printReport(plan *importPlan, st *store.Store) {
+	exists := func(q interface{}, where string, arg interface{}) string {
+		if st == nil {
+			return "new"
+		}
+		var count int64
+		st.DB.Model(q).Where(where, arg).Count(&count)
+		if count > 0 {
+			return "update"
+		}
+		return "new"
+	}
+
+	fmt.Printf("\n📋 Import plan\n")
+	fmt.Printf("   Domains (%d):\n", len(plan.Domains))
+	for _, d := range plan.Domains {
+		fmt.Printf("     [%s] %s\n", exists(&models.Domain{}, "name = ?", d), d)
+	}
+	fmt.Printf("   IPs (%d): %s\n", len(plan.IPs), strings.Join(plan.IPs, ", "))
+	fmt.Printf("   Pools (%d):\n", len(plan.Pools))
+	for _, p := range plan.Pools {
+		fmt.Printf("     [%s] %s (%d IPs)\n", exists(&models.EgressPool{}, "name = ?", p.Name), p.Name, len(p.Members))
+	}
+	fmt.Printf("   Senders (%d):\n", len(plan.Senders))
+	for _, s := range plan.Senders {
+		egress := s.IP
+		if s.Pool != "" {
+			egress = "pool " + s.Pool
+		}
+		extra := []string{}
+		if s.DKIMSelector != "" {
+			extra = append(extra, "dkim="+s.DKIMSelector)
+		}
+		if s.SMTPPassword != "" {
+			extra = append(extra, "smtp-auth")
+		}
+		if s.MessageRate != "" {
+			extra = append(extra, "rate="+s.MessageRate)
+		}
+		fmt.Printf("     [%s] %s via %s %s\n", exists(&models.Sender{}, "email = ?", s.Email), s.Email, egress, strings.Join(extra, " "))
+	}
+	if len(plan.Campaigns) > 0 {
+		fmt.Printf("   Campaign queue overrides (%d):\n", len(plan.Campaigns))
+		for _, c := range plan.Campaigns {
+			fmt.Printf("     %s / %s\n", c.Email, c.Campaign)
+		}
+	}
+	for _, u := range plan.Unmapped {
+		fmt.Printf("   ⚠️  Unmapped source: %s (IP kept in inventory)\n", u)
+	}
+	for _, w := range plan.Warnings {
+		fmt.Printf("   ⚠️  %s\n", w)
+	}
+}
+
+// applyPlan writes the plan to the DB. Every step is an upsert keyed on a
+// natural name (domain name, email, IP, pool name), so re-running is safe.
+func applyPlan(st *store.Store, plan *importPlan) error {
+	for _, ip := range plan.IPs {
+		sysIP := &models.SystemIP{
+			Value:     ip,
+			CreatedAt: time.Now(),
+			Interface: "eth0", // Default, can be edited in UI
+		}
+		if err := st.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(sysIP).Error; err != nil {
+			return fmt.Errorf("ip %s: %w", ip, err)
+		}
+	}
+
+	for _, d := range plan.Domains {
+		ensureDomain(st, d)
+	}
+
+	poolIDs := map[string]uint{}
+	for _, p := range plan.Pools {
+		id, err := upsertPool(st, p)
+		if err != nil {
+			return fmt.Errorf("pool %s: %w", p.Name, err)
+		}
+		poolIDs[p.Name] = id
+	}
+
+	senderIDs := map[string]*models.Sender{}
+	for _, ps := range plan.Senders {
+		snd, err := upsertSender(st, ps, poolIDs[ps.Pool])
+		if err != nil {
+			return fmt.Errorf("sender %s: %w", ps.Email, err)
+		}
+		senderIDs[ps.Email] = snd
+	}
+
+	for _, pc := range plan.Campaigns {
+		snd := senderIDs[pc.Email]
+		if snd == nil {
+			continue
+		}
+		var cp models.CampaignQueuePolicy
+		err := st.DB.Where("domain_id = ? AND sender_id = ? AND campaign = ?", snd.DomainID, snd.ID, pc.Campaign).First(&cp).Error
+		cp.DomainID, cp.SenderID, cp.Campaign = snd.DomainID, snd.ID, pc.Campaign
+		cp.QueuePolicy = pc.QueuePolicy
+		if err == nil {
+			err = st.UpdateCampaignQueuePolicy(&cp)
+		} else {
+			err = st.CreateCampaignQueuePolicy(&cp)
+		}
+		if err != nil {
+			return fmt.Errorf("campaign %s/%s: %w", pc.Email, pc.Campaign, err)
+		}
+	}
+	return nil
+}
+
+func upsertPool(st *store.Store, p plannedPool) (uint, error) {
+	var members []models.EgressPoolMember
+	for _, m := range p.Members {
+		var ip models.SystemIP
+		if err := st.DB.Where("value = ?", m.IP).First(&ip).Error; err != nil {
+			return 0, err
+		}
+		// Keep the per-IP EHLO as the IP's hostname unless one is set already
+		if ip.Hostname == "" && m.EHLO != "" {
+			ip.Hostname = m.EHLO
+			if err := st.UpdateSystemIP(&ip); err != nil {
+				return 0, err
+			}
+		}
+		weight := m.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		members = append(members, models.EgressPoolMember{SystemIPID: ip.ID, Weight: weight})
+	}
+
+	var existing models.EgressPool
+	if err := st.DB.Where("name = ?", p.Name).First(&existing).Error; err == nil {
+		existing.Members = members
+		return existing.ID, st.UpdateEgressPool(&existing)
+	}
+	pool := &models.EgressPool{Name: p.Name, Members: members, CreatedAt: time.Now()}
+	if err := st.CreateEgressPool(pool); err != nil {
+		return 0, err
+	}
+	return pool.ID, nil
+}
+
+func upsertSender(st *store.Store, ps plannedSender, poolID uint) (*models.Sender, error) {
+	domain := ensureDomain(st, ps.Domain)
+	bounceUser := "b-" + ps.LocalPart
+	ensureBounceAccount(st, bounceUser, ps.Domain)
+
+	var snd models.Sender
+	isNew := st.DB.Where("email = ?", ps.Email).First(&snd).Error != nil
+	if isNew {
+		snd = models.Sender{
+			DomainID:       domain.ID,
+			LocalPart:      ps.LocalPart,
+			Email:          ps.Email,
+			BounceUsername: bounceUser,
+		}
+	}
+
+	if ps.IP != "" {
+		snd.IP = ps.IP
+	}
+	snd.EgressPoolID = poolID
+	if ps.SMTPPassword != "" {
+		snd.SMTPPassword = ps.SMTPPassword
+	}
+	snd.QueuePolicy = ps.QueuePolicy
+	// A warming sender's rate comes from its plan, not from the file
+	if !snd.WarmupEnabled {
+		snd.MessageRate = ps.MessageRate
+	}
+
+	// Only store DKIM settings that differ from what the panel would generate
+	snd.DKIMSelector, snd.DKIMKeyPath = "", ""
+	if ps.DKIMSelector != "" && ps.DKIMSelector != ps.LocalPart {
+		snd.DKIMSelector = ps.DKIMSelector
+	}
+	defaultKey := fmt.Sprintf("%s/%s/%s.key", core.DKIMBasePath, ps.Domain, ps.LocalPart)
+	if ps.DKIMKeyPath != "" && ps.DKIMKeyPath != defaultKey {
+		snd.DKIMKeyPath = ps.DKIMKeyPath
+	}
+
+	// Same for the EHLO: keep it only when it isn't "localpart.domain"
+	snd.EHLODomain = ""
+	if ps.Pool == "" && ps.EHLO != "" && !strings.EqualFold(ps.EHLO, ps.LocalPart+"."+ps.Domain) {
+		snd.EHLODomain = strings.ToLower(ps.EHLO)
+	}
+
+	var err error
+	if isNew {
+		err = st.CreateSender(&snd)
+	} else {
+		err = st.UpdateSender(&snd)
+	}
+	return &snd, err
+}
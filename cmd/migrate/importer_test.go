@@ -0,0 +1,182 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+	"github.com/pulak-ranjan/kumomta-ui/internal/store"
+)
+
+var fixtures = map[string]string{
+	"sources.toml": `
+["example.com__news"]
+source_address = "192.0.2.10"
+ehlo_domain = "mta1.mail.example.com"
+
+["pool__bulk-ips"]
+source_address = "192.0.2.20"
+ehlo_domain = "out20.example.net"
+
+["pool__bulk-ips-b"]
+source_address = "192.0.2.21"
+ehlo_domain = "out21_example net"
+
+["orphan"]
+source_address = "192.0.2.99"
+
+[pools."pool__bulk"]
+entries = [ { name = "pool__bulk-ips", weight = 3 }, { name = "pool__bulk-ips-b", weight = 1 } ]
+`,
+	"queues.toml": `
+["tenant:example.com__news"]
+egress_pool = "example.com__news"
+retry_interval = "1m"
+max_retry_interval = "2h"
+max_age = "3d"
+max_message_rate = "500/hr"
+
+["tenant:shop.example.org__promo"]
+egress_pool = "pool__bulk"
+retry_interval = "5m"
+max_age = "1d"
+
+["campaign:example.com__news:spring"]
+egress_pool = "example.com__news"
+max_age = "6h"
+`,
+	"dkim_data.toml": `
+[domain."example.com"]
+selector = "news"
+headers = ["From", "To", "Subject"]
+
+[[domain."example.com".policy]]
+selector = "s2024.news"
+filename = "/etc/keys/example.com/s2024.key"
+match_sender = "news@example.com"
+`,
+	"auth.toml": `
+"news@example.com" = "s3cret"
+`,
+	"listener_domains.toml": `
+["relay.example.net"]
+relay_to = true
+`,
+}
+
+func writeFixtures(t *testing.T) string {
+	dir := t.TempDir()
+	for name, content := range fixtures {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestBuildPlan(t *testing.T) {
+	cfg, err := loadKumoConfig(writeFixtures(t))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	plan := buildPlan(cfg)
+
+	wantDomains := []string{"example.com", "relay.example.net", "shop.example.org"}
+	if len(plan.Domains) != len(wantDomains) {
+		t.Fatalf("domains = %v", plan.Domains)
+	}
+	for i, d := range wantDomains {
+		if plan.Domains[i] != d {
+			t.Errorf("domain %d = %s, want %s", i, plan.Domains[i], d)
+		}
+	}
+
+	if len(plan.Senders) != 2 {
+		t.Fatalf("senders = %+v", plan.Senders)
+	}
+	news := plan.Senders[0]
+	if news.Email != "news@example.com" || news.IP != "192.0.2.10" || news.EHLO != "mta1.mail.example.com" {
+		t.Errorf("news sender = %+v", news)
+	}
+	if news.DKIMSelector != "s2024.news" || news.DKIMKeyPath != "/etc/keys/example.com/s2024.key" {
+		t.Errorf("news dkim = %q %q", news.DKIMSelector, news.DKIMKeyPath)
+	}
+	if news.SMTPPassword != "s3cret" || news.MessageRate != "500/hr" {
+		t.Errorf("news auth/rate = %q %q", news.SMTPPassword, news.MessageRate)
+	}
+	// Values equal to the panel defaults are not stored as overrides
+	if news.QueuePolicy != (models.QueuePolicy{MaxRetryInterval: "2h"}) {
+		t.Errorf("news queue policy = %+v", news.QueuePolicy)
+	}
+
+	promo := plan.Senders[1]
+	if promo.Email != "promo@shop.example.org" || promo.Pool != "bulk" || promo.IP != "" {
+		t.Errorf("promo sender = %+v", promo)
+	}
+
+	if len(plan.Pools) != 1 || len(plan.Pools[0].Members) != 2 || plan.Pools[0].Members[0].Weight != 3 {
+		t.Errorf("pools = %+v", plan.Pools)
+	}
+	if len(plan.Campaigns) != 1 || plan.Campaigns[0].Campaign != "spring" || plan.Campaigns[0].QueuePolicy.MaxAge != "6h" {
+		t.Errorf("campaigns = %+v", plan.Campaigns)
+	}
+	if len(plan.Unmapped) != 1 || plan.Unmapped[0] != "orphan (192.0.2.99)" {
+		t.Errorf("unmapped = %v", plan.Unmapped)
+	}
+
+	// A malformed ehlo_domain is dropped, not carried into the panel
+	if ehlo := plan.Pools[0].Members[1].EHLO; ehlo != "" {
+		t.Errorf("invalid pool member ehlo kept: %q", ehlo)
+	}
+	if len(plan.Warnings) != 1 || plan.Warnings[0] != `sources.toml [pool__bulk-ips-b]: invalid ehlo_domain "out21_example net" dropped` {
+		t.Errorf("warnings = %v", plan.Warnings)
+	}
+}
+
+func TestApplyPlanIsIdempotent(t *testing.T) {
+	cfg, err := loadKumoConfig(writeFixtures(t))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	st, err := store.NewStore(filepath.Join(t.TempDir(), "panel.db"))
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := applyPlan(st, buildPlan(cfg)); err != nil {
+			t.Fatalf("apply #%d: %v", i+1, err)
+		}
+	}
+
+	counts := map[string]interface{}{
+		"domains":   &models.Domain{},
+		"senders":   &models.Sender{},
+		"ips":       &models.SystemIP{},
+		"pools":     &models.EgressPool{},
+		"members":   &models.EgressPoolMember{},
+		"campaigns": &models.CampaignQueuePolicy{},
+		"bounces":   &models.BounceAccount{},
+	}
+	want := map[string]int64{"domains": 3, "senders": 2, "ips": 4, "pools": 1, "members": 2, "campaigns": 1, "bounces": 2}
+	for name, m := range counts {
+		var n int64
+		st.DB.Model(m).Count(&n)
+		if n != want[name] {
+			t.Errorf("%s = %d, want %d", name, n, want[name])
+		}
+	}
+
+	var snd models.Sender
+	st.DB.Where("email = ?", "news@example.com").First(&snd)
+	if snd.EHLODomain != "mta1.mail.example.com" {
+		t.Errorf("news ehlo_domain = %q", snd.EHLODomain)
+	}
+
+	snd = models.Sender{}
+	st.DB.Where("email = ?", "promo@shop.example.org").First(&snd)
+	if snd.EgressPoolID == 0 || snd.QueuePolicy.RetryInterval != "5m" || snd.QueuePolicy.MaxAge != "1d" {
+		t.Errorf("promo sender = %+v", snd)
+	}
+}
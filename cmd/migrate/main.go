@@ -2,51 +2,76 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"log"
 	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
 
 	"github.com/pulak-ranjan/kumomta-ui/internal/models"
 	"github.com/pulak-ranjan/kumomta-ui/internal/store"
-	"gorm.io/gorm/clause"
 )
 
 // Standard KumoMTA paths
 const (
-	SourcesPath = "/opt/kumomta/etc/policy/sources.toml"
-	InitLuaPath = "/opt/kumomta/etc/policy/init.lua"
-	DBPath      = "/var/lib/kumomta-ui/panel.db"
+	PolicyDir = "/opt/kumomta/etc/policy"
+	DBPath    = "/var/lib/kumomta-ui/panel.db"
 )
 
 func main() {
+	policyDir := flag.String("policy-dir", PolicyDir, "KumoMTA policy directory to import from")
+	dbPath := flag.String("db", DBPath, "panel database")
+	dryRun := flag.Bool("dry-run", false, "print what would be imported without writing anything")
+	flag.Parse()
+
 	// 1. Safety Check: Verify KumoMTA config exists
-	if _, err := os.Stat(SourcesPath); os.IsNotExist(err) {
-		fmt.Printf("⚠️  KumoMTA configuration not found at %s\n", SourcesPath)
+	sourcesPath := filepath.Join(*policyDir, "sources.toml")
+	if _, err := os.Stat(sourcesPath); os.IsNotExist(err) {
+		fmt.Printf("⚠️  KumoMTA configuration not found at %s\n", sourcesPath)
 		fmt.Println("   Skipping migration (Run this only on a server with KumoMTA installed)")
 		return
 	}
 
-	// 2. Open Database
-	fmt.Printf("📂 Opening DB at %s...\n", DBPath)
-	st, err := store.NewStore(DBPath)
+	// 2. Parse the policy files
+	fmt.Printf("🔍 Reading policy files in %s...\n", *policyDir)
+	cfg, err := loadKumoConfig(*policyDir)
 	if err != nil {
-		log.Fatalf("❌ Failed to open DB: %v", err)
+		log.Fatalf("❌ Failed to parse KumoMTA config: %v", err)
+	}
+	plan := buildPlan(cfg)
+
+	// 3. Open Database (a dry run never creates one)
+	var st *store.Store
+	if _, statErr := os.Stat(*dbPath); !*dryRun || statErr == nil {
+		fmt.Printf("📂 Opening DB at %s...\n", *dbPath)
+		st, err = store.NewStore(*dbPath)
+		if err != nil {
+			log.Fatalf("❌ Failed to open DB: %v", err)
+		}
 	}
 
-	// 3. Parse Global Settings (init.lua)
-	parseInitLua(st)
+	printReport(plan, st)
+	if *dryRun {
+		fmt.Println("\n🧪 Dry run: nothing was written.")
+		return
+	}
 
-	// 4. Parse Domains, Senders & IPs (sources.toml)
-	parseSourcesToml(st)
+	// 4. Parse Global Settings (init.lua)
+	parseInitLua(st, filepath.Join(*policyDir, "init.lua"))
+
+	// 5. Import Domains, Senders, IPs, Pools & queue settings
+	if err := applyPlan(st, plan); err != nil {
+		log.Fatalf("❌ Import failed: %v", err)
+	}
 
 	fmt.Println("\n✅ Migration complete! Configuration and IPs have been imported.")
 
-	// 5. Safe Restart (Preserves Queue, Applies New Config)
+	// 6. Safe Restart (Preserves Queue, Applies New Config)
 	resetKumoMTA()
 }
 
@@ -80,18 +105,23 @@ func resetKumoMTA() {
 	}
 }
 
-func parseInitLua(st *store.Store) {
+func parseInitLua(st *store.Store, path string) {
 	fmt.Println("🔍 Reading init.lua for settings...")
-	file, err := os.Open(InitLuaPath)
+	file, err := os.Open(path)
 	if err != nil {
 		fmt.Printf("⚠️  Could not read init.lua: %v\n", err)
 		return
 	}
 	defer file.Close()
 
-	settings := &models.AppSettings{
-		AIProvider: "openai", // Default
+	// Start from the saved settings so re-running keeps panel-only fields
+	settings, _ := st.GetSettings()
+	if settings == nil {
+		settings = &models.AppSettings{
+			AIProvider: "openai", // Default
+		}
 	}
+	hostnameFound := false
 
 	// Regex to find config values generic format
 	reHostname := regexp.MustCompile(`hostname\s*=\s*'([^']+)'`)
@@ -103,7 +133,8 @@ func parseInitLua(st *store.Store) {
 
 		// Capture Hostname
 		if matches := reHostname.FindStringSubmatch(line); len(matches) > 1 {
-			if settings.MainHostname == "" {
+			if !hostnameFound {
+				hostnameFound = true
 				settings.MainHostname = matches[1]
 				fmt.Printf("   Found Hostname: %s\n", settings.MainHostname)
 			}
@@ -126,94 +157,9 @@ func parseInitLua(st *store.Store) {
 		fmt.Printf("   Auto-detected Server IP: %s\n", settings.MainServerIP)
 	}
 
-	// Upsert Settings
-	existing, _ := st.GetSettings()
-	if existing != nil {
-		settings.ID = existing.ID
-	}
 	st.UpsertSettings(settings)
 }
 
-func parseSourcesToml(st *store.Store) {
-	fmt.Println("🔍 Reading sources.toml for domains & IPs...")
-	file, err := os.Open(SourcesPath)
-	if err != nil {
-		log.Fatalf("❌ Failed to open sources.toml: %v", err)
-	}
-	defer file.Close()
-
-	reEhlo := regexp.MustCompile(`ehlo_domain\s*=\s*"([^"]+)"`)
-	reSource := regexp.MustCompile(`source_address\s*=\s*"([^"]+)"`)
-
-	var currentIP string
-	count := 0
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		// Skip comments
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-
-		// 1. Capture Source IP
-		if matches := reSource.FindStringSubmatch(line); len(matches) > 1 {
-			currentIP = matches[1]
-
-			// FEATURE: Add to IP Inventory automatically
-			if currentIP != "" {
-				sysIP := &models.SystemIP{
-					Value:     currentIP,
-					CreatedAt: time.Now(),
-					Interface: "eth0", // Default, can be edited in UI
-				}
-				st.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(sysIP)
-			}
-		}
-
-		// 2. Capture Identity (EHLO)
-		if matches := reEhlo.FindStringSubmatch(line); len(matches) > 1 {
-			ehlo := matches[1] // e.g. "selector.example.com"
-
-			// Generic splitting logic: assume generic format "selector.domain.tld"
-			parts := strings.SplitN(ehlo, ".", 2)
-			if len(parts) != 2 {
-				continue
-			}
-			localPart := parts[0]
-			domainName := parts[1]
-
-			// A. Ensure Domain Exists
-			domain := ensureDomain(st, domainName)
-
-			// B. Create Standard Bounce User (b-localpart)
-			bounceUser := "b-" + localPart
-			ensureBounceAccount(st, bounceUser, domainName)
-
-			// C. Create Sender
-			sender := &models.Sender{
-				DomainID:       domain.ID,
-				LocalPart:      localPart,
-				Email:          localPart + "@" + domainName,
-				IP:             currentIP,
-				BounceUsername: bounceUser,
-			}
-
-			// Upsert Sender
-			var existing models.Sender
-			if err := st.DB.Where("email = ?", sender.Email).First(&existing).Error; err == nil {
-				existing.IP = currentIP
-				existing.BounceUsername = bounceUser
-				st.DB.Save(&existing)
-			} else {
-				st.CreateSender(sender)
-				count++
-			}
-		}
-	}
-	fmt.Printf("   Imported %d senders.\n", count)
-}
-
 // Helpers
 
 func ensureDomain(st *store.Store, name string) *models.Domain {
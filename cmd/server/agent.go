@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/agent"
+	"github.com/pulak-ranjan/kumomta-ui/internal/core"
+)
+
+// runAgent starts the node agent: it accepts config bundles signed by the
+// panel and reports this host's health and stats.
+//
+//	KUMO_AGENT_SECRET=<node secret> kumomta-ui agent -listen 0.0.0.0:9100
+func runAgent(args []string) {
+	fs := flag.NewFlagSet("agent", flag.ExitOnError)
+	listen := fs.String("listen", "0.0.0.0:9100", "address the agent listens on")
+	policyDir := fs.String("policy-dir", core.KumoPolicyDir, "KumoMTA policy directory")
+	dkimDir := fs.String("dkim-dir", core.DKIMBasePath, "directory for DKIM keys shipped by the panel")
+	tlsCert := fs.String("tls-cert", "", "TLS certificate (required, bundles carry DKIM keys)")
+	tlsKey := fs.String("tls-key", "", "TLS private key")
+	insecureLoopback := fs.Bool("insecure-loopback", false, "serve plain HTTP; only with a loopback -listen address")
+	fs.Parse(args)
+
+	secret := os.Getenv("KUMO_AGENT_SECRET")
+	if len(secret) < 32 {
+		log.Fatalf("KUMO_AGENT_SECRET must be set to the node secret shown by the panel")
+	}
+
+	useTLS := *tlsCert != "" || *tlsKey != ""
+	if useTLS && (*tlsCert == "" || *tlsKey == "") {
+		log.Fatalf("-tls-cert and -tls-key must be set together")
+	}
+	if !useTLS {
+		host, _, err := net.SplitHostPort(*listen)
+		if !*insecureLoopback || err != nil || !core.IsLoopbackHost(host) {
+			log.Fatalf("the agent needs -tls-cert and -tls-key (plain HTTP only with -insecure-loopback and a loopback -listen address)")
+		}
+	}
+
+	a := agent.New(secret, *policyDir, *dkimDir)
+
+	log.Printf("Kumo UI agent listening on %s (policy dir %s)\n", *listen, *policyDir)
+	var err error
+	if useTLS {
+		err = http.ListenAndServeTLS(*listen, *tlsCert, *tlsKey, a.Handler())
+	} else {
+		log.Println("Warning: agent is running without TLS on loopback")
+		err = http.ListenAndServe(*listen, a.Handler())
+	}
+	if err != nil {
+		log.Fatalf("agent error: %v", err)
+	}
+}
@@ -12,6 +12,12 @@ import (
 )
 
 func main() {
+	// "kumomta-ui agent" runs the node agent instead of the panel
+	if len(os.Args) > 1 && os.Args[1] == "agent" {
+		runAgent(os.Args[2:])
+		return
+	}
+
 	// Check security configuration first
 	if _, err := core.GetEncryptionKey(); err != nil {
 		log.Fatalf("Security configuration error: %v. Please set KUMO_APP_SECRET environment variable.", err)
@@ -22,6 +28,7 @@ func main() {
 		dbDir = "/var/lib/kumomta-ui"
 	}
 	dbPath := dbDir + "/panel.db"
+	core.AssetDir = dbDir + "/assets"
 
 	// Ensure DB directory exists
 	if err := os.MkdirAll(dbDir, 0o755); err != nil {
@@ -34,6 +41,16 @@ func main() {
 		log.Fatalf("failed to open DB: %v", err)
 	}
 
+	// Keep a hand-written custom.lua from being overwritten by the first apply
+	if err := core.AdoptLegacyCustomLua(st); err != nil {
+		log.Printf("Warning: failed to adopt existing custom.lua: %v", err)
+	}
+
+	// Older config revisions stored the kumod -> panel tokens in init.lua
+	if err := core.RedactStoredRevisions(st); err != nil {
+		log.Printf("Warning: failed to redact stored config revisions: %v", err)
+	}
+
 	// Initialize Core Services
 	ws := core.NewWebhookService(st)
 	srv := api.NewServer(st, ws)
@@ -100,6 +117,12 @@ func startScheduler(ws *core.WebhookService) {
 				log.Printf("Scheduled campaign error: %v", err)
 			}
 
+			// 3. Node health & stats
+			core.PollNodes(ws.Store)
+
+			// 4. mailto: unsubscribes in the bounce mailboxes
+			core.ProcessUnsubscribeMailboxes(ws.Store)
+
 		case <-dailyTicker.C:
 			log.Println("[Scheduler] Running daily tasks...")
 
@@ -5,11 +5,13 @@ go 1.24.0
 toolchain go1.24.3
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/go-chi/chi/v5 v5.0.12
 	github.com/go-chi/cors v1.2.2
 	github.com/klauspost/compress v1.17.9
 	golang.org/x/crypto v0.46.0
 	golang.org/x/net v0.48.0
+	golang.org/x/time v0.14.0
 	gorm.io/driver/sqlite v1.5.7
 	gorm.io/gorm v1.25.7
 )
@@ -18,5 +20,4 @@ require (
 	github.com/jinzhu/inflection v1.0.0 // indirect
 	github.com/jinzhu/now v1.1.5 // indirect
 	github.com/mattn/go-sqlite3 v1.14.22 // indirect
-	golang.org/x/time v0.14.0 // indirect
 )
@@ -0,0 +1,214 @@
+// Package agent is the node side of multi-node management: a small HTTP
+// service ("kumomta-ui agent") that runs next to kumod on a remote host,
+// applies the signed config bundles the panel pushes and reports health,
+// queue and log stats back.
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/core"
+)
+
+// hashFile records the hash of the last bundle applied, inside PolicyDir.
+const hashFile = ".panel-bundle-hash"
+
+// Agent applies bundles for one node.
+type Agent struct {
+	Secret  string // shared with the panel (shown when the node is created)
+	DKIMDir string // where shipped DKIM keys are written
+	Applier *core.Applier
+
+	mu     sync.Mutex // one apply at a time
+	nonces core.AgentNonceCache
+}
+
+// New builds an agent that applies through the production applier
+// (KUMO_APPLY_MODE is honoured, so "noop" works for local testing).
+func New(secret, policyDir, dkimDir string) *Agent {
+	applier := core.NewApplierFromEnv()
+	applier.PolicyDir = policyDir
+	return &Agent{Secret: secret, DKIMDir: dkimDir, Applier: applier}
+}
+
+// Handler returns the agent's HTTP routes.
+func (a *Agent) Handler() http.Handler {
+	r := chi.NewRouter()
+	r.Post(core.AgentApplyPath, a.handleApply)
+	r.Get(core.AgentReportPath, a.handleReport)
+	return r
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// verify reads the body and checks the panel's signature.
+func (a *Agent) verify(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 50<<20))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "body too large"})
+		return nil, false
+	}
+	if err := core.VerifyAgentRequest(a.Secret, &a.nonces, r, body); err != nil {
+		log.Printf("Agent: rejected %s %s from %s: %v", r.Method, r.URL.Path, r.RemoteAddr, err)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+		return nil, false
+	}
+	return body, true
+}
+
+// POST /agent/apply
+func (a *Agent) handleApply(w http.ResponseWriter, r *http.Request) {
+	body, ok := a.verify(w, r)
+	if !ok {
+		return
+	}
+
+	var bundle core.NodeBundle
+	if err := json.Unmarshal(body, &bundle); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid bundle"})
+		return
+	}
+	if len(bundle.Files) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "bundle has no files"})
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	res, err := a.Apply(&bundle)
+	if err != nil {
+		log.Printf("Agent: apply of bundle %s failed: %v", shortHash(bundle.Hash), err)
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{"result": res, "error": err.Error()})
+		return
+	}
+	log.Printf("Agent: applied bundle %s for node %s", shortHash(bundle.Hash), bundle.Node)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"result": res})
+}
+
+// Apply writes the bundle's DKIM keys, then validates, swaps in and
+// reloads its policy files.
+func (a *Agent) Apply(bundle *core.NodeBundle) (*core.ApplyResult, error) {
+	for _, f := range bundle.Files {
+		if f.Name != filepath.Base(f.Name) || strings.HasPrefix(f.Name, ".") {
+			return nil, fmt.Errorf("invalid file name %q", f.Name)
+		}
+	}
+	for _, k := range bundle.DKIMKeys {
+		if err := a.writeDKIMKey(k); err != nil {
+			return nil, err
+		}
+	}
+
+	res, err := a.Applier.Apply(bundle.Files)
+	if err != nil {
+		return res, err
+	}
+
+	hash := bundle.ContentHash()
+	if err := os.WriteFile(filepath.Join(a.Applier.PolicyDir, hashFile), []byte(hash), 0o644); err != nil {
+		log.Printf("Agent: failed to record bundle hash: %v", err)
+	}
+	return res, nil
+}
+
+// writeDKIMKey stores a private key under DKIMDir, refusing paths that
+// would escape it.
+func (a *Agent) writeDKIMKey(k core.BundleFile) error {
+	path := filepath.Join(a.DKIMDir, filepath.Clean("/"+k.Path))
+	if rel, err := filepath.Rel(a.DKIMDir, path); err != nil || strings.HasPrefix(rel, "..") || rel == "." {
+		return fmt.Errorf("invalid DKIM key path %q", k.Path)
+	}
+
+	if existing, err := os.ReadFile(path); err == nil && string(existing) == k.Content {
+		return nil
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return fmt.Errorf("mkdir dkim dir: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(k.Content), 0o600); err != nil {
+		return fmt.Errorf("write dkim key: %w", err)
+	}
+	// Same ownership as keys generated by the panel; ignored on dev boxes
+	_ = exec.Command("chown", "-R", "kumod:kumod", dir).Run()
+	return nil
+}
+
+// GET /agent/report
+func (a *Agent) handleReport(w http.ResponseWriter, r *http.Request) {
+	if _, ok := a.verify(w, r); !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, a.Report())
+}
+
+// Report collects health, queue and today's log stats for this host.
+func (a *Agent) Report() *core.NodeReport {
+	rep := &core.NodeReport{
+		Time:     time.Now().UTC(),
+		Services: map[string]string{},
+	}
+	rep.Hostname, _ = os.Hostname()
+
+	for _, svc := range []string{"kumomta", "firewalld"} {
+		out, _ := exec.Command("systemctl", "is-active", svc).Output()
+		status := strings.TrimSpace(string(out))
+		if status == "" {
+			status = "unknown"
+		}
+		rep.Services[svc] = status
+	}
+
+	if data, err := os.ReadFile("/proc/loadavg"); err == nil {
+		if parts := strings.Fields(string(data)); len(parts) > 0 {
+			rep.Load1m, _ = strconv.ParseFloat(parts[0], 64)
+		}
+	}
+	if data, err := os.ReadFile("/proc/meminfo"); err == nil {
+		mem := map[string]int64{}
+		for _, line := range strings.Split(string(data), "\n") {
+			if parts := strings.Fields(line); len(parts) >= 2 {
+				mem[strings.TrimSuffix(parts[0], ":")], _ = strconv.ParseInt(parts[1], 10, 64)
+			}
+		}
+		rep.RAMTotalMB = mem["MemTotal"] / 1024
+		rep.RAMAvailableMB = mem["MemAvailable"] / 1024
+	}
+	if out, err := exec.Command("df", "-h", "/").Output(); err == nil {
+		rep.DiskUsage = string(out)
+	}
+
+	rep.Queue, _ = core.GetQueueStats()
+	if stats, err := core.GetAllDomainsStats(1); err == nil {
+		rep.Stats = stats
+	}
+	if data, err := os.ReadFile(filepath.Join(a.Applier.PolicyDir, hashFile)); err == nil {
+		rep.PolicyHash = strings.TrimSpace(string(data))
+	}
+	return rep
+}
+
+func shortHash(h string) string {
+	if len(h) > 12 {
+		return h[:12]
+	}
+	return h
+}
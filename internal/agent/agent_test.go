@@ -0,0 +1,135 @@
+package agent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/core"
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+	"github.com/pulak-ranjan/kumomta-ui/internal/store"
+)
+
+func newTestAgent(t *testing.T, secret string) *Agent {
+	dir := t.TempDir()
+	return &Agent{
+		Secret:  secret,
+		DKIMDir: filepath.Join(dir, "dkim"),
+		Applier: &core.Applier{
+			PolicyDir: filepath.Join(dir, "policy"),
+			Validator: core.NoopValidator{},
+			Reloader:  &core.NoopReloader{},
+		},
+	}
+}
+
+func TestPushAndReport(t *testing.T) {
+	t.Setenv("KUMO_APP_SECRET", "test-secret-that-is-at-least-32-characters")
+	st, err := store.NewStore(filepath.Join(t.TempDir(), "panel.db"))
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+
+	secret := core.GenerateNodeSecret()
+	a := newTestAgent(t, secret)
+	srv := httptest.NewServer(a.Handler())
+	defer srv.Close()
+
+	enc, _ := core.Encrypt(secret)
+	node := models.Node{Name: "mta2", URL: srv.URL, Secret: enc, Enabled: true}
+	if err := st.CreateNode(&node); err != nil {
+		t.Fatalf("create node: %v", err)
+	}
+	st.CreateDomain(&models.Domain{Name: "local.example"})
+	st.CreateDomain(&models.Domain{Name: "remote.example", NodeID: node.ID})
+
+	if _, err := core.PushNodeConfig(st, &node); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(a.Applier.PolicyDir, "listener_domains.toml"))
+	if err != nil {
+		t.Fatalf("listener_domains.toml not written: %v", err)
+	}
+	if !strings.Contains(string(data), "remote.example") || strings.Contains(string(data), "local.example") {
+		t.Errorf("node got the wrong domains:\n%s", data)
+	}
+
+	got, _ := st.GetNodeByID(node.ID)
+	if got.AppliedHash == "" || got.LastApplyError != "" {
+		t.Errorf("apply not recorded: hash %q, error %q", got.AppliedHash, got.LastApplyError)
+	}
+
+	report, err := core.FetchNodeReport(st, got)
+	if err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	if report.PolicyHash != got.AppliedHash {
+		t.Errorf("report hash %q, want %q", report.PolicyHash, got.AppliedHash)
+	}
+	got, _ = st.GetNodeByID(node.ID)
+	if got.LastSeenAt == nil || got.LastReport == "" {
+		t.Error("report not recorded on the node")
+	}
+}
+
+func TestRejectsBadSignature(t *testing.T) {
+	a := newTestAgent(t, core.GenerateNodeSecret())
+
+	req := httptest.NewRequest(http.MethodGet, core.AgentReportPath, nil)
+	rec := httptest.NewRecorder()
+	a.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("unsigned request: status %d", rec.Code)
+	}
+
+	signed := func(ts int64, nonce string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, core.AgentReportPath, nil)
+		req.Header.Set(core.AgentTimestampHeader, strconv.FormatInt(ts, 10))
+		req.Header.Set(core.AgentNonceHeader, nonce)
+		req.Header.Set(core.AgentSignatureHeader, core.SignAgentRequest(a.Secret, http.MethodGet, core.AgentReportPath, ts, nonce, nil))
+		return req
+	}
+	serve := func(req *http.Request) int {
+		rec := httptest.NewRecorder()
+		a.Handler().ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := serve(signed(1, core.NewAgentNonce())); code != http.StatusUnauthorized {
+		t.Errorf("stale request: status %d", code)
+	}
+
+	// A captured request can't be replayed within the clock skew window
+	now, nonce := time.Now().Unix(), core.NewAgentNonce()
+	if code := serve(signed(now, nonce)); code != http.StatusOK {
+		t.Fatalf("signed request: status %d", code)
+	}
+	if code := serve(signed(now, nonce)); code != http.StatusUnauthorized {
+		t.Errorf("replayed request: status %d", code)
+	}
+	if code := serve(signed(now, "")); code != http.StatusUnauthorized {
+		t.Errorf("request without a nonce: status %d", code)
+	}
+}
+
+func TestApplyRejectsUnsafePaths(t *testing.T) {
+	a := newTestAgent(t, "secret")
+	files := []core.KumoConfigFile{{Name: "init.lua", Content: "-- test"}}
+
+	if _, err := a.Apply(&core.NodeBundle{Files: files, DKIMKeys: []core.BundleFile{{Path: "../../etc/passwd", Content: "x"}}}); err != nil {
+		t.Fatalf("cleaned path should stay under the DKIM dir: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(a.DKIMDir, "etc", "passwd")); err != nil {
+		t.Errorf("key not written under the DKIM dir: %v", err)
+	}
+
+	bad := []core.KumoConfigFile{{Name: "../init.lua", Content: "-- test"}}
+	if _, err := a.Apply(&core.NodeBundle{Files: bad}); err == nil {
+		t.Error("file name with a path accepted")
+	}
+}
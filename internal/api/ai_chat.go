@@ -213,22 +213,66 @@ func (s *Server) runSafeTool(cmdName, args string) string {
 			return "Error: Invalid IP address provided."
 		}
 		
-		// Update DB
 		settings, err := s.Store.GetSettings()
 		if err != nil {
 			settings = &models.AppSettings{} 
 		}
-		settings.SMTPListenAddr = ip + ":25"
+		oldAddr := settings.SMTPListenAddr
+		if oldAddr == "" {
+			oldAddr = "127.0.0.1:25"
+		}
+		newAddr := net.JoinHostPort(ip, "25")
+
+		// Configured listeners take precedence over SMTPListenAddr. Only the
+		// one bound to the old address moves (or the only port 25 one), and
+		// everything is checked before the settings are saved.
+		listeners, err := s.Store.ListListeners()
+		if err != nil {
+			return "Database Error: " + err.Error()
+		}
+		var target *models.Listener
+		var port25 []*models.Listener
+		for i := range listeners {
+			if listeners[i].ListenAddr == oldAddr {
+				target = &listeners[i]
+			}
+			if _, port, err := net.SplitHostPort(listeners[i].ListenAddr); err == nil && port == "25" {
+				port25 = append(port25, &listeners[i])
+			}
+		}
+		if target == nil && len(port25) == 1 {
+			target = port25[0]
+		}
+		if target == nil && len(port25) > 1 {
+			return "Error: several listeners use port 25 and none is bound to " + oldAddr + ". Change the right one on the Listeners page."
+		}
+		for i := range listeners {
+			if target != nil && listeners[i].ID != target.ID && listeners[i].ListenAddr == newAddr {
+				return "Error: another listener is already bound to " + newAddr + "."
+			}
+		}
+
+		// Update DB
+		settings.SMTPListenAddr = newAddr
 		if err := s.Store.UpsertSettings(settings); err != nil {
 			return "Database Error: " + err.Error()
 		}
+		if target != nil && target.ListenAddr != newAddr {
+			target.ListenAddr = newAddr
+			if err := s.Store.UpdateListener(target); err != nil {
+				return "Database Error: " + err.Error()
+			}
+		}
 
 		// Apply & Restart
 		snap, err := core.LoadSnapshot(s.Store)
 		if err != nil { return "Snapshot Error: " + err.Error() }
 		
-		res, err := core.ApplyKumoConfig(snap)
+		res, _, err := core.ApplyAndRecord(s.Store, snap, "ai-agent")
 		if err != nil {
+			if res == nil {
+				return "Apply Failed: " + err.Error()
+			}
 			return fmt.Sprintf("Apply Failed: %v\nValidation Output: %s", err, res.ValidationLog)
 		}
 		return fmt.Sprintf("Success! Port 25 Listener updated to %s. Service restarted.", settings.SMTPListenAddr)
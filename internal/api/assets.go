@@ -0,0 +1,109 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pulak-ranjan/kumomta-ui/internal/core"
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+)
+
+// GET /api/assets
+func (s *Server) handleListAssets(w http.ResponseWriter, r *http.Request) {
+	assets := []models.Asset{}
+	if err := s.Store.DB.Order("id desc").Find(&assets).Error; err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list assets"})
+		return
+	}
+	writeJSON(w, http.StatusOK, assets)
+}
+
+// POST /api/assets (multipart, field "file")
+// Use the returned id in a campaign's attachment_ids, or show an image
+// inline with <img src="cid:asset-ID">.
+func (s *Server) handleUploadAsset(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, core.MaxAssetSize+1<<20)
+	if err := r.ParseMultipartForm(core.MaxAssetSize); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("file too big (max %d MB)", core.MaxAssetSize>>20)})
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "missing file"})
+		return
+	}
+	defer file.Close()
+
+	asset, err := core.SaveAsset(s.Store, header.Filename, file)
+	if errors.Is(err, core.ErrAssetRejected) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to save asset"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Upload Asset", fmt.Sprintf("%s (%s, %d bytes)", asset.Name, asset.ContentType, asset.Size), s.getUser(r))
+
+	writeJSON(w, http.StatusCreated, asset)
+}
+
+// GET /api/assets/{id}/content
+func (s *Server) handleAssetContent(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	var asset models.Asset
+	if err := s.Store.DB.First(&asset, id).Error; err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "asset not found"})
+		return
+	}
+	data, err := core.ReadAsset(asset)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to read asset"})
+		return
+	}
+
+	w.Header().Set("Content-Type", asset.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": asset.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(data)
+}
+
+// DELETE /api/assets/{id}
+func (s *Server) handleDeleteAsset(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	var asset models.Asset
+	if err := s.Store.DB.First(&asset, id).Error; err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "asset not found"})
+		return
+	}
+
+	campaignID, workflowID, err := core.AssetInUse(s.Store, asset.ID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to check asset usage"})
+		return
+	}
+	if campaignID != 0 {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": fmt.Sprintf("asset is used by campaign %d", campaignID)})
+		return
+	}
+	if workflowID != 0 {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": fmt.Sprintf("asset is used by automation workflow %d", workflowID)})
+		return
+	}
+
+	if err := core.DeleteAsset(s.Store, asset); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to delete asset"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Delete Asset", fmt.Sprintf("%s (ID: %d)", asset.Name, asset.ID), s.getUser(r))
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
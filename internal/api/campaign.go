@@ -2,9 +2,12 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/pulak-ranjan/kumomta-ui/internal/core"
@@ -31,17 +34,83 @@ func (h *CampaignHandler) Routes(r chi.Router) {
 	r.Post("/", h.createCampaign)
 	r.Post("/{id}/import", h.importRecipients)
 	r.Post("/{id}/send", h.startCampaign)
+	r.Post("/{id}/pause", h.pauseCampaign)
+	r.Post("/{id}/resume", h.resumeCampaign)
+	r.Post("/{id}/cancel", h.cancelCampaign)
+	r.Post("/{id}/reschedule", h.rescheduleCampaign)
+	r.Post("/{id}/clone", h.cloneCampaign)
+	r.Post("/{id}/preview", h.previewCampaign)
+	r.Get("/{id}/audience", h.campaignAudience)
+	r.Get("/{id}/progress", h.campaignProgress)
+	r.Put("/{id}", h.updateCampaign)
 	r.Get("/{id}", h.getCampaign)
 }
 
+// writeCampaignError maps lifecycle errors to HTTP statuses.
+func writeCampaignError(w http.ResponseWriter, err error) {
+	var stateErr *core.CampaignStateError
+	switch {
+	case errors.Is(err, core.ErrCampaignNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+	case errors.As(err, &stateErr):
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+}
+
+// validateCampaignTemplates reports personalization syntax errors in the
+// subject and body (nil: not being changed).
+func validateCampaignTemplates(v *validation.Validator, subject, body *string) {
+	if subject != nil {
+		if err := core.ValidateTemplate(*subject); err != nil {
+			v.AddError("subject", err.Error())
+		}
+	}
+	if body != nil {
+		if err := core.ValidateTemplate(*body); err != nil {
+			v.AddError("body", err.Error())
+		}
+	}
+}
+
+// validateVariants checks the A/B variants' content; empty subject or
+// body use the campaign's.
+func validateVariants(v *validation.Validator, variants []models.CampaignVariant) {
+	for i := range variants {
+		field := fmt.Sprintf("variants[%d]", i)
+		v.MaxLength(field+".name", variants[i].Name, 50)
+		v.MaxLength(field+".subject", variants[i].Subject, 500).NoScriptTags(field+".subject", variants[i].Subject)
+		v.NoScriptTags(field+".body", variants[i].Body)
+		if err := core.ValidateTemplate(variants[i].Subject); err != nil {
+			v.AddError(field+".subject", err.Error())
+		}
+		if err := core.ValidateTemplate(variants[i].Body); err != nil {
+			v.AddError(field+".body", err.Error())
+		}
+	}
+}
+
+// campaignDTO adds the live throughput of a campaign that is sending and,
+// for a single campaign, its progress.
+type campaignDTO struct {
+	models.Campaign
+	Live     *core.CampaignThroughput `json:"live,omitempty"`
+	Progress *core.CampaignProgress   `json:"progress,omitempty"`
+}
+
 func (h *CampaignHandler) listCampaigns(w http.ResponseWriter, r *http.Request) {
 	var campaigns []models.Campaign
 	// Order by newest first
-	if err := h.Store.DB.Order("created_at desc").Find(&campaigns).Error; err != nil {
+	if err := h.Store.DB.Preload("Variants").Order("created_at desc").Find(&campaigns).Error; err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
 		return
 	}
-	writeJSON(w, http.StatusOK, campaigns)
+	out := make([]campaignDTO, 0, len(campaigns))
+	for _, c := range campaigns {
+		out = append(out, campaignDTO{Campaign: c, Live: core.CampaignLiveStats(c.ID)})
+	}
+	writeJSON(w, http.StatusOK, out)
 }
 
 func (h *CampaignHandler) createCampaign(w http.ResponseWriter, r *http.Request) {
@@ -50,6 +119,25 @@ func (h *CampaignHandler) createCampaign(w http.ResponseWriter, r *http.Request)
 		Subject  string `json:"subject"`
 		Body     string `json:"body"`
 		SenderID uint   `json:"sender_id"`
+
+		Concurrency   int     `json:"concurrency"`
+		RatePerSecond float64 `json:"rate_per_second"`
+
+		ListIDs   string `json:"list_ids"`
+		SegmentID uint   `json:"segment_id"`
+
+		SendAtLocalTime string `json:"send_at_local_time"`
+		SendWindowDays  string `json:"send_window_days"`
+		SendWindowStart string `json:"send_window_start"`
+		SendWindowEnd   string `json:"send_window_end"`
+		Timezone        string `json:"timezone"`
+
+		AttachmentIDs string `json:"attachment_ids"`
+
+		ABTestPercent  int                      `json:"ab_test_percent"`
+		ABWinnerMetric string                   `json:"ab_winner_metric"`
+		ABWaitMinutes  int                      `json:"ab_wait_minutes"`
+		Variants       []models.CampaignVariant `json:"variants"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
@@ -60,10 +148,15 @@ func (h *CampaignHandler) createCampaign(w http.ResponseWriter, r *http.Request)
 	v.Required("name", req.Name).MaxLength("name", req.Name, 200)
 	v.Required("subject", req.Subject).MaxLength("subject", req.Subject, 500).NoScriptTags("subject", req.Subject)
 	v.Required("body", req.Body).NoScriptTags("body", req.Body)
+	validateCampaignTemplates(v, &req.Subject, &req.Body)
+	validateVariants(v, req.Variants)
 
 	if req.SenderID == 0 {
 		v.AddError("sender_id", "is required")
 	}
+	if err := core.ValidateCampaignSpeed(req.Concurrency, req.RatePerSecond); err != nil {
+		v.AddError("speed", err.Error())
+	}
 
 	if !v.Valid() {
 		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"errors": v.Errors()})
@@ -82,7 +175,44 @@ func (h *CampaignHandler) createCampaign(w http.ResponseWriter, r *http.Request)
 		Subject:  req.Subject,
 		Body:     req.Body,
 		SenderID: req.SenderID,
-		Status:   "draft",
+		Status:   core.CampaignDraft,
+
+		Concurrency:   req.Concurrency,
+		RatePerSecond: req.RatePerSecond,
+
+		ListIDs:   req.ListIDs,
+		SegmentID: req.SegmentID,
+
+		SendAtLocalTime: req.SendAtLocalTime,
+		SendWindowDays:  req.SendWindowDays,
+		SendWindowStart: req.SendWindowStart,
+		SendWindowEnd:   req.SendWindowEnd,
+		Timezone:        req.Timezone,
+
+		AttachmentIDs: req.AttachmentIDs,
+
+		ABTestPercent:  req.ABTestPercent,
+		ABWinnerMetric: req.ABWinnerMetric,
+		ABWaitMinutes:  req.ABWaitMinutes,
+	}
+	if err := core.ValidateSendSchedule(&campaign); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := core.ValidateCampaignAudience(h.Store, &campaign); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := core.ValidateABTest(&campaign, req.Variants); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := core.ValidateCampaignAssets(h.Store, &campaign, req.Variants); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	for _, variant := range req.Variants {
+		campaign.Variants = append(campaign.Variants, models.CampaignVariant{Name: variant.Name, Subject: variant.Subject, Body: variant.Body})
 	}
 
 	if err := h.Store.DB.Create(&campaign).Error; err != nil {
@@ -132,21 +262,322 @@ func (h *CampaignHandler) startCampaign(w http.ResponseWriter, r *http.Request)
 	id, _ := strconv.Atoi(idStr)
 
 	if err := h.Service.StartCampaign(uint(id)); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		writeCampaignError(w, err)
 		return
 	}
 
 	writeJSON(w, http.StatusOK, map[string]string{"status": "started"})
 }
 
+// pauseCampaign stops sending after the current batch.
+func (h *CampaignHandler) pauseCampaign(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, _ := strconv.Atoi(idStr)
+
+	if err := h.Service.PauseCampaign(uint(id)); err != nil {
+		writeCampaignError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": core.CampaignPaused})
+}
+
+func (h *CampaignHandler) resumeCampaign(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, _ := strconv.Atoi(idStr)
+
+	if err := h.Service.ResumeCampaign(uint(id)); err != nil {
+		writeCampaignError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": core.CampaignSending})
+}
+
+func (h *CampaignHandler) cancelCampaign(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, _ := strconv.Atoi(idStr)
+
+	if err := h.Service.CancelCampaign(uint(id)); err != nil {
+		writeCampaignError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": core.CampaignCancelled})
+}
+
+func (h *CampaignHandler) rescheduleCampaign(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, _ := strconv.Atoi(idStr)
+
+	var req struct {
+		ScheduledAt time.Time `json:"scheduled_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json (scheduled_at must be RFC 3339)"})
+		return
+	}
+
+	if err := h.Service.RescheduleCampaign(uint(id), req.ScheduledAt); err != nil {
+		writeCampaignError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": core.CampaignScheduled, "scheduled_at": req.ScheduledAt})
+}
+
+// updateCampaign edits a draft (or a scheduled campaign that hasn't started).
+func (h *CampaignHandler) updateCampaign(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, _ := strconv.Atoi(idStr)
+
+	var req struct {
+		Name     *string `json:"name"`
+		Subject  *string `json:"subject"`
+		Body     *string `json:"body"`
+		SenderID *uint   `json:"sender_id"`
+
+		Concurrency   *int     `json:"concurrency"`
+		RatePerSecond *float64 `json:"rate_per_second"`
+
+		ListIDs   *string `json:"list_ids"`
+		SegmentID *uint   `json:"segment_id"`
+
+		SendAtLocalTime *string `json:"send_at_local_time"`
+		SendWindowDays  *string `json:"send_window_days"`
+		SendWindowStart *string `json:"send_window_start"`
+		SendWindowEnd   *string `json:"send_window_end"`
+		Timezone        *string `json:"timezone"`
+
+		AttachmentIDs *string `json:"attachment_ids"`
+
+		ABTestPercent  *int                      `json:"ab_test_percent"`
+		ABWinnerMetric *string                   `json:"ab_winner_metric"`
+		ABWaitMinutes  *int                      `json:"ab_wait_minutes"`
+		Variants       *[]models.CampaignVariant `json:"variants"` // replaces all; [] removes the test
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+
+	v := validation.New()
+	if req.Name != nil {
+		v.Required("name", *req.Name).MaxLength("name", *req.Name, 200)
+	}
+	if req.Subject != nil {
+		v.Required("subject", *req.Subject).MaxLength("subject", *req.Subject, 500).NoScriptTags("subject", *req.Subject)
+	}
+	if req.Body != nil {
+		v.Required("body", *req.Body).NoScriptTags("body", *req.Body)
+	}
+	validateCampaignTemplates(v, req.Subject, req.Body)
+	if req.Variants != nil {
+		validateVariants(v, *req.Variants)
+	}
+	if req.Concurrency != nil || req.RatePerSecond != nil {
+		concurrency, rate := 0, 0.0
+		if req.Concurrency != nil {
+			concurrency = *req.Concurrency
+		}
+		if req.RatePerSecond != nil {
+			rate = *req.RatePerSecond
+		}
+		if err := core.ValidateCampaignSpeed(concurrency, rate); err != nil {
+			v.AddError("speed", err.Error())
+		}
+	}
+	if !v.Valid() {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"errors": v.Errors()})
+		return
+	}
+	if req.SenderID != nil {
+		var sender models.Sender
+		if err := h.Store.DB.First(&sender, *req.SenderID).Error; err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "sender not found"})
+			return
+		}
+	}
+
+	campaign, err := h.Service.UpdateCampaignDraft(uint(id), core.CampaignDraftUpdate{
+		Name:     req.Name,
+		Subject:  req.Subject,
+		Body:     req.Body,
+		SenderID: req.SenderID,
+
+		Concurrency:   req.Concurrency,
+		RatePerSecond: req.RatePerSecond,
+
+		ListIDs:   req.ListIDs,
+		SegmentID: req.SegmentID,
+
+		SendAtLocalTime: req.SendAtLocalTime,
+		SendWindowDays:  req.SendWindowDays,
+		SendWindowStart: req.SendWindowStart,
+		SendWindowEnd:   req.SendWindowEnd,
+		Timezone:        req.Timezone,
+
+		AttachmentIDs: req.AttachmentIDs,
+
+		ABTestPercent:  req.ABTestPercent,
+		ABWinnerMetric: req.ABWinnerMetric,
+		ABWaitMinutes:  req.ABWaitMinutes,
+		Variants:       req.Variants,
+	})
+	if err != nil {
+		writeCampaignError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, campaign)
+}
+
+// cloneCampaign copies a campaign and its recipients into a new draft.
+func (h *CampaignHandler) cloneCampaign(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, _ := strconv.Atoi(idStr)
+
+	campaign, err := h.Service.CloneCampaign(uint(id))
+	if err != nil {
+		writeCampaignError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, campaign)
+}
+
+// campaignProgress reports recipients by state, those waiting for their
+// local send time, and the expected completion.
+func (h *CampaignHandler) campaignProgress(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, _ := strconv.Atoi(idStr)
+
+	progress, err := h.Service.Progress(uint(id))
+	if err != nil {
+		writeCampaignError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, progress)
+}
+
+// campaignAudience counts the contacts the campaign's lists and segment
+// currently match, before they are added as recipients.
+func (h *CampaignHandler) campaignAudience(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, _ := strconv.Atoi(idStr)
+
+	var campaign models.Campaign
+	if err := h.Store.DB.First(&campaign, id).Error; err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+	contacts, err := core.CampaignAudience(h.Store, &campaign)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	var recipients int64
+	h.Store.DB.Model(&models.CampaignRecipient{}).Where("campaign_id = ?", campaign.ID).Count(&recipients)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"contacts":               len(contacts),
+		"recipients":             recipients,
+		"recipients_resolved_at": campaign.RecipientsResolvedAt,
+	})
+}
+
+// previewCampaign renders the subject and body for one contact (by id or
+// email). Subject and body may be overridden to preview unsaved edits.
+func (h *CampaignHandler) previewCampaign(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, _ := strconv.Atoi(idStr)
+
+	var req struct {
+		ContactID uint    `json:"contact_id"`
+		Email     string  `json:"email"`
+		VariantID uint    `json:"variant_id"`
+		Subject   *string `json:"subject"`
+		Body      *string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+
+	var campaign models.Campaign
+	if err := h.Store.DB.First(&campaign, id).Error; err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+		return
+	}
+	if req.VariantID != 0 {
+		var variant models.CampaignVariant
+		if err := h.Store.DB.Where("id = ? AND campaign_id = ?", req.VariantID, campaign.ID).First(&variant).Error; err != nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "variant not found"})
+			return
+		}
+		if variant.Subject != "" {
+			campaign.Subject = variant.Subject
+		}
+		if variant.Body != "" {
+			campaign.Body = variant.Body
+		}
+	}
+	if req.Subject != nil {
+		campaign.Subject = *req.Subject
+	}
+	if req.Body != nil {
+		campaign.Body = *req.Body
+	}
+
+	var contact *models.Contact
+	email := strings.TrimSpace(req.Email)
+	switch {
+	case req.ContactID != 0:
+		var c models.Contact
+		if err := h.Store.DB.First(&c, req.ContactID).Error; err != nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "contact not found"})
+			return
+		}
+		contact, email = &c, c.Email
+	case email != "":
+		var c models.Contact
+		if err := h.Store.DB.Where("email = ?", email).First(&c).Error; err == nil {
+			contact = &c
+		}
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "contact_id or email required"})
+		return
+	}
+
+	v := validation.New()
+	validateCampaignTemplates(v, &campaign.Subject, &campaign.Body)
+	if !v.Valid() {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"errors": v.Errors()})
+		return
+	}
+	subjectTmpl, _ := core.ParseTemplate(campaign.Subject)
+	bodyTmpl, _ := core.ParseTemplate(campaign.Body)
+
+	data := core.RecipientMergeData(email, contact)
+	missing := []string{}
+	seen := map[string]bool{}
+	for _, f := range append(subjectTmpl.Fields(), bodyTmpl.Fields()...) {
+		if _, ok := data[f]; !ok && !seen[f] {
+			seen[f] = true
+			missing = append(missing, f)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"email":          email,
+		"subject":        subjectTmpl.Render(data, false),
+		"body":           bodyTmpl.Render(data, true),
+		"missing_fields": missing,
+	})
+}
+
 func (h *CampaignHandler) getCampaign(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, _ := strconv.Atoi(idStr)
 
 	var campaign models.Campaign
-	if err := h.Store.DB.Preload("Recipients").First(&campaign, id).Error; err != nil {
+	if err := h.Store.DB.Preload("Recipients").Preload("Variants").First(&campaign, id).Error; err != nil {
 		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
 		return
 	}
-	writeJSON(w, http.StatusOK, campaign)
+	progress, _ := h.Service.Progress(campaign.ID)
+	writeJSON(w, http.StatusOK, campaignDTO{Campaign: campaign, Live: core.CampaignLiveStats(campaign.ID), Progress: progress})
 }
@@ -1,9 +1,15 @@
 package api
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
 
 	"github.com/pulak-ranjan/kumomta-ui/internal/core"
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+	"github.com/pulak-ranjan/kumomta-ui/internal/store"
 )
 
 // configPreviewDTO is what we return for previewing generated configs.
@@ -12,16 +18,24 @@ type configPreviewDTO struct {
 	QueuesTOML          string `json:"queues_toml"`
 	ListenerDomainsTOML string `json:"listener_domains_toml"`
 	DKIMDataTOML        string `json:"dkim_data_toml"`
+	ShapingTOML         string `json:"shaping_toml"`
+	RoutingTOML         string `json:"routing_toml"`
+	SuppressionTOML     string `json:"suppression_toml"`
+	CustomLua           string `json:"custom_lua"`
 	InitLua             string `json:"init_lua"`
 }
 
 // configApplyResponse is what we return after applying to the system.
 type configApplyResponse struct {
-	ApplyResult *core.ApplyResult `json:"apply_result,omitempty"`
-	Error       string            `json:"error,omitempty"`
+	ApplyResult *core.ApplyResult      `json:"apply_result,omitempty"`
+	Revision    *models.ConfigRevision `json:"revision,omitempty"`
+	Error       string                 `json:"error,omitempty"`
 }
 
 // GET /api/config/preview
+// GET /api/config/preview?mode=diff returns per-file hunks against what is
+// currently on disk instead of the raw generated text.
+// GET /api/config/preview?node=ID previews a remote node's files.
 func (s *Server) handlePreviewConfig(w http.ResponseWriter, r *http.Request) {
 	snap, err := core.LoadSnapshot(s.Store)
 	if err != nil {
@@ -30,6 +44,27 @@ func (s *Server) handlePreviewConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// ?node=ID renders a remote node's config (raw only, its files aren't local)
+	var nodeID uint
+	if v := r.URL.Query().Get("node"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || !s.nodeExists(uint(id)) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "node not found"})
+			return
+		}
+		nodeID = uint(id)
+	}
+
+	if r.URL.Query().Get("mode") == "diff" {
+		if nodeID != 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "diff preview is only available for this host"})
+			return
+		}
+		writeJSON(w, http.StatusOK, core.PreviewConfig(snap))
+		return
+	}
+	snap = snap.ForNode(nodeID)
+
 	const dkimBasePath = "/opt/kumomta/etc/dkim"
 
 	out := configPreviewDTO{
@@ -37,7 +72,11 @@ func (s *Server) handlePreviewConfig(w http.ResponseWriter, r *http.Request) {
 		QueuesTOML:          core.GenerateQueuesTOML(snap),
 		ListenerDomainsTOML: core.GenerateListenerDomainsTOML(snap),
 		DKIMDataTOML:        core.GenerateDKIMDataTOML(snap, dkimBasePath),
-		InitLua:             core.GenerateInitLua(snap),
+		ShapingTOML:         core.GenerateShapingTOML(snap),
+		RoutingTOML:         core.GenerateRoutingTOML(snap),
+		SuppressionTOML:     core.GenerateSuppressionTOML(snap),
+		CustomLua:           core.GenerateCustomLua(snap),
+		InitLua:             core.RedactSecrets(core.GenerateInitLua(snap)),
 	}
 
 	writeJSON(w, http.StatusOK, out)
@@ -50,6 +89,7 @@ func (s *Server) handlePreviewConfig(w http.ResponseWriter, r *http.Request) {
 //  - write them to real Kumo paths
 //  - validate via kumod
 //  - restart kumomta if validation passes
+//  - record the outcome as a config revision
 func (s *Server) handleApplyConfig(w http.ResponseWriter, r *http.Request) {
 	snap, err := core.LoadSnapshot(s.Store)
 	if err != nil {
@@ -60,11 +100,12 @@ func (s *Server) handleApplyConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res, applyErr := core.ApplyKumoConfig(snap)
+	res, rev, applyErr := core.ApplyAndRecord(s.Store, snap, s.getUser(r))
 	if applyErr != nil {
 		s.Store.LogError(applyErr)
 		writeJSON(w, http.StatusInternalServerError, configApplyResponse{
 			ApplyResult: res,
+			Revision:    rev,
 			Error:       applyErr.Error(),
 		})
 		return
@@ -72,5 +113,112 @@ func (s *Server) handleApplyConfig(w http.ResponseWriter, r *http.Request) {
 
 	writeJSON(w, http.StatusOK, configApplyResponse{
 		ApplyResult: res,
+		Revision:    rev,
 	})
 }
+
+// configRevisionDTO is a single revision including its stored files.
+type configRevisionDTO struct {
+	*models.ConfigRevision
+	Files []core.KumoConfigFile `json:"files"`
+}
+
+// GET /api/config/revisions
+func (s *Server) handleListRevisions(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+
+	list, err := s.Store.ListConfigRevisions(limit)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list revisions"})
+		return
+	}
+	if list == nil {
+		list = []models.ConfigRevision{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// GET /api/config/revisions/{id}
+func (s *Server) handleGetRevision(w http.ResponseWriter, r *http.Request) {
+	rev, ok := s.loadRevision(w, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+	files, err := core.RevisionFiles(rev)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, configRevisionDTO{ConfigRevision: rev, Files: files})
+}
+
+// GET /api/config/revisions/diff?from=1&to=2
+func (s *Server) handleDiffRevisions(w http.ResponseWriter, r *http.Request) {
+	from, ok := s.loadRevision(w, r.URL.Query().Get("from"))
+	if !ok {
+		return
+	}
+	to, ok := s.loadRevision(w, r.URL.Query().Get("to"))
+	if !ok {
+		return
+	}
+
+	diffs, err := core.DiffRevisions(from, to)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"from":  from.ID,
+		"to":    to.ID,
+		"files": diffs,
+	})
+}
+
+// POST /api/config/revisions/{id}/rollback
+// Re-applies the files of an earlier revision (validate, then restart).
+func (s *Server) handleRollbackRevision(w http.ResponseWriter, r *http.Request) {
+	target, ok := s.loadRevision(w, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+
+	res, rev, err := core.RollbackToRevision(s.Store, target.ID, s.getUser(r))
+	if err != nil {
+		s.Store.LogError(err)
+		writeJSON(w, http.StatusInternalServerError, configApplyResponse{
+			ApplyResult: res,
+			Revision:    rev,
+			Error:       err.Error(),
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, configApplyResponse{
+		ApplyResult: res,
+		Revision:    rev,
+	})
+}
+
+// loadRevision parses a revision id and fetches it, writing the error
+// response itself when that fails.
+func (s *Server) loadRevision(w http.ResponseWriter, idStr string) (*models.ConfigRevision, bool) {
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid revision id"})
+		return nil, false
+	}
+	rev, err := s.Store.GetConfigRevisionByID(uint(id))
+	if errors.Is(err, store.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "revision not found"})
+		return nil, false
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to load revision"})
+		return nil, false
+	}
+	return rev, true
+}
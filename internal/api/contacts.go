@@ -2,11 +2,15 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+
 	"github.com/pulak-ranjan/kumomta-ui/internal/core"
 	"github.com/pulak-ranjan/kumomta-ui/internal/models"
 	"github.com/pulak-ranjan/kumomta-ui/internal/store"
@@ -111,3 +115,106 @@ func (h *ContactHandler) HandleCleanList(w http.ResponseWriter, r *http.Request)
 		"count": strconv.Itoa(len(contacts)),
 	})
 }
+
+// GET /api/lists
+func (h *ContactHandler) HandleListLists(w http.ResponseWriter, r *http.Request) {
+	var lists []struct {
+		models.ContactList
+		ContactCount int64 `json:"contact_count"`
+	}
+	if err := h.Store.DB.Model(&models.ContactList{}).
+		Select("contact_lists.*, (SELECT COUNT(*) FROM contacts WHERE contacts.list_id = contact_lists.id) AS contact_count").
+		Order("name").Scan(&lists).Error; err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, lists)
+}
+
+// POST /api/lists
+func (h *ContactHandler) HandleCreateList(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+	list := models.ContactList{Name: strings.TrimSpace(req.Name)}
+	if list.Name == "" || len(list.Name) > 200 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name is required (max 200 characters)"})
+		return
+	}
+	if err := h.Store.DB.Create(&list).Error; err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create list"})
+		return
+	}
+	writeJSON(w, http.StatusCreated, list)
+}
+
+// DELETE /api/lists/{id}
+// Deletes the list and its contacts.
+func (h *ContactHandler) HandleDeleteList(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, _ := strconv.Atoi(idStr)
+
+	cid, err := core.AudienceInUse(h.Store, uint(id), 0)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+		return
+	}
+	if cid != 0 {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": fmt.Sprintf("list is used by campaign %d", cid)})
+		return
+	}
+	err = h.Store.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("list_id = ?", id).Delete(&models.Contact{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.ContactList{}, id).Error
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to delete list"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// POST /api/lists/{id}/import
+// CSV with a header row, see core.ImportContactsCSV.
+func (h *ContactHandler) HandleImportContacts(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, _ := strconv.Atoi(idStr)
+
+	var list models.ContactList
+	if err := h.Store.DB.First(&list, id).Error; err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "list not found"})
+		return
+	}
+
+	// Max 10MB CSV
+	r.Body = http.MaxBytesReader(w, r.Body, 10<<20)
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "file too big"})
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "missing file"})
+		return
+	}
+	defer file.Close()
+
+	added, updated, err := core.ImportContactsCSV(h.Store, list.ID, file)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": fmt.Sprintf("import failed: %v", err), "added": added, "updated": updated,
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "imported",
+		"added":   added,
+		"updated": updated,
+	})
+}
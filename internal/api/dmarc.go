@@ -100,14 +100,15 @@ func (s *Server) handleGetAllDNS(w http.ResponseWriter, r *http.Request) {
 	}
 
 	settings, _ := s.Store.GetSettings()
-	mainIP := ""
+	mainIP, mainIPv6 := "", ""
 	if settings != nil {
 		mainIP = settings.MainServerIP
+		mainIPv6 = settings.MainServerIPv6
 	}
 
 	// 1. Expected Records
 	snap, _ := core.LoadSnapshot(s.Store)
-	generated := core.GenerateAllDNSRecords(domain, mainIP, snap)
+	generated := core.GenerateAllDNSRecords(domain, mainIP, mainIPv6, snap)
 
 	// 2. Live Records
 	live, _ := core.LookupLiveDNS(domain)
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/pulak-ranjan/kumomta-ui/internal/core"
@@ -54,6 +55,19 @@ func (s *Server) handleCreateDomain(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name required"})
 		return
 	}
+	if err := core.ValidateQueuePolicy(&d.QueuePolicy); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := core.CheckQueuePolicyLayers(d, nil); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if !s.nodeExists(d.NodeID) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "node not found"})
+		return
+	}
 
 	if d.MailHost == "" {
 		d.MailHost = "mail." + d.Name
@@ -116,7 +130,12 @@ func (s *Server) handleUpdateDomain(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var update models.Domain
+	// queue_policy, when present, replaces the whole policy (so fields can be cleared)
+	var update struct {
+		models.Domain
+		QueuePolicy *models.QueuePolicy `json:"queue_policy"`
+		NodeID      *uint               `json:"node_id"` // 0 moves it back to this host
+	}
 	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
 		return
@@ -129,6 +148,27 @@ func (s *Server) handleUpdateDomain(w http.ResponseWriter, r *http.Request) {
 	if update.DMARCRua != "" { domain.DMARCRua = update.DMARCRua }
 	if update.DMARCRuf != "" { domain.DMARCRuf = update.DMARCRuf }
 	if update.DMARCPercentage > 0 { domain.DMARCPercentage = update.DMARCPercentage }
+	if update.QueuePolicy != nil {
+		if err := core.ValidateQueuePolicy(update.QueuePolicy); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		domain.QueuePolicy = *update.QueuePolicy
+	}
+	if update.NodeID != nil {
+		if !s.nodeExists(*update.NodeID) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "node not found"})
+			return
+		}
+		domain.NodeID = *update.NodeID
+	}
+
+	if update.QueuePolicy != nil {
+		if err := s.checkQueuePolicyLayers(*domain, nil); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
 
 	if err := s.Store.UpdateDomain(domain); err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update domain"})
@@ -219,6 +259,24 @@ func (s *Server) handleCreateSender(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := core.ValidateQueuePolicy(&snd.QueuePolicy); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if snd.MessageRate != "" && !core.ValidateThrottle(snd.MessageRate) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid message_rate (e.g. 500/hr)"})
+		return
+	}
+	if snd.EHLODomain, err = core.ValidateEHLODomain(snd.EHLODomain); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if !s.nodeExists(snd.NodeID) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "node not found"})
+		return
+	}
+	snd.DisplayName = strings.TrimSpace(snd.DisplayName)
+
 	snd.DomainID = uint(domainID)
 	if snd.LocalPart != "" && snd.Email == "" {
 		snd.Email = snd.LocalPart + "@" + domain.Name
@@ -227,6 +285,13 @@ func (s *Server) handleCreateSender(w http.ResponseWriter, r *http.Request) {
 		snd.BounceUsername = "b-" + snd.LocalPart
 	}
 
+	withNew := *domain
+	withNew.Senders = append(append([]models.Sender{}, domain.Senders...), snd)
+	if err := s.checkQueuePolicyLayers(withNew, nil); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
 	if err := s.Store.CreateSender(&snd); err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create sender"})
 		return
@@ -271,7 +336,15 @@ func (s *Server) handleUpdateSender(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var update models.Sender
+	// queue_policy, when present, replaces the whole override (so fields can be cleared)
+	var update struct {
+		models.Sender
+		QueuePolicy  *models.QueuePolicy `json:"queue_policy"`
+		NodeID       *uint               `json:"node_id"`        // 0 follows the domain's node
+		EgressPoolID *uint               `json:"egress_pool_id"` // 0 unassigns the pool
+		EHLODomain   *string             `json:"ehlo_domain"`    // "" restores the default
+		DisplayName  *string             `json:"display_name"`
+	}
 	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
 		return
@@ -282,6 +355,66 @@ func (s *Server) handleUpdateSender(w http.ResponseWriter, r *http.Request) {
 	if update.IP != "" { sender.IP = update.IP }
 	if update.SMTPPassword != "" { sender.SMTPPassword = update.SMTPPassword }
 	if update.BounceUsername != "" { sender.BounceUsername = update.BounceUsername }
+	if update.DKIMSelector != "" { sender.DKIMSelector = update.DKIMSelector }
+	if update.DKIMKeyPath != "" { sender.DKIMKeyPath = update.DKIMKeyPath }
+	if update.MessageRate != "" {
+		if !core.ValidateThrottle(update.MessageRate) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid message_rate (e.g. 500/hr)"})
+			return
+		}
+		sender.MessageRate = update.MessageRate
+	}
+	if update.EgressPoolID != nil {
+		if *update.EgressPoolID != 0 {
+			if _, err := s.Store.GetEgressPoolByID(*update.EgressPoolID); err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "egress pool not found"})
+				return
+			}
+		}
+		sender.EgressPoolID = *update.EgressPoolID
+	}
+	if update.QueuePolicy != nil {
+		if err := core.ValidateQueuePolicy(update.QueuePolicy); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		sender.QueuePolicy = *update.QueuePolicy
+	}
+	if update.NodeID != nil {
+		if !s.nodeExists(*update.NodeID) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "node not found"})
+			return
+		}
+		sender.NodeID = *update.NodeID
+	}
+	if update.EHLODomain != nil {
+		ehlo, err := core.ValidateEHLODomain(*update.EHLODomain)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		sender.EHLODomain = ehlo
+	}
+	if update.DisplayName != nil {
+		sender.DisplayName = strings.TrimSpace(*update.DisplayName)
+	}
+
+	if update.QueuePolicy != nil {
+		domain, err := s.Store.GetDomainByID(sender.DomainID)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to load domain"})
+			return
+		}
+		for i := range domain.Senders {
+			if domain.Senders[i].ID == sender.ID {
+				domain.Senders[i] = *sender
+			}
+		}
+		if err := s.checkQueuePolicyLayers(*domain, nil); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
 
 	if err := s.Store.UpdateSender(sender); err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update sender"})
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/core"
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+	"github.com/pulak-ranjan/kumomta-ui/internal/store"
+)
+
+// POST /api/events/ingest
+// Called by the KumoMTA log hook generated in init.lua, not by users.
+// Auth: "Authorization: Bearer <core.IngestToken()>".
+func (s *Server) handleIngestEvents(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !core.VerifyIngestToken(token) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid ingest token"})
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 5<<20))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "body too large"})
+		return
+	}
+
+	recs, err := core.ParseLogRecords(body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	// A 5xx makes kumod keep the record queued and retry it later
+	n, err := core.IngestLogRecords(s.Store, recs)
+	if err != nil {
+		s.Store.LogError(err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to store events"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int{"stored": n})
+}
+
+// GET /api/events?message_id=&recipient=&campaign=&type=&limit=
+func (s *Server) handleListEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+
+	list, err := s.Store.ListDeliveryEvents(store.DeliveryEventFilter{
+		MessageID: q.Get("message_id"),
+		Recipient: q.Get("recipient"),
+		Campaign:  q.Get("campaign"),
+		Type:      q.Get("type"),
+		Limit:     limit,
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list events"})
+		return
+	}
+	if list == nil {
+		list = []models.DeliveryEvent{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pulak-ranjan/kumomta-ui/internal/core"
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+	"github.com/pulak-ranjan/kumomta-ui/internal/store"
+)
+
+// GET /api/listeners
+func (s *Server) handleListListeners(w http.ResponseWriter, r *http.Request) {
+	list, err := s.Store.ListListeners()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list listeners"})
+		return
+	}
+	if list == nil {
+		list = []models.Listener{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// POST /api/listeners
+func (s *Server) handleCreateListener(w http.ResponseWriter, r *http.Request) {
+	var l models.Listener
+	if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+	l.ID = 0
+
+	if err := core.ValidateListener(&l); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := s.checkListenerPortAuth(l); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := s.Store.CreateListener(&l); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create listener (duplicate address?)"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Create Listener", fmt.Sprintf("Listen: %s", l.ListenAddr), s.getUser(r))
+
+	writeJSON(w, http.StatusCreated, l)
+}
+
+// PUT /api/listeners/{id}
+func (s *Server) handleUpdateListener(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid id"})
+		return
+	}
+
+	existing, err := s.Store.GetListenerByID(uint(id))
+	if err != nil {
+		if err == store.ErrNotFound {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "listener not found"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to load listener"})
+		return
+	}
+
+	var update models.Listener
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+
+	// Full replace of the listener options
+	update.ID = existing.ID
+	update.CreatedAt = existing.CreatedAt
+	if update.ListenAddr == "" {
+		update.ListenAddr = existing.ListenAddr
+	}
+
+	if err := core.ValidateListener(&update); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := s.checkListenerPortAuth(update); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := s.Store.UpdateListener(&update); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update listener"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Update Listener", fmt.Sprintf("Listen: %s", update.ListenAddr), s.getUser(r))
+
+	writeJSON(w, http.StatusOK, update)
+}
+
+// checkListenerPortAuth runs core.CheckListenerPortAuth against the saved
+// listeners.
+func (s *Server) checkListenerPortAuth(l models.Listener) error {
+	existing, err := s.Store.ListListeners()
+	if err != nil {
+		return fmt.Errorf("failed to load listeners")
+	}
+	return core.CheckListenerPortAuth(l, existing)
+}
+
+// DELETE /api/listeners/{id}
+func (s *Server) handleDeleteListener(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid id"})
+		return
+	}
+
+	if err := s.Store.DeleteListener(uint(id)); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to delete listener"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Delete Listener", fmt.Sprintf("Deleted listener ID: %d", id), s.getUser(r))
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
@@ -0,0 +1,249 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pulak-ranjan/kumomta-ui/internal/core"
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+	"github.com/pulak-ranjan/kumomta-ui/internal/store"
+)
+
+// nodeDTO adds the decoded agent report and sync state to a node.
+type nodeDTO struct {
+	models.Node
+	Report        *core.NodeReport `json:"report"`
+	ConfigCurrent bool             `json:"config_current"` // last push matches the current config
+}
+
+type nodeRequest struct {
+	Name    string `json:"name"`
+	URL     string `json:"url"`
+	Enabled *bool  `json:"enabled"`
+}
+
+// nodeExists reports whether id is the local host (0) or a known node.
+func (s *Server) nodeExists(id uint) bool {
+	if id == 0 {
+		return true
+	}
+	_, err := s.Store.GetNodeByID(id)
+	return err == nil
+}
+
+// loadNode parses {id} and fetches the node, writing the error response
+// itself when that fails.
+func (s *Server) loadNode(w http.ResponseWriter, r *http.Request) (*models.Node, bool) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid id"})
+		return nil, false
+	}
+	node, err := s.Store.GetNodeByID(uint(id))
+	if errors.Is(err, store.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "node not found"})
+		return nil, false
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get node"})
+		return nil, false
+	}
+	return node, true
+}
+
+// GET /api/nodes
+func (s *Server) handleListNodes(w http.ResponseWriter, r *http.Request) {
+	nodes, err := s.Store.ListNodes()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list nodes"})
+		return
+	}
+	snap, err := core.LoadSnapshot(s.Store)
+	if err != nil {
+		s.Store.LogError(err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to load snapshot"})
+		return
+	}
+
+	out := make([]nodeDTO, 0, len(nodes))
+	for _, n := range nodes {
+		dto := nodeDTO{Node: n}
+		if n.LastReport != "" {
+			var rep core.NodeReport
+			if json.Unmarshal([]byte(n.LastReport), &rep) == nil {
+				dto.Report = &rep
+			}
+		}
+		dto.ConfigCurrent = n.AppliedHash != "" && n.AppliedHash == core.BuildNodeBundle(snap, n).Hash
+		out = append(out, dto)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// POST /api/nodes
+// The response is the only time the node secret is shown; the agent on the
+// node is started with it (KUMO_AGENT_SECRET).
+func (s *Server) handleCreateNode(w http.ResponseWriter, r *http.Request) {
+	var req nodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+
+	node := models.Node{Name: req.Name, URL: req.URL, Enabled: true}
+	if req.Enabled != nil {
+		node.Enabled = *req.Enabled
+	}
+	if err := core.ValidateNode(&node); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	secret := core.GenerateNodeSecret()
+	enc, err := core.Encrypt(secret)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to encrypt node secret"})
+		return
+	}
+	node.Secret = enc
+
+	if err := s.Store.CreateNode(&node); err != nil {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "node name already exists"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Create Node", fmt.Sprintf("Node: %s (%s)", node.Name, node.URL), s.getUser(r))
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"node": node, "secret": secret})
+}
+
+// PUT /api/nodes/{id}
+func (s *Server) handleUpdateNode(w http.ResponseWriter, r *http.Request) {
+	node, ok := s.loadNode(w, r)
+	if !ok {
+		return
+	}
+
+	var req nodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+	if req.Name != "" { node.Name = req.Name }
+	if req.URL != "" { node.URL = req.URL }
+	if req.Enabled != nil { node.Enabled = *req.Enabled }
+
+	if err := core.ValidateNode(node); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := s.Store.UpdateNode(node); err != nil {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "failed to update node (duplicate name?)"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Update Node", fmt.Sprintf("Updated node %s", node.Name), s.getUser(r))
+
+	writeJSON(w, http.StatusOK, node)
+}
+
+// DELETE /api/nodes/{id}
+// Refused while domains or senders are still assigned to the node.
+func (s *Server) handleDeleteNode(w http.ResponseWriter, r *http.Request) {
+	node, ok := s.loadNode(w, r)
+	if !ok {
+		return
+	}
+
+	n, err := s.Store.CountNodeAssignments(node.ID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to check node assignments"})
+		return
+	}
+	if n > 0 {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": fmt.Sprintf("node still has %d domain/sender assignments", n)})
+		return
+	}
+
+	if err := s.Store.DeleteNode(node.ID); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to delete node"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Delete Node", fmt.Sprintf("Deleted node %s", node.Name), s.getUser(r))
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// POST /api/nodes/{id}/rotate-secret
+// The agent must be restarted with the new secret before the next push.
+func (s *Server) handleRotateNodeSecret(w http.ResponseWriter, r *http.Request) {
+	node, ok := s.loadNode(w, r)
+	if !ok {
+		return
+	}
+
+	secret := core.GenerateNodeSecret()
+	enc, err := core.Encrypt(secret)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to encrypt node secret"})
+		return
+	}
+	node.Secret = enc
+	if err := s.Store.UpdateNode(node); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update node"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Rotate Node Secret", fmt.Sprintf("Rotated agent secret for node %s", node.Name), s.getUser(r))
+
+	writeJSON(w, http.StatusOK, map[string]string{"secret": secret})
+}
+
+// POST /api/nodes/{id}/apply
+// Pushes the node's config; its agent validates before swapping files in.
+func (s *Server) handleApplyNode(w http.ResponseWriter, r *http.Request) {
+	node, ok := s.loadNode(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := core.PushNodeConfig(s.Store, node)
+
+	status := "applied"
+	if err != nil {
+		status = "failed: " + err.Error()
+	}
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Apply Node Config", fmt.Sprintf("Node %s: %s", node.Name, status), s.getUser(r))
+
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, configApplyResponse{ApplyResult: res, Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, configApplyResponse{ApplyResult: res})
+}
+
+// POST /api/nodes/{id}/refresh
+// Fetches a fresh health/queue/stats report from the node's agent.
+func (s *Server) handleRefreshNode(w http.ResponseWriter, r *http.Request) {
+	node, ok := s.loadNode(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := core.FetchNodeReport(s.Store, node)
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,272 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pulak-ranjan/kumomta-ui/internal/core"
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+	"github.com/pulak-ranjan/kumomta-ui/internal/store"
+)
+
+// Pool names end up inside KumoMTA pool/source names, keep them simple.
+var poolNameRegex = regexp.MustCompile(`^[a-zA-Z0-9.-]+$`)
+
+type poolMemberRequest struct {
+	SystemIPID uint `json:"system_ip_id"`
+	Weight     int  `json:"weight"`
+}
+
+type poolRequest struct {
+	Name       string              `json:"name"`
+	EHLODomain string              `json:"ehlo_domain"`
+	Members    []poolMemberRequest `json:"members"`
+}
+
+// buildPoolMembers validates member IPs against the inventory.
+func (s *Server) buildPoolMembers(req []poolMemberRequest) ([]models.EgressPoolMember, error) {
+	seen := make(map[uint]bool)
+	members := make([]models.EgressPoolMember, 0, len(req))
+	for _, m := range req {
+		if seen[m.SystemIPID] {
+			return nil, fmt.Errorf("ip %d listed twice", m.SystemIPID)
+		}
+		seen[m.SystemIPID] = true
+
+		ip, err := s.Store.GetSystemIPByID(m.SystemIPID)
+		if err != nil {
+			return nil, fmt.Errorf("system ip %d not found", m.SystemIPID)
+		}
+		weight := m.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		members = append(members, models.EgressPoolMember{
+			SystemIPID: ip.ID,
+			SystemIP:   *ip,
+			Weight:     weight,
+		})
+	}
+	return members, nil
+}
+
+// GET /api/pools
+func (s *Server) handleListPools(w http.ResponseWriter, r *http.Request) {
+	pools, err := s.Store.ListEgressPools()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list pools"})
+		return
+	}
+	if pools == nil {
+		pools = []models.EgressPool{}
+	}
+	writeJSON(w, http.StatusOK, pools)
+}
+
+// GET /api/pools/{id}
+func (s *Server) handleGetPool(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid id"})
+		return
+	}
+
+	pool, err := s.Store.GetEgressPoolByID(uint(id))
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "pool not found"})
+		return
+	}
+
+	var senders []models.Sender
+	s.Store.DB.Where("egress_pool_id = ?", pool.ID).Find(&senders)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"pool":    pool,
+		"senders": senders,
+	})
+}
+
+// POST /api/pools
+func (s *Server) handleCreatePool(w http.ResponseWriter, r *http.Request) {
+	var req poolRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if !poolNameRegex.MatchString(req.Name) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "name required (letters, digits, dot, hyphen)"})
+		return
+	}
+
+	members, err := s.buildPoolMembers(req.Members)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	ehlo, err := core.ValidateEHLODomain(req.EHLODomain)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	pool := &models.EgressPool{
+		Name:       req.Name,
+		EHLODomain: ehlo,
+		Members:    members,
+		CreatedAt:  time.Now(),
+	}
+	if err := s.Store.CreateEgressPool(pool); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create pool (duplicate name?)"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Create Pool", fmt.Sprintf("Pool %s with %d IPs", pool.Name, len(members)), s.getUser(r))
+
+	writeJSON(w, http.StatusCreated, pool)
+}
+
+// PUT /api/pools/{id}
+// Replaces name/EHLO and the full member list.
+func (s *Server) handleUpdatePool(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid id"})
+		return
+	}
+
+	pool, err := s.Store.GetEgressPoolByID(uint(id))
+	if err != nil {
+		if err == store.ErrNotFound {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "pool not found"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to load pool"})
+		return
+	}
+
+	var req poolRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+
+	if name := strings.TrimSpace(req.Name); name != "" {
+		if !poolNameRegex.MatchString(name) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid name (letters, digits, dot, hyphen)"})
+			return
+		}
+		pool.Name = name
+	}
+	ehlo, err := core.ValidateEHLODomain(req.EHLODomain)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	pool.EHLODomain = ehlo
+
+	members, err := s.buildPoolMembers(req.Members)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	pool.Members = members
+
+	if err := s.Store.UpdateEgressPool(pool); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update pool"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Update Pool", fmt.Sprintf("Pool %s now has %d IPs", pool.Name, len(members)), s.getUser(r))
+
+	writeJSON(w, http.StatusOK, pool)
+}
+
+// DELETE /api/pools/{id}
+func (s *Server) handleDeletePool(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid id"})
+		return
+	}
+
+	if err := s.Store.DeleteEgressPool(uint(id)); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to delete pool"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Delete Pool", fmt.Sprintf("Deleted pool ID: %d (senders unassigned)", id), s.getUser(r))
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// POST /api/pools/{id}/assign
+// Body: { "sender_ids": [1, 2, 3] }
+func (s *Server) handleAssignPool(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid id"})
+		return
+	}
+
+	if _, err := s.Store.GetEgressPoolByID(uint(id)); err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "pool not found"})
+		return
+	}
+
+	var req struct {
+		SenderIDs []uint `json:"sender_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+
+	if err := s.Store.AssignSendersToPool(uint(id), req.SenderIDs); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to assign senders"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Assign Pool", fmt.Sprintf("Assigned %d senders to pool ID %d", len(req.SenderIDs), id), s.getUser(r))
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "assigned", "count": len(req.SenderIDs)})
+}
+
+// DELETE /api/pools/{id}/senders/{senderID}
+// Sends the sender back to its own single IP.
+func (s *Server) handleUnassignPool(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	senderID, err := strconv.ParseUint(chi.URLParam(r, "senderID"), 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid sender id"})
+		return
+	}
+
+	snd, err := s.Store.GetSenderByID(uint(senderID))
+	if err != nil || id <= 0 || snd.EgressPoolID != uint(id) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "sender not in this pool"})
+		return
+	}
+
+	if err := s.Store.AssignSendersToPool(0, []uint{snd.ID}); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to unassign sender"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Unassign Pool", fmt.Sprintf("Removed sender %s from pool ID %d", snd.Email, id), s.getUser(r))
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "unassigned"})
+}
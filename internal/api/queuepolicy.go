@@ -0,0 +1,198 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pulak-ranjan/kumomta-ui/internal/core"
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+	"github.com/pulak-ranjan/kumomta-ui/internal/store"
+)
+
+// validateCampaignPolicy checks a campaign override against its domain and
+// the overrides that already exist there.
+func (s *Server) validateCampaignPolicy(cp *models.CampaignQueuePolicy) error {
+	cp.Campaign = strings.TrimSpace(cp.Campaign)
+	if err := core.ValidateCampaignName(cp.Campaign); err != nil {
+		return err
+	}
+	if err := core.ValidateQueuePolicy(&cp.QueuePolicy); err != nil {
+		return err
+	}
+	if cp.SenderID != 0 {
+		snd, err := s.Store.GetSenderByID(cp.SenderID)
+		if err != nil || snd.DomainID != cp.DomainID {
+			return fmt.Errorf("sender not found in this domain")
+		}
+	}
+
+	existing, err := s.Store.ListCampaignQueuePoliciesByDomain(cp.DomainID)
+	if err != nil {
+		return fmt.Errorf("failed to load existing overrides")
+	}
+	for _, e := range existing {
+		if e.ID != cp.ID && e.SenderID == cp.SenderID && e.Campaign == cp.Campaign {
+			return fmt.Errorf("an override for this campaign already exists")
+		}
+	}
+
+	domain, err := s.Store.GetDomainByID(cp.DomainID)
+	if err != nil {
+		return fmt.Errorf("domain not found")
+	}
+	return s.checkQueuePolicyLayers(*domain, cp)
+}
+
+// checkQueuePolicyLayers checks the merged queue policies of d, whose
+// Senders and QueuePolicy hold the values about to be saved. cp, if set,
+// is a campaign override about to be created or replaced.
+func (s *Server) checkQueuePolicyLayers(d models.Domain, cp *models.CampaignQueuePolicy) error {
+	campaigns, err := s.Store.ListCampaignQueuePoliciesByDomain(d.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load campaign overrides")
+	}
+	if cp != nil {
+		replaced := false
+		for i := range campaigns {
+			if cp.ID != 0 && campaigns[i].ID == cp.ID {
+				campaigns[i], replaced = *cp, true
+			}
+		}
+		if !replaced {
+			campaigns = append(campaigns, *cp)
+		}
+	}
+	return core.CheckQueuePolicyLayers(d, campaigns)
+}
+
+// GET /api/domains/{id}/campaign-policies
+func (s *Server) handleListCampaignPolicies(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid id"})
+		return
+	}
+
+	list, err := s.Store.ListCampaignQueuePoliciesByDomain(uint(id))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list campaign policies"})
+		return
+	}
+	if list == nil {
+		list = []models.CampaignQueuePolicy{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// POST /api/domains/{id}/campaign-policies
+func (s *Server) handleCreateCampaignPolicy(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid id"})
+		return
+	}
+
+	domain, err := s.Store.GetDomainByID(uint(id))
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "domain not found"})
+		return
+	}
+
+	var cp models.CampaignQueuePolicy
+	if err := json.NewDecoder(r.Body).Decode(&cp); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+	cp.ID = 0
+	cp.DomainID = domain.ID
+
+	if err := s.validateCampaignPolicy(&cp); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := s.Store.CreateCampaignQueuePolicy(&cp); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create campaign policy"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Create Campaign Policy", fmt.Sprintf("Campaign %s on %s", cp.Campaign, domain.Name), s.getUser(r))
+
+	writeJSON(w, http.StatusCreated, cp)
+}
+
+// PUT /api/campaign-policies/{id}
+func (s *Server) handleUpdateCampaignPolicy(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid id"})
+		return
+	}
+
+	existing, err := s.Store.GetCampaignQueuePolicyByID(uint(id))
+	if err != nil {
+		if err == store.ErrNotFound {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "campaign policy not found"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to load campaign policy"})
+		return
+	}
+
+	var update models.CampaignQueuePolicy
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+
+	// Full replace; the domain never changes
+	update.ID = existing.ID
+	update.DomainID = existing.DomainID
+	update.CreatedAt = existing.CreatedAt
+	if update.Campaign == "" {
+		update.Campaign = existing.Campaign
+	}
+
+	if err := s.validateCampaignPolicy(&update); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := s.Store.UpdateCampaignQueuePolicy(&update); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update campaign policy"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Update Campaign Policy", fmt.Sprintf("Campaign %s", update.Campaign), s.getUser(r))
+
+	writeJSON(w, http.StatusOK, update)
+}
+
+// DELETE /api/campaign-policies/{id}
+func (s *Server) handleDeleteCampaignPolicy(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid id"})
+		return
+	}
+
+	if err := s.Store.DeleteCampaignQueuePolicy(uint(id)); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to delete campaign policy"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Delete Campaign Policy", fmt.Sprintf("Deleted campaign policy ID: %d", id), s.getUser(r))
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
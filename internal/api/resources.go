@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -151,6 +152,7 @@ func (s *Server) handleAddIP(w http.ResponseWriter, r *http.Request) {
 		Value     string `json:"value"`
 		Netmask   string `json:"netmask"`
 		Interface string `json:"interface"`
+		Hostname  string `json:"hostname"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -162,11 +164,24 @@ func (s *Server) handleAddIP(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "value required"})
 		return
 	}
+	value, err := core.NormalizeIP(req.Value)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	// Used as the EHLO of pool members (sources.toml)
+	hostname, err := core.ValidateEHLODomain(req.Hostname)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "hostname must be a fully qualified hostname, e.g. mta1.example.com"})
+		return
+	}
 
 	ip := &models.SystemIP{
-		Value:     req.Value,
+		Value:     value,
 		Netmask:   req.Netmask,
 		Interface: req.Interface,
+		Hostname:  hostname,
 		CreatedAt: time.Now(),
 	}
 
@@ -190,13 +205,20 @@ func (s *Server) handleBulkAddIPs(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ips := make([]models.SystemIP, 0, len(req.IPs))
+	invalid := []string{}
 	for _, ipVal := range req.IPs {
-		if ipVal != "" {
-			ips = append(ips, models.SystemIP{
-				Value:     strings.TrimSpace(ipVal),
-				CreatedAt: time.Now(),
-			})
+		if strings.TrimSpace(ipVal) == "" {
+			continue
+		}
+		value, err := core.NormalizeIP(ipVal)
+		if err != nil {
+			invalid = append(invalid, ipVal)
+			continue
 		}
+		ips = append(ips, models.SystemIP{
+			Value:     value,
+			CreatedAt: time.Now(),
+		})
 	}
 
 	if err := s.Store.CreateSystemIPs(ips); err != nil {
@@ -204,7 +226,7 @@ func (s *Server) handleBulkAddIPs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	writeJSON(w, http.StatusCreated, map[string]int{"added": len(ips)})
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"added": len(ips), "invalid": invalid})
 }
 
 // POST /api/system/ips/cidr
@@ -243,6 +265,69 @@ func (s *Server) handleAddIPsByCIDR(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// POST /api/system/ips/allocate-v6
+// Adds the next free addresses of an IPv6 prefix (e.g. the server's /64) to
+// the inventory, optionally configuring them on an interface as well.
+func (s *Server) handleAllocateIPv6(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Prefix    string `json:"prefix"`
+		Count     int    `json:"count"`
+		Interface string `json:"interface"`
+		Configure bool   `json:"configure"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+
+	existing, err := s.Store.ListSystemIPs()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list IPs"})
+		return
+	}
+	used := make(map[string]bool, len(existing))
+	for _, ip := range existing {
+		used[ip.Value] = true
+	}
+
+	ipList, err := core.AllocateIPv6(req.Prefix, req.Count, used)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	ips := make([]models.SystemIP, 0, len(ipList))
+	for _, ipVal := range ipList {
+		ips = append(ips, models.SystemIP{
+			Value:     ipVal,
+			Netmask:   "/128",
+			Interface: req.Interface,
+			CreatedAt: time.Now(),
+		})
+	}
+	if err := s.Store.CreateSystemIPs(ips); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to add IPs"})
+		return
+	}
+
+	errs := []string{}
+	if req.Configure {
+		for _, ip := range ips {
+			if err := core.ConfigureSystemIP(ip.Value, ip.Netmask, ip.Interface); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+
+	go s.WS.SendAuditLog("Allocate IPv6", fmt.Sprintf("Allocated %d addresses from %s", len(ips), req.Prefix), s.getUser(r))
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"added":  len(ips),
+		"ips":    ipList,
+		"errors": errs,
+	})
+}
+
 // POST /api/system/ips/detect
 func (s *Server) handleDetectIPs(w http.ResponseWriter, r *http.Request) {
 	detected := core.DetectServerIPs()
@@ -267,6 +352,49 @@ func (s *Server) handleDetectIPs(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// PUT /api/system/ips/{id}
+// Updates the interface/netmask/hostname of an inventory IP (the address itself is immutable).
+func (s *Server) handleUpdateIP(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid id"})
+		return
+	}
+
+	ip, err := s.Store.GetSystemIPByID(uint(id))
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "ip not found"})
+		return
+	}
+
+	var req struct {
+		Netmask   string `json:"netmask"`
+		Interface string `json:"interface"`
+		Hostname  string `json:"hostname"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+
+	if req.Netmask != "" { ip.Netmask = req.Netmask }
+	if req.Interface != "" { ip.Interface = req.Interface }
+	hostname, err := core.ValidateEHLODomain(req.Hostname)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "hostname must be a fully qualified hostname, e.g. mta1.example.com"})
+		return
+	}
+	ip.Hostname = hostname
+
+	if err := s.Store.UpdateSystemIP(ip); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update IP"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ip)
+}
+
 // DELETE /api/system/ips/{id}
 func (s *Server) handleDeleteIP(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
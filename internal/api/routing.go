@@ -0,0 +1,181 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pulak-ranjan/kumomta-ui/internal/core"
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+	"github.com/pulak-ranjan/kumomta-ui/internal/store"
+)
+
+// validateRoutingRule runs the core checks and makes sure the pool exists.
+func (s *Server) validateRoutingRule(rule *models.RoutingRule) error {
+	if err := core.ValidateRoutingRule(rule); err != nil {
+		return err
+	}
+	if rule.EgressPoolID != 0 {
+		if _, err := s.Store.GetEgressPoolByID(rule.EgressPoolID); err != nil {
+			return fmt.Errorf("egress pool not found")
+		}
+	}
+	return nil
+}
+
+// GET /api/routing/rules
+func (s *Server) handleListRoutingRules(w http.ResponseWriter, r *http.Request) {
+	list, err := s.Store.ListRoutingRules()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list routing rules"})
+		return
+	}
+	if list == nil {
+		list = []models.RoutingRule{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// POST /api/routing/rules
+// New rules are appended to the end of the evaluation order.
+func (s *Server) handleCreateRoutingRule(w http.ResponseWriter, r *http.Request) {
+	var rule models.RoutingRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+	rule.ID = 0
+
+	if err := s.validateRoutingRule(&rule); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := s.Store.CreateRoutingRule(&rule); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create routing rule"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Create Routing Rule", fmt.Sprintf("Rule: %s", rule.Name), s.getUser(r))
+
+	writeJSON(w, http.StatusCreated, rule)
+}
+
+// PUT /api/routing/rules/{id}
+func (s *Server) handleUpdateRoutingRule(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid id"})
+		return
+	}
+
+	existing, err := s.Store.GetRoutingRuleByID(uint(id))
+	if err != nil {
+		if err == store.ErrNotFound {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "routing rule not found"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to load routing rule"})
+		return
+	}
+
+	var update models.RoutingRule
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+
+	// Full replace; order is changed through /reorder only
+	update.ID = existing.ID
+	update.Position = existing.Position
+	update.CreatedAt = existing.CreatedAt
+
+	if err := s.validateRoutingRule(&update); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := s.Store.UpdateRoutingRule(&update); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update routing rule"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Update Routing Rule", fmt.Sprintf("Rule: %s", update.Name), s.getUser(r))
+
+	writeJSON(w, http.StatusOK, update)
+}
+
+// DELETE /api/routing/rules/{id}
+func (s *Server) handleDeleteRoutingRule(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid id"})
+		return
+	}
+
+	if err := s.Store.DeleteRoutingRule(uint(id)); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to delete routing rule"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Delete Routing Rule", fmt.Sprintf("Deleted routing rule ID: %d", id), s.getUser(r))
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// POST /api/routing/rules/reorder
+// Body: { "ids": [3, 1, 2] } (first = evaluated first)
+func (s *Server) handleReorderRoutingRules(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IDs []uint `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.IDs) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "ids required"})
+		return
+	}
+
+	if err := s.Store.ReorderRoutingRules(req.IDs); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to reorder routing rules"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Reorder Routing Rules", fmt.Sprintf("Order: %v", req.IDs), s.getUser(r))
+
+	s.handleListRoutingRules(w, r)
+}
+
+// POST /api/routing/test
+// Body: { "sender": "news@example.com", "recipient": "someone@outlook.com" }
+// Reports which pool/sources/route the current DB config would choose.
+func (s *Server) handleTestRoute(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Sender    string `json:"sender"`
+		Recipient string `json:"recipient"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+
+	snap, err := core.LoadSnapshot(s.Store)
+	if err != nil {
+		s.Store.LogError(err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to load snapshot"})
+		return
+	}
+
+	dec, err := core.ResolveRoute(snap, req.Sender, req.Recipient)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, dec)
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/core"
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+)
+
+// GET /api/segments
+func (h *ContactHandler) HandleListSegments(w http.ResponseWriter, r *http.Request) {
+	var segments []models.Segment
+	if err := h.Store.DB.Order("name").Find(&segments).Error; err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, segments)
+}
+
+// POST /api/segments
+func (h *ContactHandler) HandleCreateSegment(w http.ResponseWriter, r *http.Request) {
+	var seg models.Segment
+	if err := json.NewDecoder(r.Body).Decode(&seg); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+	seg.ID = 0
+	if err := core.ValidateSegment(&seg); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := h.Store.DB.Create(&seg).Error; err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create segment"})
+		return
+	}
+	writeJSON(w, http.StatusCreated, seg)
+}
+
+// PUT /api/segments/{id}
+// Full replace. Campaigns using the segment see the change if they
+// haven't started yet.
+func (h *ContactHandler) HandleUpdateSegment(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, _ := strconv.Atoi(idStr)
+
+	var existing models.Segment
+	if err := h.Store.DB.First(&existing, id).Error; err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "segment not found"})
+		return
+	}
+	var update models.Segment
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+	update.ID = existing.ID
+	update.CreatedAt = existing.CreatedAt
+	if err := core.ValidateSegment(&update); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if err := h.Store.DB.Save(&update).Error; err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update segment"})
+		return
+	}
+	writeJSON(w, http.StatusOK, update)
+}
+
+// DELETE /api/segments/{id}
+func (h *ContactHandler) HandleDeleteSegment(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, _ := strconv.Atoi(idStr)
+
+	cid, err := core.AudienceInUse(h.Store, 0, uint(id))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "db error"})
+		return
+	}
+	if cid != 0 {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": fmt.Sprintf("segment is used by campaign %d", cid)})
+		return
+	}
+	if err := h.Store.DB.Delete(&models.Segment{}, id).Error; err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to delete segment"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// GET /api/segments/{id}/preview?list_ids=1,2
+// Counts the matching contacts (optionally within lists) and shows a few.
+func (h *ContactHandler) HandlePreviewSegment(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, _ := strconv.Atoi(idStr)
+
+	var seg models.Segment
+	if err := h.Store.DB.First(&seg, id).Error; err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "segment not found"})
+		return
+	}
+	listIDs, err := core.ParseListIDs(r.URL.Query().Get("list_ids"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	contacts, err := core.AudienceContacts(h.Store, listIDs, &seg)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	sample := contacts
+	if len(sample) > 10 {
+		sample = sample[:10]
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"count":  len(contacts),
+		"sample": sample,
+	})
+}
@@ -36,7 +36,8 @@ func (s *Server) routes() chi.Router {
 
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Use(custom.GeneralLimiter.Limit)
+	// kumod calls these for every log record / SMTP AUTH attempt
+	r.Use(custom.GeneralLimiter.LimitExcept("/api/events/ingest", "/api/smtp-auth/verify"))
 
 	// Dynamic CORS for Credentials support
 	r.Use(cors.Handler(cors.Options{
@@ -102,12 +103,17 @@ func (s *Server) routes() chi.Router {
 		r.Get("/api/domains/{id}", s.handleGetDomain)
 		r.Put("/api/domains/{id}", s.handleUpdateDomain)
 		r.Delete("/api/domains/{id}", s.handleDeleteDomain)
+		r.Get("/api/domains/{id}/campaign-policies", s.handleListCampaignPolicies)
+		r.Post("/api/domains/{id}/campaign-policies", s.handleCreateCampaignPolicy)
+		r.Put("/api/campaign-policies/{id}", s.handleUpdateCampaignPolicy)
+		r.Delete("/api/campaign-policies/{id}", s.handleDeleteCampaignPolicy)
 
 		// Senders
 		r.Get("/api/domains/{domainID}/senders", s.handleListSenders)
 		r.Post("/api/domains/{domainID}/senders", s.handleCreateSender)
 		r.Get("/api/senders/{id}", s.handleGetSender)
 		r.Put("/api/senders/{id}", s.handleUpdateSender)
+		r.Post("/api/senders/{id}/rotate-password", s.handleRotateSenderPassword)
 		r.Delete("/api/senders/{id}", s.handleDeleteSender)
 		r.Post("/api/domains/{domainID}/senders/{id}/setup", s.handleSetupSender)
 
@@ -124,7 +130,18 @@ func (s *Server) routes() chi.Router {
 		r.Delete("/api/system/ips/{id}", s.handleDeleteIP)
 		r.Post("/api/system/ips/bulk", s.handleBulkAddIPs)
 		r.Post("/api/system/ips/cidr", s.handleAddIPsByCIDR)
+		r.Post("/api/system/ips/allocate-v6", s.handleAllocateIPv6)
 		r.Post("/api/system/ips/detect", s.handleDetectIPs)
+		r.Put("/api/system/ips/{id}", s.handleUpdateIP)
+
+		// Egress Pools (weighted multi-IP)
+		r.Get("/api/pools", s.handleListPools)
+		r.Post("/api/pools", s.handleCreatePool)
+		r.Get("/api/pools/{id}", s.handleGetPool)
+		r.Put("/api/pools/{id}", s.handleUpdatePool)
+		r.Delete("/api/pools/{id}", s.handleDeletePool)
+		r.Post("/api/pools/{id}/assign", s.handleAssignPool)
+		r.Delete("/api/pools/{id}/senders/{senderID}", s.handleUnassignPool)
 
 		// DKIM
 		r.Get("/api/dkim/records", s.handleListDKIM)
@@ -157,6 +174,7 @@ func (s *Server) routes() chi.Router {
 		// System Tools & Actions (Guardian)
 		r.Post("/api/system/check-blacklist", s.handleCheckBlacklist)
 		r.Post("/api/system/check-security", s.handleCheckSecurity)
+		r.Get("/api/system/alignment", s.handleCheckAlignment)
 		r.Post("/api/system/action/block-ip", s.handleBlockIP)
 		r.Post("/api/tools/send-test", s.handleSendTestEmail)
 
@@ -174,9 +192,65 @@ func (s *Server) routes() chi.Router {
 		r.Post("/api/keys", s.handleCreateKey)
 		r.Delete("/api/keys/{id}", s.handleDeleteKey)
 
+		// SMTP Listeners
+		r.Get("/api/listeners", s.handleListListeners)
+		r.Post("/api/listeners", s.handleCreateListener)
+		r.Put("/api/listeners/{id}", s.handleUpdateListener)
+		r.Delete("/api/listeners/{id}", s.handleDeleteListener)
+
+		// Routing Rules (recipient domain -> pool / smarthost)
+		r.Get("/api/routing/rules", s.handleListRoutingRules)
+		r.Post("/api/routing/rules", s.handleCreateRoutingRule)
+		r.Post("/api/routing/rules/reorder", s.handleReorderRoutingRules)
+		r.Put("/api/routing/rules/{id}", s.handleUpdateRoutingRule)
+		r.Delete("/api/routing/rules/{id}", s.handleDeleteRoutingRule)
+		r.Post("/api/routing/test", s.handleTestRoute)
+
+		// Policy snippets (custom.lua)
+		r.Get("/api/policy/snippets", s.handleListPolicySnippets)
+		r.Post("/api/policy/snippets", s.handleCreatePolicySnippet)
+		r.Post("/api/policy/snippets/reorder", s.handleReorderPolicySnippets)
+		r.Put("/api/policy/snippets/{id}", s.handleUpdatePolicySnippet)
+		r.Delete("/api/policy/snippets/{id}", s.handleDeletePolicySnippet)
+
+		// Suppression list (enforced in KumoMTA and by campaigns)
+		r.Get("/api/suppressions", s.handleListSuppressions)
+		r.Post("/api/suppressions", s.handleCreateSuppression)
+		r.Post("/api/suppressions/import", s.handleImportSuppressions)
+		r.Get("/api/suppressions/export", s.handleExportSuppressions)
+		r.Delete("/api/suppressions/{id}", s.handleDeleteSuppression)
+
+		// Assets (attachments and inline images for campaigns and automations)
+		r.Get("/api/assets", s.handleListAssets)
+		r.Post("/api/assets", s.handleUploadAsset)
+		r.Get("/api/assets/{id}/content", s.handleAssetContent)
+		r.Delete("/api/assets/{id}", s.handleDeleteAsset)
+
+		// Delivery events (pushed by the KumoMTA log hook)
+		r.Get("/api/events", s.handleListEvents)
+
+		// Traffic Shaping (per destination)
+		r.Get("/api/shaping", s.handleListShaping)
+		r.Post("/api/shaping", s.handleCreateShaping)
+		r.Put("/api/shaping/{id}", s.handleUpdateShaping)
+		r.Delete("/api/shaping/{id}", s.handleDeleteShaping)
+
+		// Nodes (remote KumoMTA hosts driven by this panel)
+		r.Get("/api/nodes", s.handleListNodes)
+		r.Post("/api/nodes", s.handleCreateNode)
+		r.Put("/api/nodes/{id}", s.handleUpdateNode)
+		r.Delete("/api/nodes/{id}", s.handleDeleteNode)
+		r.Post("/api/nodes/{id}/rotate-secret", s.handleRotateNodeSecret)
+		r.Post("/api/nodes/{id}/apply", s.handleApplyNode)
+		r.Post("/api/nodes/{id}/refresh", s.handleRefreshNode)
+
 		// Config
 		r.Get("/api/config/preview", s.handlePreviewConfig)
 		r.Post("/api/config/apply", s.handleApplyConfig)
+		r.Get("/api/config/revisions", s.handleListRevisions)
+		r.Get("/api/config/revisions/diff", s.handleDiffRevisions)
+		r.Get("/api/config/revisions/{id}", s.handleGetRevision)
+		r.Post("/api/config/revisions/{id}/rollback", s.handleRollbackRevision)
 
 		// Logs
 		r.Get("/api/logs/kumomta", s.handleLogsKumo)
@@ -203,6 +277,14 @@ func (s *Server) routes() chi.Router {
 	tracking := NewTrackingHandler(s.Store)
 	r.Get("/api/track/open/{id}", tracking.HandleTrackOpen)
 	r.Get("/api/track/click/{id}", tracking.HandleTrackClick)
+	r.Get("/api/unsubscribe/{token}", tracking.HandleUnsubscribePage)
+	r.Post("/api/unsubscribe/{token}", tracking.HandleUnsubscribe)
+
+	// --- KumoMTA Log Hook (token auth, see core.IngestToken) ---
+	r.Post("/api/events/ingest", s.handleIngestEvents)
+
+	// --- KumoMTA SMTP AUTH hook (token auth, see core.SMTPAuthToken) ---
+	r.Post("/api/smtp-auth/verify", s.handleVerifySMTPAuth)
 
 	// --- Analytics (Protected) ---
 	r.Group(func(r chi.Router) {
@@ -214,6 +296,17 @@ func (s *Server) routes() chi.Router {
 		contacts := NewContactHandler(s.Store)
 		r.With(custom.VerifyLimiter.Limit).Post("/api/contacts/verify", contacts.HandleVerifyEmail)
 		r.Post("/api/lists/{id}/clean", contacts.HandleCleanList)
+		r.Get("/api/lists", contacts.HandleListLists)
+		r.Post("/api/lists", contacts.HandleCreateList)
+		r.Delete("/api/lists/{id}", contacts.HandleDeleteList)
+		r.Post("/api/lists/{id}/import", contacts.HandleImportContacts)
+
+		// Saved segments, for campaign targeting
+		r.Get("/api/segments", contacts.HandleListSegments)
+		r.Post("/api/segments", contacts.HandleCreateSegment)
+		r.Put("/api/segments/{id}", contacts.HandleUpdateSegment)
+		r.Delete("/api/segments/{id}", contacts.HandleDeleteSegment)
+		r.Get("/api/segments/{id}/preview", contacts.HandlePreviewSegment)
 
 		// Automation & WhatsApp
 		wa := NewWhatsAppHandler(s.Store)
@@ -3,6 +3,7 @@ package api
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
 
 	"github.com/pulak-ranjan/kumomta-ui/internal/core"
 	"github.com/pulak-ranjan/kumomta-ui/internal/models"
@@ -10,11 +11,13 @@ import (
 )
 
 type settingsDTO struct {
-	MainHostname string `json:"main_hostname"`
-	MainServerIP string `json:"main_server_ip"`
-	RelayIPs     string `json:"relay_ips"`
-	AIProvider   string `json:"ai_provider"`
-	AIAPIKey     string `json:"ai_api_key,omitempty"`
+	MainHostname   string `json:"main_hostname"`
+	MainServerIP   string `json:"main_server_ip"`
+	MainServerIPv6 string `json:"main_server_ipv6"`
+	RelayIPs       string `json:"relay_ips"`
+	PanelURL       string `json:"panel_url"`
+	AIProvider     string `json:"ai_provider"`
+	AIAPIKey       string `json:"ai_api_key,omitempty"`
 }
 
 // GET /api/settings
@@ -31,10 +34,12 @@ func (s *Server) handleGetSettings(w http.ResponseWriter, r *http.Request) {
 	}
 
 	writeJSON(w, http.StatusOK, settingsDTO{
-		MainHostname: st.MainHostname,
-		MainServerIP: st.MainServerIP,
-		RelayIPs:     st.MailWizzIP,
-		AIProvider:   st.AIProvider,
+		MainHostname:   st.MainHostname,
+		MainServerIP:   st.MainServerIP,
+		MainServerIPv6: st.MainServerIPv6,
+		RelayIPs:       st.MailWizzIP,
+		PanelURL:       st.PanelURL,
+		AIProvider:     st.AIProvider,
 		// AIAPIKey intentionally omitted - write-only
 	})
 }
@@ -57,9 +62,23 @@ func (s *Server) handleSetSettings(w http.ResponseWriter, r *http.Request) {
 		existing = &models.AppSettings{}
 	}
 
+	if dto.PanelURL != "" && !strings.HasPrefix(dto.PanelURL, "http://") && !strings.HasPrefix(dto.PanelURL, "https://") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "panel_url must start with http:// or https://"})
+		return
+	}
+	if dto.MainServerIPv6 != "" {
+		if !core.IsIPv6(dto.MainServerIPv6) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "main_server_ipv6 must be an IPv6 address"})
+			return
+		}
+		dto.MainServerIPv6, _ = core.NormalizeIP(dto.MainServerIPv6)
+	}
+
 	existing.MainHostname = dto.MainHostname
 	existing.MainServerIP = dto.MainServerIP
+	existing.MainServerIPv6 = dto.MainServerIPv6
 	existing.MailWizzIP = dto.RelayIPs
+	existing.PanelURL = strings.TrimRight(strings.TrimSpace(dto.PanelURL), "/")
 	existing.AIProvider = dto.AIProvider
 
 	if dto.AIAPIKey != "" {
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pulak-ranjan/kumomta-ui/internal/core"
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+	"github.com/pulak-ranjan/kumomta-ui/internal/store"
+)
+
+// GET /api/shaping
+func (s *Server) handleListShaping(w http.ResponseWriter, r *http.Request) {
+	list, err := s.Store.ListTrafficShaping()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list shaping rules"})
+		return
+	}
+	if list == nil {
+		list = []models.TrafficShaping{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// POST /api/shaping
+func (s *Server) handleCreateShaping(w http.ResponseWriter, r *http.Request) {
+	var sh models.TrafficShaping
+	if err := json.NewDecoder(r.Body).Decode(&sh); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+	sh.ID = 0
+
+	if err := core.ValidateShaping(&sh); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := s.Store.CreateTrafficShaping(&sh); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create shaping rule (duplicate domain?)"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Create Shaping", fmt.Sprintf("Destination: %s", sh.Domain), s.getUser(r))
+
+	writeJSON(w, http.StatusCreated, sh)
+}
+
+// PUT /api/shaping/{id}
+func (s *Server) handleUpdateShaping(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid id"})
+		return
+	}
+
+	existing, err := s.Store.GetTrafficShapingByID(uint(id))
+	if err != nil {
+		if err == store.ErrNotFound {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "shaping rule not found"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to load shaping rule"})
+		return
+	}
+
+	var update models.TrafficShaping
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+
+	// Full replace of the tunables (zero means "KumoMTA default")
+	update.ID = existing.ID
+	update.CreatedAt = existing.CreatedAt
+	if update.Domain == "" {
+		update.Domain = existing.Domain
+	}
+
+	if err := core.ValidateShaping(&update); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := s.Store.UpdateTrafficShaping(&update); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update shaping rule"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Update Shaping", fmt.Sprintf("Destination: %s", update.Domain), s.getUser(r))
+
+	writeJSON(w, http.StatusOK, update)
+}
+
+// DELETE /api/shaping/{id}
+func (s *Server) handleDeleteShaping(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid id"})
+		return
+	}
+
+	if err := s.Store.DeleteTrafficShaping(uint(id)); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to delete shaping rule"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Delete Shaping", fmt.Sprintf("Deleted shaping rule ID: %d", id), s.getUser(r))
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pulak-ranjan/kumomta-ui/internal/core"
+)
+
+// POST /api/smtp-auth/verify
+// Called by the smtp_server_auth_plain hook generated in init.lua, not by
+// users. Auth: "Authorization: Bearer <core.SMTPAuthToken()>".
+// 200 = valid credential, 401 = invalid (or bad token).
+func (s *Server) handleVerifySMTPAuth(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !core.VerifySMTPAuthToken(token) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid auth token"})
+		return
+	}
+
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+
+	ok, err := core.VerifySMTPCredential(s.Store, req.Username, req.Password)
+	if err != nil {
+		s.Store.LogError(err)
+	}
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]bool{"ok": false})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+}
+
+// POST /api/senders/{id}/rotate-password
+// Generates a new SMTP AUTH password. The response is the only time it is
+// shown; afterwards only its hash is kept.
+func (s *Server) handleRotateSenderPassword(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid id"})
+		return
+	}
+
+	sender, err := s.Store.GetSenderByID(uint(id))
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "sender not found"})
+		return
+	}
+	hadPassword := sender.HasSMTPPassword
+
+	password, err := core.RotateSMTPPassword(s.Store, sender)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to rotate password"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Rotate SMTP Password", fmt.Sprintf("Rotated SMTP AUTH password for %s", sender.Email), s.getUser(r))
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"username": sender.Email,
+		"password": password,
+		// A sender without a password isn't in auth.toml until the next apply
+		"requires_apply": !hadPassword,
+	})
+}
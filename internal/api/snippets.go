@@ -0,0 +1,140 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pulak-ranjan/kumomta-ui/internal/core"
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+	"github.com/pulak-ranjan/kumomta-ui/internal/store"
+)
+
+// GET /api/policy/snippets
+func (s *Server) handleListPolicySnippets(w http.ResponseWriter, r *http.Request) {
+	list, err := s.Store.ListPolicySnippets()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list policy snippets"})
+		return
+	}
+	if list == nil {
+		list = []models.PolicySnippet{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// POST /api/policy/snippets
+// New snippets are appended to the end of custom.lua.
+func (s *Server) handleCreatePolicySnippet(w http.ResponseWriter, r *http.Request) {
+	var snip models.PolicySnippet
+	if err := json.NewDecoder(r.Body).Decode(&snip); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+	snip.ID = 0
+
+	if err := core.ValidatePolicySnippet(&snip); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := s.Store.CreatePolicySnippet(&snip); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create policy snippet"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Create Policy Snippet", fmt.Sprintf("Snippet: %s", snip.Name), s.getUser(r))
+
+	writeJSON(w, http.StatusCreated, snip)
+}
+
+// PUT /api/policy/snippets/{id}
+func (s *Server) handleUpdatePolicySnippet(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid id"})
+		return
+	}
+
+	existing, err := s.Store.GetPolicySnippetByID(uint(id))
+	if err != nil {
+		if err == store.ErrNotFound {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "policy snippet not found"})
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to load policy snippet"})
+		return
+	}
+
+	var update models.PolicySnippet
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+
+	// Full replace; order is changed through /reorder only
+	update.ID = existing.ID
+	update.Position = existing.Position
+	update.CreatedAt = existing.CreatedAt
+
+	if err := core.ValidatePolicySnippet(&update); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := s.Store.UpdatePolicySnippet(&update); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to update policy snippet"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Update Policy Snippet", fmt.Sprintf("Snippet: %s", update.Name), s.getUser(r))
+
+	writeJSON(w, http.StatusOK, update)
+}
+
+// DELETE /api/policy/snippets/{id}
+func (s *Server) handleDeletePolicySnippet(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid id"})
+		return
+	}
+
+	if err := s.Store.DeletePolicySnippet(uint(id)); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to delete policy snippet"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Delete Policy Snippet", fmt.Sprintf("Deleted policy snippet ID: %d", id), s.getUser(r))
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// POST /api/policy/snippets/reorder
+// Body: { "ids": [3, 1, 2] } (first = loaded first)
+func (s *Server) handleReorderPolicySnippets(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IDs []uint `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.IDs) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "ids required"})
+		return
+	}
+
+	if err := s.Store.ReorderPolicySnippets(req.IDs); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to reorder policy snippets"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Reorder Policy Snippets", fmt.Sprintf("Order: %v", req.IDs), s.getUser(r))
+
+	s.handleListPolicySnippets(w, r)
+}
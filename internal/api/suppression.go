@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/pulak-ranjan/kumomta-ui/internal/core"
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+)
+
+// GET /api/suppressions?q=example.com
+func (s *Server) handleListSuppressions(w http.ResponseWriter, r *http.Request) {
+	list, err := s.Store.ListSuppressions(r.URL.Query().Get("q"))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list suppressions"})
+		return
+	}
+	if list == nil {
+		list = []models.Suppression{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// POST /api/suppressions
+// Suppressing a value that is already listed updates it.
+func (s *Server) handleCreateSuppression(w http.ResponseWriter, r *http.Request) {
+	var sup models.Suppression
+	if err := json.NewDecoder(r.Body).Decode(&sup); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json"})
+		return
+	}
+	sup.ID = 0
+
+	if err := core.ValidateSuppression(&sup); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := s.Store.UpsertSuppression(&sup); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to save suppression"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Suppress", fmt.Sprintf("%s (%s)", sup.Value, sup.Reason), s.getUser(r))
+
+	writeJSON(w, http.StatusCreated, sup)
+}
+
+// DELETE /api/suppressions/{id}
+func (s *Server) handleDeleteSuppression(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid id"})
+		return
+	}
+
+	if err := s.Store.DeleteSuppression(uint(id)); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to delete suppression"})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Unsuppress", fmt.Sprintf("Deleted suppression ID: %d", id), s.getUser(r))
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// POST /api/suppressions/import (multipart, field "file")
+func (s *Server) handleImportSuppressions(w http.ResponseWriter, r *http.Request) {
+	// Max 10MB CSV
+	r.Body = http.MaxBytesReader(w, r.Body, 10<<20)
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "file too big"})
+		return
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "file required"})
+		return
+	}
+	defer file.Close()
+
+	res, err := core.ImportSuppressionsCSV(s.Store, file, "import")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	// AUDIT LOG
+	go s.WS.SendAuditLog("Import Suppressions", fmt.Sprintf("Imported %d entries", res.Imported), s.getUser(r))
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+// GET /api/suppressions/export
+func (s *Server) handleExportSuppressions(w http.ResponseWriter, r *http.Request) {
+	list, err := s.Store.ListSuppressions("")
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to list suppressions"})
+		return
+	}
+
+	filename := fmt.Sprintf("suppressions-%s.csv", time.Now().Format("20060102"))
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if err := core.ExportSuppressionsCSV(w, list); err != nil {
+		s.Store.LogError(err)
+	}
+}
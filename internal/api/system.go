@@ -175,6 +175,18 @@ func (s *Server) handleCheckBlacklist(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "started", "message": "Blacklist scan started. Report will be sent via webhook."})
 }
 
+// GET /api/system/alignment
+// Checks every sender's EHLO against live A/AAAA and PTR records.
+func (s *Server) handleCheckAlignment(w http.ResponseWriter, r *http.Request) {
+	report, err := core.RunAlignmentCheck(s.Store)
+	if err != nil {
+		s.Store.LogError(err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to run alignment check"})
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
 // POST /api/system/check-security
 func (s *Server) handleCheckSecurity(w http.ResponseWriter, r *http.Request) {
 	go s.WS.RunSecurityAudit()
@@ -1,12 +1,14 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"os/exec"
 	"strings"
 
+	"github.com/pulak-ranjan/kumomta-ui/internal/core"
 	"github.com/pulak-ranjan/kumomta-ui/internal/models"
 )
 
@@ -45,7 +47,27 @@ func (s *Server) handleSendTestEmail(w http.ResponseWriter, r *http.Request) {
 		helo = fmt.Sprintf("%s.%s", sender.LocalPart, sender.Domain.Name)
 	}
 
-	// 3. EXECUTE SWAKS
+	// 3. BUILD THE MESSAGE: same MIME builder as campaigns, plain text when
+	// the body has no HTML
+	out := core.OutboundMessage{
+		FromName:  sender.DisplayName,
+		FromEmail: sender.Email,
+		To:        req.Recipient,
+		Subject:   req.Subject,
+		Headers:   map[string]string{"X-Kumo-Test": "True"}, // Header to identify test traffic
+	}
+	if strings.Contains(req.Body, "<") {
+		out.HTML = req.Body
+	} else {
+		out.Text = req.Body
+	}
+	msg, err := core.BuildMessage(out)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	// 4. EXECUTE SWAKS
 	// We connect to localhost:25. KumoMTA's init.lua uses the 'MAIL FROM' to map to the correct source IP.
 	args := []string{
 		"--to", req.Recipient,
@@ -53,15 +75,14 @@ func (s *Server) handleSendTestEmail(w http.ResponseWriter, r *http.Request) {
 		"--server", "127.0.0.1",
 		"--port", "25",
 		"--helo", helo,
-		"--header", "Subject: " + req.Subject,
-		"--header", "X-Kumo-Test: True", // Header to identify test traffic
-		"--body", req.Body,
+		"--data", "-", // message on stdin
 		"--hide-all",
 	}
 
 	cmdStr := fmt.Sprintf("swaks %s", strings.Join(args, " "))
 	
 	cmd := exec.Command("swaks", args...)
+	cmd.Stdin = bytes.NewReader(msg)
 	output, err := cmd.CombinedOutput()
 
 	response := map[string]string{
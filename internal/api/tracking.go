@@ -2,11 +2,15 @@ package api
 
 import (
 	"encoding/base64"
+	"errors"
+	"html/template"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+
 	"github.com/pulak-ranjan/kumomta-ui/internal/core"
 	"github.com/pulak-ranjan/kumomta-ui/internal/models"
 	"github.com/pulak-ranjan/kumomta-ui/internal/store"
@@ -78,12 +82,19 @@ func (h *TrackingHandler) recordOpen(id uint, r *http.Request) {
 			h.Store.DB.Save(&camp)
 		}
 
+		// A/B variant counter
+		if recip.VariantID > 0 {
+			h.Store.DB.Model(&models.CampaignVariant{}).Where("id = ?", recip.VariantID).
+				Update("opens", gorm.Expr("opens + 1"))
+		}
+
 		// Update Contact Score (AI Superlead)
 		if recip.ContactID > 0 {
 			var contact models.Contact
 			if err := h.Store.DB.First(&contact, recip.ContactID).Error; err == nil {
 				contact.TotalOpens++
 				contact.Score += 1 // +1 for open
+				contact.LastOpenedAt = &now
 				h.Store.DB.Save(&contact)
 			}
 		}
@@ -96,6 +107,15 @@ func (h *TrackingHandler) recordClick(id uint) {
 		return
 	}
 
+	// A/B variant counters: every click, and the first per recipient
+	if recip.VariantID > 0 {
+		updates := map[string]interface{}{"clicks": gorm.Expr("clicks + 1")}
+		if recip.ClickedAt == nil {
+			updates["unique_clicks"] = gorm.Expr("unique_clicks + 1")
+		}
+		h.Store.DB.Model(&models.CampaignVariant{}).Where("id = ?", recip.VariantID).Updates(updates)
+	}
+
 	now := time.Now()
 	if recip.ClickedAt == nil {
 		recip.ClickedAt = &now
@@ -119,3 +139,69 @@ func (h *TrackingHandler) recordClick(id uint) {
 		}
 	}
 }
+
+// unsubscribePage is the hosted unsubscribe page. GET only asks for
+// confirmation (link scanners prefetch URLs); POST, from the form or a
+// mail client's RFC 8058 one-click request, unsubscribes.
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Unsubscribe</title>
+<style>body{font-family:system-ui,sans-serif;max-width:28rem;margin:4rem auto;padding:0 1rem;color:#222}button{padding:.6rem 1.2rem;font-size:1rem;cursor:pointer}</style>
+</head><body>
+{{if .Invalid}}<h1>Link not valid</h1><p>This unsubscribe link is invalid or has expired.</p>
+{{else if .Done}}<h1>You are unsubscribed</h1><p><strong>{{.Email}}</strong> will not receive these emails any more.</p>
+{{else}}<h1>Unsubscribe</h1><p>Stop sending emails to <strong>{{.Email}}</strong>?</p>
+<form method="post"><button type="submit">Unsubscribe</button></form>{{end}}
+</body></html>`))
+
+type unsubscribeView struct {
+	Email   string
+	Done    bool
+	Invalid bool
+}
+
+func renderUnsubscribePage(w http.ResponseWriter, status int, view unsubscribeView) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	unsubscribePage.Execute(w, view)
+}
+
+// GET /api/unsubscribe/{token}
+func (h *TrackingHandler) HandleUnsubscribePage(w http.ResponseWriter, r *http.Request) {
+	id, err := core.ParseUnsubscribeToken(chi.URLParam(r, "token"))
+	if err != nil {
+		renderUnsubscribePage(w, http.StatusBadRequest, unsubscribeView{Invalid: true})
+		return
+	}
+	var recip models.CampaignRecipient
+	if err := h.Store.DB.First(&recip, id).Error; err != nil {
+		renderUnsubscribePage(w, http.StatusNotFound, unsubscribeView{Invalid: true})
+		return
+	}
+	renderUnsubscribePage(w, http.StatusOK, unsubscribeView{Email: recip.Email, Done: recip.UnsubscribedAt != nil})
+}
+
+// POST /api/unsubscribe/{token}
+func (h *TrackingHandler) HandleUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	id, err := core.ParseUnsubscribeToken(chi.URLParam(r, "token"))
+	if err != nil {
+		renderUnsubscribePage(w, http.StatusBadRequest, unsubscribeView{Invalid: true})
+		return
+	}
+
+	via := "page"
+	if r.ParseForm() == nil && r.PostForm.Get("List-Unsubscribe") == "One-Click" {
+		via = "one-click"
+	}
+	recip, err := core.Unsubscribe(h.Store, id, via)
+	if errors.Is(err, core.ErrInvalidUnsubscribeToken) {
+		renderUnsubscribePage(w, http.StatusNotFound, unsubscribeView{Invalid: true})
+		return
+	}
+	if err != nil {
+		http.Error(w, "Unsubscribe failed, please try again later", http.StatusInternalServerError)
+		return
+	}
+	renderUnsubscribePage(w, http.StatusOK, unsubscribeView{Email: recip.Email, Done: true})
+}
@@ -99,9 +99,10 @@ func (s *Server) handleUpdateWarmup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Apply config immediately to enforce new rate (don't wait for daily cron)
+	user := s.getUser(r)
 	go func() {
 		snap, _ := core.LoadSnapshot(s.Store)
-		core.ApplyKumoConfig(snap)
+		core.ApplyAndRecord(s.Store, snap, user)
 	}()
 
 	writeJSON(w, http.StatusOK, map[string]string{"status": "updated"})
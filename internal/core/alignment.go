@@ -0,0 +1,277 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+	"github.com/pulak-ranjan/kumomta-ui/internal/store"
+)
+
+var ehloDomainRegex = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)+$`)
+
+// ValidateEHLODomain normalizes an EHLO override. Empty is allowed and
+// means the default "localpart.domain".
+func ValidateEHLODomain(host string) (string, error) {
+	host = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(host), "."))
+	if host == "" {
+		return "", nil
+	}
+	if len(host) > 253 || !ehloDomainRegex.MatchString(host) {
+		return "", fmt.Errorf("ehlo_domain must be a fully qualified hostname, e.g. mta1.example.com")
+	}
+	return host, nil
+}
+
+// Resolver is the DNS interface used by the alignment checker
+// (satisfied by *net.Resolver).
+type Resolver interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// dnsLookupTimeout bounds each PTR / A / AAAA lookup.
+const dnsLookupTimeout = 5 * time.Second
+
+// IPAlignment is the reverse DNS state of one source IP.
+type IPAlignment struct {
+	IP               string   `json:"ip"`
+	Hostname         string   `json:"hostname"` // inventory hostname (pool EHLO), if any
+	PTR              []string `json:"ptr"`
+	ForwardConfirmed bool     `json:"forward_confirmed"` // a PTR name resolves back to the IP
+	Issues           []string `json:"issues"`
+}
+
+// SenderAlignment checks one source a sender egresses from: the EHLO it
+// announces must resolve to the source IP and match the IP's PTR.
+type SenderAlignment struct {
+	SenderID     uint     `json:"sender_id"`
+	Email        string   `json:"email"`
+	Source       string   `json:"source"`
+	IP           string   `json:"ip"`
+	EHLO         string   `json:"ehlo"`
+	EHLOResolves bool     `json:"ehlo_resolves"` // A/AAAA of the EHLO includes the IP
+	PTRMatches   bool     `json:"ptr_matches"`   // the IP's PTR is the EHLO
+	Aligned      bool     `json:"aligned"`
+	Issues       []string `json:"issues"`
+}
+
+// AlignmentReport is the result of an EHLO / reverse DNS check.
+type AlignmentReport struct {
+	CheckedAt  time.Time         `json:"checked_at"`
+	IPs        []IPAlignment     `json:"ips"`
+	Senders    []SenderAlignment `json:"senders"`
+	Misaligned int               `json:"misaligned"` // sender sources with issues
+}
+
+// normalizeHost lowercases a DNS name and drops the trailing dot.
+func normalizeHost(h string) string {
+	return strings.ToLower(strings.TrimSuffix(h, "."))
+}
+
+// alignmentChecker caches lookups so shared IPs and EHLO names are only
+// resolved once per run.
+type alignmentChecker struct {
+	r  Resolver
+	mu sync.Mutex
+
+	hosts map[string][]net.IP
+	errs  map[string]error
+}
+
+func (c *alignmentChecker) resolve(ctx context.Context, host string) ([]net.IP, error) {
+	c.mu.Lock()
+	if ips, ok := c.hosts[host]; ok {
+		err := c.errs[host]
+		c.mu.Unlock()
+		return ips, err
+	}
+	c.mu.Unlock()
+
+	lctx, cancel := context.WithTimeout(ctx, dnsLookupTimeout)
+	defer cancel()
+	addrs, err := c.r.LookupIPAddr(lctx, host)
+	var ips []net.IP
+	for _, a := range addrs {
+		ips = append(ips, a.IP)
+	}
+
+	c.mu.Lock()
+	c.hosts[host] = ips
+	c.errs[host] = err
+	c.mu.Unlock()
+	return ips, err
+}
+
+func (c *alignmentChecker) resolvesTo(ctx context.Context, host, ip string) bool {
+	want := net.ParseIP(ip)
+	ips, _ := c.resolve(ctx, host)
+	for _, got := range ips {
+		if got.Equal(want) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *alignmentChecker) checkIP(ctx context.Context, ip, hostname string) IPAlignment {
+	res := IPAlignment{IP: ip, Hostname: hostname, PTR: []string{}, Issues: []string{}}
+
+	lctx, cancel := context.WithTimeout(ctx, dnsLookupTimeout)
+	names, err := c.r.LookupAddr(lctx, ip)
+	cancel()
+	if err != nil || len(names) == 0 {
+		res.Issues = append(res.Issues, fmt.Sprintf("%s has no PTR record", ip))
+		return res
+	}
+	for _, n := range names {
+		res.PTR = append(res.PTR, normalizeHost(n))
+	}
+
+	for _, n := range res.PTR {
+		if c.resolvesTo(ctx, n, ip) {
+			res.ForwardConfirmed = true
+			break
+		}
+	}
+	if !res.ForwardConfirmed {
+		res.Issues = append(res.Issues, fmt.Sprintf("PTR %s does not resolve back to %s", strings.Join(res.PTR, ", "), ip))
+	}
+	if hostname != "" && !containsString(res.PTR, normalizeHost(hostname)) {
+		res.Issues = append(res.Issues, fmt.Sprintf("inventory hostname %s is not the PTR of %s (%s)", hostname, ip, strings.Join(res.PTR, ", ")))
+	}
+	return res
+}
+
+func containsString(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// senderSource is one (source, IP, EHLO) a sender can egress from.
+type senderSource struct {
+	name, ip, ehlo string
+}
+
+// senderSources lists the sources a sender uses, with the EHLO each one
+// announces, mirroring GenerateSourcesTOML.
+func senderSources(snap *Snapshot, d models.Domain, s models.Sender) []senderSource {
+	if SenderPoolName(snap, d, s) != PoolName(d, s) {
+		p := snap.PoolByID(s.EgressPoolID)
+		var out []senderSource
+		for _, m := range p.Members {
+			out = append(out, senderSource{PoolSourceName(*p, m.SystemIP.Value), m.SystemIP.Value, poolMemberEHLO(snap, *p, m)})
+		}
+		return out
+	}
+	return []senderSource{{SourceName(d, s), s.IP, senderEHLO(d, s)}}
+}
+
+// CheckAlignment looks up the PTR of every inventory and sender IP,
+// forward-confirms it, and flags sender sources whose EHLO does not
+// resolve to the IP or does not match its PTR.
+func CheckAlignment(ctx context.Context, r Resolver, snap *Snapshot, inventory []models.SystemIP) *AlignmentReport {
+	c := &alignmentChecker{r: r, hosts: map[string][]net.IP{}, errs: map[string]error{}}
+	report := &AlignmentReport{CheckedAt: time.Now().UTC(), IPs: []IPAlignment{}, Senders: []SenderAlignment{}}
+
+	// Collect every IP to check, with its inventory hostname
+	hostnames := map[string]string{}
+	for _, ip := range inventory {
+		hostnames[ip.Value] = ip.Hostname
+	}
+	for _, d := range snap.Domains {
+		for _, s := range d.Senders {
+			for _, src := range senderSources(snap, d, s) {
+				if _, ok := hostnames[src.ip]; !ok && src.ip != "" {
+					hostnames[src.ip] = ""
+				}
+			}
+		}
+	}
+	ips := make([]string, 0, len(hostnames))
+	for ip := range hostnames {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+
+	// PTR lookups in parallel; big pools would take minutes otherwise
+	results := make([]IPAlignment, len(ips))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 16)
+	for i, ip := range ips {
+		wg.Add(1)
+		go func(i int, ip string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = c.checkIP(ctx, ip, hostnames[ip])
+		}(i, ip)
+	}
+	wg.Wait()
+
+	byIP := map[string]IPAlignment{}
+	for _, res := range results {
+		byIP[res.IP] = res
+		report.IPs = append(report.IPs, res)
+	}
+
+	for _, d := range snap.Domains {
+		for _, s := range d.Senders {
+			for _, src := range senderSources(snap, d, s) {
+				sa := SenderAlignment{
+					SenderID: s.ID,
+					Email:    s.Email,
+					Source:   src.name,
+					IP:       src.ip,
+					EHLO:     src.ehlo,
+					Issues:   []string{},
+				}
+				if src.ip == "" {
+					sa.Issues = append(sa.Issues, "no source IP")
+				} else {
+					ipRes := byIP[src.ip]
+					ehlo := normalizeHost(src.ehlo)
+					sa.EHLOResolves = c.resolvesTo(ctx, ehlo, src.ip)
+					sa.PTRMatches = containsString(ipRes.PTR, ehlo)
+					if !sa.EHLOResolves {
+						sa.Issues = append(sa.Issues, fmt.Sprintf("EHLO %s does not resolve to %s", src.ehlo, src.ip))
+					}
+					if len(ipRes.PTR) == 0 {
+						sa.Issues = append(sa.Issues, fmt.Sprintf("%s has no PTR record", src.ip))
+					} else if !sa.PTRMatches {
+						sa.Issues = append(sa.Issues, fmt.Sprintf("PTR of %s is %s, not EHLO %s", src.ip, strings.Join(ipRes.PTR, ", "), src.ehlo))
+					}
+				}
+				sa.Aligned = len(sa.Issues) == 0
+				if !sa.Aligned {
+					report.Misaligned++
+				}
+				report.Senders = append(report.Senders, sa)
+			}
+		}
+	}
+	return report
+}
+
+// RunAlignmentCheck checks the current config against live DNS.
+func RunAlignmentCheck(st *store.Store) (*AlignmentReport, error) {
+	snap, err := LoadSnapshot(st)
+	if err != nil {
+		return nil, err
+	}
+	inventory, err := st.ListSystemIPs()
+	if err != nil {
+		return nil, err
+	}
+	return CheckAlignment(context.Background(), net.DefaultResolver, snap, inventory), nil
+}
@@ -0,0 +1,112 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+)
+
+// fakeResolver answers from fixed PTR and A/AAAA tables.
+type fakeResolver struct {
+	ptr map[string][]string
+	a   map[string][]string
+}
+
+func (f fakeResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	if names, ok := f.ptr[addr]; ok {
+		return names, nil
+	}
+	return nil, fmt.Errorf("no such host")
+}
+
+func (f fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	var out []net.IPAddr
+	for _, ip := range f.a[host] {
+		out = append(out, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no such host")
+	}
+	return out, nil
+}
+
+func TestCheckAlignment(t *testing.T) {
+	r := fakeResolver{
+		ptr: map[string][]string{
+			"192.0.2.10":  {"mta1.example.com."},
+			"192.0.2.11":  {"news.example.com."},
+			"2001:db8::5": {"pool5.example.net."},
+		},
+		a: map[string][]string{
+			"mta1.example.com":  {"192.0.2.10"},
+			"news.example.com":  {"192.0.2.99"}, // PTR not forward-confirmed
+			"pool5.example.net": {"2001:db8::5"},
+		},
+	}
+	pool := models.EgressPool{ID: 1, Name: "bulk", Members: []models.EgressPoolMember{
+		{SystemIP: models.SystemIP{Value: "2001:db8::5", Hostname: "pool5.example.net"}},
+	}}
+	snap := &Snapshot{
+		Domains: []models.Domain{{Name: "example.com", Senders: []models.Sender{
+			{ID: 1, LocalPart: "ops", Email: "ops@example.com", IP: "192.0.2.10", EHLODomain: "mta1.example.com"},
+			{ID: 2, LocalPart: "news", Email: "news@example.com", IP: "192.0.2.11"},
+			{ID: 3, LocalPart: "bulk", Email: "bulk@example.com", EgressPoolID: 1},
+			{ID: 4, LocalPart: "none", Email: "none@example.com", IP: "192.0.2.12"},
+		}}},
+		Pools: []models.EgressPool{pool},
+	}
+
+	report := CheckAlignment(context.Background(), r, snap, []models.SystemIP{{Value: "192.0.2.10"}})
+
+	if len(report.IPs) != 4 {
+		t.Fatalf("ips = %+v", report.IPs)
+	}
+	bySender := map[uint]SenderAlignment{}
+	for _, sa := range report.Senders {
+		bySender[sa.SenderID] = sa
+	}
+
+	if sa := bySender[1]; !sa.Aligned || sa.EHLO != "mta1.example.com" {
+		t.Errorf("ops should be aligned through its EHLO override: %+v", sa)
+	}
+	if sa := bySender[2]; sa.Aligned || sa.EHLOResolves || !sa.PTRMatches {
+		t.Errorf("news EHLO resolves elsewhere: %+v", sa)
+	}
+	if sa := bySender[3]; !sa.Aligned || sa.EHLO != "pool5.example.net" {
+		t.Errorf("pooled sender should use the member hostname: %+v", sa)
+	}
+	if sa := bySender[4]; sa.Aligned || len(sa.Issues) != 2 || !strings.Contains(sa.Issues[1], "no PTR") {
+		t.Errorf("sender without PTR: %+v", sa)
+	}
+	if report.Misaligned != 2 {
+		t.Errorf("misaligned = %d", report.Misaligned)
+	}
+
+	for _, ip := range report.IPs {
+		if ip.IP == "192.0.2.11" && (ip.ForwardConfirmed || len(ip.Issues) != 1) {
+			t.Errorf("192.0.2.11 PTR should fail forward confirmation: %+v", ip)
+		}
+	}
+
+	if !strings.Contains(GenerateSourcesTOML(snap), "ehlo_domain = \"mta1.example.com\"") {
+		t.Error("sources.toml should use the sender's EHLO override")
+	}
+}
+
+func TestValidateEHLODomain(t *testing.T) {
+	if got, err := ValidateEHLODomain(" MTA1.Example.com. "); err != nil || got != "mta1.example.com" {
+		t.Errorf("got %q, %v", got, err)
+	}
+	if got, err := ValidateEHLODomain(""); err != nil || got != "" {
+		t.Errorf("empty: %q, %v", got, err)
+	}
+	for _, bad := range []string{"localhost", "bad host.example.com", "-x.example.com", "x\".example.com"} {
+		if _, err := ValidateEHLODomain(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
@@ -3,8 +3,8 @@ package core
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strings"
 )
 
 // Paths for Kumo policy files.
@@ -15,17 +15,32 @@ const (
 	KumoListenerDomainsPath = "/opt/kumomta/etc/policy/listener_domains.toml"
 	KumoDKIMDataPath        = "/opt/kumomta/etc/policy/dkim_data.toml"
 	KumoAuthPath            = "/opt/kumomta/etc/policy/auth.toml" // <--- NEW
+	KumoShapingPath         = "/opt/kumomta/etc/policy/shaping.toml"
+	KumoRoutingPath         = "/opt/kumomta/etc/policy/routing.toml"
+	KumoSuppressionPath     = "/opt/kumomta/etc/policy/suppression.toml"
+	KumoCustomLuaPath       = "/opt/kumomta/etc/policy/custom.lua"
 	KumoInitLuaPath         = "/opt/kumomta/etc/policy/init.lua"
 
 	KumoBinary = "/opt/kumomta/sbin/kumod"
 )
 
+// KumoConfigFile is one generated policy file.
+type KumoConfigFile struct {
+	Name    string `json:"name"` // e.g. "sources.toml"
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
 // ApplyResult captures what happened during apply.
 type ApplyResult struct {
 	SourcesPath         string `json:"sources_path"`
 	QueuesPath          string `json:"queues_path"`
 	ListenerDomainsPath string `json:"listener_domains_path"`
 	DKIMDataPath        string `json:"dkim_data_path"`
+	ShapingPath         string `json:"shaping_path"`
+	RoutingPath         string `json:"routing_path"`
+	SuppressionPath     string `json:"suppression_path"`
+	CustomLuaPath       string `json:"custom_lua_path"`
 	InitLuaPath         string `json:"init_lua_path"`
 
 	ValidationOK  bool   `json:"validation_ok"`
@@ -35,92 +50,194 @@ type ApplyResult struct {
 	RestartLog string `json:"restart_log"`
 }
 
+// GenerateKumoFiles renders every managed policy file from the DB snapshot.
+// init.lua comes last so the data files it loads are in place first.
+func GenerateKumoFiles(snap *Snapshot) []KumoConfigFile {
+	return []KumoConfigFile{
+		{Name: "sources.toml", Path: KumoSourcesPath, Content: GenerateSourcesTOML(snap)},
+		{Name: "queues.toml", Path: KumoQueuesPath, Content: GenerateQueuesTOML(snap)},
+		{Name: "listener_domains.toml", Path: KumoListenerDomainsPath, Content: GenerateListenerDomainsTOML(snap)},
+		{Name: "dkim_data.toml", Path: KumoDKIMDataPath, Content: GenerateDKIMDataTOML(snap, DKIMBasePath)},
+		{Name: "auth.toml", Path: KumoAuthPath, Content: GenerateAuthTOML(snap)},
+		{Name: "shaping.toml", Path: KumoShapingPath, Content: GenerateShapingTOML(snap)},
+		{Name: "routing.toml", Path: KumoRoutingPath, Content: GenerateRoutingTOML(snap)},
+		{Name: "suppression.toml", Path: KumoSuppressionPath, Content: GenerateSuppressionTOML(snap)},
+		{Name: "custom.lua", Path: KumoCustomLuaPath, Content: GenerateCustomLua(snap)},
+		{Name: "init.lua", Path: KumoInitLuaPath, Content: GenerateInitLua(snap)},
+	}
+}
+
 // ApplyKumoConfig generates comprehensive configs from the DB.
 // It effectively "searches and verifies" that all records in the DB
 // are present in the config files.
 func ApplyKumoConfig(snap *Snapshot) (*ApplyResult, error) {
-	// 1. Ensure Directory Exists
-	if err := os.MkdirAll(KumoPolicyDir, 0o755); err != nil {
-		return nil, fmt.Errorf("failed to create policy dir: %w", err)
-	}
+	return applyKumoFiles(GenerateKumoFiles(snap))
+}
 
-	// 2. Generate "Perfect" Content from Database
-	sources := GenerateSourcesTOML(snap)
-	queues := GenerateQueuesTOML(snap)
-	listenerDomains := GenerateListenerDomainsTOML(snap)
-	dkimData := GenerateDKIMDataTOML(snap, "/opt/kumomta/etc/dkim")
-	authData := GenerateAuthTOML(snap) // <--- NEW
-	initLua := GenerateInitLua(snap)
+// applyKumoFiles runs the files through the production applier.
+// Shared by normal applies and rollbacks.
+func applyKumoFiles(files []KumoConfigFile) (*ApplyResult, error) {
+	return NewApplierFromEnv().Apply(files)
+}
 
-	// Helper: Smart Update
-	// Writes the file only if it's missing or different.
-	// If different, it creates a .bak backup first.
-	applyFile := func(path string, content string) error {
-		return smartUpdateFile(path, []byte(content), 0o644)
+// Applier validates generated files in a staging directory, swaps them
+// into PolicyDir and asks the reloader to make kumod pick them up.
+type Applier struct {
+	PolicyDir  string // live policy dir, e.g. KumoPolicyDir
+	StagingDir string // parent for staging dirs; defaults to PolicyDir's parent
+	Validator  ConfigValidator
+	Reloader   ServiceReloader
+	// InitReloader, if set, is used instead of Reloader when the init
+	// handler of init.lua changed (listeners, log hook, HTTP listener,
+	// spools, bounce classifier), which a config epoch bump doesn't re-run.
+	InitReloader ServiceReloader
+}
+
+// NewApplierFromEnv builds the applier used in production.
+// KUMO_APPLY_MODE selects how kumod is told about new files:
+//   - "restart" (default): kumod --validate, then systemctl restart
+//   - "reload": kumod --validate, then a config epoch bump (keeps SMTP sessions);
+//     a restart when the init handler changed, as the bump doesn't re-run it
+//   - "noop": no validation and no reload (CI / dev boxes)
+func NewApplierFromEnv() *Applier {
+	a := &Applier{
+		PolicyDir: KumoPolicyDir,
+		Validator: KumodValidator{},
+		Reloader:  SystemdRestartReloader{},
+	}
+	switch os.Getenv("KUMO_APPLY_MODE") {
+	case "reload":
+		a.Reloader = ConfigEpochReloader{}
+		a.InitReloader = SystemdRestartReloader{}
+	case "noop":
+		a.Validator = NoopValidator{}
+		a.Reloader = &NoopReloader{}
 	}
+	return a
+}
 
-	// 3. Apply Files (Self-Healing)
-	if err := applyFile(KumoSourcesPath, sources); err != nil {
-		return nil, fmt.Errorf("failed to apply sources.toml: %w", err)
+// Apply stages, validates, swaps in and reloads. If validation fails the
+// live files are left untouched.
+func (a *Applier) Apply(files []KumoConfigFile) (*ApplyResult, error) {
+	// 1. Ensure Directory Exists
+	if err := os.MkdirAll(a.PolicyDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create policy dir: %w", err)
 	}
-	if err := applyFile(KumoQueuesPath, queues); err != nil {
-		return nil, fmt.Errorf("failed to apply queues.toml: %w", err)
+
+	res := &ApplyResult{
+		SourcesPath:         filepath.Join(a.PolicyDir, "sources.toml"),
+		QueuesPath:          filepath.Join(a.PolicyDir, "queues.toml"),
+		ListenerDomainsPath: filepath.Join(a.PolicyDir, "listener_domains.toml"),
+		DKIMDataPath:        filepath.Join(a.PolicyDir, "dkim_data.toml"),
+		ShapingPath:         filepath.Join(a.PolicyDir, "shaping.toml"),
+		RoutingPath:         filepath.Join(a.PolicyDir, "routing.toml"),
+		SuppressionPath:     filepath.Join(a.PolicyDir, "suppression.toml"),
+		CustomLuaPath:       filepath.Join(a.PolicyDir, "custom.lua"),
+		InitLuaPath:         filepath.Join(a.PolicyDir, "init.lua"),
 	}
-	if err := applyFile(KumoListenerDomainsPath, listenerDomains); err != nil {
-		return nil, fmt.Errorf("failed to apply listener_domains.toml: %w", err)
+
+	// 2. Stage & Validate
+	// init.lua loads its data files by absolute path, so the staged copy
+	// is rewritten to point at the staging dir.
+	stagingParent := a.StagingDir
+	if stagingParent == "" {
+		stagingParent = filepath.Dir(a.PolicyDir)
 	}
-	if err := applyFile(KumoDKIMDataPath, dkimData); err != nil {
-		return nil, fmt.Errorf("failed to apply dkim_data.toml: %w", err)
+	staging, err := os.MkdirTemp(stagingParent, ".policy-staging-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging dir: %w", err)
 	}
-	// Apply Auth Config
-	if err := applyFile(KumoAuthPath, authData); err != nil {
-		return nil, fmt.Errorf("failed to apply auth.toml: %w", err)
+	defer os.RemoveAll(staging)
+	// kumod validates as its own user, not as us.
+	if err := os.Chmod(staging, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to prepare staging dir: %w", err)
 	}
-	// This heals init.lua if it's missing the new logic
-	if err := applyFile(KumoInitLuaPath, initLua); err != nil {
-		return nil, fmt.Errorf("failed to apply init.lua: %w", err)
+
+	for _, f := range files {
+		staged := strings.ReplaceAll(f.Content, KumoPolicyDir+"/", staging+"/")
+		if err := os.WriteFile(filepath.Join(staging, f.Name), []byte(staged), 0o644); err != nil {
+			return nil, fmt.Errorf("failed to stage %s: %w", f.Name, err)
+		}
 	}
 
-	res := &ApplyResult{
-		SourcesPath:         KumoSourcesPath,
-		QueuesPath:          KumoQueuesPath,
-		ListenerDomainsPath: KumoListenerDomainsPath,
-		DKIMDataPath:        KumoDKIMDataPath,
-		InitLuaPath:         KumoInitLuaPath,
-	}
-
-	// 4. Validate Configuration
-	// We use the real Kumo binary to verify the generated config is valid.
-	validateCmd := exec.Command(
-		KumoBinary,
-		"--policy", KumoInitLuaPath,
-		"--validate",
-		"--user", "kumod",
-	)
-	out, err := validateCmd.CombinedOutput()
-	res.ValidationLog = string(out)
-	
+	log, err := a.Validator.Validate(filepath.Join(staging, "init.lua"))
+	res.ValidationLog = log
 	if err != nil {
-		res.ValidationOK = false
-		// CRITICAL: Validation failed. We do NOT restart.
-		// The .bak files are available if the user needs to revert manually.
-		return res, fmt.Errorf("kumod validation failed (check logs): %w", err)
+		// CRITICAL: Validation failed. Nothing was written and we do NOT reload.
+		return res, err
 	}
 	res.ValidationOK = true
 
-	// 5. Restart Service
-	restartCmd := exec.Command("systemctl", "restart", "kumomta")
-	restartOut, restartErr := restartCmd.CombinedOutput()
-	res.RestartLog = string(restartOut)
-	if restartErr != nil {
-		res.RestartOK = false
-		return res, fmt.Errorf("failed to restart kumomta: %w", restartErr)
+	// Compared before the swap: the init handler only runs on startup
+	reloader := a.Reloader
+	if a.InitReloader != nil && initHandlerChanged(filepath.Join(a.PolicyDir, "init.lua"), files) {
+		reloader = a.InitReloader
+	}
+
+	// 3. Swap Files In (Self-Healing)
+	// Writes each file only if it's missing or different.
+	// If different, it creates a .bak backup first.
+	for _, f := range files {
+		if err := smartUpdateFile(filepath.Join(a.PolicyDir, f.Name), []byte(f.Content), 0o644); err != nil {
+			return res, fmt.Errorf("failed to apply %s: %w", f.Name, err)
+		}
+	}
+
+	// 4. Reload Service
+	log, err = reloader.Reload()
+	res.RestartLog = log
+	if err != nil {
+		return res, err
 	}
 	res.RestartOK = true
 
 	return res, nil
 }
 
+// initHandler returns the kumo.on('init', ...) block of an init.lua.
+func initHandler(lua string) (string, bool) {
+	start := strings.Index(lua, "kumo.on('init', function()")
+	if start < 0 {
+		return "", false
+	}
+	end := strings.Index(lua[start:], "\nend)\n")
+	if end < 0 {
+		return "", false
+	}
+	return lua[start : start+end], true
+}
+
+// initHandlerChanged reports whether applying files changes the init
+// handler of the live init.lua (or it can't tell).
+func initHandlerChanged(livePath string, files []KumoConfigFile) bool {
+	live, err := os.ReadFile(livePath)
+	if err != nil {
+		return true
+	}
+	for _, f := range files {
+		if f.Name != "init.lua" {
+			continue
+		}
+		old, ok1 := initHandler(string(live))
+		next, ok2 := initHandler(f.Content)
+		return !ok1 || !ok2 || old != next
+	}
+	return false
+}
+
+// readCurrentFiles returns what is on disk right now for each managed file
+// (missing files are left out of the map).
+func readCurrentFiles(files []KumoConfigFile) map[string]string {
+	current := make(map[string]string, len(files))
+	for _, f := range files {
+		data, err := os.ReadFile(f.Path)
+		if err == nil {
+			current[f.Name] = string(data)
+		}
+	}
+	return current
+}
+
 // smartUpdateFile implements the "Check, Backup, Write" logic
 func smartUpdateFile(path string, data []byte, perm os.FileMode) error {
 	// 1. Read existing file
@@ -0,0 +1,127 @@
+package core
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeValidator records the staged init.lua it was given.
+type fakeValidator struct {
+	err    error
+	staged string
+}
+
+func (v *fakeValidator) Validate(initLuaPath string) (string, error) {
+	data, _ := os.ReadFile(initLuaPath)
+	v.staged = string(data)
+	return "checked " + initLuaPath, v.err
+}
+
+func testFiles() []KumoConfigFile {
+	return []KumoConfigFile{
+		{Name: "queues.toml", Content: "[\"tenant:a.com__x\"]\n"},
+		{Name: "init.lua", Content: "kumo.toml_load('" + KumoQueuesPath + "')\n"},
+	}
+}
+
+func TestApplierApply(t *testing.T) {
+	dir := t.TempDir()
+	policyDir := filepath.Join(dir, "policy")
+	v := &fakeValidator{}
+	r := &NoopReloader{}
+	a := &Applier{PolicyDir: policyDir, StagingDir: dir, Validator: v, Reloader: r}
+
+	res, err := a.Apply(testFiles())
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !res.ValidationOK || !res.RestartOK || r.Calls != 1 {
+		t.Errorf("unexpected result %+v (reloads: %d)", res, r.Calls)
+	}
+
+	// The validator saw the staged copy pointing at the staging dir.
+	if strings.Contains(v.staged, KumoPolicyDir) || !strings.Contains(v.staged, "/.policy-staging-") {
+		t.Errorf("staged init.lua was not rewritten: %q", v.staged)
+	}
+
+	// The live copy keeps the real paths.
+	live, err := os.ReadFile(filepath.Join(policyDir, "init.lua"))
+	if err != nil || !strings.Contains(string(live), KumoQueuesPath) {
+		t.Errorf("unexpected live init.lua: %q (%v)", live, err)
+	}
+
+	// Staging dirs are cleaned up.
+	if m, _ := filepath.Glob(filepath.Join(dir, ".policy-staging-*")); len(m) != 0 {
+		t.Errorf("staging dir left behind: %v", m)
+	}
+}
+
+func TestApplierValidationFailure(t *testing.T) {
+	dir := t.TempDir()
+	policyDir := filepath.Join(dir, "policy")
+	v := &fakeValidator{err: errors.New("syntax error")}
+	r := &NoopReloader{}
+	a := &Applier{PolicyDir: policyDir, StagingDir: dir, Validator: v, Reloader: r}
+
+	res, err := a.Apply(testFiles())
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	if res.ValidationOK || r.Calls != 0 {
+		t.Errorf("reloaded after failed validation: %+v", res)
+	}
+	if _, err := os.Stat(filepath.Join(policyDir, "queues.toml")); !os.IsNotExist(err) {
+		t.Error("live files were written despite failed validation")
+	}
+}
+
+func TestApplierRestartsOnInitChange(t *testing.T) {
+	dir := t.TempDir()
+	reload, restart := &NoopReloader{}, &NoopReloader{}
+	a := &Applier{PolicyDir: filepath.Join(dir, "policy"), StagingDir: dir, Validator: &fakeValidator{}, Reloader: reload, InitReloader: restart}
+
+	initLua := func(listen, rest string) []KumoConfigFile {
+		return []KumoConfigFile{{Name: "init.lua", Content: "kumo.on('init', function()\n  kumo.start_esmtp_listener { listen = '" + listen + "' }\nend)\n\n" + rest}}
+	}
+	for i, step := range []struct {
+		files            []KumoConfigFile
+		reloads, restart int
+	}{
+		{initLua("0.0.0.0:25", "-- a\n"), 0, 1},  // nothing live yet
+		{initLua("0.0.0.0:25", "-- b\n"), 1, 1},  // only event handlers changed
+		{initLua("0.0.0.0:587", "-- b\n"), 1, 2}, // new listener needs a restart
+		{testFiles()[:1], 2, 2},                  // init.lua untouched
+	} {
+		if _, err := a.Apply(step.files); err != nil {
+			t.Fatal(err)
+		}
+		if reload.Calls != step.reloads || restart.Calls != step.restart {
+			t.Errorf("step %d: %d reloads, %d restarts", i, reload.Calls, restart.Calls)
+		}
+	}
+}
+
+func TestConfigEpochReloader(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Method + " " + r.URL.Path
+	}))
+	defer srv.Close()
+
+	if _, err := (ConfigEpochReloader{Endpoint: srv.URL}).Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got != "POST /api/admin/bump-config-epoch" {
+		t.Errorf("request = %q", got)
+	}
+
+	srv.Config.Handler = http.NotFoundHandler()
+	if _, err := (ConfigEpochReloader{Endpoint: srv.URL}).Reload(); err == nil {
+		t.Error("error status treated as success")
+	}
+}
@@ -0,0 +1,423 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+	"github.com/pulak-ranjan/kumomta-ui/internal/store"
+)
+
+// =======================
+// Asset store
+// =======================
+
+// AssetDir holds uploaded asset content, one file per SHA256 (next to
+// the database, see cmd/server).
+var AssetDir = "/var/lib/kumomta-ui/assets"
+
+const (
+	MaxAssetSize        = 10 << 20 // per file
+	MaxMessageAssetSize = 20 << 20 // attachments + inline images of one message
+)
+
+// ErrAssetRejected is returned for uploads that are empty, too large or
+// of a type that may not be sent.
+var ErrAssetRejected = errors.New("asset rejected")
+
+// SaveAsset stores an uploaded file. The content type is sniffed from
+// the data, not taken from the client: only images, PDF, plain text,
+// CSV, calendar invites, ZIP and Office documents are accepted, so no
+// HTML, scripts or executables go out as attachments.
+func SaveAsset(st *store.Store, name string, r io.Reader) (*models.Asset, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxAssetSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: empty file", ErrAssetRejected)
+	}
+	if len(data) > MaxAssetSize {
+		return nil, fmt.Errorf("%w: larger than %d MB", ErrAssetRejected, MaxAssetSize>>20)
+	}
+
+	name = headerSafe(filepath.Base(strings.ReplaceAll(name, "\\", "/")))
+	if name == "" || name == "." || name == "/" {
+		name = "attachment"
+	}
+	contentType, err := assetContentType(name, data)
+	if err != nil {
+		return nil, err
+	}
+	name = assetFileName(name, contentType)
+
+	sum := sha256.Sum256(data)
+	asset := models.Asset{Name: name, ContentType: contentType, Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])}
+	if err := writeAssetFile(asset.SHA256, data); err != nil {
+		return nil, err
+	}
+	if err := st.DB.Create(&asset).Error; err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+// assetContentType sniffs data; the extension only picks between types
+// that look the same (CSV vs. plain text, DOCX vs. ZIP).
+func assetContentType(name string, data []byte) (string, error) {
+	sniffed := http.DetectContentType(data)
+	ext := strings.ToLower(filepath.Ext(name))
+
+	switch base, _, _ := strings.Cut(sniffed, ";"); base {
+	case "image/png", "image/jpeg", "image/gif", "image/webp", "application/pdf":
+		return base, nil
+	case "text/plain":
+		switch ext {
+		case ".csv":
+			return "text/csv; charset=utf-8", nil
+		case ".ics":
+			return "text/calendar; charset=utf-8", nil
+		}
+		return "text/plain; charset=utf-8", nil
+	case "application/zip":
+		switch ext {
+		case ".docx":
+			return "application/vnd.openxmlformats-officedocument.wordprocessingml.document", nil
+		case ".xlsx":
+			return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", nil
+		case ".pptx":
+			return "application/vnd.openxmlformats-officedocument.presentationml.presentation", nil
+		}
+		return "application/zip", nil
+	}
+	return "", fmt.Errorf("%w: file type %s is not allowed", ErrAssetRejected, sniffed)
+}
+
+// assetExtensions lists the file extensions allowed per content type; the
+// first one is used when the uploaded name doesn't match.
+var assetExtensions = map[string][]string{
+	"image/png":                    {".png"},
+	"image/jpeg":                   {".jpg", ".jpeg"},
+	"image/gif":                    {".gif"},
+	"image/webp":                   {".webp"},
+	"application/pdf":              {".pdf"},
+	"text/plain; charset=utf-8":    {".txt"},
+	"text/csv; charset=utf-8":      {".csv"},
+	"text/calendar; charset=utf-8": {".ics"},
+	"application/zip":              {".zip"},
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   {".docx"},
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         {".xlsx"},
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": {".pptx"},
+}
+
+// assetFileName makes the extension of name match contentType, so a
+// recipient's mail client never opens e.g. a text file as "invoice.exe".
+func assetFileName(name, contentType string) string {
+	exts := assetExtensions[contentType]
+	if len(exts) == 0 {
+		return name
+	}
+	ext := filepath.Ext(name)
+	for _, allowed := range exts {
+		if strings.EqualFold(ext, allowed) {
+			return name
+		}
+	}
+	return strings.TrimSuffix(name, ext) + exts[0]
+}
+
+func assetPath(sha string) string {
+	return filepath.Join(AssetDir, sha)
+}
+
+// writeAssetFile stores data under its hash (once: identical uploads
+// share the file).
+func writeAssetFile(sha string, data []byte) error {
+	if err := os.MkdirAll(AssetDir, 0700); err != nil {
+		return err
+	}
+	if _, err := os.Stat(assetPath(sha)); err == nil {
+		return nil
+	}
+	tmp, err := os.CreateTemp(AssetDir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), assetPath(sha))
+}
+
+// ReadAsset returns an asset's content.
+func ReadAsset(a models.Asset) ([]byte, error) {
+	return os.ReadFile(assetPath(a.SHA256))
+}
+
+// DeleteAsset removes the asset, and its file unless another asset has
+// the same content.
+func DeleteAsset(st *store.Store, a models.Asset) error {
+	if err := st.DB.Delete(&a).Error; err != nil {
+		return err
+	}
+	var n int64
+	if err := st.DB.Model(&models.Asset{}).Where("sha256 = ?", a.SHA256).Count(&n).Error; err != nil {
+		return err
+	}
+	if n == 0 {
+		if err := os.Remove(assetPath(a.SHA256)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// =======================
+// Attachments and inline images
+// =======================
+
+// inlineAssetRe matches inline image references: <img src="cid:asset-12">.
+var inlineAssetRe = regexp.MustCompile(`cid:asset-(\d+)`)
+
+// assetContentID is the Content-ID of an inline asset.
+func assetContentID(id uint) string {
+	return fmt.Sprintf("asset-%d", id)
+}
+
+// ParseAssetIDs parses a comma separated list of Asset ids.
+func ParseAssetIDs(s string) ([]uint, error) {
+	return parseIDList(s, "asset")
+}
+
+// inlineAssetIDs returns the assets the HTML shows as cid: images.
+func inlineAssetIDs(bodies ...string) []uint {
+	var ids []uint
+	seen := map[uint]bool{}
+	for _, body := range bodies {
+		for _, m := range inlineAssetRe.FindAllStringSubmatch(body, -1) {
+			id, err := strconv.ParseUint(m[1], 10, 32)
+			if err != nil || id == 0 || seen[uint(id)] {
+				continue
+			}
+			seen[uint(id)] = true
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids
+}
+
+// ValidateMessageAssets normalizes a comma separated list of attachment
+// ids and checks the attachments and the inline images in bodies exist
+// and fit in one message.
+func ValidateMessageAssets(st *store.Store, attachmentIDs string, bodies ...string) (string, error) {
+	ids, err := ParseAssetIDs(attachmentIDs)
+	if err != nil {
+		return "", err
+	}
+	var attachments []models.Asset
+	if len(ids) > 0 {
+		if err := st.DB.Where("id IN ?", ids).Find(&attachments).Error; err != nil {
+			return "", err
+		}
+		if len(attachments) != len(ids) {
+			return "", fmt.Errorf("attachment_ids: unknown asset")
+		}
+	}
+
+	var inline []models.Asset
+	if inlineIDs := inlineAssetIDs(bodies...); len(inlineIDs) > 0 {
+		if err := st.DB.Where("id IN ?", inlineIDs).Find(&inline).Error; err != nil {
+			return "", err
+		}
+		if len(inline) != len(inlineIDs) {
+			return "", fmt.Errorf("body: cid:asset reference to an unknown asset")
+		}
+	}
+	var total int64
+	for _, a := range inline {
+		if !strings.HasPrefix(a.ContentType, "image/") {
+			return "", fmt.Errorf("body: asset %d is not an image and can't be shown inline", a.ID)
+		}
+		total += a.Size
+	}
+	for _, a := range attachments {
+		total += a.Size
+	}
+	if total > MaxMessageAssetSize {
+		return "", fmt.Errorf("attachments and inline images exceed %d MB", MaxMessageAssetSize>>20)
+	}
+	return joinIDList(ids), nil
+}
+
+// ValidateCampaignAssets normalizes AttachmentIDs and checks the assets
+// the campaign and its variants use.
+func ValidateCampaignAssets(st *store.Store, c *models.Campaign, variants []models.CampaignVariant) error {
+	bodies := []string{c.Body}
+	for _, v := range variants {
+		bodies = append(bodies, v.Body)
+	}
+	ids, err := ValidateMessageAssets(st, c.AttachmentIDs, bodies...)
+	if err != nil {
+		return err
+	}
+	c.AttachmentIDs = ids
+	return nil
+}
+
+// messageAssets are the attachments and inline images for a message
+// template, loaded once and shared by every message built from it.
+type messageAssets struct {
+	attachments []MailAttachment
+	inline      map[uint]MailAttachment
+}
+
+// loadMessageAssets reads the attachments and the inline images the
+// bodies refer to.
+func loadMessageAssets(st *store.Store, attachmentIDs []uint, bodies ...string) (*messageAssets, error) {
+	ma := &messageAssets{inline: map[uint]MailAttachment{}}
+	for _, id := range attachmentIDs {
+		a, err := loadMailAttachment(st, id, false)
+		if err != nil {
+			return nil, err
+		}
+		ma.attachments = append(ma.attachments, a)
+	}
+	for _, id := range inlineAssetIDs(bodies...) {
+		a, err := loadMailAttachment(st, id, true)
+		if err != nil {
+			return nil, err
+		}
+		ma.inline[id] = a
+	}
+
+	var total int
+	for _, a := range ma.attachments {
+		total += len(a.Data)
+	}
+	for _, a := range ma.inline {
+		total += len(a.Data)
+	}
+	if total > MaxMessageAssetSize {
+		return nil, fmt.Errorf("attachments and inline images exceed %d MB", MaxMessageAssetSize>>20)
+	}
+	return ma, nil
+}
+
+func loadMailAttachment(st *store.Store, id uint, inline bool) (MailAttachment, error) {
+	var a models.Asset
+	if err := st.DB.First(&a, id).Error; err != nil {
+		return MailAttachment{}, fmt.Errorf("asset %d: %v", id, err)
+	}
+	data, err := ReadAsset(a)
+	if err != nil {
+		return MailAttachment{}, fmt.Errorf("asset %d: %v", id, err)
+	}
+	att := MailAttachment{Filename: assetFileName(a.Name, a.ContentType), ContentType: a.ContentType, Data: data}
+	if inline {
+		att.ContentID = assetContentID(a.ID)
+	}
+	return att, nil
+}
+
+// forBody returns the attachments plus the inline images html shows.
+func (ma *messageAssets) forBody(html string) []MailAttachment {
+	if ma == nil {
+		return nil
+	}
+	out := append([]MailAttachment(nil), ma.attachments...)
+	for _, id := range inlineAssetIDs(html) {
+		if a, ok := ma.inline[id]; ok {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// stepAttachmentIDs reads an automation step's "attachment_ids", given
+// as "1,2" or [1, 2].
+func stepAttachmentIDs(step map[string]interface{}) ([]uint, error) {
+	switch v := step["attachment_ids"].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return ParseAssetIDs(v)
+	case []interface{}:
+		var ids []uint
+		for _, x := range v {
+			f, ok := x.(float64)
+			if !ok || f < 1 || f != float64(uint32(f)) {
+				return nil, fmt.Errorf("invalid asset id %v", x)
+			}
+			ids = append(ids, uint(f))
+		}
+		return ids, nil
+	}
+	return nil, fmt.Errorf("attachment_ids must be a list of asset ids")
+}
+
+// AssetInUse returns an unfinished campaign or an automation workflow
+// that still sends the asset (0, 0 if none). Such assets can't be
+// deleted.
+func AssetInUse(st *store.Store, id uint) (campaignID, workflowID uint, err error) {
+	var campaigns []models.Campaign
+	err = st.DB.Select("id", "attachment_ids", "body").
+		Where("status IN ?", []string{CampaignDraft, CampaignScheduled, CampaignSending, CampaignPaused}).
+		Preload("Variants").
+		Find(&campaigns).Error
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, c := range campaigns {
+		ids, _ := ParseAssetIDs(c.AttachmentIDs)
+		bodies := []string{c.Body}
+		for _, v := range c.Variants {
+			bodies = append(bodies, v.Body)
+		}
+		if containsID(append(ids, inlineAssetIDs(bodies...)...), id) {
+			return c.ID, 0, nil
+		}
+	}
+
+	var workflows []models.AutomationWorkflow
+	if err := st.DB.Select("id", "steps_json").Find(&workflows).Error; err != nil {
+		return 0, 0, err
+	}
+	for _, wf := range workflows {
+		var steps []map[string]interface{}
+		if json.Unmarshal([]byte(wf.StepsJSON), &steps) != nil {
+			continue
+		}
+		for _, step := range steps {
+			ids, _ := stepAttachmentIDs(step)
+			body, _ := step["body"].(string)
+			if containsID(append(ids, inlineAssetIDs(body)...), id) {
+				return 0, wf.ID, nil
+			}
+		}
+	}
+	return 0, 0, nil
+}
+
+func containsID(ids []uint, id uint) bool {
+	for _, x := range ids {
+		if x == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+)
+
+var testPNG = append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 64)...)
+
+func TestSaveAsset(t *testing.T) {
+	defer func(dir string) { AssetDir = dir }(AssetDir)
+	AssetDir = t.TempDir()
+	st := newCampaignTestService(t).Store
+
+	for _, tc := range []struct {
+		name, data, want, wantName string
+	}{
+		{"../../etc/logo.png", string(testPNG), "image/png", "logo.png"},
+		{"report.pdf", "%PDF-1.7\n...", "application/pdf", "report.pdf"},
+		{"guests.csv", "email,name\nann@example.com,Ann\n", "text/csv; charset=utf-8", "guests.csv"},
+		{"offer.docx", "PK\x03\x04 word/document.xml", "application/vnd.openxmlformats-officedocument.wordprocessingml.document", "offer.docx"},
+		{"Photo.JPEG", "\xff\xd8\xff\xe0\x00\x10JFIF", "image/jpeg", "Photo.JPEG"},
+		// The content decides, not the extension, and the name follows it
+		{"invoice.pdf", "plain text", "text/plain; charset=utf-8", "invoice.txt"},
+		{"invoice.exe", "plain text", "text/plain; charset=utf-8", "invoice.txt"},
+		{"setup.bat", string(testPNG) + "x", "image/png", "setup.png"},
+		{"bundle.js.zip", "PK\x03\x04 stuff", "application/zip", "bundle.js.zip"},
+		{"notes", "plain text", "text/plain; charset=utf-8", "notes.txt"},
+	} {
+		a, err := SaveAsset(st, tc.name, strings.NewReader(tc.data))
+		if err != nil || a.ContentType != tc.want || a.Name != tc.wantName {
+			t.Errorf("%s: %+v, %v", tc.name, a, err)
+		}
+	}
+
+	for name, data := range map[string]string{
+		"page.pdf":   "<!DOCTYPE html><html><script>alert(1)</script></html>",
+		"setup.png":  "MZ\x90\x00\x03\x00\x00\x00\x04\x00",
+		"tool.txt":   "\x7fELF\x02\x01\x01\x00",
+		"empty.txt":  "",
+		"large.csv":  strings.Repeat("a", MaxAssetSize+1),
+		"vector.svg": `<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"><script/></svg>`,
+	} {
+		if _, err := SaveAsset(st, name, strings.NewReader(data)); !errors.Is(err, ErrAssetRejected) {
+			t.Errorf("%s: err = %v", name, err)
+		}
+	}
+
+	var logo models.Asset
+	st.DB.Where("name = ?", "logo.png").First(&logo)
+	if logo.Name != "logo.png" || logo.Size != int64(len(testPNG)) {
+		t.Errorf("logo = %+v", logo)
+	}
+
+	// Identical uploads share the file until the last one is deleted
+	dup, err := SaveAsset(st, "copy.png", bytes.NewReader(testPNG))
+	if err != nil || dup.SHA256 != logo.SHA256 {
+		t.Fatalf("copy = %+v, %v", dup, err)
+	}
+	if err := DeleteAsset(st, logo); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ReadAsset(*dup); err != nil || !bytes.Equal(data, testPNG) {
+		t.Fatalf("copy after deleting the original: %v", err)
+	}
+	if err := DeleteAsset(st, *dup); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(assetPath(dup.SHA256)); !os.IsNotExist(err) {
+		t.Errorf("file left behind: %v", err)
+	}
+}
+
+func TestMessageAssets(t *testing.T) {
+	defer func(dir string) { AssetDir = dir }(AssetDir)
+	AssetDir = t.TempDir()
+	st := newCampaignTestService(t).Store
+
+	logo, _ := SaveAsset(st, "logo.png", bytes.NewReader(testPNG))
+	pdf, _ := SaveAsset(st, "terms.pdf", strings.NewReader("%PDF-1.4 terms"))
+
+	c := models.Campaign{Body: `<img src="cid:asset-1">`, AttachmentIDs: " 2, 2 "}
+	variants := []models.CampaignVariant{{Body: `<img src="cid:asset-1"><img src="cid:asset-1">`}}
+	if err := ValidateCampaignAssets(st, &c, variants); err != nil || c.AttachmentIDs != "2" {
+		t.Fatalf("assets %q: %v", c.AttachmentIDs, err)
+	}
+	for _, bad := range []models.Campaign{
+		{AttachmentIDs: "2,9"},
+		{AttachmentIDs: "two"},
+		{Body: `<img src="cid:asset-9">`},
+		{Body: `<img src="cid:asset-2">`}, // a PDF can't be shown inline
+	} {
+		bad := bad
+		if err := ValidateCampaignAssets(st, &bad, nil); err == nil {
+			t.Errorf("%+v accepted", bad)
+		}
+	}
+
+	ma, err := loadMessageAssets(st, []uint{pdf.ID}, c.Body, variants[0].Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ma.forBody(`<img src="cid:asset-1">`); len(got) != 2 || got[0].Filename != "terms.pdf" || got[1].ContentID != "asset-1" ||
+		!bytes.Equal(got[1].Data, testPNG) {
+		t.Errorf("attachments = %+v", got)
+	}
+	if got := ma.forBody("<p>no images</p>"); len(got) != 1 {
+		t.Errorf("without inline images = %+v", got)
+	}
+
+	// Assets in use by an unfinished campaign or a workflow can't go
+	st.DB.Create(&models.Campaign{Name: "news", Status: CampaignScheduled, Body: c.Body})
+	if id, _, _ := AssetInUse(st, logo.ID); id == 0 {
+		t.Error("inline image of a scheduled campaign not in use")
+	}
+	st.DB.Create(&models.AutomationWorkflow{Name: "welcome", StepsJSON: `[{"type":"send_email","attachment_ids":[2]}]`})
+	if _, wf, _ := AssetInUse(st, pdf.ID); wf == 0 {
+		t.Error("workflow attachment not in use")
+	}
+}
+
+func TestStepAttachmentIDs(t *testing.T) {
+	for _, tc := range []struct {
+		step map[string]interface{}
+		want string
+	}{
+		{map[string]interface{}{}, ""},
+		{map[string]interface{}{"attachment_ids": "3, 4"}, "3,4"},
+		{map[string]interface{}{"attachment_ids": []interface{}{3.0, 4.0}}, "3,4"},
+	} {
+		ids, err := stepAttachmentIDs(tc.step)
+		if err != nil || joinIDList(ids) != tc.want {
+			t.Errorf("%v = %v, %v", tc.step, ids, err)
+		}
+	}
+	for _, bad := range []interface{}{[]interface{}{-1.0}, []interface{}{"3"}, []interface{}{2.5}, 7.0} {
+		if _, err := stepAttachmentIDs(map[string]interface{}{"attachment_ids": bad}); err == nil {
+			t.Errorf("%v accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,457 @@
+package core
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+	"github.com/pulak-ranjan/kumomta-ui/internal/store"
+)
+
+// Campaign audiences: a campaign names contact lists and/or a saved
+// segment; when it starts, the matching contacts become its recipients
+// (linked by ContactID, so opens and clicks score the contact).
+
+// SegmentFilter is one attribute condition of a segment. Key is a merge
+// field (first_name, a custom attribute, ...), compared case-insensitively.
+type SegmentFilter struct {
+	Key   string `json:"key"`
+	Op    string `json:"op"` // eq, neq, contains, exists, not_exists
+	Value string `json:"value,omitempty"`
+}
+
+const maxSegmentOpenedDays = 3650
+
+// ValidateSegment normalizes and checks a segment before it is saved.
+func ValidateSegment(s *models.Segment) error {
+	s.Name = strings.TrimSpace(s.Name)
+	if s.Name == "" || len(s.Name) > 200 {
+		return fmt.Errorf("name is required (max 200 characters)")
+	}
+	if s.OpenedWithinDays < 0 || s.OpenedWithinDays > maxSegmentOpenedDays {
+		return fmt.Errorf("opened_within_days must be between 0 (any) and %d", maxSegmentOpenedDays)
+	}
+	filters, err := parseSegmentFilters(s.AttributeFilters)
+	if err != nil {
+		return err
+	}
+	if len(filters) == 0 {
+		s.AttributeFilters = ""
+		return nil
+	}
+	b, _ := json.Marshal(filters)
+	s.AttributeFilters = string(b)
+	return nil
+}
+
+func parseSegmentFilters(raw string) ([]SegmentFilter, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var filters []SegmentFilter
+	if err := json.Unmarshal([]byte(raw), &filters); err != nil {
+		return nil, fmt.Errorf("attribute_filters must be a JSON array of {key, op, value}")
+	}
+	for i := range filters {
+		f := &filters[i]
+		f.Key = strings.ToLower(strings.TrimSpace(f.Key))
+		f.Op = strings.ToLower(strings.TrimSpace(f.Op))
+		if f.Key == "" {
+			return nil, fmt.Errorf("attribute filter %d: key is required", i+1)
+		}
+		switch f.Op {
+		case "", "eq":
+			f.Op = "eq"
+		case "neq", "contains", "exists", "not_exists":
+		default:
+			return nil, fmt.Errorf("attribute filter %d: op must be eq, neq, contains, exists or not_exists", i+1)
+		}
+		if f.Op == "exists" || f.Op == "not_exists" {
+			f.Value = ""
+		}
+	}
+	return filters, nil
+}
+
+// matchesFilters reports whether a contact meets every attribute filter.
+func matchesFilters(filters []SegmentFilter, c *models.Contact) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	data := RecipientMergeData(c.Email, c)
+	for _, f := range filters {
+		v := strings.TrimSpace(data[f.Key])
+		switch f.Op {
+		case "eq":
+			if !strings.EqualFold(v, f.Value) {
+				return false
+			}
+		case "neq":
+			if strings.EqualFold(v, f.Value) {
+				return false
+			}
+		case "contains":
+			if !strings.Contains(strings.ToLower(v), strings.ToLower(f.Value)) {
+				return false
+			}
+		case "exists":
+			if v == "" {
+				return false
+			}
+		case "not_exists":
+			if v != "" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ParseListIDs parses a comma separated list of ContactList ids.
+func ParseListIDs(s string) ([]uint, error) {
+	return parseIDList(s, "list")
+}
+
+// parseIDList parses comma separated ids, dropping duplicates.
+func parseIDList(s, what string) ([]uint, error) {
+	var ids []uint
+	seen := map[uint]bool{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || id == 0 {
+			return nil, fmt.Errorf("invalid %s id %q", what, part)
+		}
+		if !seen[uint(id)] {
+			seen[uint(id)] = true
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids, nil
+}
+
+// joinIDList is the inverse of parseIDList.
+func joinIDList(ids []uint) string {
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return strings.Join(strs, ",")
+}
+
+// ValidateCampaignAudience normalizes ListIDs and checks that the lists
+// and the segment exist.
+func ValidateCampaignAudience(st *store.Store, c *models.Campaign) error {
+	ids, err := ParseListIDs(c.ListIDs)
+	if err != nil {
+		return err
+	}
+	if len(ids) > 0 {
+		var n int64
+		if err := st.DB.Model(&models.ContactList{}).Where("id IN ?", ids).Count(&n).Error; err != nil {
+			return err
+		}
+		if int(n) != len(ids) {
+			return fmt.Errorf("list_ids: unknown contact list")
+		}
+	}
+	c.ListIDs = joinIDList(ids)
+
+	if c.SegmentID != 0 {
+		if err := st.DB.Select("id").First(&models.Segment{}, c.SegmentID).Error; err != nil {
+			return fmt.Errorf("segment_id: unknown segment")
+		}
+	}
+	return nil
+}
+
+// AudienceContacts returns the contacts in the given lists (any list if
+// none) that match seg (everyone if nil), one per email address. Invalid
+// addresses and unsubscribed contacts are left out.
+func AudienceContacts(st *store.Store, listIDs []uint, seg *models.Segment) ([]models.Contact, error) {
+	q := st.DB.Where("unsubscribed_at IS NULL")
+	if len(listIDs) > 0 {
+		q = q.Where("list_id IN ?", listIDs)
+	}
+	var filters []SegmentFilter
+	if seg != nil {
+		if seg.ValidOnly {
+			q = q.Where("is_valid = ?", true)
+		}
+		if seg.MinScore != nil {
+			q = q.Where("score > ?", *seg.MinScore)
+		}
+		if seg.OpenedWithinDays > 0 {
+			q = q.Where("last_opened_at >= ?", time.Now().AddDate(0, 0, -seg.OpenedWithinDays))
+		}
+		var err error
+		if filters, err = parseSegmentFilters(seg.AttributeFilters); err != nil {
+			return nil, err
+		}
+	}
+
+	var out []models.Contact
+	seen := map[string]bool{}
+	var batch []models.Contact
+	err := q.Order("id").FindInBatches(&batch, 1000, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			c := batch[i]
+			email := strings.ToLower(strings.TrimSpace(c.Email))
+			if seen[email] {
+				continue
+			}
+			if addr, err := mail.ParseAddress(c.Email); err != nil || addr.Address != strings.TrimSpace(c.Email) {
+				continue
+			}
+			if !matchesFilters(filters, &c) {
+				continue
+			}
+			seen[email] = true
+			out = append(out, c)
+		}
+		return nil
+	}).Error
+	return out, err
+}
+
+// CampaignAudience resolves the contacts a campaign targets (none when it
+// has no lists or segment).
+func CampaignAudience(st *store.Store, c *models.Campaign) ([]models.Contact, error) {
+	if c.ListIDs == "" && c.SegmentID == 0 {
+		return nil, nil
+	}
+	listIDs, err := ParseListIDs(c.ListIDs)
+	if err != nil {
+		return nil, err
+	}
+	var seg *models.Segment
+	if c.SegmentID != 0 {
+		seg = &models.Segment{}
+		if err := st.DB.First(seg, c.SegmentID).Error; err != nil {
+			return nil, fmt.Errorf("segment %d: %w", c.SegmentID, err)
+		}
+	}
+	return AudienceContacts(st, listIDs, seg)
+}
+
+// materializeAudience adds the campaign's audience as pending recipients,
+// once, when it starts. Addresses already on the campaign (e.g. from a CSV
+// import) and suppressed ones are skipped.
+func (cs *CampaignService) materializeAudience(c *models.Campaign) error {
+	if c.ListIDs == "" && c.SegmentID == 0 {
+		return nil
+	}
+	contacts, err := CampaignAudience(cs.Store, c)
+	if err != nil {
+		return err
+	}
+
+	var existing []string
+	if err := cs.Store.DB.Model(&models.CampaignRecipient{}).Where("campaign_id = ?", c.ID).
+		Pluck("LOWER(email)", &existing).Error; err != nil {
+		return err
+	}
+	skip := make(map[string]bool, len(existing))
+	for _, e := range existing {
+		skip[e] = true
+	}
+
+	var recipients []models.CampaignRecipient
+	suppressed := 0
+	for start := 0; start < len(contacts); start += 500 {
+		end := start + 500
+		if end > len(contacts) {
+			end = len(contacts)
+		}
+		emails := make([]string, 0, end-start)
+		for _, ct := range contacts[start:end] {
+			emails = append(emails, ct.Email)
+		}
+		reasons, err := cs.Store.SuppressedRecipients(emails, time.Now())
+		if err != nil {
+			return err
+		}
+		for _, ct := range contacts[start:end] {
+			key := strings.ToLower(strings.TrimSpace(ct.Email))
+			if skip[key] {
+				continue
+			}
+			if _, ok := reasons[key]; ok {
+				suppressed++
+				continue
+			}
+			recipients = append(recipients, models.CampaignRecipient{
+				CampaignID: c.ID,
+				Email:      strings.TrimSpace(ct.Email),
+				ContactID:  ct.ID,
+				Status:     "pending",
+			})
+		}
+	}
+
+	now := time.Now()
+	err = cs.Store.DB.Transaction(func(tx *gorm.DB) error {
+		if len(recipients) > 0 {
+			if err := tx.CreateInBatches(&recipients, 500).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(c).Update("recipients_resolved_at", now).Error
+	})
+	if err != nil {
+		return err
+	}
+	c.RecipientsResolvedAt = &now
+	log.Printf("Campaign %d: added %d recipients from its audience (%d suppressed, %d already on the campaign)",
+		c.ID, len(recipients), suppressed, len(contacts)-len(recipients)-suppressed)
+	return nil
+}
+
+// =======================
+// Contact import
+// =======================
+
+// ImportContactsCSV adds contacts to a list from a CSV file with a header
+// row. The "email" column is required; first_name, last_name and timezone
+// (IANA name) fill those fields and any other column becomes a custom
+// attribute. A contact already
+// on the list (same email) is updated instead.
+func ImportContactsCSV(st *store.Store, listID uint, r io.Reader) (added, updated int, err error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return 0, 0, fmt.Errorf("reading header: %w", err)
+	}
+	emailCol := -1
+	cols := make([]string, len(header))
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		h = strings.NewReplacer(" ", "_", "-", "_").Replace(h)
+		switch h {
+		case "email", "email_address", "e_mail":
+			h = "email"
+		case "firstname", "first":
+			h = "first_name"
+		case "lastname", "last", "surname":
+			h = "last_name"
+		case "tz", "time_zone":
+			h = "timezone"
+		}
+		if h == "email" && emailCol < 0 {
+			emailCol = i
+		}
+		cols[i] = h
+	}
+	if emailCol < 0 {
+		return 0, 0, fmt.Errorf("the CSV needs an \"email\" column")
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return added, updated, err
+		}
+		if emailCol >= len(record) {
+			continue
+		}
+		email := strings.TrimSpace(record[emailCol])
+		if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+			continue
+		}
+
+		var contact models.Contact
+		err = st.DB.Where("list_id = ? AND LOWER(email) = ?", listID, strings.ToLower(email)).First(&contact).Error
+		isNew := errors.Is(err, gorm.ErrRecordNotFound)
+		if err != nil && !isNew {
+			return added, updated, err
+		}
+
+		attrs := map[string]interface{}{}
+		if contact.Attributes != "" {
+			json.Unmarshal([]byte(contact.Attributes), &attrs)
+		}
+		for i, col := range cols {
+			if i >= len(record) || i == emailCol || col == "" {
+				continue
+			}
+			v := strings.TrimSpace(record[i])
+			switch col {
+			case "first_name":
+				contact.FirstName = v
+			case "last_name":
+				contact.LastName = v
+			case "timezone":
+				if _, err := time.LoadLocation(v); err == nil && v != "" && !strings.EqualFold(v, "local") {
+					contact.Timezone = v
+				}
+			default:
+				if v != "" {
+					attrs[col] = v
+				}
+			}
+		}
+		if len(attrs) > 0 {
+			b, _ := json.Marshal(attrs)
+			contact.Attributes = string(b)
+		}
+
+		contact.ListID, contact.Email = listID, email
+		if isNew {
+			err = st.DB.Create(&contact).Error
+			added++
+		} else {
+			err = st.DB.Save(&contact).Error
+			updated++
+		}
+		if err != nil {
+			return added, updated, err
+		}
+	}
+	return added, updated, nil
+}
+
+// AudienceInUse returns a campaign that will still resolve the list (or
+// segment) when it starts, or 0. Such lists and segments can't be deleted.
+func AudienceInUse(st *store.Store, listID, segmentID uint) (uint, error) {
+	var campaigns []models.Campaign
+	err := st.DB.Select("id", "list_ids", "segment_id").
+		Where("recipients_resolved_at IS NULL AND status IN ?", []string{CampaignDraft, CampaignScheduled, CampaignSending, CampaignPaused}).
+		Where("list_ids <> '' OR segment_id <> 0").
+		Find(&campaigns).Error
+	if err != nil {
+		return 0, err
+	}
+	for _, c := range campaigns {
+		if segmentID != 0 && c.SegmentID == segmentID {
+			return c.ID, nil
+		}
+		if listID != 0 {
+			ids, _ := ParseListIDs(c.ListIDs)
+			for _, id := range ids {
+				if id == listID {
+					return c.ID, nil
+				}
+			}
+		}
+	}
+	return 0, nil
+}
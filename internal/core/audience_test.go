@@ -0,0 +1,143 @@
+package core
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+)
+
+func TestImportContactsCSV(t *testing.T) {
+	cs := newCampaignTestService(t)
+	list := models.ContactList{Name: "customers"}
+	cs.Store.DB.Create(&list)
+
+	csv := "\ufeffE-mail,First Name,Surname,Company,Plan\n" +
+		"ann@example.com,Ann,Lee,Acme,pro\n" +
+		"not an address,X,Y,,\n" +
+		"bob@example.net,Bob,,,\n"
+	added, updated, err := ImportContactsCSV(cs.Store, list.ID, strings.NewReader(csv))
+	if err != nil || added != 2 || updated != 0 {
+		t.Fatalf("import: added %d, updated %d, %v", added, updated, err)
+	}
+
+	// Re-import updates and merges attributes
+	added, updated, err = ImportContactsCSV(cs.Store, list.ID, strings.NewReader("email,country\nANN@example.com,NZ\n"))
+	if err != nil || added != 0 || updated != 1 {
+		t.Fatalf("re-import: added %d, updated %d, %v", added, updated, err)
+	}
+	var ann models.Contact
+	cs.Store.DB.Where("list_id = ? AND first_name = ?", list.ID, "Ann").First(&ann)
+	data := RecipientMergeData(ann.Email, &ann)
+	if data["last_name"] != "Lee" || data["company"] != "Acme" || data["country"] != "NZ" {
+		t.Errorf("contact = %+v", ann)
+	}
+
+	if _, _, err := ImportContactsCSV(cs.Store, list.ID, strings.NewReader("name,phone\nAnn,1\n")); err == nil {
+		t.Error("CSV without an email column accepted")
+	}
+}
+
+func TestAudienceContacts(t *testing.T) {
+	cs := newCampaignTestService(t)
+	st := cs.Store
+	a, b := models.ContactList{Name: "a"}, models.ContactList{Name: "b"}
+	st.DB.Create(&a)
+	st.DB.Create(&b)
+
+	recent := time.Now().Add(-48 * time.Hour)
+	old := time.Now().AddDate(0, -3, 0)
+	gone := time.Now()
+	st.DB.Create(&[]models.Contact{
+		{ListID: a.ID, Email: "ann@example.com", IsValid: true, Score: 12, LastOpenedAt: &recent, Attributes: `{"Plan":"pro"}`},
+		{ListID: b.ID, Email: "ANN@example.com", IsValid: true, Score: 12, LastOpenedAt: &recent},
+		{ListID: a.ID, Email: "bob@example.com", IsValid: true, Score: 3, LastOpenedAt: &recent, Attributes: `{"plan":"free"}`},
+		{ListID: b.ID, Email: "cy@example.com", IsValid: false, Score: 40, LastOpenedAt: &recent, Attributes: `{"plan":"pro"}`},
+		{ListID: b.ID, Email: "di@example.com", IsValid: true, Score: 40, LastOpenedAt: &old, Attributes: `{"plan":"pro"}`},
+		{ListID: b.ID, Email: "ed@example.com", IsValid: true, Score: 40, UnsubscribedAt: &gone},
+	})
+
+	emails := func(contacts []models.Contact, err error) string {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, c := range contacts {
+			out = append(out, strings.ToLower(c.Email))
+		}
+		return strings.Join(out, ",")
+	}
+
+	if got := emails(AudienceContacts(st, []uint{a.ID, b.ID}, nil)); got != "ann@example.com,bob@example.com,cy@example.com,di@example.com" {
+		t.Errorf("both lists = %s", got)
+	}
+
+	minScore := 10
+	seg := models.Segment{Name: "engaged pros", ValidOnly: true, MinScore: &minScore, OpenedWithinDays: 30,
+		AttributeFilters: `[{"key":"plan","op":"eq","value":"PRO"}]`}
+	if err := ValidateSegment(&seg); err != nil {
+		t.Fatal(err)
+	}
+	if got := emails(AudienceContacts(st, nil, &seg)); got != "ann@example.com" {
+		t.Errorf("segment = %s", got)
+	}
+	seg = models.Segment{Name: "no plan", AttributeFilters: `[{"key":"plan","op":"not_exists"}]`}
+	if got := emails(AudienceContacts(st, []uint{b.ID}, &seg)); got != "ann@example.com" {
+		t.Errorf("not_exists within list b = %s", got)
+	}
+
+	for _, bad := range []string{`{"key":"plan"}`, `[{"key":"","op":"eq"}]`, `[{"key":"plan","op":"gt"}]`} {
+		if err := ValidateSegment(&models.Segment{Name: "x", AttributeFilters: bad}); err == nil {
+			t.Errorf("filters %s accepted", bad)
+		}
+	}
+}
+
+func TestMaterializeAudience(t *testing.T) {
+	cs := newCampaignTestService(t)
+	st := cs.Store
+	list := models.ContactList{Name: "news"}
+	st.DB.Create(&list)
+	st.DB.Create(&[]models.Contact{
+		{ListID: list.ID, Email: "ann@example.com"},
+		{ListID: list.ID, Email: "bob@example.com"},
+		{ListID: list.ID, Email: "cy@blocked.example"},
+	})
+	st.UpsertSuppression(&models.Suppression{Value: "blocked.example", Reason: ReasonManual})
+
+	c := models.Campaign{Name: "news", Status: CampaignDraft, ListIDs: " 1 ,1"}
+	if err := ValidateCampaignAudience(st, &c); err != nil || c.ListIDs != "1" {
+		t.Fatalf("audience %q: %v", c.ListIDs, err)
+	}
+	if err := ValidateCampaignAudience(st, &models.Campaign{ListIDs: "1,9"}); err == nil {
+		t.Error("unknown list accepted")
+	}
+	st.DB.Create(&c)
+	st.DB.Create(&models.CampaignRecipient{CampaignID: c.ID, Email: "BOB@example.com", Status: "pending"})
+
+	if err := cs.materializeAudience(&c); err != nil {
+		t.Fatal(err)
+	}
+	var recipients []models.CampaignRecipient
+	st.DB.Where("campaign_id = ?", c.ID).Order("id").Find(&recipients)
+	if len(recipients) != 2 || recipients[1].Email != "ann@example.com" || recipients[1].ContactID == 0 {
+		t.Errorf("recipients = %+v", recipients)
+	}
+	st.DB.First(&c, c.ID)
+	if c.RecipientsResolvedAt == nil {
+		t.Error("recipients_resolved_at not set")
+	}
+
+	// A clone resolves its audience again instead of copying it
+	clone, err := cs.CloneCampaign(c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int64
+	st.DB.Model(&models.CampaignRecipient{}).Where("campaign_id = ?", clone.ID).Count(&n)
+	if n != 1 || clone.ListIDs != "1" || clone.RecipientsResolvedAt != nil {
+		t.Errorf("clone = %+v with %d recipients", clone, n)
+	}
+}
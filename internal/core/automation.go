@@ -52,12 +52,17 @@ func (as *AutomationService) runWorkflow(wf models.AutomationWorkflow, contactID
 			body, _ := step["body"].(string)
 			senderIDFloat, _ := step["sender_id"].(float64)
 			senderID := uint(senderIDFloat)
+			attachmentIDs, err := stepAttachmentIDs(step)
+			if err != nil {
+				log.Printf("Automation %d: %v", wf.ID, err)
+				continue
+			}
 
 			// Resolve contact email
 			var contact models.Contact
 			if err := as.Store.DB.First(&contact, contactID).Error; err == nil {
 				cs := NewCampaignService(as.Store)
-				if err := cs.SendSingleEmail(contact.Email, subject, body, senderID); err != nil {
+				if err := cs.SendSingleEmail(contact.Email, subject, body, senderID, RecipientMergeData(contact.Email, &contact), attachmentIDs...); err != nil {
 					log.Printf("Auto: Failed to send email to %s: %v", contact.Email, err)
 				} else {
 					log.Printf("Auto: Sent email to %s", contact.Email)
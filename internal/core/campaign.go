@@ -10,8 +10,12 @@ import (
 	"net/url"
 	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"gorm.io/gorm"
+
 	"github.com/pulak-ranjan/kumomta-ui/internal/models"
 	"github.com/pulak-ranjan/kumomta-ui/internal/store"
 )
@@ -72,39 +76,24 @@ func (cs *CampaignService) ImportRecipientsFromCSV(campaignID uint, r io.Reader)
 
 // StartCampaign launches the sending process in a background goroutine
 func (cs *CampaignService) StartCampaign(campaignID uint) error {
-	var campaign models.Campaign
-	if err := cs.Store.DB.Preload("Sender").Preload("Sender.Domain").First(&campaign, campaignID).Error; err != nil {
+	if err := cs.transition(campaignID, "start", CampaignSending, nil); err != nil {
 		return err
 	}
-
-	if campaign.Status == "sending" || campaign.Status == "completed" {
-		return fmt.Errorf("campaign is already %s", campaign.Status)
-	}
-
-	// Update status
-	campaign.Status = "sending"
-	cs.Store.DB.Save(&campaign)
-
-	go cs.processCampaign(campaign)
-
-	return nil
+	return cs.launch(campaignID)
 }
 
 // ResumeInterruptedCampaigns finds campaigns stuck in "sending" and restarts them
 func (cs *CampaignService) ResumeInterruptedCampaigns() error {
 	var campaigns []models.Campaign
-	if err := cs.Store.DB.Where("status = 'sending'").Find(&campaigns).Error; err != nil {
+	if err := cs.Store.DB.Where("status = ?", CampaignSending).Find(&campaigns).Error; err != nil {
 		return err
 	}
 
 	for _, c := range campaigns {
-		// Re-load sender details
-		if err := cs.Store.DB.Preload("Sender").Preload("Sender.Domain").First(&c, c.ID).Error; err != nil {
+		log.Printf("Resuming campaign %d: %s", c.ID, c.Name)
+		if err := cs.launch(c.ID); err != nil {
 			log.Printf("Failed to reload campaign %d: %v", c.ID, err)
-			continue
 		}
-		log.Printf("Resuming campaign %d: %s", c.ID, c.Name)
-		go cs.processCampaign(c)
 	}
 	return nil
 }
@@ -114,159 +103,424 @@ func (cs *CampaignService) StartScheduledCampaigns() error {
 	var campaigns []models.Campaign
 	now := time.Now()
 
-	if err := cs.Store.DB.Where("status = 'scheduled' AND scheduled_at <= ?", now).Find(&campaigns).Error; err != nil {
+	if err := cs.Store.DB.Where("status = ? AND scheduled_at <= ?", CampaignScheduled, now).Find(&campaigns).Error; err != nil {
 		return err
 	}
 
 	for _, c := range campaigns {
 		// Atomic update to prevent double-send race conditions
-		result := cs.Store.DB.Model(&c).Where("status = 'scheduled'").Update("status", "sending")
+		result := cs.Store.DB.Model(&c).Where("status = ?", CampaignScheduled).Update("status", CampaignSending)
 		if result.RowsAffected == 0 {
 			continue // Already picked up by another worker?
 		}
 
-		// Reload full object with preload
-		if err := cs.Store.DB.Preload("Sender").Preload("Sender.Domain").First(&c, c.ID).Error; err != nil {
+		log.Printf("Starting scheduled campaign %d: %s", c.ID, c.Name)
+		if err := cs.launch(c.ID); err != nil {
 			log.Printf("Failed to load scheduled campaign %d: %v", c.ID, err)
-			continue
 		}
-
-		log.Printf("Starting scheduled campaign %d: %s", c.ID, c.Name)
-		go cs.processCampaign(c)
 	}
 	return nil
 }
 
+// processCampaign sends the pending recipients batch by batch. Within a
+// batch, a pool of workers shares a bounded set of SMTP connections and an
+// adaptive rate limit; results are written back by this goroutine only.
 func (cs *CampaignService) processCampaign(c models.Campaign) {
-	batchSize := 100
 	sender := c.Sender
-	addr := "127.0.0.1:25"
+	concurrency, targetRate := campaignSettings(c)
+	batchSize := concurrency * 25
+	if batchSize < 100 {
+		batchSize = 100
+	}
 
-	// Construct message common headers
-	safeSubject := strings.ReplaceAll(c.Subject, "\r", "")
-	safeSubject = strings.ReplaceAll(safeSubject, "\n", "")
-	baseHeaders := fmt.Sprintf("From: %s\r\nSubject: %s\r\nX-Campaign: %d\r\nX-Kumo-Ref: Bulk\r\nContent-Type: text/html; charset=UTF-8\r\n\r\n",
-		sender.Email, safeSubject, c.ID)
+	var variants []models.CampaignVariant
+	if err := cs.Store.DB.Where("campaign_id = ?", c.ID).Order("id").Find(&variants).Error; err != nil {
+		log.Printf("Campaign %d: failed to load variants: %v", c.ID, err)
+		cs.finishRun(c.ID, CampaignPaused)
+		return
+	}
+	abTest := len(variants) >= MinCampaignVariants && c.WinnerVariantID == 0
+
+	// Personalized per recipient. Templates are validated on save, but
+	// campaigns saved before that may still be broken.
+	templates, err := parseCampaignTemplates(c, variants)
+	if err != nil {
+		log.Printf("Campaign %d: invalid template: %v", c.ID, err)
+		cs.finishRun(c.ID, CampaignFailed)
+		return
+	}
+
+	// Attachments and inline images, read once for the whole run
+	attachmentIDs, err := ParseAssetIDs(c.AttachmentIDs)
+	if err != nil {
+		log.Printf("Campaign %d: invalid attachments: %v", c.ID, err)
+		cs.finishRun(c.ID, CampaignFailed)
+		return
+	}
+	bodies := []string{c.Body}
+	for _, v := range variants {
+		bodies = append(bodies, v.Body)
+	}
+	assets, err := loadMessageAssets(cs.Store, attachmentIDs, bodies...)
+	if err != nil {
+		log.Printf("Campaign %d: failed to load attachments: %v", c.ID, err)
+		cs.finishRun(c.ID, CampaignFailed)
+		return
+	}
+
+	campaignHeaders := map[string]string{
+		"X-Campaign": fmt.Sprint(c.ID),
+		"X-Kumo-Ref": "Bulk",
+	}
 
 	// Determine Base URL for tracking
+	settings, _ := cs.Store.GetSettings()
 	baseURL := "http://localhost:9000"
-	if settings, err := cs.Store.GetSettings(); err == nil && settings.MainHostname != "" {
+	if settings != nil && settings.MainHostname != "" {
 		protocol := "https"
 		if settings.MainHostname == "localhost" { protocol = "http" }
 		baseURL = fmt.Sprintf("%s://%s", protocol, settings.MainHostname)
 	}
 
-	// Persistent Connection
-	// We use DialTimeout to avoid hanging if local MTA is stuck
-	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	pool := newSMTPPool(InjectionAddr(settings), concurrency)
+	defer pool.close()
+
+	// Fail fast if the MTA isn't there at all
+	client, err := pool.get()
 	if err != nil {
 		log.Printf("Campaign %d: Failed to connect to SMTP: %v", c.ID, err)
-		c.Status = "failed"
-		cs.Store.DB.Save(&c)
+		cs.finishRun(c.ID, CampaignFailed)
 		return
 	}
+	pool.put(client, true)
 
-	client, err := smtp.NewClient(conn, "localhost")
+	pacer := newAdaptivePacer(targetRate)
+	meter := startCampaignMeter(c.ID, concurrency, pacer)
+	defer campaignMeters.Delete(c.ID)
+
+	// Lists and segments are resolved once, on the first run
+	if c.RecipientsResolvedAt == nil {
+		if err := cs.materializeAudience(&c); err != nil {
+			log.Printf("Campaign %d: failed to add its audience: %v", c.ID, err)
+			cs.finishRun(c.ID, CampaignPaused)
+			return
+		}
+	}
+
+	// Local send time / sending window: release times per recipient
+	schedule, err := campaignSchedule(c)
 	if err != nil {
-		conn.Close()
-		log.Printf("Campaign %d: SMTP Client handshake failed: %v", c.ID, err)
-		c.Status = "failed"
-		cs.Store.DB.Save(&c)
+		log.Printf("Campaign %d: invalid send schedule: %v", c.ID, err)
+		cs.finishRun(c.ID, CampaignFailed)
 		return
 	}
-	defer client.Quit()
+	if schedule != nil {
+		if err := cs.scheduleRecipients(&c, schedule); err != nil {
+			log.Printf("Campaign %d: failed to schedule recipients: %v", c.ID, err)
+			cs.finishRun(c.ID, CampaignPaused)
+			return
+		}
+	}
+
+	if abTest && c.ABStatus == "" {
+		if err := cs.startABTest(&c, variants); err != nil {
+			log.Printf("Campaign %d: failed to set up the A/B test: %v", c.ID, err)
+			cs.finishRun(c.ID, CampaignPaused)
+			return
+		}
+	}
 
 	for {
+		// Paused or cancelled from the API: stop before the next batch
+		if !cs.stillSending(c.ID) {
+			log.Printf("Campaign %d: no longer sending, stopping", c.ID)
+			return
+		}
+
+		if abTest && c.ABStatus == ABWaiting {
+			// Idle connections would go stale during the wait
+			pool.close()
+			if !cs.waitForABResult(&c) {
+				log.Printf("Campaign %d: no longer sending, stopping", c.ID)
+				return
+			}
+			if _, err := cs.decideABWinner(&c); err != nil {
+				log.Printf("Campaign %d: failed to pick the A/B winner: %v", c.ID, err)
+				cs.finishRun(c.ID, CampaignPaused)
+				return
+			}
+			abTest = false
+			continue
+		}
+
+		// While testing, only the test cell is sent
+		q := cs.Store.DB.Where("campaign_id = ? AND status = 'pending'", c.ID)
+		if abTest {
+			q = q.Where("variant_id <> 0")
+		}
+		// Held back by the send schedule or a deferral backoff
+		q = q.Where("not_before IS NULL OR not_before <= ?", time.Now())
 		var recipients []models.CampaignRecipient
-		if err := cs.Store.DB.Where("campaign_id = ? AND status = 'pending'", c.ID).Limit(batchSize).Find(&recipients).Error; err != nil {
+		if err := q.Order("id").Limit(batchSize).Find(&recipients).Error; err != nil {
 			log.Printf("DB Error fetching recipients: %v", err)
-			break
+			cs.finishRun(c.ID, CampaignPaused)
+			return
+		}
+		if schedule != nil && len(recipients) > 0 {
+			if recipients = cs.holdClosedWindow(schedule, recipients); len(recipients) == 0 {
+				continue
+			}
 		}
 
 		if len(recipients) == 0 {
+			// Nobody due yet: sleep until the next local send time or retry
+			if next, ok := cs.nextRelease(c.ID, abTest); ok {
+				pool.close()
+				if !cs.sleepUntil(c.ID, next) {
+					log.Printf("Campaign %d: no longer sending, stopping", c.ID)
+					return
+				}
+				continue
+			}
+			if abTest {
+				if err := cs.finishABTestCell(&c); err != nil {
+					log.Printf("Campaign %d: %v", c.ID, err)
+					cs.finishRun(c.ID, CampaignPaused)
+					return
+				}
+				continue
+			}
 			// No more pending recipients -> Completed
-			c.Status = "completed"
-			cs.Store.DB.Save(&c)
+			cs.finishRun(c.ID, CampaignCompleted)
 			return
 		}
 
-		for _, r := range recipients {
-			// Reconnection Logic
-			if err := client.Mail(sender.Email); err != nil {
-				log.Printf("SMTP Connection lost (%v). Reconnecting...", err)
-				client.Close()
-
-				conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
-				if err == nil {
-					client, err = smtp.NewClient(conn, "localhost")
-				}
+		// Skip suppressed recipients (checked per batch, so additions made
+		// while the campaign runs still apply)
+		emails := make([]string, len(recipients))
+		for i, r := range recipients {
+			emails[i] = r.Email
+		}
+		suppressed, err := cs.Store.SuppressedRecipients(emails, time.Now())
+		if err != nil {
+			log.Printf("Campaign %d: suppression lookup failed: %v", c.ID, err)
+			cs.finishRun(c.ID, CampaignPaused)
+			return
+		}
 
-				if err != nil {
-					log.Printf("Failed to reconnect: %v. Pausing campaign.", err)
-					c.Status = "paused" // Mark paused to be resumed manually or by scheduler
-					cs.Store.DB.Save(&c)
-					return
+		contacts, err := cs.recipientContacts(recipients)
+		if err != nil {
+			log.Printf("Campaign %d: contact lookup failed: %v", c.ID, err)
+			cs.finishRun(c.ID, CampaignPaused)
+			return
+		}
+
+		jobs := make(chan models.CampaignRecipient)
+		results := make(chan sendResult)
+		var aborting atomic.Bool
+		var wg sync.WaitGroup
+
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for r := range jobs {
+					if aborting.Load() {
+						results <- sendResult{Recipient: r, Outcome: sendSkipped}
+						continue
+					}
+
+					data := RecipientMergeData(r.Email, contacts[r.ContactID])
+					data["unsubscribe_url"] = UnsubscribeURL(baseURL, r.ID)
+
+					headers := ListUnsubscribeHeaders(baseURL, sender, r.ID)
+					for k, v := range campaignHeaders {
+						headers[k] = v
+					}
+
+					// Inject Tracking Pixel & Rewrite Links
+					trackingOpenURL := fmt.Sprintf("%s/api/track/open/%d", baseURL, r.ID)
+					pixel := fmt.Sprintf(`<img src="%s" alt="" width="1" height="1" style="display:none" />`, trackingOpenURL)
+					tmpl, ok := templates[r.VariantID]
+					if !ok {
+						tmpl = templates[0]
+					}
+					bodyFinal := rewriteLinks(tmpl.body.Render(data, true), baseURL, r.ID) + "\n" + pixel
+
+					msg, err := BuildMessage(OutboundMessage{
+						FromName:  sender.DisplayName,
+						FromEmail: sender.Email,
+						To:        r.Email,
+						Subject:   tmpl.subject.Render(data, false),
+						HTML:      bodyFinal,
+						MessageID: CampaignMessageID(c.ID, r.ID, sender.Email),
+						Headers:   headers,
+
+						Attachments: assets.forBody(bodyFinal),
+					})
+					if err != nil {
+						results <- sendResult{Recipient: r, Outcome: sendFailed, Err: err}
+						continue
+					}
+
+					pacer.Wait()
+					outcome, err := sendWithPool(pool, sender.Email, r.Email, msg)
+					if outcome == sendConnError {
+						aborting.Store(true)
+					}
+					results <- sendResult{Recipient: r, Outcome: outcome, Err: err}
 				}
-				// Retry MAIL command
-				if err := client.Mail(sender.Email); err != nil {
-					log.Printf("Reconnection failed: %v", err)
-					c.Status = "paused"
-					cs.Store.DB.Save(&c)
-					return
+			}()
+		}
+
+		go func() {
+			for _, r := range recipients {
+				if _, ok := suppressed[strings.ToLower(strings.TrimSpace(r.Email))]; ok {
+					continue
 				}
+				jobs <- r
 			}
+			close(jobs)
+			wg.Wait()
+			close(results)
+		}()
 
-			if err := client.Rcpt(r.Email); err != nil {
-				// Recipient rejected (e.g. invalid syntax, or server block)
-				// We fail this specific recipient but continue
-				r.Status = "failed"
-				r.Error = err.Error()
+		for _, r := range recipients {
+			if reason, ok := suppressed[strings.ToLower(strings.TrimSpace(r.Email))]; ok {
+				r.Status = "suppressed"
+				r.Error = "suppressed: " + reason
 				cs.Store.DB.Save(&r)
-				client.Reset()
-				continue
 			}
+		}
 
-			wc, err := client.Data()
-			if err != nil {
-				log.Printf("SMTP Data error: %v", err)
-				client.Reset()
+		var connErr error
+		failed := 0
+		variantSent := map[uint]int{}
+		for res := range results {
+			r := res.Recipient
+			meter.record(res.Outcome)
+			switch res.Outcome {
+			case sendOK:
+				r.Status = "sent"
+				r.Error = ""
+				r.SentAt = time.Now()
+				c.TotalSent++
+				if r.VariantID != 0 {
+					variantSent[r.VariantID]++
+				}
+				pacer.Success()
+			case sendFailed:
+				// Recipient rejected (e.g. invalid syntax, or server block)
+				r.Status = "failed"
+				r.Error = smtpErrorText(res.Err)
+				failed++
+			case sendDeferred:
+				// KumoMTA is pushing back: slow down, and retry this
+				// recipient after a growing delay
+				pacer.Slowdown()
+				r.Attempts++
+				r.Error = smtpErrorText(res.Err)
+				if r.Attempts >= maxRecipientAttempts {
+					r.Status = "failed"
+					failed++
+				} else {
+					retry := time.Now().Add(deferralBackoff(r.Attempts))
+					r.NotBefore = &retry
+				}
+			case sendConnError:
+				connErr = res.Err
+				continue
+			case sendSkipped:
 				continue
 			}
+			cs.Store.DB.Save(&r)
+		}
 
-			// Inject Tracking Pixel & Rewrite Links
-			trackingOpenURL := fmt.Sprintf("%s/api/track/open/%d", baseURL, r.ID)
-			pixel := fmt.Sprintf(`<img src="%s" alt="" width="1" height="1" style="display:none" />`, trackingOpenURL)
-
-			// Rewrite Links for Click Tracking
-			bodyWithLinks := rewriteLinks(c.Body, baseURL, r.ID)
-
-			bodyFinal := bodyWithLinks + "\n" + pixel
-
-			msg := fmt.Sprintf("To: %s\r\n%s%s", r.Email, baseHeaders, bodyFinal)
+		// Update stats after batch. total_failed is incremented in place:
+		// bounces of accepted messages are added to it concurrently (see
+		// IngestLogRecords).
+		cs.Store.DB.Model(&c).Updates(map[string]interface{}{
+			"total_sent":   c.TotalSent,
+			"total_failed": gorm.Expr("total_failed + ?", failed),
+		})
+		for id, n := range variantSent {
+			cs.Store.DB.Model(&models.CampaignVariant{}).Where("id = ?", id).
+				Update("sent", gorm.Expr("sent + ?", n))
+		}
 
-			if _, err = wc.Write([]byte(msg)); err != nil {
-				log.Printf("SMTP Write error: %v", err)
-			}
-			if err = wc.Close(); err != nil {
-				log.Printf("SMTP Close error: %v", err)
-			}
+		if connErr != nil {
+			log.Printf("Campaign %d: lost the SMTP connection (%v). Pausing campaign.", c.ID, connErr)
+			cs.finishRun(c.ID, CampaignPaused) // resumed via POST /api/campaigns/{id}/resume
+			return
+		}
+	}
+}
 
-			// Success
-			r.Status = "sent"
-			r.SentAt = time.Now()
-			cs.Store.DB.Save(&r)
+// messageTemplates is a parsed subject and body.
+type messageTemplates struct {
+	subject, body *Template
+}
 
-			c.TotalSent++
-			// Throttle
-			time.Sleep(10 * time.Millisecond)
+// parseCampaignTemplates parses the campaign's subject and body (key 0)
+// and those of its A/B variants, which default to the campaign's.
+func parseCampaignTemplates(c models.Campaign, variants []models.CampaignVariant) (map[uint]messageTemplates, error) {
+	out := map[uint]messageTemplates{}
+	parse := func(id uint, name, subject, body string) error {
+		var t messageTemplates
+		var err error
+		if t.subject, err = ParseTemplate(subject); err != nil {
+			return fmt.Errorf("%s subject: %v", name, err)
+		}
+		if t.body, err = ParseTemplate(body); err != nil {
+			return fmt.Errorf("%s body: %v", name, err)
 		}
+		out[id] = t
+		return nil
+	}
+	if err := parse(0, "campaign", c.Subject, c.Body); err != nil {
+		return nil, err
+	}
+	for _, v := range variants {
+		subject, body := v.Subject, v.Body
+		if subject == "" {
+			subject = c.Subject
+		}
+		if body == "" {
+			body = c.Body
+		}
+		if err := parse(v.ID, "variant "+v.Name, subject, body); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
 
-		// Update stats after batch
-		cs.Store.DB.Model(&c).Updates(map[string]interface{}{
-			"total_sent": c.TotalSent,
-			"total_failed": c.TotalFailed,
-		})
+// recipientContacts loads the contacts linked to a batch of recipients,
+// keyed by contact id.
+func (cs *CampaignService) recipientContacts(recipients []models.CampaignRecipient) (map[uint]*models.Contact, error) {
+	var ids []uint
+	for _, r := range recipients {
+		if r.ContactID != 0 {
+			ids = append(ids, r.ContactID)
+		}
+	}
+	out := map[uint]*models.Contact{}
+	if len(ids) == 0 {
+		return out, nil
+	}
+	var contacts []models.Contact
+	if err := cs.Store.DB.Where("id IN ?", ids).Find(&contacts).Error; err != nil {
+		return nil, err
 	}
+	for i := range contacts {
+		out[contacts[i].ID] = &contacts[i]
+	}
+	return out, nil
+}
+
+// headerSafe strips CR/LF so a merge field can't inject headers.
+func headerSafe(s string) string {
+	return strings.NewReplacer("\r", "", "\n", " ").Replace(s)
 }
 
 // rewriteLinks finds all href="..." and replaces them with tracking URLs
@@ -281,6 +535,11 @@ func rewriteLinks(html string, baseURL string, recipientID uint) string {
 		quote := match[5:6] // " or '
 		originalURL := match[6 : len(match)-1]
 
+		// The unsubscribe link goes straight to the panel
+		if strings.HasPrefix(originalURL, baseURL+"/api/unsubscribe/") {
+			return match
+		}
+
 		// Encode the original URL
 		encodedURL := url.QueryEscape(originalURL)
 
@@ -293,16 +552,49 @@ func rewriteLinks(html string, baseURL string, recipientID uint) string {
 	})
 }
 
-// SendSingleEmail sends a transactional email via local KumoMTA
-func (cs *CampaignService) SendSingleEmail(to string, subject string, body string, senderID uint) error {
+// SendSingleEmail sends a transactional email via local KumoMTA. Subject
+// and body are personalization templates rendered with data (nil: only
+// the recipient's email). attachmentIDs are Assets sent as attachments;
+// the body can show image assets inline as <img src="cid:asset-ID">.
+func (cs *CampaignService) SendSingleEmail(to string, subject string, body string, senderID uint, data MergeData, attachmentIDs ...uint) error {
 	var sender models.Sender
 	if err := cs.Store.DB.Preload("Domain").First(&sender, senderID).Error; err != nil {
 		return fmt.Errorf("sender not found: %v", err)
 	}
 
-	addr := "127.0.0.1:25"
+	if data == nil {
+		data = RecipientMergeData(to, nil)
+	}
+	subject, err := RenderTemplate(subject, data, false)
+	if err != nil {
+		return fmt.Errorf("subject: %v", err)
+	}
+	// Inline images come from the template, not from merged-in values
+	assets, err := loadMessageAssets(cs.Store, attachmentIDs, body)
+	if err != nil {
+		return err
+	}
+	body, err = RenderTemplate(body, data, true)
+	if err != nil {
+		return fmt.Errorf("body: %v", err)
+	}
+
+	msg, err := BuildMessage(OutboundMessage{
+		FromName:  sender.DisplayName,
+		FromEmail: sender.Email,
+		To:        to,
+		Subject:   subject,
+		HTML:      body,
+
+		Attachments: assets.forBody(body),
+	})
+	if err != nil {
+		return err
+	}
+
+	settings, _ := cs.Store.GetSettings()
 	// Use DialTimeout for robustness
-	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	conn, err := net.DialTimeout("tcp", InjectionAddr(settings), 5*time.Second)
 	if err != nil {
 		return err
 	}
@@ -314,18 +606,6 @@ func (cs *CampaignService) SendSingleEmail(to string, subject string, body strin
 	}
 	defer client.Quit()
 
-	if err := client.Mail(sender.Email); err != nil { return err }
-	if err := client.Rcpt(to); err != nil { return err }
-
-	wc, err := client.Data()
-	if err != nil { return err }
-
-	// Simple Headers
-	headers := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/html; charset=UTF-8\r\n\r\n",
-		sender.Email, to, subject)
-
-	msg := []byte(headers + body)
-
-	if _, err = wc.Write(msg); err != nil { return err }
-	return wc.Close()
+	_, err = deliver(client, sender.Email, to, msg)
+	return err
 }
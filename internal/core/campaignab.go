@@ -0,0 +1,198 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+)
+
+// A/B test phases (Campaign.ABStatus). The phase is stored, so a campaign
+// resumed after a restart continues where it was.
+const (
+	ABTesting = "testing" // sending the test cell
+	ABWaiting = "waiting" // test cell sent, collecting opens/clicks
+	ABDecided = "decided" // winner picked, sending it to the rest
+)
+
+// Winner metrics.
+const (
+	ABMetricOpens        = "opens"
+	ABMetricClicks       = "clicks"
+	ABMetricUniqueClicks = "unique_clicks"
+)
+
+const (
+	MinCampaignVariants = 2
+	MaxCampaignVariants = 5
+
+	defaultABWaitMinutes = 60
+	maxABWaitMinutes     = 7 * 24 * 60
+)
+
+// ValidateABTest normalizes the A/B settings of c for the given variants
+// (none = no test) and fills in defaults: metric opens, a 60 minute wait
+// and variant names A, B, ...
+func ValidateABTest(c *models.Campaign, variants []models.CampaignVariant) error {
+	if len(variants) == 0 {
+		if c.ABTestPercent != 0 {
+			return fmt.Errorf("ab_test_percent needs at least %d variants", MinCampaignVariants)
+		}
+		return nil
+	}
+	if len(variants) < MinCampaignVariants || len(variants) > MaxCampaignVariants {
+		return fmt.Errorf("an A/B test needs %d to %d variants", MinCampaignVariants, MaxCampaignVariants)
+	}
+	if c.ABTestPercent < 1 || c.ABTestPercent > 100 {
+		return fmt.Errorf("ab_test_percent must be between 1 and 100")
+	}
+
+	c.ABWinnerMetric = strings.ToLower(strings.TrimSpace(c.ABWinnerMetric))
+	switch c.ABWinnerMetric {
+	case "":
+		c.ABWinnerMetric = ABMetricOpens
+	case ABMetricOpens, ABMetricClicks, ABMetricUniqueClicks:
+	default:
+		return fmt.Errorf("ab_winner_metric must be opens, clicks or unique_clicks")
+	}
+	if c.ABWaitMinutes == 0 {
+		c.ABWaitMinutes = defaultABWaitMinutes
+	}
+	if c.ABWaitMinutes < 1 || c.ABWaitMinutes > maxABWaitMinutes {
+		return fmt.Errorf("ab_wait_minutes must be between 1 and %d", maxABWaitMinutes)
+	}
+
+	names := map[string]bool{}
+	for i := range variants {
+		v := &variants[i]
+		v.Name = strings.TrimSpace(v.Name)
+		if v.Name == "" {
+			v.Name = string(rune('A' + i))
+		}
+		if names[v.Name] {
+			return fmt.Errorf("duplicate variant name %q", v.Name)
+		}
+		names[v.Name] = true
+	}
+	return nil
+}
+
+// startABTest assigns the test cell: ABTestPercent of the pending
+// recipients, picked at random and dealt round-robin to the variants.
+func (cs *CampaignService) startABTest(c *models.Campaign, variants []models.CampaignVariant) error {
+	var pending int64
+	if err := cs.Store.DB.Model(&models.CampaignRecipient{}).
+		Where("campaign_id = ? AND status = 'pending' AND variant_id = 0", c.ID).Count(&pending).Error; err != nil {
+		return err
+	}
+	cell := int((pending*int64(c.ABTestPercent) + 99) / 100)
+
+	var ids []uint
+	if err := cs.Store.DB.Model(&models.CampaignRecipient{}).
+		Where("campaign_id = ? AND status = 'pending' AND variant_id = 0", c.ID).
+		Order("RANDOM()").Limit(cell).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+
+	byVariant := make([][]uint, len(variants))
+	for i, id := range ids {
+		byVariant[i%len(variants)] = append(byVariant[i%len(variants)], id)
+	}
+
+	err := cs.Store.DB.Transaction(func(tx *gorm.DB) error {
+		for i, v := range variants {
+			for start := 0; start < len(byVariant[i]); start += 500 {
+				end := start + 500
+				if end > len(byVariant[i]) {
+					end = len(byVariant[i])
+				}
+				if err := tx.Model(&models.CampaignRecipient{}).Where("id IN ?", byVariant[i][start:end]).
+					Update("variant_id", v.ID).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Model(c).Update("ab_status", ABTesting).Error
+	})
+	if err != nil {
+		return err
+	}
+	c.ABStatus = ABTesting
+	log.Printf("Campaign %d: A/B test cell of %d recipients across %d variants", c.ID, len(ids), len(variants))
+	return nil
+}
+
+// finishABTestCell starts the wait for opens and clicks.
+func (cs *CampaignService) finishABTestCell(c *models.Campaign) error {
+	ends := time.Now().Add(time.Duration(c.ABWaitMinutes) * time.Minute)
+	if err := cs.Store.DB.Model(c).Updates(map[string]interface{}{
+		"ab_status":       ABWaiting,
+		"ab_test_ends_at": ends,
+	}).Error; err != nil {
+		return err
+	}
+	c.ABStatus, c.ABTestEndsAt = ABWaiting, &ends
+	log.Printf("Campaign %d: A/B test cell sent, picking a winner at %s", c.ID, ends.Format(time.RFC3339))
+	return nil
+}
+
+// waitForABResult sleeps until the test ends. It returns false if the
+// campaign was paused or cancelled meanwhile.
+func (cs *CampaignService) waitForABResult(c *models.Campaign) bool {
+	return cs.sleepUntil(c.ID, *c.ABTestEndsAt)
+}
+
+// abMetric is the winner metric per message sent.
+func abMetric(v models.CampaignVariant, metric string) float64 {
+	if v.Sent == 0 {
+		return 0
+	}
+	n := v.Opens
+	switch metric {
+	case ABMetricClicks:
+		n = v.Clicks
+	case ABMetricUniqueClicks:
+		n = v.UniqueClicks
+	}
+	return float64(n) / float64(v.Sent)
+}
+
+// decideABWinner picks the variant with the best metric rate (ties go to
+// the earlier variant) and assigns it to all recipients not yet sent.
+func (cs *CampaignService) decideABWinner(c *models.Campaign) (*models.CampaignVariant, error) {
+	var variants []models.CampaignVariant
+	if err := cs.Store.DB.Where("campaign_id = ?", c.ID).Order("id").Find(&variants).Error; err != nil {
+		return nil, err
+	}
+	if len(variants) == 0 {
+		return nil, fmt.Errorf("campaign has no variants")
+	}
+	best := variants[0]
+	for _, v := range variants[1:] {
+		if abMetric(v, c.ABWinnerMetric) > abMetric(best, c.ABWinnerMetric) {
+			best = v
+		}
+	}
+
+	err := cs.Store.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.CampaignRecipient{}).
+			Where("campaign_id = ? AND status = 'pending' AND variant_id = 0", c.ID).
+			Update("variant_id", best.ID).Error; err != nil {
+			return err
+		}
+		return tx.Model(c).Updates(map[string]interface{}{
+			"ab_status":         ABDecided,
+			"winner_variant_id": best.ID,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.ABStatus, c.WinnerVariantID = ABDecided, best.ID
+	log.Printf("Campaign %d: A/B winner is variant %s (%s %.3f)", c.ID, best.Name, c.ABWinnerMetric, abMetric(best, c.ABWinnerMetric))
+	return &best, nil
+}
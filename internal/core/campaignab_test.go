@@ -0,0 +1,139 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+)
+
+func TestValidateABTest(t *testing.T) {
+	c := models.Campaign{ABTestPercent: 20}
+	variants := []models.CampaignVariant{{Subject: "One"}, {Name: " Short ", Subject: "Two"}}
+	if err := ValidateABTest(&c, variants); err != nil {
+		t.Fatal(err)
+	}
+	if c.ABWinnerMetric != ABMetricOpens || c.ABWaitMinutes != 60 || variants[0].Name != "A" || variants[1].Name != "Short" {
+		t.Errorf("defaults: %+v %+v", c, variants)
+	}
+
+	for _, tc := range []struct {
+		c        models.Campaign
+		variants int
+	}{
+		{models.Campaign{ABTestPercent: 20}, 1},
+		{models.Campaign{ABTestPercent: 20}, 6},
+		{models.Campaign{ABTestPercent: 0}, 2},
+		{models.Campaign{ABTestPercent: 101}, 2},
+		{models.Campaign{ABTestPercent: 20, ABWinnerMetric: "replies"}, 2},
+		{models.Campaign{ABTestPercent: 20, ABWaitMinutes: -5}, 2},
+		{models.Campaign{ABTestPercent: 20}, 0},
+	} {
+		if err := ValidateABTest(&tc.c, make([]models.CampaignVariant, tc.variants)); err == nil {
+			t.Errorf("%+v with %d variants accepted", tc.c, tc.variants)
+		}
+	}
+	if err := ValidateABTest(&c, []models.CampaignVariant{{Name: "X"}, {Name: "X"}}); err == nil {
+		t.Error("duplicate names accepted")
+	}
+}
+
+func TestCampaignABTest(t *testing.T) {
+	defer func(d time.Duration) { waitPollInterval = d }(waitPollInterval)
+	waitPollInterval = 10 * time.Millisecond
+
+	cs := newCampaignTestService(t)
+	mta := startFakeMTA(t)
+	cs.Store.UpsertSettings(&models.AppSettings{SMTPListenAddr: mta.ln.Addr().String()})
+
+	dom := models.Domain{Name: "example.com"}
+	cs.Store.DB.Create(&dom)
+	snd := models.Sender{DomainID: dom.ID, LocalPart: "news", Email: "news@example.com"}
+	cs.Store.DB.Create(&snd)
+
+	c := models.Campaign{
+		Name: "ab", Subject: "Hi", Body: "<p>Hi</p>", SenderID: snd.ID, Status: CampaignDraft, RatePerSecond: 2000,
+		ABTestPercent: 40, ABWinnerMetric: ABMetricOpens, ABWaitMinutes: 1,
+		Variants: []models.CampaignVariant{{Name: "A", Subject: "Hello"}, {Name: "B", Subject: "Last chance"}},
+	}
+	cs.Store.DB.Create(&c)
+	var recipients []models.CampaignRecipient
+	for i := 0; i < 20; i++ {
+		recipients = append(recipients, models.CampaignRecipient{CampaignID: c.ID, Email: fmt.Sprintf("user%d@example.net", i), Status: "pending"})
+	}
+	cs.Store.DB.Create(&recipients)
+
+	waitFor := func(what string, cond func(models.Campaign) bool) models.Campaign {
+		t.Helper()
+		deadline := time.Now().Add(30 * time.Second)
+		for {
+			var got models.Campaign
+			cs.Store.DB.First(&got, c.ID)
+			if cond(got) {
+				return got
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s: %+v", what, got)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	if err := cs.StartCampaign(c.ID); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	waitFor("the test cell", func(got models.Campaign) bool { return got.ABStatus == ABWaiting })
+
+	var variants []models.CampaignVariant
+	cs.Store.DB.Where("campaign_id = ?", c.ID).Order("id").Find(&variants)
+	if len(mta.delivered) != 8 || variants[0].Sent != 4 || variants[1].Sent != 4 {
+		t.Fatalf("test cell: delivered %d, variants %+v", len(mta.delivered), variants)
+	}
+
+	// B wins on opens; the wait is cut short by pausing and moving the end
+	cs.Store.DB.Model(&variants[0]).Update("opens", 1)
+	cs.Store.DB.Model(&variants[1]).Update("opens", 3)
+	cs.PauseCampaign(c.ID)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		campaignRunMu.Lock()
+		running := campaignRunning[c.ID]
+		campaignRunMu.Unlock()
+		if !running || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cs.Store.DB.Model(&c).Update("ab_test_ends_at", time.Now().Add(-time.Second))
+	if err := cs.ResumeCampaign(c.ID); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+
+	got := waitFor("completion", func(got models.Campaign) bool { return got.Status != CampaignSending })
+	if got.Status != CampaignCompleted || got.ABStatus != ABDecided || got.WinnerVariantID != variants[1].ID {
+		t.Fatalf("campaign = %+v", got)
+	}
+	if len(mta.delivered) != 20 {
+		t.Errorf("delivered %d, want 20", len(mta.delivered))
+	}
+	var byVariant []struct {
+		VariantID uint
+		N         int
+	}
+	cs.Store.DB.Model(&models.CampaignRecipient{}).Select("variant_id, COUNT(*) AS n").
+		Where("campaign_id = ?", c.ID).Group("variant_id").Order("variant_id").Scan(&byVariant)
+	if len(byVariant) != 2 || byVariant[0].N != 4 || byVariant[1].N != 16 {
+		t.Errorf("recipients per variant = %+v", byVariant)
+	}
+
+	clone, err := cs.CloneCampaign(c.ID)
+	if err != nil {
+		t.Fatalf("clone: %v", err)
+	}
+	var cloned []models.CampaignVariant
+	cs.Store.DB.Where("campaign_id = ?", clone.ID).Order("id").Find(&cloned)
+	if clone.ABStatus != "" || clone.WinnerVariantID != 0 || len(cloned) != 2 || cloned[1].Subject != "Last chance" || cloned[1].Sent != 0 {
+		t.Errorf("clone = %+v, variants = %+v", clone, cloned)
+	}
+}
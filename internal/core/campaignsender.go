@@ -0,0 +1,391 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+)
+
+// Campaign sending defaults and limits.
+const (
+	DefaultCampaignConcurrency = 4
+	MaxCampaignConcurrency     = 64
+	DefaultCampaignRate        = 50.0 // messages per second
+	MaxCampaignRate            = 5000.0
+
+	// After a 4xx the rate is halved, but never below this
+	minCampaignRate = 1.0
+	// Halving at most once per interval, so a burst of 4xx from parallel
+	// workers counts as one push-back
+	campaignSlowdownInterval = 2 * time.Second
+	// A recipient deferred (4xx) this many times is marked failed
+	maxRecipientAttempts = 5
+	// Longest wait between two attempts at a deferred recipient
+	maxDeferralDelay = 30 * time.Minute
+)
+
+// deferralBaseDelay is the wait after a recipient's first deferral; it
+// doubles with every further one (a var so tests can shorten it).
+var deferralBaseDelay = 30 * time.Second
+
+// deferralBackoff returns how long a recipient deferred attempts times
+// waits before it is tried again.
+func deferralBackoff(attempts int) time.Duration {
+	d := deferralBaseDelay
+	for i := 1; i < attempts && d < maxDeferralDelay; i++ {
+		d *= 2
+	}
+	if d > maxDeferralDelay {
+		d = maxDeferralDelay
+	}
+	return d
+}
+
+// InjectionAddr is where the panel submits mail to KumoMTA: the
+// configured SMTP listener, reached over loopback when it binds to all
+// interfaces.
+func InjectionAddr(settings *models.AppSettings) string {
+	addr := "127.0.0.1:25"
+	if settings == nil || settings.SMTPListenAddr == "" {
+		return addr
+	}
+	host, port, err := net.SplitHostPort(settings.SMTPListenAddr)
+	if err != nil {
+		return addr
+	}
+	switch host {
+	case "", "0.0.0.0":
+		host = "127.0.0.1"
+	case "::":
+		host = "::1"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// campaignSettings returns the effective concurrency and target rate.
+func campaignSettings(c models.Campaign) (int, float64) {
+	concurrency := c.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultCampaignConcurrency
+	}
+	if concurrency > MaxCampaignConcurrency {
+		concurrency = MaxCampaignConcurrency
+	}
+	target := c.RatePerSecond
+	if target <= 0 {
+		target = DefaultCampaignRate
+	}
+	if target > MaxCampaignRate {
+		target = MaxCampaignRate
+	}
+	return concurrency, target
+}
+
+// =======================
+// SMTP connection pool
+// =======================
+
+// smtpPool hands out at most size connections to the MTA and keeps
+// returned healthy ones for reuse.
+type smtpPool struct {
+	addr string
+	idle chan *smtp.Client
+	sem  chan struct{}
+}
+
+func newSMTPPool(addr string, size int) *smtpPool {
+	return &smtpPool{
+		addr: addr,
+		idle: make(chan *smtp.Client, size),
+		sem:  make(chan struct{}, size),
+	}
+}
+
+// get returns an idle connection or dials a new one, blocking while all
+// size connections are in use.
+func (p *smtpPool) get() (*smtp.Client, error) {
+	p.sem <- struct{}{}
+	select {
+	case c := <-p.idle:
+		return c, nil
+	default:
+	}
+
+	conn, err := net.DialTimeout("tcp", p.addr, 5*time.Second)
+	if err != nil {
+		<-p.sem
+		return nil, err
+	}
+	c, err := smtp.NewClient(conn, "localhost")
+	if err != nil {
+		conn.Close()
+		<-p.sem
+		return nil, err
+	}
+	return c, nil
+}
+
+// put returns a connection. Healthy ones are RSET and kept; broken ones
+// are closed.
+func (p *smtpPool) put(c *smtp.Client, healthy bool) {
+	if healthy && c.Reset() == nil {
+		p.idle <- c
+	} else {
+		c.Close()
+	}
+	<-p.sem
+}
+
+func (p *smtpPool) close() {
+	for {
+		select {
+		case c := <-p.idle:
+			c.Quit()
+		default:
+			return
+		}
+	}
+}
+
+// =======================
+// Adaptive pacing
+// =======================
+
+// adaptivePacer spaces out sends to a target rate, halves the rate when
+// the MTA defers (4xx) and climbs back as messages are accepted.
+type adaptivePacer struct {
+	mu           sync.Mutex
+	limiter      *rate.Limiter
+	target       float64
+	current      float64
+	lastSlowdown time.Time
+}
+
+func newAdaptivePacer(target float64) *adaptivePacer {
+	return &adaptivePacer{
+		limiter: rate.NewLimiter(rate.Limit(target), 1),
+		target:  target,
+		current: target,
+	}
+}
+
+func (p *adaptivePacer) Wait() {
+	p.limiter.Wait(context.Background())
+}
+
+// Slowdown reacts to a 4xx from the MTA.
+func (p *adaptivePacer) Slowdown() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if time.Since(p.lastSlowdown) < campaignSlowdownInterval {
+		return
+	}
+	p.lastSlowdown = time.Now()
+	p.current = p.current / 2
+	if p.current < minCampaignRate {
+		p.current = minCampaignRate
+	}
+	p.limiter.SetLimit(rate.Limit(p.current))
+}
+
+// Success recovers 2% of the target per accepted message.
+func (p *adaptivePacer) Success() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.current >= p.target {
+		return
+	}
+	p.current += p.target / 50
+	if p.current > p.target {
+		p.current = p.target
+	}
+	p.limiter.SetLimit(rate.Limit(p.current))
+}
+
+func (p *adaptivePacer) Rate() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.current
+}
+
+// =======================
+// Live throughput
+// =======================
+
+// CampaignThroughput is the live view of a running campaign.
+type CampaignThroughput struct {
+	Concurrency   int       `json:"concurrency"`
+	TargetRate    float64   `json:"target_rate"`
+	CurrentRate   float64   `json:"current_rate"`    // target after 4xx slow-downs
+	SentPerSecond float64   `json:"sent_per_second"` // over the last 10 seconds
+	Sent          int64     `json:"sent"`            // since this run started
+	Deferred      int64     `json:"deferred"`        // 4xx responses this run
+	Failed        int64     `json:"failed"`
+	StartedAt     time.Time `json:"started_at"`
+}
+
+const throughputWindow = 10 // seconds
+
+// campaignMeter counts sends per second for the throughput window.
+type campaignMeter struct {
+	mu      sync.Mutex
+	pacer   *adaptivePacer
+	stats   CampaignThroughput
+	buckets [throughputWindow]int64
+	seconds [throughputWindow]int64
+}
+
+func (m *campaignMeter) record(kind sendOutcome) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch kind {
+	case sendOK:
+		m.stats.Sent++
+		now := time.Now().Unix()
+		i := now % throughputWindow
+		if m.seconds[i] != now {
+			m.seconds[i], m.buckets[i] = now, 0
+		}
+		m.buckets[i]++
+	case sendDeferred:
+		m.stats.Deferred++
+	case sendFailed:
+		m.stats.Failed++
+	}
+}
+
+func (m *campaignMeter) snapshot() *CampaignThroughput {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := m.stats
+	out.CurrentRate = m.pacer.Rate()
+
+	// Only count complete seconds, and no more than the run has lasted
+	now := time.Now().Unix()
+	var sent int64
+	for i := range m.buckets {
+		if age := now - m.seconds[i]; age >= 1 && age <= throughputWindow {
+			sent += m.buckets[i]
+		}
+	}
+	window := float64(throughputWindow)
+	if elapsed := float64(now - m.stats.StartedAt.Unix()); elapsed < window {
+		window = elapsed
+	}
+	if window >= 1 {
+		out.SentPerSecond = float64(sent) / window
+	}
+	return &out
+}
+
+// Meters of the campaigns sending in this process.
+var campaignMeters sync.Map // campaign id -> *campaignMeter
+
+func startCampaignMeter(id uint, concurrency int, pacer *adaptivePacer) *campaignMeter {
+	m := &campaignMeter{pacer: pacer, stats: CampaignThroughput{
+		Concurrency: concurrency,
+		TargetRate:  pacer.target,
+		StartedAt:   time.Now().UTC(),
+	}}
+	campaignMeters.Store(id, m)
+	return m
+}
+
+// CampaignLiveStats returns the throughput of a campaign sending in this
+// process, or nil.
+func CampaignLiveStats(id uint) *CampaignThroughput {
+	if m, ok := campaignMeters.Load(id); ok {
+		return m.(*campaignMeter).snapshot()
+	}
+	return nil
+}
+
+// =======================
+// Sending one message
+// =======================
+
+type sendOutcome int
+
+const (
+	sendOK sendOutcome = iota
+	sendFailed
+	sendDeferred  // 4xx or a dropped connection: stays pending
+	sendConnError // MTA unreachable: the run is paused
+	sendSkipped   // not attempted because the run is aborting
+)
+
+type sendResult struct {
+	Recipient models.CampaignRecipient
+	Outcome   sendOutcome
+	Err       error
+}
+
+// deliver runs one SMTP transaction on a pooled connection. dataSent
+// reports whether the server accepted DATA, after which it may have
+// queued the message even if the transaction failed.
+func deliver(c *smtp.Client, from, to string, msg []byte) (dataSent bool, err error) {
+	if err := c.Mail(from); err != nil {
+		return false, err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return false, err
+	}
+	wc, err := c.Data()
+	if err != nil {
+		return false, err
+	}
+	if _, err := wc.Write(msg); err != nil {
+		wc.Close()
+		return true, err
+	}
+	return true, wc.Close()
+}
+
+// sendWithPool delivers msg, classifying the outcome. A pooled connection
+// that turns out to be broken before DATA is replaced and the message
+// tried once more; once DATA was sent it is left to a later, backed-off
+// attempt, as an inline retry could deliver it twice.
+func sendWithPool(pool *smtpPool, from, to string, msg []byte) (sendOutcome, error) {
+	var lastErr error
+	for attempt := 0; attempt < 2; attempt++ {
+		client, err := pool.get()
+		if err != nil {
+			return sendConnError, err
+		}
+
+		dataSent, err := deliver(client, from, to, msg)
+		if err == nil {
+			pool.put(client, true)
+			return sendOK, nil
+		}
+
+		var perr *textproto.Error
+		if errors.As(err, &perr) {
+			pool.put(client, true)
+			if perr.Code >= 400 && perr.Code < 500 {
+				return sendDeferred, err
+			}
+			return sendFailed, err
+		}
+		pool.put(client, false)
+		if dataSent {
+			return sendDeferred, err
+		}
+		lastErr = err
+	}
+	return sendDeferred, lastErr
+}
+
+// smtpErrorText flattens an SMTP error for CampaignRecipient.Error.
+func smtpErrorText(err error) string {
+	return strings.TrimSpace(strings.ReplaceAll(err.Error(), "\r\n", " "))
+}
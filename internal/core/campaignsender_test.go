@@ -0,0 +1,283 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+)
+
+// fakeMTA is a minimal SMTP server. Recipients starting with "reject"
+// get a 550, "defer" always a 451, "slow" a 451 the first two times.
+// For "drop" the message is queued but the connection closed before the
+// reply.
+type fakeMTA struct {
+	ln        net.Listener
+	mu        sync.Mutex
+	delivered []string
+	tries     map[string]int
+	open      atomic.Int32
+	maxOpen   atomic.Int32
+}
+
+func startFakeMTA(t *testing.T) *fakeMTA {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	m := &fakeMTA{ln: ln, tries: map[string]int{}}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go m.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return m
+}
+
+func (m *fakeMTA) serve(conn net.Conn) {
+	defer conn.Close()
+	if n := m.open.Add(1); n > m.maxOpen.Load() {
+		m.maxOpen.Store(n)
+	}
+	defer m.open.Add(-1)
+
+	r := bufio.NewReader(conn)
+	reply := func(s string) { fmt.Fprintf(conn, "%s\r\n", s) }
+	reply("220 fake ESMTP")
+
+	var rcpt string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 fake")
+		case strings.HasPrefix(cmd, "MAIL"), strings.HasPrefix(cmd, "RSET"):
+			reply("250 ok")
+		case strings.HasPrefix(cmd, "RCPT"):
+			rcpt = strings.ToLower(strings.Trim(strings.TrimSpace(line)[8:], "<>"))
+			m.mu.Lock()
+			m.tries[rcpt]++
+			tries := m.tries[rcpt]
+			m.mu.Unlock()
+			switch {
+			case strings.HasPrefix(rcpt, "reject"):
+				reply("550 no such user")
+			case strings.HasPrefix(rcpt, "defer"), strings.HasPrefix(rcpt, "slow") && tries <= 2:
+				reply("451 try again later")
+			default:
+				reply("250 ok")
+			}
+		case cmd == "DATA":
+			reply("354 go ahead")
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+			}
+			m.mu.Lock()
+			m.delivered = append(m.delivered, rcpt)
+			m.mu.Unlock()
+			if strings.HasPrefix(rcpt, "drop") {
+				return
+			}
+			reply("250 queued")
+		case strings.HasPrefix(cmd, "QUIT"):
+			reply("221 bye")
+			return
+		default:
+			reply("502 unknown")
+		}
+	}
+}
+
+func TestCampaignConcurrentSend(t *testing.T) {
+	defer func(d, p time.Duration) { deferralBaseDelay, waitPollInterval = d, p }(deferralBaseDelay, waitPollInterval)
+	deferralBaseDelay, waitPollInterval = time.Millisecond, 10*time.Millisecond
+
+	cs := newCampaignTestService(t)
+	mta := startFakeMTA(t)
+	cs.Store.UpsertSettings(&models.AppSettings{SMTPListenAddr: mta.ln.Addr().String()})
+
+	dom := models.Domain{Name: "example.com"}
+	cs.Store.DB.Create(&dom)
+	snd := models.Sender{DomainID: dom.ID, LocalPart: "news", Email: "news@example.com"}
+	cs.Store.DB.Create(&snd)
+
+	c := models.Campaign{Name: "load", Subject: "Hi", Body: "<p>Hi</p>", SenderID: snd.ID, Status: CampaignDraft, Concurrency: 3, RatePerSecond: 2000}
+	cs.Store.DB.Create(&c)
+	var recipients []models.CampaignRecipient
+	for i := 0; i < 40; i++ {
+		recipients = append(recipients, models.CampaignRecipient{CampaignID: c.ID, Email: fmt.Sprintf("user%d@example.net", i), Status: "pending"})
+	}
+	recipients = append(recipients,
+		models.CampaignRecipient{CampaignID: c.ID, Email: "reject@example.net", Status: "pending"},
+		models.CampaignRecipient{CampaignID: c.ID, Email: "defer@example.net", Status: "pending"},
+		models.CampaignRecipient{CampaignID: c.ID, Email: "slow@example.net", Status: "pending"},
+	)
+	cs.Store.DB.Create(&recipients)
+
+	if err := cs.StartCampaign(c.ID); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	deadline := time.Now().Add(30 * time.Second)
+	for campaignStatus(cs, c.ID) == CampaignSending && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if got := campaignStatus(cs, c.ID); got != CampaignCompleted {
+		t.Fatalf("status = %s", got)
+	}
+
+	var got models.Campaign
+	cs.Store.DB.First(&got, c.ID)
+	if got.TotalSent != 41 || len(mta.delivered) != 41 {
+		t.Errorf("total_sent = %d, delivered = %d, want 41", got.TotalSent, len(mta.delivered))
+	}
+	// The rejected and the always-deferred recipient
+	if got.TotalFailed != 2 {
+		t.Errorf("total_failed = %d, want 2", got.TotalFailed)
+	}
+	if n := mta.maxOpen.Load(); n > 3 {
+		t.Errorf("%d parallel connections, concurrency is 3", n)
+	}
+
+	byEmail := map[string]models.CampaignRecipient{}
+	var all []models.CampaignRecipient
+	cs.Store.DB.Where("campaign_id = ?", c.ID).Find(&all)
+	for _, r := range all {
+		byEmail[r.Email] = r
+	}
+	if r := byEmail["reject@example.net"]; r.Status != "failed" || !strings.Contains(r.Error, "550") {
+		t.Errorf("rejected recipient = %+v", r)
+	}
+	if r := byEmail["defer@example.net"]; r.Status != "failed" || r.Attempts != maxRecipientAttempts {
+		t.Errorf("always-deferred recipient = %+v", r)
+	}
+	if r := byEmail["slow@example.net"]; r.Status != "sent" || r.Attempts != 2 {
+		t.Errorf("deferred-then-accepted recipient = %+v", r)
+	}
+	if CampaignLiveStats(c.ID) != nil {
+		t.Error("live stats should be dropped when the run ends")
+	}
+}
+
+func TestDeferredRecipientBacksOff(t *testing.T) {
+	defer func(d, p time.Duration) { deferralBaseDelay, waitPollInterval = d, p }(deferralBaseDelay, waitPollInterval)
+	deferralBaseDelay, waitPollInterval = 10*time.Minute, 10*time.Millisecond
+
+	for attempts, want := range map[int]time.Duration{1: 10 * time.Minute, 2: 20 * time.Minute, 3: maxDeferralDelay, 10: maxDeferralDelay} {
+		if got := deferralBackoff(attempts); got != want {
+			t.Errorf("deferralBackoff(%d) = %v", attempts, got)
+		}
+	}
+
+	cs := newCampaignTestService(t)
+	mta := startFakeMTA(t)
+	cs.Store.UpsertSettings(&models.AppSettings{SMTPListenAddr: mta.ln.Addr().String()})
+	dom := models.Domain{Name: "example.com"}
+	cs.Store.DB.Create(&dom)
+	snd := models.Sender{DomainID: dom.ID, LocalPart: "news", Email: "news@example.com"}
+	cs.Store.DB.Create(&snd)
+	c := models.Campaign{Name: "retry", Subject: "Hi", Body: "<p>Hi</p>", SenderID: snd.ID, Status: CampaignDraft}
+	cs.Store.DB.Create(&c)
+	r := models.CampaignRecipient{CampaignID: c.ID, Email: "defer@example.net", Status: "pending"}
+	cs.Store.DB.Create(&r)
+
+	if err := cs.StartCampaign(c.ID); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for r.Attempts == 0 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+		cs.Store.DB.First(&r, r.ID)
+	}
+	// Give the sender time to (wrongly) pick the recipient up again
+	time.Sleep(200 * time.Millisecond)
+	cs.Store.DB.First(&r, r.ID)
+	if r.Status != "pending" || r.Attempts != 1 || r.NotBefore == nil || time.Until(*r.NotBefore) < 9*time.Minute {
+		t.Errorf("deferred recipient = %+v", r)
+	}
+	// Waiting for the retry, not finished
+	if got := campaignStatus(cs, c.ID); got != CampaignSending {
+		t.Errorf("status = %s", got)
+	}
+	if err := cs.PauseCampaign(c.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSendWithPoolRetry(t *testing.T) {
+	mta := startFakeMTA(t)
+	pool := newSMTPPool(mta.ln.Addr().String(), 1)
+	defer pool.close()
+	msg := []byte("Subject: Hi\r\n\r\nHi\r\n")
+
+	// A pooled connection the server has since closed is replaced
+	if out, err := sendWithPool(pool, "news@example.com", "first@example.net", msg); out != sendOK {
+		t.Fatalf("first = %v, %v", out, err)
+	}
+	c, _ := pool.get()
+	c.Text.Close()
+	pool.idle <- c
+	<-pool.sem
+	if out, err := sendWithPool(pool, "news@example.com", "second@example.net", msg); out != sendOK {
+		t.Errorf("after a dropped idle connection = %v, %v", out, err)
+	}
+
+	// Lost after DATA: the server may have queued it, so no second try
+	if out, err := sendWithPool(pool, "news@example.com", "drop@example.net", msg); out != sendDeferred || err == nil {
+		t.Errorf("dropped after DATA = %v, %v", out, err)
+	}
+	mta.mu.Lock()
+	defer mta.mu.Unlock()
+	if n := mta.tries["drop@example.net"]; n != 1 {
+		t.Errorf("tried %d times after DATA, want 1", n)
+	}
+}
+
+func TestAdaptivePacer(t *testing.T) {
+	p := newAdaptivePacer(100)
+	p.Slowdown()
+	p.Slowdown() // within the interval: ignored
+	if got := p.Rate(); got != 50 {
+		t.Errorf("rate after 4xx = %g, want 50", got)
+	}
+	for i := 0; i < 100; i++ {
+		p.Success()
+	}
+	if got := p.Rate(); got != 100 {
+		t.Errorf("rate after recovery = %g, want 100", got)
+	}
+}
+
+func TestInjectionAddr(t *testing.T) {
+	cases := map[string]string{
+		"":              "127.0.0.1:25",
+		"0.0.0.0:25":    "127.0.0.1:25",
+		"10.0.0.5:2525": "10.0.0.5:2525",
+		"[::]:25":       "[::1]:25",
+	}
+	for listen, want := range cases {
+		if got := InjectionAddr(&models.AppSettings{SMTPListenAddr: listen}); got != want {
+			t.Errorf("InjectionAddr(%q) = %q, want %q", listen, got, want)
+		}
+	}
+}
@@ -0,0 +1,412 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+)
+
+// Campaign states.
+const (
+	CampaignDraft     = "draft"
+	CampaignScheduled = "scheduled"
+	CampaignSending   = "sending"
+	CampaignPaused    = "paused"
+	CampaignCancelled = "cancelled"
+	CampaignCompleted = "completed"
+	CampaignFailed    = "failed"
+)
+
+// ErrCampaignNotFound is returned for unknown campaign ids.
+var ErrCampaignNotFound = errors.New("campaign not found")
+
+// CampaignStateError is returned when an action isn't allowed in the
+// campaign's current state.
+type CampaignStateError struct {
+	Action string
+	Status string
+}
+
+func (e *CampaignStateError) Error() string {
+	return fmt.Sprintf("cannot %s a campaign that is %s", e.Action, e.Status)
+}
+
+// campaignTransitions lists, per action, the states it may start from.
+var campaignTransitions = map[string][]string{
+	"start":      {CampaignDraft, CampaignScheduled},
+	"pause":      {CampaignSending},
+	"resume":     {CampaignPaused, CampaignFailed},
+	"cancel":     {CampaignDraft, CampaignScheduled, CampaignSending, CampaignPaused, CampaignFailed},
+	"reschedule": {CampaignDraft, CampaignScheduled, CampaignPaused},
+	"edit":       {CampaignDraft, CampaignScheduled},
+}
+
+// transition atomically moves a campaign from one of the states allowed
+// for action to status ("" keeps the status). Extra column updates are
+// applied in the same statement, so a concurrent transition can't slip in
+// between.
+func (cs *CampaignService) transition(id uint, action, status string, extra map[string]interface{}) error {
+	return cs.transitionTx(cs.Store.DB, id, action, status, extra)
+}
+
+// transitionTx is transition within a transaction.
+func (cs *CampaignService) transitionTx(tx *gorm.DB, id uint, action, status string, extra map[string]interface{}) error {
+	updates := map[string]interface{}{}
+	if status != "" {
+		updates["status"] = status
+	}
+	for k, v := range extra {
+		updates[k] = v
+	}
+	res := tx.Model(&models.Campaign{}).
+		Where("id = ? AND status IN ?", id, campaignTransitions[action]).
+		Updates(updates)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 1 {
+		return nil
+	}
+
+	var c models.Campaign
+	if err := tx.Select("status").First(&c, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrCampaignNotFound
+		}
+		return err
+	}
+	return &CampaignStateError{Action: action, Status: c.Status}
+}
+
+// =======================
+// Running campaigns
+// =======================
+
+// Campaigns with a sending goroutine in this process. Handlers and the
+// scheduler use separate CampaignService values, so this is package state.
+var (
+	campaignRunMu   sync.Mutex
+	campaignRunning = map[uint]bool{}
+)
+
+// launch starts the sending goroutine unless one is already running
+// (e.g. a paused campaign resumed before its goroutine noticed the pause:
+// that goroutine simply keeps going).
+func (cs *CampaignService) launch(id uint) error {
+	var c models.Campaign
+	if err := cs.Store.DB.Preload("Sender").Preload("Sender.Domain").First(&c, id).Error; err != nil {
+		return err
+	}
+
+	campaignRunMu.Lock()
+	defer campaignRunMu.Unlock()
+	if campaignRunning[id] {
+		return nil
+	}
+	campaignRunning[id] = true
+	go cs.processCampaign(c)
+	return nil
+}
+
+// stillSending is checked by the sending goroutine between batches. When
+// the campaign left "sending" (paused, cancelled) the goroutine is
+// unregistered and must return.
+func (cs *CampaignService) stillSending(id uint) bool {
+	campaignRunMu.Lock()
+	defer campaignRunMu.Unlock()
+
+	var c models.Campaign
+	if err := cs.Store.DB.Select("status").First(&c, id).Error; err == nil && c.Status == CampaignSending {
+		return true
+	}
+	delete(campaignRunning, id)
+	return false
+}
+
+// finishRun ends the sending goroutine with a final status. The status is
+// only written if the campaign is still "sending", so a cancel that raced
+// with the last batch wins.
+func (cs *CampaignService) finishRun(id uint, status string) {
+	campaignRunMu.Lock()
+	defer campaignRunMu.Unlock()
+
+	cs.Store.DB.Model(&models.Campaign{}).
+		Where("id = ? AND status = ?", id, CampaignSending).
+		Update("status", status)
+	delete(campaignRunning, id)
+}
+
+// =======================
+// Lifecycle actions
+// =======================
+
+// PauseCampaign stops a sending campaign after its current batch.
+func (cs *CampaignService) PauseCampaign(id uint) error {
+	return cs.transition(id, "pause", CampaignPaused, nil)
+}
+
+// ResumeCampaign continues a paused (or failed) campaign with its
+// remaining pending recipients.
+func (cs *CampaignService) ResumeCampaign(id uint) error {
+	if err := cs.transition(id, "resume", CampaignSending, nil); err != nil {
+		return err
+	}
+	return cs.launch(id)
+}
+
+// CancelCampaign stops a campaign for good. Recipients not sent yet stay
+// "pending" so the report shows how far it got.
+func (cs *CampaignService) CancelCampaign(id uint) error {
+	return cs.transition(id, "cancel", CampaignCancelled, nil)
+}
+
+// RescheduleCampaign (re)schedules a draft, scheduled or paused campaign.
+func (cs *CampaignService) RescheduleCampaign(id uint, at time.Time) error {
+	if !at.After(time.Now()) {
+		return fmt.Errorf("scheduled_at must be in the future")
+	}
+	return cs.transition(id, "reschedule", CampaignScheduled, map[string]interface{}{"scheduled_at": at})
+}
+
+// CampaignDraftUpdate holds the editable fields of a campaign that hasn't
+// started; nil fields are left unchanged.
+type CampaignDraftUpdate struct {
+	Name     *string
+	Subject  *string
+	Body     *string
+	SenderID *uint
+
+	Concurrency   *int
+	RatePerSecond *float64
+
+	// Audience (see ValidateCampaignAudience)
+	ListIDs   *string
+	SegmentID *uint
+
+	// Local send time and sending window (see ValidateSendSchedule)
+	SendAtLocalTime *string
+	SendWindowDays  *string
+	SendWindowStart *string
+	SendWindowEnd   *string
+	Timezone        *string
+
+	// Comma separated Asset ids (see ValidateCampaignAssets)
+	AttachmentIDs *string
+
+	// A/B test; Variants replaces all variants (empty: no test)
+	ABTestPercent  *int
+	ABWinnerMetric *string
+	ABWaitMinutes  *int
+	Variants       *[]models.CampaignVariant
+}
+
+// ValidateCampaignSpeed checks the sending speed settings (0 = default).
+func ValidateCampaignSpeed(concurrency int, ratePerSecond float64) error {
+	if concurrency < 0 || concurrency > MaxCampaignConcurrency {
+		return fmt.Errorf("concurrency must be between 0 (default) and %d", MaxCampaignConcurrency)
+	}
+	if ratePerSecond < 0 || ratePerSecond > MaxCampaignRate {
+		return fmt.Errorf("rate_per_second must be between 0 (default) and %g", MaxCampaignRate)
+	}
+	return nil
+}
+
+// UpdateCampaignDraft edits a campaign that hasn't started sending.
+func (cs *CampaignService) UpdateCampaignDraft(id uint, u CampaignDraftUpdate) (*models.Campaign, error) {
+	updates := map[string]interface{}{}
+	if u.Name != nil {
+		updates["name"] = *u.Name
+	}
+	if u.Subject != nil {
+		updates["subject"] = *u.Subject
+	}
+	if u.Body != nil {
+		updates["body"] = *u.Body
+	}
+	if u.SenderID != nil {
+		updates["sender_id"] = *u.SenderID
+	}
+	if u.Concurrency != nil {
+		updates["concurrency"] = *u.Concurrency
+	}
+	if u.RatePerSecond != nil {
+		updates["rate_per_second"] = *u.RatePerSecond
+	}
+
+	var c models.Campaign
+	if err := cs.Store.DB.Preload("Variants").First(&c, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCampaignNotFound
+		}
+		return nil, err
+	}
+
+	if u.ListIDs != nil || u.SegmentID != nil {
+		if u.ListIDs != nil {
+			c.ListIDs = *u.ListIDs
+		}
+		if u.SegmentID != nil {
+			c.SegmentID = *u.SegmentID
+		}
+		if err := ValidateCampaignAudience(cs.Store, &c); err != nil {
+			return nil, err
+		}
+		updates["list_ids"] = c.ListIDs
+		updates["segment_id"] = c.SegmentID
+	}
+
+	if u.SendAtLocalTime != nil || u.SendWindowDays != nil || u.SendWindowStart != nil || u.SendWindowEnd != nil || u.Timezone != nil {
+		if u.SendAtLocalTime != nil {
+			c.SendAtLocalTime = *u.SendAtLocalTime
+		}
+		if u.SendWindowDays != nil {
+			c.SendWindowDays = *u.SendWindowDays
+		}
+		if u.SendWindowStart != nil {
+			c.SendWindowStart = *u.SendWindowStart
+		}
+		if u.SendWindowEnd != nil {
+			c.SendWindowEnd = *u.SendWindowEnd
+		}
+		if u.Timezone != nil {
+			c.Timezone = *u.Timezone
+		}
+		if err := ValidateSendSchedule(&c); err != nil {
+			return nil, err
+		}
+		updates["send_at_local_time"] = c.SendAtLocalTime
+		updates["send_window_days"] = c.SendWindowDays
+		updates["send_window_start"] = c.SendWindowStart
+		updates["send_window_end"] = c.SendWindowEnd
+		updates["timezone"] = c.Timezone
+	}
+
+	if u.ABTestPercent != nil || u.ABWinnerMetric != nil || u.ABWaitMinutes != nil || u.Variants != nil {
+		if u.ABTestPercent != nil {
+			c.ABTestPercent = *u.ABTestPercent
+		}
+		if u.ABWinnerMetric != nil {
+			c.ABWinnerMetric = *u.ABWinnerMetric
+		}
+		if u.ABWaitMinutes != nil {
+			c.ABWaitMinutes = *u.ABWaitMinutes
+		}
+		variants := c.Variants
+		if u.Variants != nil {
+			variants = *u.Variants
+		}
+		if err := ValidateABTest(&c, variants); err != nil {
+			return nil, err
+		}
+		updates["ab_test_percent"] = c.ABTestPercent
+		updates["ab_winner_metric"] = c.ABWinnerMetric
+		updates["ab_wait_minutes"] = c.ABWaitMinutes
+		c.Variants = variants
+	}
+
+	// Inline images are checked again whenever a body changes
+	if u.AttachmentIDs != nil || u.Body != nil || u.Variants != nil {
+		if u.AttachmentIDs != nil {
+			c.AttachmentIDs = *u.AttachmentIDs
+		}
+		if u.Body != nil {
+			c.Body = *u.Body
+		}
+		if err := ValidateCampaignAssets(cs.Store, &c, c.Variants); err != nil {
+			return nil, err
+		}
+		updates["attachment_ids"] = c.AttachmentIDs
+	}
+	if len(updates) == 0 {
+		return &c, nil
+	}
+
+	// The WHERE on the current state keeps this from racing with the scheduler
+	err := cs.Store.DB.Transaction(func(tx *gorm.DB) error {
+		if err := cs.transitionTx(tx, id, "edit", "", updates); err != nil {
+			return err
+		}
+		if u.Variants == nil {
+			return nil
+		}
+		if err := tx.Where("campaign_id = ?", id).Delete(&models.CampaignVariant{}).Error; err != nil {
+			return err
+		}
+		for _, v := range c.Variants {
+			nv := models.CampaignVariant{CampaignID: id, Name: v.Name, Subject: v.Subject, Body: v.Body}
+			if err := tx.Create(&nv).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := cs.Store.DB.Preload("Variants").First(&c, id).Error; err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// CloneCampaign copies a campaign and its recipient list into a new draft.
+// Recipients that came from the audience are left out; the clone resolves
+// its lists and segment again when it starts.
+func (cs *CampaignService) CloneCampaign(id uint) (*models.Campaign, error) {
+	var src models.Campaign
+	if err := cs.Store.DB.Preload("Variants", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).First(&src, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCampaignNotFound
+		}
+		return nil, err
+	}
+
+	clone := models.Campaign{
+		Name:     strings.TrimSpace(src.Name) + " (copy)",
+		Subject:  src.Subject,
+		Body:     src.Body,
+		SenderID: src.SenderID,
+		Status:   CampaignDraft,
+
+		Concurrency:   src.Concurrency,
+		RatePerSecond: src.RatePerSecond,
+
+		ListIDs:   src.ListIDs,
+		SegmentID: src.SegmentID,
+
+		SendAtLocalTime: src.SendAtLocalTime,
+		SendWindowDays:  src.SendWindowDays,
+		SendWindowStart: src.SendWindowStart,
+		SendWindowEnd:   src.SendWindowEnd,
+		Timezone:        src.Timezone,
+
+		AttachmentIDs: src.AttachmentIDs,
+
+		ABTestPercent:  src.ABTestPercent,
+		ABWinnerMetric: src.ABWinnerMetric,
+		ABWaitMinutes:  src.ABWaitMinutes,
+	}
+	for _, v := range src.Variants {
+		clone.Variants = append(clone.Variants, models.CampaignVariant{Name: v.Name, Subject: v.Subject, Body: v.Body})
+	}
+	err := cs.Store.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&clone).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`INSERT INTO campaign_recipients (campaign_id, email, contact_id, status)
+			SELECT ?, email, contact_id, ? FROM campaign_recipients WHERE campaign_id = ? AND (? OR contact_id = 0) ORDER BY id`,
+			clone.ID, "pending", src.ID, src.ListIDs == "" && src.SegmentID == 0).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Campaign %d cloned from %d", clone.ID, src.ID)
+	return &clone, nil
+}
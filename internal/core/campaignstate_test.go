@@ -0,0 +1,121 @@
+package core
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+	"github.com/pulak-ranjan/kumomta-ui/internal/store"
+)
+
+func newCampaignTestService(t *testing.T) *CampaignService {
+	st, err := store.NewStore(filepath.Join(t.TempDir(), "panel.db"))
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	return NewCampaignService(st)
+}
+
+func campaignStatus(cs *CampaignService, id uint) string {
+	var c models.Campaign
+	cs.Store.DB.First(&c, id)
+	return c.Status
+}
+
+func TestCampaignTransitions(t *testing.T) {
+	cs := newCampaignTestService(t)
+	c := models.Campaign{Name: "spring", Subject: "Hi", Body: "<p>Hi</p>", Status: CampaignDraft}
+	cs.Store.DB.Create(&c)
+
+	var stateErr *CampaignStateError
+	if err := cs.PauseCampaign(c.ID); !errors.As(err, &stateErr) || stateErr.Status != CampaignDraft {
+		t.Errorf("pausing a draft: %v", err)
+	}
+	if err := cs.RescheduleCampaign(c.ID, time.Now().Add(-time.Minute)); err == nil {
+		t.Error("scheduling in the past accepted")
+	}
+	if err := cs.RescheduleCampaign(c.ID, time.Now().Add(time.Hour)); err != nil || campaignStatus(cs, c.ID) != CampaignScheduled {
+		t.Fatalf("reschedule: %v (%s)", err, campaignStatus(cs, c.ID))
+	}
+
+	subject := "Hello again"
+	updated, err := cs.UpdateCampaignDraft(c.ID, CampaignDraftUpdate{Subject: &subject})
+	if err != nil || updated.Subject != subject || updated.Status != CampaignScheduled {
+		t.Fatalf("update scheduled campaign: %+v %v", updated, err)
+	}
+
+	// Simulate the scheduler picking it up
+	cs.Store.DB.Model(&models.Campaign{}).Where("id = ?", c.ID).Update("status", CampaignSending)
+	if _, err := cs.UpdateCampaignDraft(c.ID, CampaignDraftUpdate{Subject: &subject}); !errors.As(err, &stateErr) {
+		t.Errorf("editing a sending campaign: %v", err)
+	}
+	if err := cs.PauseCampaign(c.ID); err != nil || campaignStatus(cs, c.ID) != CampaignPaused {
+		t.Fatalf("pause: %v", err)
+	}
+	if err := cs.CancelCampaign(c.ID); err != nil || campaignStatus(cs, c.ID) != CampaignCancelled {
+		t.Fatalf("cancel: %v", err)
+	}
+	if err := cs.ResumeCampaign(c.ID); !errors.As(err, &stateErr) || stateErr.Status != CampaignCancelled {
+		t.Errorf("resuming a cancelled campaign: %v", err)
+	}
+	if err := cs.CancelCampaign(9999); !errors.Is(err, ErrCampaignNotFound) {
+		t.Errorf("unknown campaign: %v", err)
+	}
+}
+
+func TestCampaignRunStopsWhenPaused(t *testing.T) {
+	cs := newCampaignTestService(t)
+	c := models.Campaign{Name: "run", Status: CampaignSending}
+	cs.Store.DB.Create(&c)
+
+	campaignRunMu.Lock()
+	campaignRunning[c.ID] = true
+	campaignRunMu.Unlock()
+
+	if !cs.stillSending(c.ID) {
+		t.Fatal("sending campaign should keep running")
+	}
+	cs.PauseCampaign(c.ID)
+	if cs.stillSending(c.ID) {
+		t.Fatal("paused campaign should stop between batches")
+	}
+	campaignRunMu.Lock()
+	running := campaignRunning[c.ID]
+	campaignRunMu.Unlock()
+	if running {
+		t.Error("stopped goroutine still registered")
+	}
+
+	// A cancel racing with the last batch is not overwritten by "completed"
+	cs.Store.DB.Model(&c).Update("status", CampaignCancelled)
+	cs.finishRun(c.ID, CampaignCompleted)
+	if got := campaignStatus(cs, c.ID); got != CampaignCancelled {
+		t.Errorf("status = %s, want cancelled", got)
+	}
+}
+
+func TestCloneCampaign(t *testing.T) {
+	cs := newCampaignTestService(t)
+	c := models.Campaign{Name: "spring", Subject: "Hi", Body: "body", SenderID: 3, Status: CampaignCompleted, TotalSent: 2}
+	cs.Store.DB.Create(&c)
+	cs.Store.DB.Create(&[]models.CampaignRecipient{
+		{CampaignID: c.ID, Email: "a@example.com", Status: "sent"},
+		{CampaignID: c.ID, Email: "b@example.com", Status: "bounced", ContactID: 7},
+	})
+
+	clone, err := cs.CloneCampaign(c.ID)
+	if err != nil {
+		t.Fatalf("clone: %v", err)
+	}
+	if clone.Name != "spring (copy)" || clone.Status != CampaignDraft || clone.TotalSent != 0 || clone.SenderID != 3 {
+		t.Errorf("clone = %+v", clone)
+	}
+
+	var recipients []models.CampaignRecipient
+	cs.Store.DB.Where("campaign_id = ?", clone.ID).Order("id").Find(&recipients)
+	if len(recipients) != 2 || recipients[0].Status != "pending" || recipients[1].ContactID != 7 {
+		t.Errorf("cloned recipients = %+v", recipients)
+	}
+}
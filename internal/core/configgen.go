@@ -2,6 +2,7 @@ package core
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/pulak-ranjan/kumomta-ui/internal/models"
@@ -27,23 +28,70 @@ func PoolName(d models.Domain, s models.Sender) string {
 	return fmt.Sprintf("%s__%s", d.Name, s.LocalPart)
 }
 
+// Shared multi-IP pool name (see models.EgressPool).
+// Prefixed so it can never collide with a "domain__localpart" tenant pool.
+func EgressPoolName(p models.EgressPool) string {
+	// Example: "pool__bulk-eu"
+	return fmt.Sprintf("pool__%s", p.Name)
+}
+
+// Source name for one member IP of a shared pool.
+// Colons (IPv6) are replaced because KumoMTA treats them as delimiters.
+func PoolSourceName(p models.EgressPool, ip string) string {
+	// Example: "pool__bulk-eu__203.0.113.10"
+	return fmt.Sprintf("%s__%s", EgressPoolName(p), strings.ReplaceAll(ip, ":", "-"))
+}
+
+// SenderPoolName returns the egress pool a sender's tenant uses:
+// its assigned shared pool if any, otherwise its own single-IP pool.
+func SenderPoolName(snap *Snapshot, d models.Domain, s models.Sender) string {
+	if p := snap.PoolByID(s.EgressPoolID); p != nil && len(p.Members) > 0 {
+		return EgressPoolName(*p)
+	}
+	return PoolName(d, s)
+}
+
+// senderEHLO is the EHLO host of a single-IP sender: its override, or
+// "localpart.domain".
+func senderEHLO(d models.Domain, s models.Sender) string {
+	if s.EHLODomain != "" {
+		return s.EHLODomain
+	}
+	return fmt.Sprintf("%s.%s", s.LocalPart, d.Name)
+}
+
+// poolMemberEHLO picks the EHLO for a pooled source: the IP's own
+// hostname (PTR) first, then the pool default, then the main hostname.
+func poolMemberEHLO(snap *Snapshot, p models.EgressPool, m models.EgressPoolMember) string {
+	if m.SystemIP.Hostname != "" {
+		return m.SystemIP.Hostname
+	}
+	if p.EHLODomain != "" {
+		return p.EHLODomain
+	}
+	if snap.Settings != nil && snap.Settings.MainHostname != "" {
+		return snap.Settings.MainHostname
+	}
+	return "localhost"
+}
+
 // =======================
 // auth.toml generator (SMTP Authentication)
 // =======================
 
+// GenerateAuthTOML lists the usernames allowed to SMTP AUTH. Passwords are
+// never written out; the auth hook verifies them against the panel.
 func GenerateAuthTOML(snap *Snapshot) string {
 	var b strings.Builder
-	fmt.Fprintln(&b, "# KumoMTA SMTP Authentication Credentials")
-	fmt.Fprintln(&b, "# Format: username = \"password\"")
+	fmt.Fprintln(&b, "# KumoMTA SMTP Authentication Users")
+	fmt.Fprintln(&b, "# Format: username = true (passwords are verified by the panel)")
 	fmt.Fprintln(&b, "")
 
 	for _, d := range snap.Domains {
 		for _, s := range d.Senders {
 			// Only add if a password is set
-			if s.SMTPPassword != "" {
-				// Escape quotes in password just in case
-				safePass := strings.ReplaceAll(s.SMTPPassword, "\"", "\\\"")
-				fmt.Fprintf(&b, "\"%s\" = \"%s\"\n", s.Email, safePass)
+			if s.SMTPPasswordHash != "" {
+				fmt.Fprintf(&b, "\"%s\" = true\n", s.Email)
 			}
 		}
 	}
@@ -67,14 +115,45 @@ func GenerateSourcesTOML(snap *Snapshot) string {
 		fmt.Fprintf(&b, "# ========================================\n\n")
 
 		for _, s := range d.Senders {
+			// Pooled senders egress through the shared pool sources below
+			if SenderPoolName(snap, d, s) != PoolName(d, s) {
+				continue
+			}
+
 			name := SourceName(d, s)
-			// EHLO host: "localpart.domain" or "mail.domain"
-			ehloDomain := fmt.Sprintf("%s.%s", s.LocalPart, d.Name)
 
 			fmt.Fprintf(&b, "[\"%s\"]\n", name)
 			fmt.Fprintf(&b, "source_address = \"%s\"\n", s.IP)
-			fmt.Fprintf(&b, "ehlo_domain = \"%s\"\n\n", ehloDomain)
+			fmt.Fprintf(&b, "ehlo_domain = \"%s\"\n\n", senderEHLO(d, s))
+		}
+	}
+
+	// Shared multi-IP pools: one source per member IP + a weighted pool table
+	for _, p := range snap.Pools {
+		if len(p.Members) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&b, "# ========================================\n")
+		fmt.Fprintf(&b, "# Pool %s\n", p.Name)
+		fmt.Fprintf(&b, "# ========================================\n\n")
+
+		for _, m := range p.Members {
+			fmt.Fprintf(&b, "[\"%s\"]\n", PoolSourceName(p, m.SystemIP.Value))
+			fmt.Fprintf(&b, "source_address = \"%s\"\n", m.SystemIP.Value)
+			fmt.Fprintf(&b, "ehlo_domain = \"%s\"\n\n", poolMemberEHLO(snap, p, m))
+		}
+
+		fmt.Fprintf(&b, "[pools.\"%s\"]\n", EgressPoolName(p))
+		fmt.Fprintf(&b, "entries = [\n")
+		for _, m := range p.Members {
+			weight := m.Weight
+			if weight <= 0 {
+				weight = 1
+			}
+			fmt.Fprintf(&b, "  { name = \"%s\", weight = %d },\n", PoolSourceName(p, m.SystemIP.Value), weight)
 		}
+		fmt.Fprintf(&b, "]\n\n")
 	}
 	return b.String()
 }
@@ -96,19 +175,32 @@ func GenerateQueuesTOML(snap *Snapshot) string {
 		fmt.Fprintf(&b, "# ========================================\n\n")
 
 		for _, s := range d.Senders {
-			pool := PoolName(d, s)
-			tenantKey := fmt.Sprintf("tenant:%s", pool)
+			pool := SenderPoolName(snap, d, s)
+			tenantKey := fmt.Sprintf("tenant:%s", PoolName(d, s))
 
 			fmt.Fprintf(&b, "[\"%s\"]\n", tenantKey)
 			fmt.Fprintf(&b, "egress_pool = \"%s\"\n", pool)
-			fmt.Fprintf(&b, "retry_interval = \"1m\"\n")
-			fmt.Fprintf(&b, "max_age = \"3d\"\n")
+			writeQueuePolicy(&b, EffectiveQueuePolicy(d, s))
 
 			rate := GetSenderRate(s)
 			if rate != "" {
 				fmt.Fprintf(&b, "max_message_rate = \"%s\"\n", rate)
 			}
 			fmt.Fprintf(&b, "\n")
+
+			// Per-campaign overrides: only the fields that differ are written,
+			// the rest falls back to the tenant entry in get_queue_config.
+			campaigns := campaignPoliciesFor(snap, d, s)
+			names := make([]string, 0, len(campaigns))
+			for name := range campaigns {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Fprintf(&b, "[\"campaign:%s:%s\"]\n", PoolName(d, s), name)
+				writeQueuePolicy(&b, campaigns[name])
+				fmt.Fprintf(&b, "\n")
+			}
 		}
 	}
 	return b.String()
@@ -129,6 +221,60 @@ func GenerateListenerDomainsTOML(snap *Snapshot) string {
 	return b.String()
 }
 
+// =======================
+// shaping.toml generator
+// =======================
+
+// GenerateShapingTOML renders per-destination egress path limits as an
+// ordered [[rules]] array, so find_shaping picks the same rule on every
+// run: rules with the most specific (longest) mx_rollup come first, ties
+// and the rest by domain. "default" applies when nothing else matches.
+func GenerateShapingTOML(snap *Snapshot) string {
+	rules := make([]models.TrafficShaping, 0, len(snap.Shaping))
+	for _, sh := range snap.Shaping {
+		// Rules saved before ValidateShaping checked hostnames
+		if err := ValidateShaping(&sh); err != nil {
+			continue
+		}
+		rules = append(rules, sh)
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		if len(rules[i].MXRollup) != len(rules[j].MXRollup) {
+			return len(rules[i].MXRollup) > len(rules[j].MXRollup)
+		}
+		return rules[i].Domain < rules[j].Domain
+	})
+
+	var b strings.Builder
+	fmt.Fprintln(&b, "# KumoMTA Traffic Shaping (per destination)")
+	fmt.Fprintln(&b, "")
+
+	for _, sh := range rules {
+		fmt.Fprintf(&b, "[[rules]]\n")
+		fmt.Fprintf(&b, "domain = \"%s\"\n", sh.Domain)
+		if sh.MXRollup != "" {
+			fmt.Fprintf(&b, "mx_rollup = \"%s\"\n", sh.MXRollup)
+		}
+		if sh.MaxConnections > 0 {
+			fmt.Fprintf(&b, "connection_limit = %d\n", sh.MaxConnections)
+		}
+		if sh.MaxDeliveriesPerConnection > 0 {
+			fmt.Fprintf(&b, "max_deliveries_per_connection = %d\n", sh.MaxDeliveriesPerConnection)
+		}
+		if sh.EnableTLS != "" {
+			fmt.Fprintf(&b, "enable_tls = \"%s\"\n", sh.EnableTLS)
+		}
+		if sh.ConnectionRate != "" {
+			fmt.Fprintf(&b, "max_connection_rate = \"%s\"\n", sh.ConnectionRate)
+		}
+		if sh.MessageRate != "" {
+			fmt.Fprintf(&b, "max_message_rate = \"%s\"\n", sh.MessageRate)
+		}
+		fmt.Fprintf(&b, "\n")
+	}
+	return b.String()
+}
+
 // =======================
 // dkim_data.toml generator
 // =======================
@@ -148,11 +294,11 @@ func GenerateDKIMDataTOML(snap *Snapshot, dkimBasePath string) string {
 		fmt.Fprintf(&b, "[domain.\"%s\"]\n", d.Name)
 		fmt.Fprintf(&b, "selector = \"default\"\n")
 		// DO NOT include X- headers here, or scrubbing them will break the signature
-		fmt.Fprintf(&b, "headers = [\"From\", \"To\", \"Subject\", \"Date\", \"Message-ID\", \"List-Unsubscribe\"]\n\n")
+		fmt.Fprintf(&b, "headers = [\"From\", \"To\", \"Subject\", \"Date\", \"Message-ID\", \"List-Unsubscribe\", \"List-Unsubscribe-Post\"]\n\n")
 
 		for _, s := range d.Senders {
-			selector := s.LocalPart
-			keyFile := fmt.Sprintf("%s/%s/%s.key", strings.TrimRight(dkimBasePath, "/"), d.Name, s.LocalPart)
+			selector := SenderDKIMSelector(s)
+			keyFile := senderDKIMKeyFile(dkimBasePath, d, s)
 			matchSender := s.Email
 
 			fmt.Fprintf(&b, "[[domain.\"%s\".policy]]\n", d.Name)
@@ -193,12 +339,6 @@ func GenerateInitLua(snap *Snapshot) string {
 		}
 	}
 
-	relayList := make([]string, 0, len(relayIPs))
-	for _, ip := range relayIPs {
-		relayList = append(relayList, fmt.Sprintf("'%s'", ip))
-	}
-	relayListStr := strings.Join(relayList, ", ")
-
 	var b strings.Builder
 
 	// --- 1. System Config ---
@@ -242,50 +382,10 @@ kumo.on('init', function()
   }
 
   -- SMTP Listeners
-  kumo.start_esmtp_listener {
-    listen = '`)
-	b.WriteString(listenAddr)
-	b.WriteString(`',
-    hostname = '`)
-	b.WriteString(mainHostname)
-	b.WriteString(`',
-    banner = '220 ' .. '`)
-	b.WriteString(mainHostname)
-	b.WriteString(`', -- Minimal banner
-    relay_hosts = { `)
-	b.WriteString(relayListStr)
-	b.WriteString(` },
-    trace_headers = trace_settings,
-  }
-
-  kumo.start_esmtp_listener {
-    listen = '0.0.0.0:587',
-    hostname = '`)
-	b.WriteString(mainHostname)
-	b.WriteString(`',
-    banner = '220 ' .. '`)
-	b.WriteString(mainHostname)
-	b.WriteString(`', 
-    relay_hosts = { `)
-	b.WriteString(relayListStr)
-	b.WriteString(` },
-    trace_headers = trace_settings,
-  }
-
-  kumo.start_esmtp_listener {
-    listen = '0.0.0.0:465',
-    hostname = '`)
-	b.WriteString(mainHostname)
-	b.WriteString(`',
-    banner = '220 ' .. '`)
-	b.WriteString(mainHostname)
-	b.WriteString(`',
-    relay_hosts = { `)
-	b.WriteString(relayListStr)
-	b.WriteString(` },
-    trace_headers = trace_settings,
-  }
-end)
+`)
+	b.WriteString(generateListenersLua(snap, mainHostname, listenAddr, relayIPs))
+	b.WriteString(generateLogHookInitLua())
+	b.WriteString(`end)
 
 `)
 
@@ -295,21 +395,15 @@ end)
 	b.WriteString("local queues_data = kumo.toml_load('/opt/kumomta/etc/policy/queues.toml')\n")
 	b.WriteString("local dkim_data = kumo.toml_load('/opt/kumomta/etc/policy/dkim_data.toml')\n")
 	b.WriteString("local listener_domains = kumo.toml_load('/opt/kumomta/etc/policy/listener_domains.toml')\n")
-	b.WriteString("local auth_users = kumo.toml_load('/opt/kumomta/etc/policy/auth.toml')\n\n")
+	b.WriteString("local auth_users = kumo.toml_load('/opt/kumomta/etc/policy/auth.toml')\n")
+	b.WriteString("local shaping_data = kumo.toml_load('/opt/kumomta/etc/policy/shaping.toml')\n")
+	b.WriteString("local routing_data = kumo.toml_load('/opt/kumomta/etc/policy/routing.toml')\n")
+	b.WriteString("local suppression_data = kumo.toml_load('/opt/kumomta/etc/policy/suppression.toml')\n\n")
 
 	// --- 3. SMTP Authentication Hook ---
-	b.WriteString(`-- =====================================================
--- SMTP AUTHENTICATION (PLAIN)
--- =====================================================
-kumo.on('smtp_server_auth_plain', function(auth_user, auth_password)
-  local valid_pass = auth_users[auth_user]
-  if valid_pass and valid_pass == auth_password then
-    return true
-  end
-  return false
-end)
-
-`)
+	b.WriteString(generateSMTPAuthLua(snap))
+	b.WriteString(generateRequireAuthLua(snap))
+	b.WriteString(generateLogHookLua(snap))
 
 	// --- 4. Tenant Logic (Double-Underscore Separator) ---
 	b.WriteString(`-- =====================================================
@@ -349,7 +443,20 @@ end)
 -- EGRESS POOLS / SOURCES
 -- =====================================================
 -- Pool name uses double-underscore separator: "domain.com__localpart"
+-- Shared multi-IP pools are named "pool__<name>" and listed under [pools]
 kumo.on('get_egress_pool', function(pool_name)
+  local shared = sources_data.pools and sources_data.pools[pool_name]
+  if shared then
+    local entries = {}
+    for _, e in ipairs(shared.entries or {}) do
+      table.insert(entries, { name = e.name, weight = e.weight or 1 })
+    end
+    return kumo.make_egress_pool {
+      name = pool_name,
+      entries = entries,
+    }
+  end
+
   -- Pool name format: "domain.com__localpart" (same as source name)
   if sources_data[pool_name] then
     return kumo.make_egress_pool {
@@ -372,23 +479,117 @@ kumo.on('get_egress_source', function(source_name)
   return kumo.make_egress_source { name = source_name }
 end)
 
+-- =====================================================
+-- TRAFFIC SHAPING (PER DESTINATION)
+-- =====================================================
+-- Exact recipient domain wins, then the first MX rollup match on the site
+-- name (rules are ordered most specific first), then the "default" entry.
+local function find_shaping(domain, site_name)
+  local rules = shaping_data.rules or {}
+  for _, entry in ipairs(rules) do
+    if entry.domain == domain then
+      return entry
+    end
+  end
+  if site_name then
+    for _, entry in ipairs(rules) do
+      if entry.mx_rollup and site_name:find(entry.mx_rollup, 1, true) then
+        return entry
+      end
+    end
+  end
+  for _, entry in ipairs(rules) do
+    if entry.domain == 'default' then
+      return entry
+    end
+  end
+  return {}
+end
+
+-- Smarthost routes may use a non-standard port. The site of a smarthost
+-- route is the smarthost itself (bracketed when it is an IP), so the port
+-- is looked up by exact name: a substring match would also hit MX sites
+-- that merely contain the host, e.g. "relay.corp" in "mx.relay.corp.example".
+local smarthost_ports = {}
+for _, rule in ipairs(routing_data.rules or {}) do
+  if rule.smarthost and smarthost_ports[rule.smarthost:lower()] == nil then
+    smarthost_ports[rule.smarthost:lower()] = rule.smarthost_port
+    smarthost_ports['[' .. rule.smarthost:lower() .. ']'] = rule.smarthost_port
+  end
+end
+
+local function smarthost_port(site_name)
+  if site_name then
+    return smarthost_ports[site_name:lower()]
+  end
+  return nil
+end
+
 kumo.on('get_egress_path_config', function(domain, egress_source, site_name)
+  local cfg = find_shaping(domain, site_name)
   return kumo.make_egress_path {
-    enable_tls = 'OpportunisticInsecure',
+    enable_tls = cfg.enable_tls or 'OpportunisticInsecure',
     enable_mta_sts = false,
+    connection_limit = cfg.connection_limit,
+    max_deliveries_per_connection = cfg.max_deliveries_per_connection,
+    max_connection_rate = cfg.max_connection_rate,
+    max_message_rate = cfg.max_message_rate,
+    smtp_port = smarthost_port(site_name),
   }
 end)
 
+-- =====================================================
+-- ROUTING RULES (RECIPIENT DOMAIN -> POOL / SMARTHOST)
+-- =====================================================
+-- Patterns only use '*' as wildcard; first matching rule wins.
+local function glob_match(pattern, value)
+  local escaped = pattern:gsub('[%^%$%(%)%%%.%[%]%+%-%?]', '%%%0')
+  local lua_pattern = '^' .. escaped:gsub('%*', '.*') .. '$'
+  return value:match(lua_pattern) ~= nil
+end
+
+local function find_route(tenant, domain)
+  for _, rule in ipairs(routing_data.rules or {}) do
+    if glob_match(rule.tenant or '*', tenant) then
+      for _, pattern in ipairs(rule.domains or {}) do
+        if glob_match(pattern, domain) then
+          return rule
+        end
+      end
+    end
+  end
+  return nil
+end
+
 -- =====================================================
 -- QUEUE CONFIG
 -- =====================================================
+-- Campaign overrides ("campaign:<tenant>:<X-Campaign>") win field by field
+-- over the tenant entry. Routing rules may swap the pool or add a smarthost.
 kumo.on('get_queue_config', function(domain, tenant, campaign, routing_domain)
-  tenant = tenant or "default"
+`)
+	b.WriteString(logHookQueueLua())
+	b.WriteString(`  tenant = tenant or "default"
   local cfg = queues_data['tenant:' .. tenant] or {}
+  local ccfg = {}
+  if campaign then
+    ccfg = queues_data['campaign:' .. tenant .. ':' .. campaign] or {}
+  end
+  local egress_pool = cfg.egress_pool or tenant
+  local protocol = nil
+  local route = find_route(tenant:lower(), (domain or ''):lower())
+  if route then
+    egress_pool = route.egress_pool or egress_pool
+    if route.smarthost then
+      protocol = { smtp = { mx_list = { route.smarthost } } }
+    end
+  end
   return kumo.make_queue_config {
-    egress_pool = cfg.egress_pool or tenant,
-    retry_interval = cfg.retry_interval or '1m',
-    max_age = cfg.max_age or '3d',
+    egress_pool = egress_pool,
+    protocol = protocol,
+    retry_interval = ccfg.retry_interval or cfg.retry_interval or '1m',
+    max_retry_interval = ccfg.max_retry_interval or cfg.max_retry_interval,
+    max_age = ccfg.max_age or cfg.max_age or '3d',
     max_message_rate = cfg.max_message_rate,
   }
 end)
@@ -454,9 +655,33 @@ local function scrub_headers(msg)
   ))
 end
 
+-- =====================================================
+-- SUPPRESSION LIST
+-- =====================================================
+-- Values are expiry timestamps (0 = permanent)
+local function suppression_active(expires)
+  return expires ~= nil and (expires == 0 or expires > os.time())
+end
+
+local function is_suppressed(rcpt)
+  if not rcpt then return false end
+  local addr = string.lower(tostring(rcpt))
+  local domain = addr:match('@([^@]+)$') or ''
+  return suppression_active((suppression_data.addresses or {})[addr])
+    or suppression_active((suppression_data.domains or {})[domain])
+end
+
 -- =====================================================
 -- SMTP PATH
 -- =====================================================
+-- Checked per RCPT so only the suppressed recipients of a
+-- multi-recipient transaction are refused
+kumo.on('smtp_server_rcpt_to', function(recipient, conn_meta)
+  if is_suppressed(recipient) then
+    kumo.reject(550, '5.7.1 Recipient address is suppressed')
+  end
+end)
+
 kumo.on('smtp_server_message_received', function(msg)
   local sender = msg:from_header()
   local sender_email = sender and sender.email or ""
@@ -475,6 +700,12 @@ end)
 -- HTTP / API PATH
 -- =====================================================
 kumo.on('http_message_generated', function(msg)
+  -- Injection API: drop instead of failing the whole request
+  if is_suppressed(msg:recipient()) then
+    msg:set_meta('queue', 'null')
+    return
+  end
+
   local tenant = msg:get_first_named_header_value('X-Tenant')
   if not tenant then
     local sender = msg:from_header()
@@ -491,9 +722,9 @@ kumo.on('http_message_generated', function(msg)
 end)
 
 -- =====================================================
--- OPTIONAL: Custom Hook (Safe place for manual overrides)
+-- CUSTOM POLICY SNIPPETS (managed in the panel)
 -- =====================================================
-pcall(dofile, '/opt/kumomta/etc/policy/custom.lua')
+dofile('/opt/kumomta/etc/policy/custom.lua')
 `)
 
 	return b.String()
@@ -0,0 +1,364 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+)
+
+func TestGenerateShapingTOML(t *testing.T) {
+	snap := &Snapshot{
+		Shaping: []models.TrafficShaping{
+			{
+				Domain:                     "Gmail.com",
+				MXRollup:                   "google.com",
+				MaxConnections:             20,
+				MaxDeliveriesPerConnection: 50,
+				EnableTLS:                  "Required",
+				ConnectionRate:             "10/min",
+			},
+			{Domain: "default", EnableTLS: "OpportunisticInsecure"},
+			{Domain: "outlook.com", MXRollup: "outlook.com"},
+			{Domain: "live.com", MXRollup: "outlook.com"},
+		},
+	}
+
+	out := GenerateShapingTOML(snap)
+
+	for _, want := range []string{
+		"[[rules]]\ndomain = \"gmail.com\"\n",
+		`mx_rollup = "google.com"`,
+		`connection_limit = 20`,
+		`max_deliveries_per_connection = 50`,
+		`enable_tls = "Required"`,
+		`max_connection_rate = "10/min"`,
+		`domain = "default"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output:\n%s", want, out)
+		}
+	}
+
+	// Same order every time: longest mx_rollup first, then by domain
+	var order []string
+	for _, line := range strings.Split(out, "\n") {
+		if d, ok := strings.CutPrefix(line, "domain = "); ok {
+			order = append(order, strings.Trim(d, `"`))
+		}
+	}
+	if got := strings.Join(order, ","); got != "live.com,outlook.com,gmail.com,default" {
+		t.Errorf("rule order = %s", got)
+	}
+
+	// Unset limits must not be emitted (KumoMTA defaults apply)
+	if strings.Contains(out, "max_message_rate") {
+		t.Errorf("unexpected max_message_rate in output:\n%s", out)
+	}
+}
+
+func TestValidateShaping(t *testing.T) {
+	ok := &models.TrafficShaping{Domain: " Outlook.com ", EnableTLS: "Opportunistic", ConnectionRate: "5/min"}
+	if err := ValidateShaping(ok); err != nil {
+		t.Fatalf("expected valid rule, got %v", err)
+	}
+	if ok.Domain != "outlook.com" {
+		t.Errorf("expected normalized domain, got %q", ok.Domain)
+	}
+	if err := ValidateShaping(&models.TrafficShaping{Domain: "hotmail.com", MXRollup: "Protection.Outlook.com"}); err != nil {
+		t.Errorf("rule with rollup: %v", err)
+	}
+
+	bad := []models.TrafficShaping{
+		{},
+		{Domain: "yahoo.com", EnableTLS: "Sometimes"},
+		{Domain: "yahoo.com", ConnectionRate: "fast"},
+		{Domain: "yahoo.com", MaxConnections: -1},
+		{Domain: "yahoo.com\"]\nx = 1"},
+		{Domain: "yahoo.com\\"},
+		{Domain: "yahoo"},
+		{Domain: "yahoo.com", MXRollup: "yahoodns.net\n[[rules]]"},
+		{Domain: "yahoo.com", MXRollup: `yahoodns\.net`},
+	}
+	for i := range bad {
+		if err := ValidateShaping(&bad[i]); err == nil {
+			t.Errorf("case %d: expected validation error", i)
+		}
+	}
+}
+
+func TestGenerateSourcesAndQueuesWithPool(t *testing.T) {
+	pool := models.EgressPool{
+		ID:         7,
+		Name:       "bulk",
+		EHLODomain: "mta.example.net",
+		Members: []models.EgressPoolMember{
+			{SystemIP: models.SystemIP{Value: "203.0.113.10", Hostname: "o1.example.net"}, Weight: 3},
+			{SystemIP: models.SystemIP{Value: "203.0.113.11"}},
+		},
+	}
+	snap := &Snapshot{
+		Pools: []models.EgressPool{pool},
+		Domains: []models.Domain{{
+			Name: "example.com",
+			Senders: []models.Sender{
+				{LocalPart: "news", IP: "198.51.100.5", EgressPoolID: 7},
+				{LocalPart: "info", IP: "198.51.100.6"},
+			},
+		}},
+	}
+
+	sources := GenerateSourcesTOML(snap)
+	for _, want := range []string{
+		`["example.com__info"]`,
+		`["pool__bulk__203.0.113.10"]`,
+		`ehlo_domain = "o1.example.net"`,
+		`ehlo_domain = "mta.example.net"`,
+		`[pools."pool__bulk"]`,
+		`{ name = "pool__bulk__203.0.113.10", weight = 3 },`,
+		`{ name = "pool__bulk__203.0.113.11", weight = 1 },`,
+	} {
+		if !strings.Contains(sources, want) {
+			t.Errorf("expected %q in sources.toml:\n%s", want, sources)
+		}
+	}
+	// Pooled sender must not keep its own single-IP source
+	if strings.Contains(sources, `["example.com__news"]`) {
+		t.Errorf("pooled sender still has a single-IP source:\n%s", sources)
+	}
+
+	queues := GenerateQueuesTOML(snap)
+	if !strings.Contains(queues, "[\"tenant:example.com__news\"]\negress_pool = \"pool__bulk\"") {
+		t.Errorf("pooled tenant not routed to shared pool:\n%s", queues)
+	}
+	if !strings.Contains(queues, "[\"tenant:example.com__info\"]\negress_pool = \"example.com__info\"") {
+		t.Errorf("single-IP tenant changed pool:\n%s", queues)
+	}
+}
+
+func TestGenerateInitLuaListeners(t *testing.T) {
+	settings := &models.AppSettings{MainHostname: "mta.example.net", SMTPListenAddr: "10.0.0.1:25"}
+
+	// No listeners configured: legacy 25/587/465 set.
+	legacy := GenerateInitLua(&Snapshot{Settings: settings})
+	for _, want := range []string{"listen = '10.0.0.1:25'", "listen = '0.0.0.0:587'", "listen = '0.0.0.0:465'"} {
+		if !strings.Contains(legacy, want) {
+			t.Errorf("expected %q in legacy listeners", want)
+		}
+	}
+	if strings.Contains(legacy, "smtp_server_mail_from") {
+		t.Error("legacy listeners should not require AUTH")
+	}
+
+	l := models.Listener{
+		ListenAddr:     "0.0.0.0:465",
+		TLSCertificate: "/etc/pki/mta.crt",
+		TLSPrivateKey:  "/etc/pki/mta.key",
+		ImplicitTLS:    true,
+		RequireAuth:    true,
+		RelayHosts:     "192.0.2.0/24, 127.0.0.1",
+		MaxMessageSize: 10485760,
+	}
+	if err := ValidateListener(&l); err != nil {
+		t.Fatalf("ValidateListener: %v", err)
+	}
+
+	lua := GenerateInitLua(&Snapshot{Settings: settings, Listeners: []models.Listener{l}})
+	for _, want := range []string{
+		"listen = '0.0.0.0:465',\n    hostname = 'mta.example.net',\n    banner = '220 mta.example.net',",
+		"relay_hosts = { '192.0.2.0/24', '127.0.0.1' },",
+		"tls_certificate = '/etc/pki/mta.crt',",
+		"implicit_tls = true,",
+		"max_message_size = 10485760,",
+		"local auth_required_ports = { ['465'] = true }",
+	} {
+		if !strings.Contains(lua, want) {
+			t.Errorf("expected %q in init.lua", want)
+		}
+	}
+	if strings.Contains(lua, "0.0.0.0:587") {
+		t.Error("unconfigured 587 listener was still rendered")
+	}
+
+	bad := models.Listener{ListenAddr: "0.0.0.0:465", ImplicitTLS: true}
+	if err := ValidateListener(&bad); err == nil {
+		t.Error("implicit TLS without a certificate should be rejected")
+	}
+
+	// Same port on another IP: only allowed with the same require_auth
+	l.ID = 1
+	saved := []models.Listener{l}
+	if err := CheckListenerPortAuth(models.Listener{ID: 2, ListenAddr: "10.0.0.5:465"}, saved); err == nil {
+		t.Error("same-port listener without AUTH accepted")
+	}
+	if err := CheckListenerPortAuth(models.Listener{ID: 2, ListenAddr: "10.0.0.5:465", RequireAuth: true}, saved); err != nil {
+		t.Errorf("same-port listener with AUTH: %v", err)
+	}
+	if err := CheckListenerPortAuth(models.Listener{ID: 1, ListenAddr: "0.0.0.0:465"}, saved); err != nil {
+		t.Errorf("turning AUTH off on the only listener: %v", err)
+	}
+}
+
+func TestGenerateQueuesTOMLPolicies(t *testing.T) {
+	snap := &Snapshot{
+		Domains: []models.Domain{{
+			ID:          1,
+			Name:        "example.com",
+			QueuePolicy: models.QueuePolicy{RetryInterval: "10m", MaxRetryInterval: "4h"},
+			Senders: []models.Sender{
+				{ID: 1, LocalPart: "news", IP: "198.51.100.5"},
+				{ID: 2, LocalPart: "alerts", IP: "198.51.100.6", QueuePolicy: models.QueuePolicy{RetryInterval: "30s", MaxAge: "2h"}},
+			},
+		}},
+		CampaignPolicies: []models.CampaignQueuePolicy{
+			{DomainID: 1, Campaign: "42", QueuePolicy: models.QueuePolicy{MaxAge: "1d"}},
+			{DomainID: 1, SenderID: 2, Campaign: "42", QueuePolicy: models.QueuePolicy{MaxAge: "30m"}},
+		},
+	}
+
+	queues := GenerateQueuesTOML(snap)
+	for _, want := range []string{
+		"[\"tenant:example.com__news\"]\negress_pool = \"example.com__news\"\nretry_interval = \"10m\"\nmax_retry_interval = \"4h\"\nmax_age = \"3d\"\n",
+		"[\"tenant:example.com__alerts\"]\negress_pool = \"example.com__alerts\"\nretry_interval = \"30s\"\nmax_retry_interval = \"4h\"\nmax_age = \"2h\"\n",
+		"[\"campaign:example.com__news:42\"]\nmax_age = \"1d\"\n",
+		"[\"campaign:example.com__alerts:42\"]\nmax_age = \"30m\"\n",
+	} {
+		if !strings.Contains(queues, want) {
+			t.Errorf("expected %q in queues.toml:\n%s", want, queues)
+		}
+	}
+
+	bad := models.QueuePolicy{RetryInterval: "1h", MaxRetryInterval: "10m"}
+	if err := ValidateQueuePolicy(&bad); err == nil {
+		t.Error("max_retry_interval shorter than retry_interval should be rejected")
+	}
+	if err := ValidateQueuePolicy(&models.QueuePolicy{MaxAge: "forever"}); err == nil {
+		t.Error("invalid duration should be rejected")
+	}
+
+	// Each layer valid on its own, inverted once merged
+	d := models.Domain{ID: 1, Name: "example.com", QueuePolicy: models.QueuePolicy{MaxRetryInterval: "10m"}}
+	if err := CheckQueuePolicyLayers(d, nil); err != nil {
+		t.Errorf("domain alone: %v", err)
+	}
+	d.Senders = []models.Sender{{ID: 1, Email: "news@example.com", QueuePolicy: models.QueuePolicy{RetryInterval: "1h"}}}
+	if err := CheckQueuePolicyLayers(d, nil); err == nil || !strings.Contains(err.Error(), "news@example.com") {
+		t.Errorf("sender retry_interval over the domain cap: %v", err)
+	}
+	d.Senders[0].QueuePolicy = models.QueuePolicy{RetryInterval: "5m"}
+	for _, cp := range []models.CampaignQueuePolicy{
+		{DomainID: 1, Campaign: "sale", QueuePolicy: models.QueuePolicy{RetryInterval: "30m"}},
+		{DomainID: 1, SenderID: 1, Campaign: "sale", QueuePolicy: models.QueuePolicy{RetryInterval: "20m"}},
+	} {
+		if err := CheckQueuePolicyLayers(d, []models.CampaignQueuePolicy{cp}); err == nil {
+			t.Errorf("campaign %+v over the domain cap accepted", cp)
+		}
+	}
+	if err := CheckQueuePolicyLayers(models.Domain{Name: "x.com", QueuePolicy: models.QueuePolicy{MaxRetryInterval: "30s"}}, nil); err == nil {
+		t.Error("max_retry_interval under the built-in retry_interval accepted")
+	}
+}
+
+func TestRoutingRules(t *testing.T) {
+	pool := models.EgressPool{
+		ID:   3,
+		Name: "microsoft",
+		Members: []models.EgressPoolMember{
+			{SystemIP: models.SystemIP{Value: "203.0.113.20", Hostname: "o2.example.net"}, Weight: 1},
+		},
+	}
+	snap := &Snapshot{
+		Pools: []models.EgressPool{pool},
+		Domains: []models.Domain{{
+			Name:    "example.com",
+			Senders: []models.Sender{{LocalPart: "news", Email: "news@example.com", IP: "198.51.100.5"}},
+		}},
+		RoutingRules: []models.RoutingRule{
+			{ID: 1, Name: "disabled", Enabled: false, RecipientDomains: "*", Smarthost: "nowhere.test"},
+			{ID: 2, Name: "microsoft", Enabled: true, RecipientDomains: "outlook.com,hotmail.com", EgressPoolID: 3},
+			{ID: 3, Name: "internal", Enabled: true, TenantPattern: "example.com__*", RecipientDomains: "*.internal", Smarthost: "relay.corp:2525"},
+		},
+	}
+	for i := range snap.RoutingRules {
+		if err := ValidateRoutingRule(&snap.RoutingRules[i]); err != nil {
+			t.Fatalf("ValidateRoutingRule(%s): %v", snap.RoutingRules[i].Name, err)
+		}
+	}
+
+	toml := GenerateRoutingTOML(snap)
+	if strings.Contains(toml, "disabled") {
+		t.Errorf("disabled rule rendered:\n%s", toml)
+	}
+	for _, want := range []string{
+		"name = \"microsoft\"\ntenant = \"*\"\ndomains = [\"outlook.com\", \"hotmail.com\"]\negress_pool = \"pool__microsoft\"\n",
+		"tenant = \"example.com__*\"\ndomains = [\"*.internal\"]\nsmarthost = \"relay.corp\"\nsmarthost_port = 2525\n",
+	} {
+		if !strings.Contains(toml, want) {
+			t.Errorf("expected %q in routing.toml:\n%s", want, toml)
+		}
+	}
+
+	dec, err := ResolveRoute(snap, "news@example.com", "someone@Outlook.com")
+	if err != nil {
+		t.Fatalf("ResolveRoute: %v", err)
+	}
+	if dec.RuleName != "microsoft" || dec.EgressPool != "pool__microsoft" || len(dec.Sources) != 1 || dec.Sources[0].EHLODomain != "o2.example.net" {
+		t.Errorf("unexpected decision: %+v", dec)
+	}
+
+	dec, _ = ResolveRoute(snap, "news@example.com", "ops@build.internal")
+	if dec.RuleName != "internal" || dec.Smarthost != "relay.corp:2525" || dec.EgressPool != "example.com__news" {
+		t.Errorf("unexpected decision: %+v", dec)
+	}
+
+	dec, _ = ResolveRoute(snap, "news@example.com", "a@gmail.com")
+	if dec.RuleID != 0 || dec.Sources[0].Address != "198.51.100.5" {
+		t.Errorf("expected default route: %+v", dec)
+	}
+
+	if _, err := ResolveRoute(snap, "nobody@example.com", "a@gmail.com"); err == nil {
+		t.Error("unknown sender should fail")
+	}
+
+	// The smarthost port only applies to the smarthost's own site, not to
+	// every MX site whose name contains it
+	init := GenerateInitLua(snap)
+	if !strings.Contains(init, "return smarthost_ports[site_name:lower()]") || strings.Contains(init, "site_name:find(rule.smarthost") {
+		t.Error("init.lua should look up smarthost ports by exact site name")
+	}
+}
+
+func TestGenerateCustomLua(t *testing.T) {
+	snap := &Snapshot{Snippets: []models.PolicySnippet{
+		{Name: "rewrite-from", Enabled: true, Content: "local x = 1\n"},
+		{Name: "disabled", Enabled: false, Content: "error('boom')"},
+		{Name: "special-route", Enabled: true, Content: "local x = 2"},
+	}}
+
+	lua := GenerateCustomLua(snap)
+	if !strings.HasPrefix(lua, customLuaHeader) {
+		t.Error("custom.lua should start with the managed header")
+	}
+	first := strings.Index(lua, "-- snippet: rewrite-from\ndo\nlocal x = 1\nend\n")
+	second := strings.Index(lua, "-- snippet: special-route\ndo\nlocal x = 2\nend\n")
+	if first < 0 || second < 0 || second < first {
+		t.Errorf("snippets missing or out of order:\n%s", lua)
+	}
+	if strings.Contains(lua, "boom") {
+		t.Error("disabled snippet was rendered")
+	}
+
+	init := GenerateInitLua(snap)
+	if !strings.Contains(init, "\ndofile('/opt/kumomta/etc/policy/custom.lua')") || strings.Contains(init, "pcall(dofile") {
+		t.Error("init.lua should load custom.lua without pcall")
+	}
+
+	for _, bad := range []models.PolicySnippet{
+		{Name: "has space", Content: "x = 1"},
+		{Name: "empty", Content: "  \n"},
+	} {
+		if err := ValidatePolicySnippet(&bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad.Name)
+		}
+	}
+}
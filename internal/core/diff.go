@@ -0,0 +1,217 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Line kinds used in DiffLine.Kind.
+const (
+	DiffAdded     = "added"
+	DiffRemoved   = "removed"
+	DiffUnchanged = "unchanged"
+)
+
+// diffContext is the number of unchanged lines kept around each change.
+const diffContext = 3
+
+// maxLCSCells caps the LCS table; beyond this the changed block is shown
+// as a full replace instead of a minimal diff.
+const maxLCSCells = 4_000_000
+
+// DiffLine is one line of a diff.
+type DiffLine struct {
+	Kind string `json:"kind"` // added, removed, unchanged
+	Text string `json:"text"`
+}
+
+// DiffHunk is a contiguous group of changes with surrounding context.
+// Start values are 1-based line numbers, as in unified diff headers.
+type DiffHunk struct {
+	OldStart int        `json:"old_start"`
+	OldLines int        `json:"old_lines"`
+	NewStart int        `json:"new_start"`
+	NewLines int        `json:"new_lines"`
+	Lines    []DiffLine `json:"lines"`
+}
+
+// splitLines splits text into lines, ignoring a single trailing newline.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// DiffLines returns the line-by-line edit script turning a into b.
+func DiffLines(a, b []string) []DiffLine {
+	// Common prefix and suffix are cheap and usually most of a config file.
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	out := make([]DiffLine, 0, len(a)+len(b))
+	for _, l := range a[:pre] {
+		out = append(out, DiffLine{Kind: DiffUnchanged, Text: l})
+	}
+
+	midA := a[pre : len(a)-suf]
+	midB := b[pre : len(b)-suf]
+	if len(midA)*len(midB) > maxLCSCells {
+		for _, l := range midA {
+			out = append(out, DiffLine{Kind: DiffRemoved, Text: l})
+		}
+		for _, l := range midB {
+			out = append(out, DiffLine{Kind: DiffAdded, Text: l})
+		}
+	} else {
+		out = append(out, lcsDiff(midA, midB)...)
+	}
+
+	for _, l := range a[len(a)-suf:] {
+		out = append(out, DiffLine{Kind: DiffUnchanged, Text: l})
+	}
+	return out
+}
+
+// lcsDiff is the classic longest-common-subsequence diff.
+func lcsDiff(a, b []string) []DiffLine {
+	n, m := len(a), len(b)
+	// lcs[i][j] = LCS length of a[i:] and b[j:]
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var out []DiffLine
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			out = append(out, DiffLine{Kind: DiffUnchanged, Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			out = append(out, DiffLine{Kind: DiffRemoved, Text: a[i]})
+			i++
+		default:
+			out = append(out, DiffLine{Kind: DiffAdded, Text: b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		out = append(out, DiffLine{Kind: DiffRemoved, Text: a[i]})
+	}
+	for ; j < m; j++ {
+		out = append(out, DiffLine{Kind: DiffAdded, Text: b[j]})
+	}
+	return out
+}
+
+// ComputeHunks diffs two texts and groups the changes into hunks with
+// diffContext lines of context. Identical texts produce no hunks.
+func ComputeHunks(oldText, newText string) []DiffHunk {
+	ops := DiffLines(splitLines(oldText), splitLines(newText))
+
+	// Line positions (0-based) in old/new before each op.
+	oldPos := make([]int, len(ops)+1)
+	newPos := make([]int, len(ops)+1)
+	for i, op := range ops {
+		oldPos[i+1], newPos[i+1] = oldPos[i], newPos[i]
+		if op.Kind != DiffAdded {
+			oldPos[i+1]++
+		}
+		if op.Kind != DiffRemoved {
+			newPos[i+1]++
+		}
+	}
+
+	var hunks []DiffHunk
+	i := 0
+	for i < len(ops) {
+		if ops[i].Kind == DiffUnchanged {
+			i++
+			continue
+		}
+
+		// Extend over further changes separated by at most 2*context lines.
+		last := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].Kind != DiffUnchanged {
+				last = j
+			} else if j-last > 2*diffContext {
+				break
+			}
+		}
+
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		stop := last + diffContext + 1
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+
+		h := DiffHunk{
+			OldStart: oldPos[start] + 1,
+			OldLines: oldPos[stop] - oldPos[start],
+			NewStart: newPos[start] + 1,
+			NewLines: newPos[stop] - newPos[start],
+			Lines:    append([]DiffLine(nil), ops[start:stop]...),
+		}
+		// Unified diff convention: an empty range starts at the line before.
+		if h.OldLines == 0 {
+			h.OldStart--
+		}
+		if h.NewLines == 0 {
+			h.NewStart--
+		}
+		hunks = append(hunks, h)
+		i = stop
+	}
+	return hunks
+}
+
+// UnifiedDiff renders a unified diff for one file, or "" if unchanged.
+func UnifiedDiff(name, oldText, newText string) string {
+	hunks := ComputeHunks(oldText, newText)
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- a/%s\n+++ b/%s\n", name, name)
+	for _, h := range hunks {
+		fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@\n", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+		for _, l := range h.Lines {
+			switch l.Kind {
+			case DiffAdded:
+				b.WriteString("+")
+			case DiffRemoved:
+				b.WriteString("-")
+			default:
+				b.WriteString(" ")
+			}
+			b.WriteString(l.Text)
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
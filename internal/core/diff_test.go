@@ -0,0 +1,101 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestComputeHunksIdentical(t *testing.T) {
+	text := "a\nb\nc\n"
+	if h := ComputeHunks(text, text); len(h) != 0 {
+		t.Fatalf("expected no hunks, got %d", len(h))
+	}
+	if d := UnifiedDiff("x.toml", text, text); d != "" {
+		t.Fatalf("expected empty diff, got %q", d)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	oldText := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	newText := "1\n2\n3\n4\nfive\n6\n7\n8\n9\n10\n11\n"
+
+	hunks := ComputeHunks(oldText, newText)
+	if len(hunks) != 1 {
+		t.Fatalf("expected changes to merge into 1 hunk, got %d", len(hunks))
+	}
+	h := hunks[0]
+	if h.OldStart != 2 || h.OldLines != 9 || h.NewStart != 2 || h.NewLines != 10 {
+		t.Errorf("unexpected hunk header: %+v", h)
+	}
+
+	want := `--- a/x.toml
++++ b/x.toml
+@@ -2,9 +2,10 @@
+ 2
+ 3
+ 4
+-5
++five
+ 6
+ 7
+ 8
+ 9
+ 10
++11
+`
+	if got := UnifiedDiff("x.toml", oldText, newText); got != want {
+		t.Errorf("unexpected diff:\n%s", got)
+	}
+}
+
+func TestUnifiedDiffNewFile(t *testing.T) {
+	got := UnifiedDiff("auth.toml", "", "a\nb\n")
+	if !strings.Contains(got, "@@ -0,0 +1,2 @@\n+a\n+b\n") {
+		t.Errorf("unexpected diff for new file:\n%s", got)
+	}
+}
+
+func TestComputeHunksSeparate(t *testing.T) {
+	var oldLines, newLines []string
+	for i := 0; i < 30; i++ {
+		l := strings.Repeat("x", i+1)
+		oldLines = append(oldLines, l)
+		if i == 2 || i == 25 {
+			l += "!"
+		}
+		newLines = append(newLines, l)
+	}
+	hunks := ComputeHunks(strings.Join(oldLines, "\n"), strings.Join(newLines, "\n"))
+	if len(hunks) != 2 {
+		t.Fatalf("expected 2 hunks, got %d", len(hunks))
+	}
+	if hunks[0].OldStart != 1 || hunks[1].OldStart != 23 {
+		t.Errorf("unexpected hunk starts: %d, %d", hunks[0].OldStart, hunks[1].OldStart)
+	}
+}
+
+func TestBuildPreview(t *testing.T) {
+	oldQueues := "[\"tenant:a.com__x\"]\negress_pool = \"a.com__x\"\n\n[\"tenant:a.com__y\"]\negress_pool = \"a.com__y\"\n"
+	newQueues := "[\"tenant:a.com__x\"]\negress_pool = \"a.com__x\"\n\n[\"tenant:b.com__z\"]\negress_pool = \"b.com__z\"\n\n[\"tenant:b.com__w\"]\negress_pool = \"b.com__w\"\n"
+	dkim := "[[domain.\"a.com\".policy]]\nmatch_sender = \"x@a.com\"\n"
+
+	files := []KumoConfigFile{
+		{Name: "queues.toml", Content: newQueues},
+		{Name: "dkim_data.toml", Content: ""},
+	}
+	p := buildPreview(files, map[string]string{"queues.toml": oldQueues, "dkim_data.toml": dkim})
+	if p.NoOp {
+		t.Fatal("expected changes")
+	}
+	if p.Summary != "2 tenants added, 1 tenant removed, 1 DKIM policy removed" {
+		t.Errorf("unexpected summary: %q", p.Summary)
+	}
+	if p.Files[0].Status != FileChanged || len(p.Files[0].Hunks) == 0 {
+		t.Errorf("expected queues.toml to be changed with hunks: %+v", p.Files[0])
+	}
+
+	same := buildPreview(files, map[string]string{"queues.toml": newQueues, "dkim_data.toml": ""})
+	if !same.NoOp || same.Summary != "no changes" {
+		t.Errorf("expected no-op preview, got %+v", same)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/pem"
 	"fmt"
 	"os"
@@ -24,6 +25,54 @@ func dkimKeyPaths(domain, selector string) (privPath, pubPath, dir string) {
 	return
 }
 
+// SenderDKIMSelector returns the selector a sender signs with
+// (its local part unless one was imported/configured).
+func SenderDKIMSelector(s models.Sender) string {
+	if s.DKIMSelector != "" {
+		return s.DKIMSelector
+	}
+	return s.LocalPart
+}
+
+// senderDKIMKeyFile returns the private key a sender signs with.
+func senderDKIMKeyFile(dkimBasePath string, d models.Domain, s models.Sender) string {
+	if s.DKIMKeyPath != "" {
+		return s.DKIMKeyPath
+	}
+	return fmt.Sprintf("%s/%s/%s.key", strings.TrimRight(dkimBasePath, "/"), d.Name, s.LocalPart)
+}
+
+// publicKeyFromPrivateFile derives the base64 DER public key from a PEM
+// private key (PKCS#1 or PKCS#8), for keys we did not generate ourselves.
+func publicKeyFromPrivateFile(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return ""
+	}
+
+	var pub interface{}
+	if k, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		pub = &k.PublicKey
+	} else if k, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if rk, ok := k.(*rsa.PrivateKey); ok {
+			pub = &rk.PublicKey
+		}
+	}
+	if pub == nil {
+		return ""
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(der)
+}
+
 // Check if DKIM key exists
 func DKIMKeyExists(domain, selector string) bool {
 	privPath, _, _ := dkimKeyPaths(domain, selector)
@@ -99,18 +148,22 @@ func ListDKIMDNSRecords(snap *Snapshot) ([]DKIMDNSRecord, error) {
 
 	for _, d := range snap.Domains {
 		for _, s := range d.Senders {
-			selector := s.LocalPart
+			selector := SenderDKIMSelector(s)
 			if selector == "" {
 				continue
 			}
 
-			_, pubPath, _ := dkimKeyPaths(d.Name, selector)
-			data, err := os.ReadFile(pubPath)
-			if err != nil {
-				continue
+			var pubBase64 string
+			if s.DKIMKeyPath != "" {
+				pubBase64 = publicKeyFromPrivateFile(s.DKIMKeyPath)
+			} else {
+				_, pubPath, _ := dkimKeyPaths(d.Name, s.LocalPart)
+				data, err := os.ReadFile(pubPath)
+				if err != nil {
+					continue
+				}
+				pubBase64 = extractPEMBase64(string(data))
 			}
-
-			pubBase64 := extractPEMBase64(string(data))
 			if pubBase64 == "" {
 				continue
 			}
@@ -3,6 +3,7 @@ package core
 import (
 	"fmt"
 	"net"
+	"sort"
 	"strings"
 	"sync"
 
@@ -21,6 +22,7 @@ type DMARCRecord struct {
 type AllDNSRecords struct {
 	Domain string          `json:"domain"`
 	A      []DNSRecord     `json:"a"`
+	AAAA   []DNSRecord     `json:"aaaa"`
 	MX     []DNSRecord     `json:"mx"`
 	SPF    DNSRecord       `json:"spf"`
 	DMARC  DNSRecord       `json:"dmarc"`
@@ -74,8 +76,9 @@ func GenerateDMARCRecord(domain *models.Domain) DMARCRecord {
 	}
 }
 
-// GenerateAllDNSRecords generates expected DNS records based on configuration
-func GenerateAllDNSRecords(domain *models.Domain, mainIP string, snap *Snapshot) AllDNSRecords {
+// GenerateAllDNSRecords generates expected DNS records based on configuration.
+// mainIPv6 is optional; when set the mail and bounce hosts also get AAAA records.
+func GenerateAllDNSRecords(domain *models.Domain, mainIP, mainIPv6 string, snap *Snapshot) AllDNSRecords {
 	records := AllDNSRecords{
 		Domain: domain.Name,
 	}
@@ -95,6 +98,12 @@ func GenerateAllDNSRecords(domain *models.Domain, mainIP string, snap *Snapshot)
 		{Name: mailHost, Type: "A", Value: mainIP, TTL: 3600},
 		{Name: bounceHost, Type: "A", Value: mainIP, TTL: 3600},
 	}
+	if mainIPv6 != "" {
+		records.AAAA = []DNSRecord{
+			{Name: mailHost, Type: "AAAA", Value: mainIPv6, TTL: 3600},
+			{Name: bounceHost, Type: "AAAA", Value: mainIPv6, TTL: 3600},
+		}
+	}
 
 	// MX Record
 	records.MX = []DNSRecord{
@@ -104,16 +113,22 @@ func GenerateAllDNSRecords(domain *models.Domain, mainIP string, snap *Snapshot)
 	// SPF Record - collect all IPs
 	ips := make(map[string]bool)
 	ips[mainIP] = true
+	ips[mainIPv6] = true
 	for _, sender := range domain.Senders {
+		if snap != nil {
+			if p := snap.PoolByID(sender.EgressPoolID); p != nil && len(p.Members) > 0 {
+				for _, m := range p.Members {
+					ips[m.SystemIP.Value] = true
+				}
+				continue
+			}
+		}
 		if sender.IP != "" {
 			ips[sender.IP] = true
 		}
 	}
 
-	ipParts := []string{}
-	for ip := range ips {
-		ipParts = append(ipParts, fmt.Sprintf("ip4:%s", ip))
-	}
+	ipParts := spfIPMechanisms(ips)
 
 	spfValue := fmt.Sprintf("v=spf1 %s ~all", strings.Join(ipParts, " "))
 	records.SPF = DNSRecord{
@@ -145,6 +160,23 @@ func GenerateAllDNSRecords(domain *models.Domain, mainIP string, snap *Snapshot)
 	return records
 }
 
+// spfIPMechanisms renders ip4:/ip6: mechanisms, IPv4 first, in a stable order.
+func spfIPMechanisms(ips map[string]bool) []string {
+	var v4, v6 []string
+	for ip := range ips {
+		switch {
+		case ip == "":
+		case IsIPv6(ip):
+			v6 = append(v6, "ip6:"+ip)
+		default:
+			v4 = append(v4, "ip4:"+ip)
+		}
+	}
+	sort.Strings(v4)
+	sort.Strings(v6)
+	return append(v4, v6...)
+}
+
 // LookupLiveDNS queries the actual DNS records for the domain
 func LookupLiveDNS(domain *models.Domain) (AllDNSRecords, error) {
 	records := AllDNSRecords{
@@ -154,17 +186,19 @@ func LookupLiveDNS(domain *models.Domain) (AllDNSRecords, error) {
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 
-	// Helper to add A records
+	// Helper to add A/AAAA records
 	addA := func(name string) {
 		defer wg.Done()
 		ips, err := net.LookupIP(name)
 		if err == nil {
 			for _, ip := range ips {
+				mu.Lock()
 				if ipv4 := ip.To4(); ipv4 != nil {
-					mu.Lock()
 					records.A = append(records.A, DNSRecord{Name: name, Type: "A", Value: ipv4.String()})
-					mu.Unlock()
+				} else {
+					records.AAAA = append(records.AAAA, DNSRecord{Name: name, Type: "AAAA", Value: ip.String()})
 				}
+				mu.Unlock()
 			}
 		}
 	}
@@ -231,23 +265,16 @@ func LookupLiveDNS(domain *models.Domain) (AllDNSRecords, error) {
 		}
 	}
 
-	wg.Add(3)
-	// 1. A Records
-	go func() {
-		defer wg.Done()
-		var subWg sync.WaitGroup
-		
-		mailHost := domain.MailHost
-		if mailHost == "" { mailHost = "mail." + domain.Name }
-		
-		bounceHost := domain.BounceHost
-		if bounceHost == "" { bounceHost = "bounce." + domain.Name }
-
-		subWg.Add(2)
-		go addA(mailHost)
-		go addA(bounceHost)
-		subWg.Wait()
-	}()
+	mailHost := domain.MailHost
+	if mailHost == "" { mailHost = "mail." + domain.Name }
+
+	bounceHost := domain.BounceHost
+	if bounceHost == "" { bounceHost = "bounce." + domain.Name }
+
+	wg.Add(4)
+	// 1. A/AAAA Records
+	go addA(mailHost)
+	go addA(bounceHost)
 
 	// 2. MX Records
 	go addMX()
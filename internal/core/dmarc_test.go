@@ -0,0 +1,33 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+)
+
+func TestGenerateAllDNSRecordsDualStack(t *testing.T) {
+	pool := models.EgressPool{ID: 1, Name: "bulk", Members: []models.EgressPoolMember{
+		{SystemIP: models.SystemIP{Value: "2001:db8::10"}},
+		{SystemIP: models.SystemIP{Value: "198.51.100.7"}},
+	}}
+	domain := models.Domain{Name: "example.com", Senders: []models.Sender{
+		{LocalPart: "news", IP: "203.0.113.5"},
+		{LocalPart: "bulk", EgressPoolID: 1},
+	}}
+	snap := &Snapshot{Pools: []models.EgressPool{pool}}
+
+	recs := GenerateAllDNSRecords(&domain, "192.0.2.1", "2001:db8::1", snap)
+	want := "v=spf1 ip4:192.0.2.1 ip4:198.51.100.7 ip4:203.0.113.5 ip6:2001:db8::1 ip6:2001:db8::10 ~all"
+	if recs.SPF.Value != want {
+		t.Errorf("SPF = %s\nwant  %s", recs.SPF.Value, want)
+	}
+	if len(recs.AAAA) != 2 || recs.AAAA[0].Value != "2001:db8::1" || recs.AAAA[0].Name != "mail.example.com" {
+		t.Errorf("AAAA = %+v", recs.AAAA)
+	}
+
+	v4only := GenerateAllDNSRecords(&domain, "192.0.2.1", "", nil)
+	if len(v4only.AAAA) != 0 {
+		t.Errorf("no AAAA expected without an IPv6 address: %+v", v4only.AAAA)
+	}
+}
@@ -0,0 +1,421 @@
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+	"github.com/pulak-ranjan/kumomta-ui/internal/store"
+)
+
+// Log record types the generated log hook forwards to the panel.
+const (
+	EventReception        = "Reception"
+	EventDelivery         = "Delivery"
+	EventBounce           = "Bounce"
+	EventTransientFailure = "TransientFailure"
+	EventFeedback         = "Feedback"
+)
+
+// Automation triggers fired by delivery events.
+const (
+	TriggerEmailDelivered  = "email_delivered"
+	TriggerEmailBounced    = "email_bounced"
+	TriggerEmailComplained = "email_complained"
+	TriggerUnsubscribed    = "unsubscribed"
+)
+
+// localPanelURL is the panel API as seen from kumod on the panel's own host.
+const localPanelURL = "http://127.0.0.1:9000"
+
+// PanelEventsURL is where kumod posts log records.
+const PanelEventsURL = localPanelURL + "/api/events/ingest"
+
+// panelURL returns the URL kumod on the node being generated should call:
+// remote nodes reach the panel through Settings.PanelURL instead of
+// localhost.
+func panelURL(snap *Snapshot, local string) string {
+	if snap.NodeID == 0 || snap.Settings == nil || snap.Settings.PanelURL == "" {
+		return local
+	}
+	return snap.Settings.PanelURL + strings.TrimPrefix(local, localPanelURL)
+}
+
+// KumoLogRecord is the subset of a KumoMTA JSON log record we keep.
+type KumoLogRecord struct {
+	Type      string `json:"type"`
+	ID        string `json:"id"`
+	Sender    string `json:"sender"`
+	Recipient string `json:"recipient"`
+	Queue     string `json:"queue"`
+	Site      string `json:"site"`
+
+	Response struct {
+		Code    int    `json:"code"`
+		Content string `json:"content"`
+	} `json:"response"`
+	PeerAddress *struct {
+		Name string `json:"name"`
+		Addr string `json:"addr"`
+	} `json:"peer_address"`
+
+	Timestamp            int64     `json:"timestamp"`
+	EventTime            time.Time `json:"event_time"`
+	NumAttempts          int       `json:"num_attempts"`
+	BounceClassification string    `json:"bounce_classification"`
+	EgressPool           string    `json:"egress_pool"`
+	EgressSource         string    `json:"egress_source"`
+
+	// Message meta selected in configure_log_hook (tenant, campaign)
+	Meta map[string]interface{} `json:"meta"`
+
+	// Parsed ARF report of a Feedback record. The record's own recipient
+	// is the FBL mailbox the report was sent to, not the complainant.
+	FeedbackReport *KumoFeedbackReport `json:"feedback_report"`
+}
+
+// KumoFeedbackReport is the subset of an ARF report we use.
+type KumoFeedbackReport struct {
+	FeedbackType    string          `json:"feedback_type"`
+	OriginalRcptTo  json.RawMessage `json:"original_rcpt_to"` // a string or a list
+	OriginalMessage string          `json:"original_message"`
+}
+
+// complainant returns who complained and the panel campaign of the
+// reported message: Original-Rcpt-To, else the To and X-Campaign headers
+// of the embedded original message. Providers often redact the address,
+// in which case it is "".
+func (fr *KumoFeedbackReport) complainant() (rcpt, campaign string) {
+	if fr == nil {
+		return "", ""
+	}
+	var one string
+	var list []string
+	if json.Unmarshal(fr.OriginalRcptTo, &one) == nil {
+		list = []string{one}
+	} else {
+		json.Unmarshal(fr.OriginalRcptTo, &list)
+	}
+	if len(list) > 0 {
+		rcpt = list[0]
+	}
+
+	if fr.OriginalMessage != "" {
+		// Reports may embed only the headers
+		if msg, err := mail.ReadMessage(strings.NewReader(fr.OriginalMessage + "\r\n\r\n")); err == nil {
+			campaign = strings.TrimSpace(msg.Header.Get("X-Campaign"))
+			if rcpt == "" {
+				if addr, err := mail.ParseAddress(msg.Header.Get("To")); err == nil {
+					rcpt = addr.Address
+				}
+			}
+		}
+	}
+	rcpt = strings.ToLower(strings.Trim(strings.TrimSpace(rcpt), "<>"))
+	if !strings.Contains(rcpt, "@") {
+		rcpt = ""
+	}
+	return rcpt, campaign
+}
+
+// internalToken derives a bearer token for kumod -> panel calls from
+// KUMO_APP_SECRET, so the generated init.lua and the server agree without
+// storing another secret. "" if no secret is set.
+func internalToken(purpose string) string {
+	key, err := GetEncryptionKey()
+	if err != nil {
+		return ""
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func verifyInternalToken(purpose, token string) bool {
+	expected := internalToken(purpose)
+	if expected == "" {
+		return false
+	}
+	return hmac.Equal([]byte(expected), []byte(token))
+}
+
+// IngestToken is the bearer token kumod uses for /api/events/ingest.
+func IngestToken() string {
+	return internalToken("kumomta-log-hook")
+}
+
+// VerifyIngestToken checks a token presented to the ingestion endpoint.
+func VerifyIngestToken(token string) bool {
+	return verifyInternalToken("kumomta-log-hook", token)
+}
+
+// ParseLogRecords accepts a single JSON record or an array of records.
+func ParseLogRecords(body []byte) ([]KumoLogRecord, error) {
+	trimmed := strings.TrimSpace(string(body))
+	if strings.HasPrefix(trimmed, "[") {
+		var recs []KumoLogRecord
+		if err := json.Unmarshal(body, &recs); err != nil {
+			return nil, fmt.Errorf("invalid log records: %w", err)
+		}
+		return recs, nil
+	}
+	var rec KumoLogRecord
+	if err := json.Unmarshal(body, &rec); err != nil {
+		return nil, fmt.Errorf("invalid log record: %w", err)
+	}
+	return []KumoLogRecord{rec}, nil
+}
+
+func metaString(meta map[string]interface{}, key string) string {
+	switch v := meta[key].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+// toDeliveryEvent maps a log record onto the stored model.
+func toDeliveryEvent(rec KumoLogRecord) models.DeliveryEvent {
+	ev := models.DeliveryEvent{
+		MessageID:    rec.ID,
+		Type:         rec.Type,
+		Tenant:       metaString(rec.Meta, "tenant"),
+		Campaign:     metaString(rec.Meta, "campaign"),
+		Sender:       strings.ToLower(rec.Sender),
+		Recipient:    strings.ToLower(rec.Recipient),
+		Queue:        rec.Queue,
+		Site:         rec.Site,
+		EgressPool:   rec.EgressPool,
+		EgressSource: rec.EgressSource,
+		ResponseCode: rec.Response.Code,
+		ResponseText: rec.Response.Content,
+		BounceClass:  rec.BounceClassification,
+		NumAttempts:  rec.NumAttempts,
+		EventTime:    rec.EventTime,
+	}
+	if rec.PeerAddress != nil {
+		ev.PeerAddress = rec.PeerAddress.Addr
+	}
+	if rec.Type == EventFeedback {
+		rcpt, campaign := rec.FeedbackReport.complainant()
+		ev.Recipient = rcpt
+		if campaign != "" {
+			ev.Campaign = campaign
+		}
+	}
+	if ev.EventTime.IsZero() {
+		if rec.Timestamp > 0 {
+			ev.EventTime = time.Unix(rec.Timestamp, 0)
+		} else {
+			ev.EventTime = time.Now()
+		}
+	}
+	return ev
+}
+
+// IsHardBounce reports whether a bounce should suppress the recipient.
+// Only permanent (5xx) failures classified as a bad address count;
+// policy/reputation/content blocks and unclassified failures say nothing
+// about the address itself.
+func IsHardBounce(ev models.DeliveryEvent) bool {
+	if ev.Type != EventBounce || ev.ResponseCode < 500 || ev.ResponseCode > 599 {
+		return false
+	}
+	switch ev.BounceClass {
+	case "InvalidRecipient", "BadDomain", "InactiveMailbox":
+		return true
+	}
+	return false
+}
+
+// IngestLogRecords stores the records and lets the rest of the panel react:
+// campaign recipients get their real delivery status, hard bounces and
+// complaints are suppressed, and automation triggers fire for contacts.
+func IngestLogRecords(st *store.Store, recs []KumoLogRecord) (int, error) {
+	events := make([]models.DeliveryEvent, 0, len(recs))
+	for _, rec := range recs {
+		switch rec.Type {
+		case EventReception, EventDelivery, EventBounce, EventTransientFailure, EventFeedback:
+			events = append(events, toDeliveryEvent(rec))
+		}
+	}
+	if err := st.CreateDeliveryEvents(events); err != nil {
+		return 0, err
+	}
+
+	auto := NewAutomationService(st)
+	for _, ev := range events {
+		updateCampaignRecipient(st, ev)
+
+		switch {
+		case ev.Type == EventBounce:
+			if IsHardBounce(ev) {
+				suppressFromEvent(st, ev, ReasonHardBounce)
+			}
+			triggerForContact(st, auto, TriggerEmailBounced, ev.Recipient)
+		case ev.Type == EventFeedback:
+			suppressFromEvent(st, ev, ReasonComplaint)
+			triggerForContact(st, auto, TriggerEmailComplained, ev.Recipient)
+		case ev.Type == EventDelivery:
+			triggerForContact(st, auto, TriggerEmailDelivered, ev.Recipient)
+		}
+	}
+	return len(events), nil
+}
+
+// updateCampaignRecipient moves a panel campaign recipient (X-Campaign is
+// the campaign ID) from "sent" to its final status.
+func updateCampaignRecipient(st *store.Store, ev models.DeliveryEvent) {
+	campaignID, err := strconv.ParseUint(ev.Campaign, 10, 32)
+	if err != nil || ev.Recipient == "" {
+		return
+	}
+
+	var recip models.CampaignRecipient
+	if err := st.DB.Where("campaign_id = ? AND LOWER(email) = ?", campaignID, ev.Recipient).First(&recip).Error; err != nil {
+		return
+	}
+
+	switch ev.Type {
+	case EventDelivery:
+		if recip.Status == "sent" {
+			st.DB.Model(&recip).Updates(map[string]interface{}{"status": "delivered", "error": ""})
+		}
+	case EventTransientFailure:
+		st.DB.Model(&recip).Update("error", fmt.Sprintf("%d %s", ev.ResponseCode, ev.ResponseText))
+	case EventBounce:
+		// Rejections at injection time were already counted by the sender
+		if recip.Status != "bounced" && recip.Status != "failed" {
+			st.DB.Model(&recip).Updates(map[string]interface{}{
+				"status": "bounced",
+				"error":  fmt.Sprintf("%d %s", ev.ResponseCode, ev.ResponseText),
+			})
+			st.DB.Model(&models.Campaign{}).Where("id = ?", campaignID).
+				Update("total_failed", gorm.Expr("total_failed + 1"))
+		}
+	case EventFeedback:
+		st.DB.Model(&recip).Update("status", "complained")
+	}
+}
+
+func suppressFromEvent(st *store.Store, ev models.DeliveryEvent, reason string) {
+	sup := models.Suppression{
+		Value:  ev.Recipient,
+		Reason: reason,
+		Source: "event:" + ev.MessageID,
+	}
+	if err := ValidateSuppression(&sup); err != nil {
+		return
+	}
+	if err := st.UpsertSuppression(&sup); err != nil {
+		log.Printf("Events: failed to suppress %s: %v", ev.Recipient, err)
+	}
+}
+
+func triggerForContact(st *store.Store, auto *AutomationService, trigger, email string) {
+	if email == "" {
+		return
+	}
+	var contacts []models.Contact
+	if err := st.DB.Where("LOWER(email) = ?", email).Find(&contacts).Error; err != nil {
+		return
+	}
+	for _, c := range contacts {
+		auto.TriggerWorkflow(trigger, c.ID)
+	}
+}
+
+// =======================
+// Log hook Lua
+// =======================
+
+// generateLogHookInitLua configures the log hook (inside the init handler).
+func generateLogHookInitLua() string {
+	if IngestToken() == "" {
+		return ""
+	}
+	return `
+  -- Push delivery events to the panel (see 'make.panel_events' below)
+  kumo.configure_log_hook {
+    name = 'panel_events',
+    meta = { 'tenant', 'campaign' },
+  }
+`
+}
+
+// generateLogHookLua renders the log record filter and the HTTP sender that
+// posts records to the panel. Records are queued, so events survive a panel
+// restart and are retried like any other message.
+func generateLogHookLua(snap *Snapshot) string {
+	token := IngestToken()
+	if token == "" {
+		return ""
+	}
+	return fmt.Sprintf(`-- =====================================================
+-- DELIVERY EVENTS -> PANEL
+-- =====================================================
+local panel_event_types = {
+  Reception = true, Delivery = true, Bounce = true, TransientFailure = true, Feedback = true,
+}
+
+kumo.on('should_enqueue_log_record', function(msg, hook_name)
+  local record = msg:get_meta('log_record')
+  -- Never log the log hook's own traffic
+  if record.reception_protocol == 'LogRecord' or not panel_event_types[record.type] then
+    return false
+  end
+  msg:set_meta('queue', 'panel_events')
+  return true
+end)
+
+kumo.on('make.panel_events', function(domain, tenant, campaign)
+  local client = kumo.http.build_client {}
+  local sender = {}
+
+  function sender:send(message)
+    local request = client:post '%s'
+    request:header('Content-Type', 'application/json')
+    request:header('Authorization', 'Bearer %s')
+    request:body(message:get_data())
+    local response = request:send()
+    if response:status_is_success() then
+      return
+    end
+    kumo.reject(500, string.format('panel returned %%d %%s', response:status_code(), response:text()))
+  end
+
+  function sender:close()
+    client:close()
+  end
+
+  return sender
+end)
+
+`, panelURL(snap, PanelEventsURL), token)
+}
+
+// logHookQueueLua is the get_queue_config branch for the log hook queue.
+func logHookQueueLua() string {
+	if IngestToken() == "" {
+		return ""
+	}
+	return `  if domain == 'panel_events' then
+    return kumo.make_queue_config {
+      protocol = { custom_lua = { constructor = 'make.panel_events' } },
+    }
+  end
+
+`
+}
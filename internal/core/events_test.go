@@ -0,0 +1,98 @@
+package core
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+	"github.com/pulak-ranjan/kumomta-ui/internal/store"
+)
+
+func TestGenerateInitLuaLogHook(t *testing.T) {
+	t.Setenv("KUMO_APP_SECRET", "")
+	if lua := GenerateInitLua(&Snapshot{}); strings.Contains(lua, "configure_log_hook") {
+		t.Error("log hook should not be generated without KUMO_APP_SECRET")
+	}
+
+	t.Setenv("KUMO_APP_SECRET", "test-secret-that-is-at-least-32-characters")
+	lua := GenerateInitLua(&Snapshot{})
+	for _, want := range []string{
+		"kumo.configure_log_hook {\n    name = 'panel_events',",
+		"kumo.on('should_enqueue_log_record'",
+		"request:header('Authorization', 'Bearer " + IngestToken() + "')",
+		"client:post '" + PanelEventsURL + "'",
+		"if domain == 'panel_events' then",
+	} {
+		if !strings.Contains(lua, want) {
+			t.Errorf("expected %q in init.lua", want)
+		}
+	}
+	if !VerifyIngestToken(IngestToken()) || VerifyIngestToken("nope") {
+		t.Error("ingest token verification is wrong")
+	}
+}
+
+func TestIngestLogRecords(t *testing.T) {
+	st, err := store.NewStore(filepath.Join(t.TempDir(), "panel.db"))
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	camp := models.Campaign{Name: "spring", Status: "sending"}
+	st.DB.Create(&camp)
+	st.DB.Create(&models.CampaignRecipient{CampaignID: camp.ID, Email: "Gone@Example.com", Status: "sent"})
+	st.DB.Create(&models.CampaignRecipient{CampaignID: camp.ID, Email: "ok@example.com", Status: "sent"})
+	st.DB.Create(&models.CampaignRecipient{CampaignID: camp.ID, Email: "annoyed@example.net", Status: "delivered"})
+
+	body := `[
+	  {"type":"Delivery","id":"m1","sender":"news@example.org","recipient":"ok@example.com",
+	   "response":{"code":250,"content":"OK"},"timestamp":1700000000,"meta":{"tenant":"example.org__news","campaign":"` + fmt.Sprint(camp.ID) + `"}},
+	  {"type":"Bounce","id":"m2","recipient":"gone@example.com","bounce_classification":"InvalidRecipient",
+	   "response":{"code":550,"content":"no such user"},"meta":{"campaign":"` + fmt.Sprint(camp.ID) + `"}},
+	  {"type":"Bounce","id":"m2","recipient":"gone@example.com","bounce_classification":"InvalidRecipient",
+	   "response":{"code":550,"content":"no such user"},"meta":{"campaign":"` + fmt.Sprint(camp.ID) + `"}},
+	  {"type":"Bounce","id":"m4","recipient":"blocked@example.com","bounce_classification":"Uncategorized",
+	   "response":{"code":554,"content":"message rejected for policy reasons"}},
+	  {"type":"Bounce","id":"m5","recipient":"spam@example.com",
+	   "response":{"code":550,"content":"content rejected"}},
+	  {"type":"Feedback","id":"f1","recipient":"fbl@example.org",
+	   "feedback_report":{"feedback_type":"abuse","original_rcpt_to":"<Annoyed@example.net>",
+	    "original_message":"From: news@example.org\r\nTo: annoyed@example.net\r\nX-Campaign: ` + fmt.Sprint(camp.ID) + `\r\nSubject: Hi\r\n"}},
+	  {"type":"Feedback","id":"f2","recipient":"fbl@example.org",
+	   "feedback_report":{"feedback_type":"abuse","original_message":"From: news@example.org\r\nTo: redacted\r\n"}},
+	  {"type":"Expiration","id":"m3","recipient":"x@example.com"}
+	]`
+	recs, err := ParseLogRecords([]byte(body))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	n, err := IngestLogRecords(st, recs)
+	if err != nil || n != 7 {
+		t.Fatalf("ingest = %d, %v", n, err)
+	}
+
+	events, _ := st.ListDeliveryEvents(store.DeliveryEventFilter{MessageID: "m1"})
+	if len(events) != 1 || events[0].Tenant != "example.org__news" || !events[0].EventTime.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("m1 events = %+v", events)
+	}
+
+	var recips []models.CampaignRecipient
+	st.DB.Order("id").Find(&recips)
+	if recips[0].Status != "bounced" || recips[1].Status != "delivered" || recips[2].Status != "complained" {
+		t.Errorf("recipient statuses = %s, %s, %s", recips[0].Status, recips[1].Status, recips[2].Status)
+	}
+	st.DB.First(&camp, camp.ID)
+	if camp.TotalFailed != 1 {
+		t.Errorf("total_failed = %d, want 1", camp.TotalFailed)
+	}
+
+	// Unclassified and policy 5xx bounces don't suppress a valid address;
+	// complaints suppress the complainant, never the FBL mailbox
+	got, _ := st.SuppressedRecipients([]string{"gone@example.com", "ok@example.com", "blocked@example.com", "spam@example.com",
+		"annoyed@example.net", "fbl@example.org"}, time.Now())
+	if got["gone@example.com"] != ReasonHardBounce || got["annoyed@example.net"] != ReasonComplaint || len(got) != 2 {
+		t.Errorf("suppressed = %v", got)
+	}
+}
@@ -100,7 +100,7 @@ func GetActiveIPsMap() map[string]bool {
 	return active
 }
 
-// DetectServerIPs finds all IPv4 addresses on the server
+// DetectServerIPs finds all IPv4 and global IPv6 addresses on the server
 func DetectServerIPs() []DetectedIP {
 	var detected []DetectedIP
 
@@ -126,13 +126,12 @@ func DetectServerIPs() []DetectedIP {
 				continue
 			}
 
-			ip := ipNet.IP.To4()
-			if ip == nil {
-				continue // Skip IPv6
+			ip := ipNet.IP
+			if ip.IsLoopback() {
+				continue
 			}
-
-			// Skip private ranges often used for internal networking
-			if ip[0] == 127 {
+			// Link-local IPv6 (fe80::/10) can't be used to send mail
+			if ip.To4() == nil && !ip.IsGlobalUnicast() {
 				continue
 			}
 
@@ -148,8 +147,15 @@ func DetectServerIPs() []DetectedIP {
 
 // ConfigureSystemIP executes the shell command to add the IP to the interface
 func ConfigureSystemIP(ip, netmask, iface string) error {
+	family := "ipv4"
+	if IsIPv6(ip) {
+		family = "ipv6"
+	}
 	if netmask == "" {
 		netmask = "/32"
+		if family == "ipv6" {
+			netmask = "/128"
+		}
 	}
 	if iface == "" {
 		iface = "eth0"
@@ -167,16 +173,51 @@ func ConfigureSystemIP(ip, netmask, iface string) error {
 	}
 
 	// 2. Persistence (Rocky/RHEL/CentOS via NetworkManager)
-	// nmcli con mod eth0 +ipv4.addresses "1.2.3.4/32"
+	// nmcli con mod eth0 +ipv4.addresses "1.2.3.4/32" (or +ipv6.addresses)
 	// We do this so it survives reboot, but we DON'T run 'con up' to avoid connection reset risks.
 	// The runtime config above handles the "now".
-	nmCmd := exec.Command("nmcli", "con", "mod", iface, "+ipv4.addresses", ip+netmask)
+	nmCmd := exec.Command("nmcli", "con", "mod", iface, "+"+family+".addresses", ip+netmask)
 	// We ignore errors here because nmcli might not be managing the interface or might be missing
 	_ = nmCmd.Run()
 
 	return nil
 }
 
+// NormalizeIP validates an IPv4 or IPv6 address and returns its canonical
+// form, so "2001:DB8::0001" and "2001:db8::1" are the same inventory entry.
+func NormalizeIP(value string) (string, error) {
+	ip := net.ParseIP(strings.TrimSpace(value))
+	if ip == nil {
+		return "", fmt.Errorf("invalid IP address: %s", value)
+	}
+	return ip.String(), nil
+}
+
+// IsIPv6 reports whether value is an IPv6 (not IPv4-mapped) address.
+func IsIPv6(value string) bool {
+	ip := net.ParseIP(value)
+	return ip != nil && ip.To4() == nil
+}
+
+// ReverseIPName returns the DNS label sequence used for PTR and DNSBL
+// lookups: reversed octets for IPv4, reversed nibbles for IPv6.
+func ReverseIPName(value string) (string, error) {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return "", fmt.Errorf("invalid IP address: %s", value)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d", ip4[3], ip4[2], ip4[1], ip4[0]), nil
+	}
+
+	const hexDigits = "0123456789abcdef"
+	labels := make([]string, 0, 32)
+	for i := len(ip) - 1; i >= 0; i-- {
+		labels = append(labels, string(hexDigits[ip[i]&0x0f]), string(hexDigits[ip[i]>>4]))
+	}
+	return strings.Join(labels, "."), nil
+}
+
 // ExpandCIDR expands a CIDR notation to list of IPs
 func ExpandCIDR(cidr string) ([]string, error) {
 	_, ipNet, err := net.ParseCIDR(cidr)
@@ -185,6 +226,9 @@ func ExpandCIDR(cidr string) ([]string, error) {
 	}
 
 	ones, bits := ipNet.Mask.Size()
+	if bits == 128 && bits-ones > 10 {
+		return nil, fmt.Errorf("IPv6 prefix too large to expand, allocate addresses from it instead")
+	}
 
 	var ips []string
 	for ip := ipNet.IP.Mask(ipNet.Mask); ipNet.Contains(ip); incrementIP(ip) {
@@ -196,6 +240,10 @@ func ExpandCIDR(cidr string) ([]string, error) {
 				}
 			}
 		}
+		// Skip the IPv6 subnet-router anycast address (host part all zero)
+		if bits == 128 && bits-ones > 0 && ip.Equal(ipNet.IP) {
+			continue
+		}
 
 		ips = append(ips, ip.String())
 
@@ -213,6 +261,40 @@ func ExpandCIDR(cidr string) ([]string, error) {
 	return ips, nil
 }
 
+// AllocateIPv6 picks the next count unused addresses from an IPv6 prefix
+// (typically the server's /64), starting at ::1 and skipping anything in
+// used (canonical form).
+func AllocateIPv6(prefix string, count int, used map[string]bool) ([]string, error) {
+	_, ipNet, err := net.ParseCIDR(strings.TrimSpace(prefix))
+	if err != nil {
+		return nil, fmt.Errorf("invalid prefix: %v", err)
+	}
+	ones, bits := ipNet.Mask.Size()
+	if bits != 128 {
+		return nil, fmt.Errorf("prefix must be IPv6")
+	}
+	if ones > 120 {
+		return nil, fmt.Errorf("prefix must be /120 or larger")
+	}
+	if count < 1 || count > 1000 {
+		return nil, fmt.Errorf("count must be between 1 and 1000")
+	}
+
+	ip := make(net.IP, len(ipNet.IP))
+	copy(ip, ipNet.IP)
+
+	var ips []string
+	for incrementIP(ip); ipNet.Contains(ip) && len(ips) < count; incrementIP(ip) {
+		if !used[ip.String()] {
+			ips = append(ips, ip.String())
+		}
+	}
+	if len(ips) < count {
+		return nil, fmt.Errorf("prefix %s has only %d free addresses", ipNet, len(ips))
+	}
+	return ips, nil
+}
+
 func incrementIP(ip net.IP) {
 	for j := len(ip) - 1; j >= 0; j-- {
 		ip[j]++
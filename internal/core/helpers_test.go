@@ -0,0 +1,67 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeIP(t *testing.T) {
+	for in, want := range map[string]string{
+		" 192.0.2.10 ":        "192.0.2.10",
+		"2001:DB8:0::0001":    "2001:db8::1",
+		"::ffff:198.51.100.1": "198.51.100.1",
+	} {
+		got, err := NormalizeIP(in)
+		if err != nil || got != want {
+			t.Errorf("NormalizeIP(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := NormalizeIP("2001:db8::/64"); err == nil {
+		t.Error("expected an error for a prefix")
+	}
+}
+
+func TestReverseIPName(t *testing.T) {
+	got, _ := ReverseIPName("192.0.2.10")
+	if got != "10.2.0.192" {
+		t.Errorf("IPv4 reverse = %s", got)
+	}
+	got, _ = ReverseIPName("2001:db8::567:89ab")
+	want := "b.a.9.8.7.6.5.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2"
+	if got != want {
+		t.Errorf("IPv6 reverse = %s, want %s", got, want)
+	}
+}
+
+func TestExpandCIDRIPv6(t *testing.T) {
+	ips, err := ExpandCIDR("2001:db8::/126")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"2001:db8::1", "2001:db8::2", "2001:db8::3"}
+	if !reflect.DeepEqual(ips, want) {
+		t.Errorf("ExpandCIDR = %v, want %v", ips, want)
+	}
+	if _, err := ExpandCIDR("2001:db8::/64"); err == nil {
+		t.Error("expanding a /64 should be refused")
+	}
+}
+
+func TestAllocateIPv6(t *testing.T) {
+	used := map[string]bool{"2001:db8:1::1": true, "2001:db8:1::3": true}
+	ips, err := AllocateIPv6("2001:db8:1::/64", 3, used)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"2001:db8:1::2", "2001:db8:1::4", "2001:db8:1::5"}
+	if !reflect.DeepEqual(ips, want) {
+		t.Errorf("AllocateIPv6 = %v, want %v", ips, want)
+	}
+
+	if _, err := AllocateIPv6("2001:db8::/126", 4, nil); err == nil {
+		t.Error("expected an error when the prefix is exhausted")
+	}
+	if _, err := AllocateIPv6("192.0.2.0/24", 1, nil); err == nil {
+		t.Error("expected an error for an IPv4 prefix")
+	}
+}
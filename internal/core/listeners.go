@@ -0,0 +1,194 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+)
+
+// ValidateListener normalizes and checks a listener before it is saved.
+func ValidateListener(l *models.Listener) error {
+	l.ListenAddr = strings.TrimSpace(l.ListenAddr)
+	l.Hostname = strings.TrimSpace(l.Hostname)
+	l.Banner = strings.TrimSpace(l.Banner)
+	l.TLSCertificate = strings.TrimSpace(l.TLSCertificate)
+	l.TLSPrivateKey = strings.TrimSpace(l.TLSPrivateKey)
+
+	host, port, err := net.SplitHostPort(l.ListenAddr)
+	if err != nil {
+		return fmt.Errorf("listen_addr must be host:port (e.g. 0.0.0.0:587)")
+	}
+	if net.ParseIP(host) == nil {
+		return fmt.Errorf("listen_addr must use an IP address")
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return fmt.Errorf("invalid port in listen_addr")
+	}
+
+	if strings.ContainsAny(l.Hostname, "'\"\\ \r\n") {
+		return fmt.Errorf("invalid hostname")
+	}
+	if strings.ContainsAny(l.Banner, "'\\\r\n") {
+		return fmt.Errorf("banner must be a single line without quotes or backslashes")
+	}
+	for _, path := range []string{l.TLSCertificate, l.TLSPrivateKey} {
+		if strings.ContainsAny(path, "'\"\\\r\n") {
+			return fmt.Errorf("invalid TLS file path")
+		}
+	}
+	if (l.TLSCertificate == "") != (l.TLSPrivateKey == "") {
+		return fmt.Errorf("tls_certificate and tls_private_key must be set together")
+	}
+	if l.ImplicitTLS && l.TLSCertificate == "" {
+		return fmt.Errorf("implicit_tls requires a certificate and private key")
+	}
+
+	hosts, err := parseRelayHosts(l.RelayHosts)
+	if err != nil {
+		return err
+	}
+	l.RelayHosts = strings.Join(hosts, ",")
+
+	if l.MaxMessageSize < 0 {
+		return fmt.Errorf("max_message_size must not be negative")
+	}
+	return nil
+}
+
+// CheckListenerPortAuth rejects l when another listener on the same port
+// disagrees on require_auth: the MAIL FROM check only sees the port the
+// client connected to (KumoMTA reports the local address, not the bind
+// address), so it can't tell such listeners apart.
+func CheckListenerPortAuth(l models.Listener, existing []models.Listener) error {
+	port := listenerPort(l.ListenAddr)
+	for _, o := range existing {
+		if o.ID != l.ID && listenerPort(o.ListenAddr) == port && o.RequireAuth != l.RequireAuth {
+			return fmt.Errorf("listener %s is on the same port with require_auth=%t; listeners sharing a port must agree on require_auth", o.ListenAddr, o.RequireAuth)
+		}
+	}
+	return nil
+}
+
+// parseRelayHosts splits a comma separated list of IPs/CIDRs.
+func parseRelayHosts(list string) ([]string, error) {
+	var hosts []string
+	for _, h := range strings.Split(list, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		if net.ParseIP(h) == nil {
+			if _, _, err := net.ParseCIDR(h); err != nil {
+				return nil, fmt.Errorf("invalid relay host: %s", h)
+			}
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts, nil
+}
+
+// effectiveListeners returns the configured listeners, or the legacy
+// set (SMTPListenAddr, 587, 465) when none are configured yet.
+func effectiveListeners(snap *Snapshot, listenAddr string) []models.Listener {
+	if len(snap.Listeners) > 0 {
+		return snap.Listeners
+	}
+	return []models.Listener{
+		{ListenAddr: listenAddr},
+		{ListenAddr: "0.0.0.0:587"},
+		{ListenAddr: "0.0.0.0:465"},
+	}
+}
+
+// listenerPort returns the port of a listener address ("" if unparsable).
+func listenerPort(addr string) string {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return ""
+	}
+	return port
+}
+
+// generateListenersLua renders the kumo.start_esmtp_listener blocks
+// (inside the init handler, after trace_settings is defined).
+func generateListenersLua(snap *Snapshot, mainHostname, listenAddr string, defaultRelay []string) string {
+	var b strings.Builder
+
+	for _, l := range effectiveListeners(snap, listenAddr) {
+		hostname := l.Hostname
+		if hostname == "" {
+			hostname = mainHostname
+		}
+		banner := l.Banner
+		if banner == "" {
+			banner = "220 " + hostname
+		}
+		relay := defaultRelay
+		if hosts, _ := parseRelayHosts(l.RelayHosts); len(hosts) > 0 {
+			relay = hosts
+		}
+		quoted := make([]string, 0, len(relay))
+		for _, h := range relay {
+			quoted = append(quoted, fmt.Sprintf("'%s'", h))
+		}
+
+		fmt.Fprintf(&b, "  kumo.start_esmtp_listener {\n")
+		fmt.Fprintf(&b, "    listen = '%s',\n", l.ListenAddr)
+		fmt.Fprintf(&b, "    hostname = '%s',\n", hostname)
+		fmt.Fprintf(&b, "    banner = '%s',\n", banner)
+		fmt.Fprintf(&b, "    relay_hosts = { %s },\n", strings.Join(quoted, ", "))
+		if l.TLSCertificate != "" {
+			fmt.Fprintf(&b, "    tls_certificate = '%s',\n", l.TLSCertificate)
+			fmt.Fprintf(&b, "    tls_private_key = '%s',\n", l.TLSPrivateKey)
+		}
+		if l.ImplicitTLS {
+			fmt.Fprintf(&b, "    implicit_tls = true,\n")
+		}
+		if l.MaxMessageSize > 0 {
+			fmt.Fprintf(&b, "    max_message_size = %d,\n", l.MaxMessageSize)
+		}
+		fmt.Fprintf(&b, "    trace_headers = trace_settings,\n")
+		fmt.Fprintf(&b, "  }\n\n")
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// generateRequireAuthLua renders the MAIL FROM check for listeners that
+// require AUTH. Listeners are matched by the port the client connected to
+// (see CheckListenerPortAuth); a port any listener requires AUTH on
+// requires it for all. Returns "" when no listener requires AUTH.
+func generateRequireAuthLua(snap *Snapshot) string {
+	var ports []string
+	seen := map[string]bool{}
+	for _, l := range snap.Listeners {
+		port := listenerPort(l.ListenAddr)
+		if l.RequireAuth && port != "" && !seen[port] {
+			seen[port] = true
+			ports = append(ports, fmt.Sprintf("['%s'] = true", port))
+		}
+	}
+	if len(ports) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(`-- =====================================================
+-- LISTENERS REQUIRING AUTH
+-- =====================================================
+`)
+	fmt.Fprintf(&b, "local auth_required_ports = { %s }\n\n", strings.Join(ports, ", "))
+	b.WriteString(`kumo.on('smtp_server_mail_from', function(sender, conn_meta)
+  local via = conn_meta:get_meta('received_via') or ''
+  local port = via:match(':(%d+)$')
+  if port and auth_required_ports[port] and not conn_meta:get_meta('authn_id') then
+    kumo.reject(530, '5.7.0 Authentication required')
+  end
+end)
+
+`)
+	return b.String()
+}
@@ -0,0 +1,319 @@
+package core
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OutboundMessage is an email to be built by BuildMessage. Every sending
+// path (campaigns, transactional sends, the test mail tool) goes through
+// it, so all mail carries Date, Message-ID and MIME-Version, encoded
+// headers and a text/plain alternative.
+type OutboundMessage struct {
+	FromName  string // display name, may be non-ASCII
+	FromEmail string
+	To        string
+	Subject   string
+	HTML      string
+	Text      string // "" = generated from HTML
+
+	// MessageID without angle brackets ("" = random on the From domain).
+	// Pass a stable one (see CampaignMessageID) so a retried message keeps
+	// its id.
+	MessageID string
+	Date      time.Time         // zero = now
+	Headers   map[string]string // extra headers, e.g. X-Campaign
+
+	Attachments []MailAttachment
+}
+
+// MailAttachment is a file sent with a message. With a ContentID it is an
+// inline part the HTML shows as <img src="cid:ContentID">.
+type MailAttachment struct {
+	Filename    string
+	ContentType string
+	ContentID   string
+	Data        []byte
+}
+
+// BuildMessage renders msg as RFC 5322 / MIME: multipart/alternative with
+// quoted-printable text and HTML parts (text/plain only when there's no
+// HTML), wrapped in multipart/related for inline images and in
+// multipart/mixed for attachments.
+func BuildMessage(msg OutboundMessage) ([]byte, error) {
+	if _, err := mail.ParseAddress(msg.FromEmail); err != nil {
+		return nil, fmt.Errorf("invalid from address %q", msg.FromEmail)
+	}
+	if _, err := mail.ParseAddress(msg.To); err != nil {
+		return nil, fmt.Errorf("invalid recipient %q", msg.To)
+	}
+
+	date := msg.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	messageID := msg.MessageID
+	if messageID == "" {
+		messageID = NewMessageID(msg.FromEmail)
+	}
+	text := msg.Text
+	if text == "" && msg.HTML != "" {
+		text = HTMLToText(msg.HTML)
+	}
+
+	var buf bytes.Buffer
+	from := mail.Address{Name: headerSafe(msg.FromName), Address: msg.FromEmail}
+	writeHeader(&buf, "From", from.String())
+	writeHeader(&buf, "To", (&mail.Address{Address: msg.To}).String())
+	writeHeader(&buf, "Subject", encodeHeader(headerSafe(msg.Subject)))
+	writeHeader(&buf, "Date", date.Format(time.RFC1123Z))
+	writeHeader(&buf, "Message-ID", "<"+messageID+">")
+	writeHeader(&buf, "MIME-Version", "1.0")
+
+	names := make([]string, 0, len(msg.Headers))
+	for name := range msg.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		writeHeader(&buf, textproto.CanonicalMIMEHeaderKey(headerSafe(name)), encodeHeader(headerSafe(msg.Headers[name])))
+	}
+
+	body, err := textBody(text, msg.HTML)
+	if err != nil {
+		return nil, err
+	}
+	var inline, attached []mimePart
+	for _, a := range msg.Attachments {
+		if a.ContentID != "" && msg.HTML != "" {
+			inline = append(inline, attachmentPart(a))
+		} else {
+			attached = append(attached, attachmentPart(a))
+		}
+	}
+	if len(inline) > 0 {
+		if body, err = multipartOf("related", "multipart/alternative", append([]mimePart{body}, inline...)); err != nil {
+			return nil, err
+		}
+	}
+	if len(attached) > 0 {
+		if body, err = multipartOf("mixed", "", append([]mimePart{body}, attached...)); err != nil {
+			return nil, err
+		}
+	}
+
+	writeHeader(&buf, "Content-Type", body.header.Get("Content-Type"))
+	if cte := body.header.Get("Content-Transfer-Encoding"); cte != "" {
+		writeHeader(&buf, "Content-Transfer-Encoding", cte)
+	}
+	buf.WriteString("\r\n")
+	buf.Write(body.body)
+	return buf.Bytes(), nil
+}
+
+// mimePart is an encoded MIME entity.
+type mimePart struct {
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+// textBody is the text/plain part, or multipart/alternative with the HTML.
+func textBody(text, html string) (mimePart, error) {
+	plain, err := qpPart("text/plain; charset=UTF-8", text)
+	if err != nil || html == "" {
+		return plain, err
+	}
+	htmlPart, err := qpPart("text/html; charset=UTF-8", html)
+	if err != nil {
+		return mimePart{}, err
+	}
+	// Least preferred first (RFC 2046 5.1.4)
+	return multipartOf("alternative", "", []mimePart{plain, htmlPart})
+}
+
+func qpPart(contentType, s string) (mimePart, error) {
+	var buf bytes.Buffer
+	if err := writeQuotedPrintable(&buf, s); err != nil {
+		return mimePart{}, err
+	}
+	return mimePart{
+		header: textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		},
+		body: buf.Bytes(),
+	}, nil
+}
+
+// multipartOf joins parts into a multipart/subtype entity (rootType is
+// the "type" parameter multipart/related needs).
+func multipartOf(subtype, rootType string, parts []mimePart) (mimePart, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for _, p := range parts {
+		w, err := mw.CreatePart(p.header)
+		if err != nil {
+			return mimePart{}, err
+		}
+		if _, err := w.Write(p.body); err != nil {
+			return mimePart{}, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return mimePart{}, err
+	}
+	contentType := fmt.Sprintf("multipart/%s;\r\n boundary=%q", subtype, mw.Boundary())
+	if rootType != "" {
+		contentType += fmt.Sprintf(";\r\n type=%q", rootType)
+	}
+	return mimePart{header: textproto.MIMEHeader{"Content-Type": {contentType}}, body: buf.Bytes()}, nil
+}
+
+// attachmentPart is a base64 attachment or, with a ContentID, inline part.
+func attachmentPart(a MailAttachment) mimePart {
+	name := headerSafe(a.Filename)
+	if name == "" {
+		name = "attachment"
+	}
+	contentType := a.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	disposition := "attachment"
+	if a.ContentID != "" {
+		disposition = "inline"
+	}
+	header := textproto.MIMEHeader{
+		"Content-Type":              {foldParams(mime.FormatMediaType(contentType, map[string]string{"name": name}))},
+		"Content-Disposition":       {foldParams(mime.FormatMediaType(disposition, map[string]string{"filename": name}))},
+		"Content-Transfer-Encoding": {"base64"},
+	}
+	if a.ContentID != "" {
+		header.Set("Content-ID", "<"+headerSafe(a.ContentID)+">")
+	}
+
+	enc := base64.StdEncoding.EncodeToString(a.Data)
+	var buf bytes.Buffer
+	for len(enc) > 76 {
+		buf.WriteString(enc[:76])
+		buf.WriteString("\r\n")
+		enc = enc[76:]
+	}
+	buf.WriteString(enc)
+	buf.WriteString("\r\n")
+	return mimePart{header: header, body: buf.Bytes()}
+}
+
+// foldParams puts each parameter of a header value on its own line.
+func foldParams(v string) string {
+	return strings.ReplaceAll(v, "; ", ";\r\n ")
+}
+
+// writeHeader writes one header, folding an encoded value that wouldn't
+// fit on the first line.
+func writeHeader(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	first, _, _ := strings.Cut(value, "\r\n")
+	if len(name)+2+len(first) > 78 && strings.HasPrefix(value, "=?") {
+		buf.WriteString(":\r\n ")
+	} else {
+		buf.WriteString(": ")
+	}
+	buf.WriteString(value)
+	buf.WriteString("\r\n")
+}
+
+// encodeHeader RFC 2047-encodes non-ASCII text, folding between encoded
+// words so lines stay short.
+func encodeHeader(s string) string {
+	enc := mime.QEncoding.Encode("UTF-8", s)
+	if enc == s {
+		return s
+	}
+	return strings.ReplaceAll(enc, "?= =?", "?=\r\n =?")
+}
+
+func writeQuotedPrintable(w interface{ Write([]byte) (int, error) }, s string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(s)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// NewMessageID returns a random Message-ID on the domain of from.
+func NewMessageID(from string) string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return fmt.Sprintf("%d.%s@%s", time.Now().Unix(), hex.EncodeToString(b), messageIDDomain(from))
+}
+
+// CampaignMessageID is the Message-ID of a campaign message. It is the
+// same every time the recipient is (re)tried.
+func CampaignMessageID(campaignID, recipientID uint, from string) string {
+	return fmt.Sprintf("c%d.r%d@%s", campaignID, recipientID, messageIDDomain(from))
+}
+
+func messageIDDomain(from string) string {
+	if i := strings.LastIndex(from, "@"); i >= 0 && i < len(from)-1 {
+		return strings.ToLower(from[i+1:])
+	}
+	return "localhost"
+}
+
+// =======================
+// HTML to text
+// =======================
+
+var (
+	htmlDropRe    = regexp.MustCompile(`(?is)<(head|style|script|title)\b.*?</(head|style|script|title)>|<!--.*?-->`)
+	htmlLinkRe    = regexp.MustCompile(`(?is)<a\b[^>]*\bhref\s*=\s*["']([^"']+)["'][^>]*>(.*?)</a>`)
+	htmlBreakRe   = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|h[1-6]|tr|table|blockquote|ul|ol)>`)
+	htmlItemRe    = regexp.MustCompile(`(?i)<li\b[^>]*>`)
+	htmlTagRe     = regexp.MustCompile(`(?s)<[^>]*>`)
+	htmlSpaceRe   = regexp.MustCompile(`[ \t\r\f\v]+`)
+	htmlNewlineRe = regexp.MustCompile(`\n{3,}`)
+)
+
+// HTMLToText makes a readable plain-text version of an HTML body: links
+// become "text (url)", block elements end lines, tags are dropped.
+func HTMLToText(s string) string {
+	s = htmlDropRe.ReplaceAllString(s, "")
+	s = htmlSpaceRe.ReplaceAllString(strings.ReplaceAll(s, "\n", " "), " ")
+	s = htmlLinkRe.ReplaceAllStringFunc(s, func(m string) string {
+		parts := htmlLinkRe.FindStringSubmatch(m)
+		href := parts[1]
+		label := strings.TrimSpace(htmlTagRe.ReplaceAllString(parts[2], ""))
+		if label == "" {
+			return href
+		}
+		if label == href || label == strings.TrimPrefix(href, "mailto:") {
+			return label
+		}
+		return label + " (" + href + ")"
+	})
+	s = htmlBreakRe.ReplaceAllString(s, "\n")
+	s = htmlItemRe.ReplaceAllString(s, "\n- ")
+	s = htmlTagRe.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSpace(htmlSpaceRe.ReplaceAllString(strings.ReplaceAll(l, "\u00a0", " "), " "))
+	}
+	s = htmlNewlineRe.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(s) + "\n"
+}
@@ -0,0 +1,205 @@
+package core
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildMessage(t *testing.T) {
+	long := strings.Repeat("Ünïcödé text that goes on ", 20)
+	raw, err := BuildMessage(OutboundMessage{
+		FromName:  "Café Crème",
+		FromEmail: "news@Example.com",
+		To:        "ann@example.net",
+		Subject:   "Grüße aus Köln — Sommer-Angebote für Sie und Ihre Familie\r\nBcc: evil@example.org",
+		HTML:      `<p>Hello <b>Ann</b>,</p><p>` + long + `</p><p><a href="https://example.com/x?a=1&amp;b=2">See offers</a></p>`,
+		MessageID: CampaignMessageID(7, 42, "news@Example.com"),
+		Date:      time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC),
+		Headers:   map[string]string{"x-campaign": "7"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(raw), "\r\n") {
+		if len(line) > 78 {
+			t.Errorf("line longer than 78 chars: %q", line)
+		}
+	}
+
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := m.Header
+	dec := new(mime.WordDecoder)
+	if subj, _ := dec.DecodeHeader(h.Get("Subject")); subj != "Grüße aus Köln — Sommer-Angebote für Sie und Ihre Familie Bcc: evil@example.org" {
+		t.Errorf("subject = %q", subj)
+	}
+	if h.Get("Bcc") != "" {
+		t.Error("CR/LF in the subject injected a header")
+	}
+	from, err := mail.ParseAddress(h.Get("From"))
+	if err != nil || from.Name != "Café Crème" || from.Address != "news@Example.com" {
+		t.Errorf("from = %+v, %v", from, err)
+	}
+	if got := h.Get("Message-ID"); got != "<c7.r42@example.com>" {
+		t.Errorf("message-id = %s", got)
+	}
+	if d, err := h.Date(); err != nil || !d.Equal(time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("date = %s", h.Get("Date"))
+	}
+	if h.Get("MIME-Version") != "1.0" || h.Get("X-Campaign") != "7" {
+		t.Errorf("headers = %v", h)
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("content-type = %s", mediaType)
+	}
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	var parts []string
+	var bodies []string
+	for {
+		p, err := mr.NextPart() // decodes quoted-printable
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(p)
+		parts = append(parts, p.Header.Get("Content-Type"))
+		bodies = append(bodies, string(b))
+	}
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "text/plain") || !strings.HasPrefix(parts[1], "text/html") {
+		t.Fatalf("parts = %v", parts)
+	}
+	if !strings.Contains(bodies[0], "Hello Ann,") || !strings.Contains(bodies[0], "See offers (https://example.com/x?a=1&b=2)") {
+		t.Errorf("text part = %q", bodies[0])
+	}
+	if !strings.Contains(bodies[1], long) {
+		t.Error("html part did not survive quoted-printable")
+	}
+}
+
+func TestBuildMessagePlainText(t *testing.T) {
+	raw, err := BuildMessage(OutboundMessage{FromEmail: "ops@example.com", To: "bob@example.net", Subject: "ping", Text: "just text"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _ := mail.ReadMessage(bytes.NewReader(raw))
+	if ct := m.Header.Get("Content-Type"); ct != "text/plain; charset=UTF-8" {
+		t.Errorf("content-type = %s", ct)
+	}
+	if id := m.Header.Get("Message-ID"); !strings.HasSuffix(id, "@example.com>") {
+		t.Errorf("message-id = %s", id)
+	}
+	if _, err := BuildMessage(OutboundMessage{FromEmail: "ops@example.com", To: "not an address"}); err == nil {
+		t.Error("invalid recipient accepted")
+	}
+}
+
+func TestHTMLToText(t *testing.T) {
+	in := `<html><head><style>p{color:red}</style></head><body>
+<h1>News</h1><p>Line one<br>line&nbsp;two</p>
+<ul><li>First</li><li>Second</li></ul>
+<a href="https://example.com">https://example.com</a> <a href="mailto:help@example.com">help@example.com</a>
+<img src="https://t.example/open.gif"></body></html>`
+	want := "News\nLine one\nline two\n\n- First\n- Second\nhttps://example.com help@example.com\n"
+	if got := HTMLToText(in); got != want {
+		t.Errorf("got %q\nwant %q", got, want)
+	}
+}
+
+func TestBuildMessageAttachments(t *testing.T) {
+	logo := bytes.Repeat([]byte{0x89, 'P', 'N', 'G'}, 100)
+	raw, err := BuildMessage(OutboundMessage{
+		FromEmail: "news@example.com",
+		To:        "ann@example.net",
+		Subject:   "Your invoice",
+		HTML:      `<p><img src="cid:asset-3"> Invoice attached</p>`,
+		Attachments: []MailAttachment{
+			{Filename: "Rechnung März 2026.pdf", ContentType: "application/pdf", Data: []byte("%PDF-1.4 invoice")},
+			{Filename: "logo.png", ContentType: "image/png", ContentID: "asset-3", Data: logo},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(raw), "\r\n") {
+		if len(line) > 78 {
+			t.Errorf("line longer than 78 chars: %q", line)
+		}
+	}
+
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	type part struct {
+		header textproto.MIMEHeader
+		body   string
+	}
+	readParts := func(contentType, want string, body io.Reader) []part {
+		t.Helper()
+		mediaType, params, err := mime.ParseMediaType(contentType)
+		if err != nil || mediaType != want {
+			t.Fatalf("content-type = %q, want %s", contentType, want)
+		}
+		var parts []part
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				return parts
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, _ := io.ReadAll(p)
+			parts = append(parts, part{p.Header, string(b)})
+		}
+	}
+	unbase64 := func(s string) []byte {
+		data, _ := base64.StdEncoding.DecodeString(strings.ReplaceAll(s, "\r\n", ""))
+		return data
+	}
+
+	mixed := readParts(m.Header.Get("Content-Type"), "multipart/mixed", m.Body)
+	if len(mixed) != 2 {
+		t.Fatalf("mixed has %d parts", len(mixed))
+	}
+	pdf := mixed[1]
+	_, params, _ := mime.ParseMediaType(pdf.header.Get("Content-Disposition"))
+	if params["filename"] != "Rechnung März 2026.pdf" || !strings.HasPrefix(pdf.header.Get("Content-Type"), "application/pdf") ||
+		!strings.HasPrefix(pdf.header.Get("Content-Disposition"), "attachment") {
+		t.Errorf("attachment headers = %v", pdf.header)
+	}
+	if data := unbase64(pdf.body); string(data) != "%PDF-1.4 invoice" {
+		t.Errorf("attachment = %q", data)
+	}
+
+	related := readParts(mixed[0].header.Get("Content-Type"), "multipart/related", strings.NewReader(mixed[0].body))
+	if len(related) != 2 {
+		t.Fatalf("related has %d parts", len(related))
+	}
+	img := related[1]
+	if img.header.Get("Content-ID") != "<asset-3>" || !strings.HasPrefix(img.header.Get("Content-Disposition"), "inline") {
+		t.Errorf("inline headers = %v", img.header)
+	}
+	if !bytes.Equal(unbase64(img.body), logo) {
+		t.Error("inline image did not survive base64")
+	}
+	alt := readParts(related[0].header.Get("Content-Type"), "multipart/alternative", strings.NewReader(related[0].body))
+	if len(alt) != 2 || !strings.Contains(alt[1].body, "cid:asset-3") {
+		t.Errorf("alternative = %v", alt)
+	}
+}
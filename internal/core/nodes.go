@@ -0,0 +1,372 @@
+package core
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+	"github.com/pulak-ranjan/kumomta-ui/internal/store"
+)
+
+// Agent endpoints and request signing headers.
+const (
+	AgentApplyPath  = "/agent/apply"
+	AgentReportPath = "/agent/report"
+
+	AgentTimestampHeader = "X-Kumo-Agent-Timestamp"
+	AgentNonceHeader     = "X-Kumo-Agent-Nonce"
+	AgentSignatureHeader = "X-Kumo-Agent-Signature"
+
+	// Signed requests older (or newer) than this are rejected
+	agentMaxClockSkew = 5 * time.Minute
+)
+
+var nodeNameRegex = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// ValidateNode normalizes and checks a node before it is saved.
+func ValidateNode(n *models.Node) error {
+	n.Name = strings.TrimSpace(n.Name)
+	n.URL = strings.TrimRight(strings.TrimSpace(n.URL), "/")
+
+	if !nodeNameRegex.MatchString(n.Name) {
+		return fmt.Errorf("name must only contain letters, digits, '.', '_' or '-'")
+	}
+	u, err := url.Parse(n.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be the agent's base URL, e.g. https://mta2.example.com:9100")
+	}
+	return checkAgentURL(n.URL)
+}
+
+// checkAgentURL requires https: bundles carry DKIM private keys and the
+// panel's bearer tokens. Plain http is only allowed to an agent on this
+// host (started with -insecure-loopback).
+func checkAgentURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid agent url: %w", err)
+	}
+	if u.Scheme == "https" || (u.Scheme == "http" && IsLoopbackHost(u.Hostname())) {
+		return nil
+	}
+	return fmt.Errorf("agent url must use https (http is only allowed on loopback)")
+}
+
+// IsLoopbackHost reports whether host is localhost or a loopback IP.
+func IsLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// GenerateNodeSecret returns a new random signing key for a node's agent.
+func GenerateNodeSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// =======================
+// Request signing
+// =======================
+
+// SignAgentRequest signs a panel <-> agent request with the node secret.
+// The timestamp, nonce, method and path are covered so a captured request
+// can't be replayed later, twice or against another endpoint.
+func SignAgentRequest(secret, method, path string, ts int64, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d\n%s\n%s %s\n", ts, nonce, method, path)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewAgentNonce returns a random request nonce.
+func NewAgentNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// AgentNonceCache remembers the nonces of accepted requests for as long
+// as their timestamp is valid. The zero value is ready to use.
+type AgentNonceCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time // nonce -> when it can be forgotten
+}
+
+// use records nonce and reports whether it was new.
+func (c *AgentNonceCache) use(nonce string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seen == nil {
+		c.seen = map[string]time.Time{}
+	}
+	for n, until := range c.seen {
+		if now.After(until) {
+			delete(c.seen, n)
+		}
+	}
+	if _, ok := c.seen[nonce]; ok {
+		return false
+	}
+	// Valid timestamps span twice the skew
+	c.seen[nonce] = now.Add(2 * agentMaxClockSkew)
+	return true
+}
+
+var agentNonceRegex = regexp.MustCompile(`^[0-9a-f]{16,64}$`)
+
+// VerifyAgentRequest checks the signature headers of a request whose body
+// has already been read, and that its nonce hasn't been used before.
+func VerifyAgentRequest(secret string, nonces *AgentNonceCache, r *http.Request, body []byte) error {
+	ts, err := strconv.ParseInt(r.Header.Get(AgentTimestampHeader), 10, 64)
+	if err != nil {
+		return fmt.Errorf("missing timestamp")
+	}
+	if skew := time.Since(time.Unix(ts, 0)); skew > agentMaxClockSkew || skew < -agentMaxClockSkew {
+		return fmt.Errorf("timestamp outside the allowed clock skew")
+	}
+	nonce := r.Header.Get(AgentNonceHeader)
+	if !agentNonceRegex.MatchString(nonce) {
+		return fmt.Errorf("missing nonce")
+	}
+	expected := SignAgentRequest(secret, r.Method, r.URL.Path, ts, nonce, body)
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get(AgentSignatureHeader))) {
+		return fmt.Errorf("invalid signature")
+	}
+	// Only signed requests get to use up a nonce
+	if !nonces.use(nonce, time.Now()) {
+		return fmt.Errorf("replayed request")
+	}
+	return nil
+}
+
+// =======================
+// Config bundles
+// =======================
+
+// NodeBundle is the signed payload pushed to an agent: the node's policy
+// files plus the DKIM keys its senders sign with.
+type NodeBundle struct {
+	Node        string           `json:"node"`
+	GeneratedAt time.Time        `json:"generated_at"`
+	Hash        string           `json:"hash"`
+	Files       []KumoConfigFile `json:"files"`
+	DKIMKeys    []BundleFile     `json:"dkim_keys"`
+}
+
+// BundleFile is a file shipped in a bundle. Path is relative to the
+// agent's DKIM directory.
+type BundleFile struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// NodeReport is what an agent reports about its host.
+type NodeReport struct {
+	Hostname       string                `json:"hostname"`
+	Time           time.Time             `json:"time"`
+	Services       map[string]string     `json:"services"` // systemctl is-active
+	Load1m         float64               `json:"load_1m"`
+	RAMTotalMB     int64                 `json:"ram_total_mb"`
+	RAMAvailableMB int64                 `json:"ram_available_mb"`
+	DiskUsage      string                `json:"disk_usage"`
+	Queue          *QueueStats           `json:"queue"`
+	Stats          map[string][]DayStats `json:"stats"`       // today's per-domain log stats
+	PolicyHash     string                `json:"policy_hash"` // hash of the last bundle applied
+}
+
+// agentApplyResponse is the agent's answer to a bundle push.
+type agentApplyResponse struct {
+	Result *ApplyResult `json:"result"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// BuildNodeBundle renders the config for one node. DKIM keys are only
+// shipped from the panel's key directory; custom key paths must already
+// exist on the node.
+func BuildNodeBundle(snap *Snapshot, node models.Node) *NodeBundle {
+	nodeSnap := snap.ForNode(node.ID)
+	bundle := &NodeBundle{
+		Node:        node.Name,
+		GeneratedAt: time.Now().UTC(),
+		Files:       GenerateKumoFiles(nodeSnap),
+		DKIMKeys:    []BundleFile{},
+	}
+
+	for _, d := range nodeSnap.Domains {
+		for _, s := range d.Senders {
+			path := senderDKIMKeyFile(DKIMBasePath, d, s)
+			rel, err := filepath.Rel(DKIMBasePath, path)
+			if err != nil || strings.HasPrefix(rel, "..") {
+				continue
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			bundle.DKIMKeys = append(bundle.DKIMKeys, BundleFile{Path: rel, Content: string(data)})
+		}
+	}
+
+	bundle.Hash = bundle.ContentHash()
+	return bundle
+}
+
+// ContentHash identifies a bundle's content (not its timestamp), so the
+// panel can tell whether a node runs the current config.
+func (b *NodeBundle) ContentHash() string {
+	h := sha256.New()
+	for _, f := range b.Files {
+		fmt.Fprintf(h, "%s\x00%s\x00", f.Name, f.Content)
+	}
+	for _, k := range b.DKIMKeys {
+		fmt.Fprintf(h, "%s\x00%s\x00", k.Path, k.Content)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// =======================
+// Panel -> agent calls
+// =======================
+
+func nodeSecret(node *models.Node) (string, error) {
+	secret, err := Decrypt(node.Secret)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt node secret: %w", err)
+	}
+	return secret, nil
+}
+
+// callAgent sends a signed request to the node's agent and decodes the
+// JSON response into out.
+func callAgent(node *models.Node, method, path string, body []byte, timeout time.Duration, out interface{}) error {
+	// Nodes saved before https was required
+	if err := checkAgentURL(node.URL); err != nil {
+		return err
+	}
+	secret, err := nodeSecret(node)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(method, node.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	ts := time.Now().Unix()
+	nonce := NewAgentNonce()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(AgentTimestampHeader, strconv.FormatInt(ts, 10))
+	req.Header.Set(AgentNonceHeader, nonce)
+	req.Header.Set(AgentSignatureHeader, SignAgentRequest(secret, method, req.URL.Path, ts, nonce, body))
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("agent unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("agent rejected the request signature (check the node secret)")
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return err
+	}
+
+	// Error responses still carry a body (e.g. the failed validation log)
+	decodeErr := json.Unmarshal(data, out)
+	if resp.StatusCode >= 300 {
+		var errBody struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &errBody) == nil && errBody.Error != "" {
+			return fmt.Errorf("%s", errBody.Error)
+		}
+		return fmt.Errorf("agent returned %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if decodeErr != nil {
+		return fmt.Errorf("invalid agent response: %w", decodeErr)
+	}
+	return nil
+}
+
+// PushNodeConfig generates the node's bundle and has its agent validate
+// and apply it. The outcome is recorded on the node.
+func PushNodeConfig(st *store.Store, node *models.Node) (*ApplyResult, error) {
+	snap, err := LoadSnapshot(st)
+	if err != nil {
+		return nil, err
+	}
+	bundle := BuildNodeBundle(snap, *node)
+	body, err := json.Marshal(bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp agentApplyResponse
+	err = callAgent(node, http.MethodPost, AgentApplyPath, body, 2*time.Minute, &resp)
+
+	if recErr := st.RecordNodeApply(node.ID, bundle.Hash, err); recErr != nil {
+		st.LogError(recErr)
+	}
+	return resp.Result, err
+}
+
+// FetchNodeReport asks the node's agent for a health/queue/stats report and
+// stores it on the node.
+func FetchNodeReport(st *store.Store, node *models.Node) (*NodeReport, error) {
+	var report NodeReport
+	err := callAgent(node, http.MethodGet, AgentReportPath, nil, 30*time.Second, &report)
+
+	raw := ""
+	if err == nil {
+		data, _ := json.Marshal(report)
+		raw = string(data)
+	}
+	if recErr := st.RecordNodeStatus(node.ID, raw, err); recErr != nil {
+		st.LogError(recErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// PollNodes refreshes the report of every enabled node.
+func PollNodes(st *store.Store) {
+	nodes, err := st.ListNodes()
+	if err != nil {
+		log.Printf("Nodes: failed to list nodes: %v", err)
+		return
+	}
+	for i := range nodes {
+		if !nodes[i].Enabled {
+			continue
+		}
+		if _, err := FetchNodeReport(st, &nodes[i]); err != nil {
+			log.Printf("Nodes: %s: %v", nodes[i].Name, err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+)
+
+func TestSnapshotForNode(t *testing.T) {
+	snap := &Snapshot{
+		Settings: &models.AppSettings{PanelURL: "https://panel.example.com"},
+		Domains: []models.Domain{
+			{ID: 1, Name: "local.example", Senders: []models.Sender{
+				{ID: 1, Email: "a@local.example", EgressPoolID: 1},
+				{ID: 2, Email: "b@local.example", NodeID: 2, EgressPoolID: 2},
+			}},
+			{ID: 2, Name: "remote.example", NodeID: 2, Senders: []models.Sender{
+				{ID: 3, Email: "c@remote.example", EgressPoolID: 2},
+			}},
+		},
+		Pools: []models.EgressPool{{ID: 1, Name: "local"}, {ID: 2, Name: "remote"}, {ID: 3, Name: "unused"}},
+	}
+
+	local := snap.ForNode(0)
+	if len(local.Domains) != 1 || len(local.Domains[0].Senders) != 1 || local.Domains[0].Senders[0].ID != 1 {
+		t.Errorf("local domains = %+v", local.Domains)
+	}
+	if len(local.Pools) != 2 || local.Pools[0].Name != "local" || local.Pools[1].Name != "unused" {
+		t.Errorf("local pools = %+v", local.Pools)
+	}
+
+	remote := snap.ForNode(2)
+	if len(remote.Domains) != 2 || len(remote.Domains[0].Senders) != 1 || remote.Domains[0].Senders[0].ID != 2 {
+		t.Errorf("remote domains = %+v", remote.Domains)
+	}
+	if len(remote.Pools) != 1 || remote.Pools[0].Name != "remote" {
+		t.Errorf("remote pools = %+v", remote.Pools)
+	}
+
+	if len(snap.Domains[0].Senders) != 2 {
+		t.Error("ForNode modified the original snapshot")
+	}
+
+	t.Setenv("KUMO_APP_SECRET", "test-secret-that-is-at-least-32-characters")
+	if lua := GenerateInitLua(remote); !strings.Contains(lua, "https://panel.example.com/api/events/ingest") {
+		t.Error("remote node should reach the panel through panel_url")
+	}
+	if lua := GenerateInitLua(local); !strings.Contains(lua, PanelEventsURL) {
+		t.Error("local host should use the loopback panel URL")
+	}
+}
+
+func TestValidateNode(t *testing.T) {
+	for url, ok := range map[string]bool{
+		"https://mta2.example.com:9100/": true,
+		"http://127.0.0.1:9100":          true,
+		"http://localhost:9100":          true,
+		"http://mta2.example.com:9100":   false,
+		"http://10.0.0.2:9100":           false,
+		"ftp://mta2.example.com":         false,
+	} {
+		n := models.Node{Name: "mta2", URL: url}
+		if err := ValidateNode(&n); (err == nil) != ok {
+			t.Errorf("%s: err = %v", url, err)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// File states in a preview.
+const (
+	FileNew       = "new"
+	FileChanged   = "changed"
+	FileUnchanged = "unchanged"
+)
+
+// FilePreview is the diff of one generated file against the copy on disk.
+type FilePreview struct {
+	Name   string     `json:"name"`
+	Path   string     `json:"path"`
+	Status string     `json:"status"` // new, changed, unchanged
+	Hunks  []DiffHunk `json:"hunks"`
+}
+
+// ChangeCount is how many entities of one kind an apply would add/remove.
+type ChangeCount struct {
+	Kind    string `json:"kind"` // e.g. "tenants"
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+}
+
+// ConfigPreview is what an apply would change on disk.
+// NoOp is true when every file is already identical, so applying (and the
+// kumomta restart that comes with it) can be skipped.
+type ConfigPreview struct {
+	Files   []FilePreview `json:"files"`
+	Changes []ChangeCount `json:"changes"`
+	Summary string        `json:"summary"`
+	NoOp    bool          `json:"no_op"`
+}
+
+// previewEntity describes how to find one kind of entity in a generated file.
+type previewEntity struct {
+	file     string
+	singular string
+	plural   string
+	re       *regexp.Regexp
+}
+
+var previewEntities = []previewEntity{
+	{"queues.toml", "tenant", "tenants", regexp.MustCompile(`(?m)^\["tenant:([^"]+)"\]$`)},
+	{"sources.toml", "source", "sources", regexp.MustCompile(`(?m)^\["([^"]+)"\]$`)},
+	{"sources.toml", "egress pool", "egress pools", regexp.MustCompile(`(?m)^\[pools\."([^"]+)"\]$`)},
+	{"dkim_data.toml", "DKIM policy", "DKIM policies", regexp.MustCompile(`(?m)^match_sender = "([^"]+)"$`)},
+	{"listener_domains.toml", "listener domain", "listener domains", regexp.MustCompile(`(?m)^\["([^"]+)"\]$`)},
+	{"shaping.toml", "shaping rule", "shaping rules", regexp.MustCompile(`(?m)^domain = "([^"]+)"$`)},
+	{"routing.toml", "routing rule", "routing rules", regexp.MustCompile(`(?m)^name = "([^"]+)"$`)},
+	{"suppression.toml", "suppression", "suppressions", regexp.MustCompile(`(?m)^"([^"]+)" = \d+$`)},
+	{"custom.lua", "policy snippet", "policy snippets", regexp.MustCompile(`(?m)^-- snippet: (.+)$`)},
+}
+
+// PreviewConfig diffs freshly generated configs against the files
+// currently under KumoPolicyDir (the panel's own host).
+func PreviewConfig(snap *Snapshot) *ConfigPreview {
+	files := GenerateKumoFiles(snap.ForNode(0))
+	return buildPreview(files, readCurrentFiles(files))
+}
+
+func buildPreview(files []KumoConfigFile, current map[string]string) *ConfigPreview {
+	out := &ConfigPreview{NoOp: true}
+	generated := make(map[string]string, len(files))
+
+	for _, f := range files {
+		generated[f.Name] = f.Content
+		old, exists := current[f.Name]
+
+		fp := FilePreview{Name: f.Name, Path: f.Path, Status: FileUnchanged, Hunks: []DiffHunk{}}
+		switch {
+		case !exists:
+			fp.Status = FileNew
+		case old != f.Content:
+			fp.Status = FileChanged
+		}
+		if fp.Status != FileUnchanged {
+			out.NoOp = false
+			if h := ComputeHunks(RedactSecrets(old), RedactSecrets(f.Content)); h != nil {
+				fp.Hunks = h
+			}
+		}
+		out.Files = append(out.Files, fp)
+	}
+
+	out.Changes = summarizeChanges(current, generated)
+	out.Summary = summaryText(out)
+	return out
+}
+
+// summarizeChanges counts entities added/removed between two file sets.
+func summarizeChanges(oldFiles, newFiles map[string]string) []ChangeCount {
+	changes := []ChangeCount{}
+	for _, e := range previewEntities {
+		oldKeys := matchSet(e.re, oldFiles[e.file])
+		newKeys := matchSet(e.re, newFiles[e.file])
+
+		c := ChangeCount{Kind: e.plural}
+		for k := range newKeys {
+			if !oldKeys[k] {
+				c.Added++
+			}
+		}
+		for k := range oldKeys {
+			if !newKeys[k] {
+				c.Removed++
+			}
+		}
+		if c.Added > 0 || c.Removed > 0 {
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+func matchSet(re *regexp.Regexp, content string) map[string]bool {
+	set := make(map[string]bool)
+	for _, m := range re.FindAllStringSubmatch(content, -1) {
+		set[m[1]] = true
+	}
+	return set
+}
+
+// summaryText renders e.g. "3 tenants added, 1 DKIM policy removed".
+func summaryText(p *ConfigPreview) string {
+	if p.NoOp {
+		return "no changes"
+	}
+
+	var parts []string
+	for _, c := range p.Changes {
+		e := entityByPlural(c.Kind)
+		if c.Added > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s added", c.Added, e.label(c.Added)))
+		}
+		if c.Removed > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s removed", c.Removed, e.label(c.Removed)))
+		}
+	}
+	if len(parts) == 0 {
+		changed := 0
+		for _, f := range p.Files {
+			if f.Status != FileUnchanged {
+				changed++
+			}
+		}
+		if changed == 1 {
+			return "1 file changed"
+		}
+		return fmt.Sprintf("%d files changed", changed)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func entityByPlural(plural string) previewEntity {
+	for _, e := range previewEntities {
+		if e.plural == plural {
+			return e
+		}
+	}
+	return previewEntity{singular: plural, plural: plural}
+}
+
+func (e previewEntity) label(n int) string {
+	if n == 1 {
+		return e.singular
+	}
+	return e.plural
+}
@@ -0,0 +1,167 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+)
+
+// Built-in queue defaults, used when neither sender nor domain set a value.
+const (
+	DefaultRetryInterval = "1m"
+	DefaultMaxAge        = "3d"
+)
+
+// KumoMTA duration, e.g. "30s", "1m", "2h", "3d", "10 minutes"
+var durationRegex = regexp.MustCompile(`^(\d+)\s?(s|sec|secs|seconds?|m|min|mins|minutes?|h|hr|hrs|hours?|d|days?)$`)
+
+// X-Campaign values we accept as override keys (they end up in TOML keys).
+var campaignNameRegex = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// durationSeconds converts a duration string to seconds (-1 if invalid).
+func durationSeconds(d string) int64 {
+	m := durationRegex.FindStringSubmatch(d)
+	if m == nil {
+		return -1
+	}
+	n, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return -1
+	}
+	switch m[2][0] {
+	case 'm':
+		return n * 60
+	case 'h':
+		return n * 3600
+	case 'd':
+		return n * 86400
+	}
+	return n
+}
+
+// ValidateQueuePolicy normalizes and checks a queue policy before it is saved.
+func ValidateQueuePolicy(p *models.QueuePolicy) error {
+	p.RetryInterval = strings.TrimSpace(p.RetryInterval)
+	p.MaxRetryInterval = strings.TrimSpace(p.MaxRetryInterval)
+	p.MaxAge = strings.TrimSpace(p.MaxAge)
+
+	for name, v := range map[string]string{
+		"retry_interval":     p.RetryInterval,
+		"max_retry_interval": p.MaxRetryInterval,
+		"max_age":            p.MaxAge,
+	} {
+		if v != "" && durationSeconds(v) <= 0 {
+			return fmt.Errorf("invalid %s (e.g. 30s, 5m, 2h, 3d)", name)
+		}
+	}
+	if p.RetryInterval != "" && p.MaxRetryInterval != "" &&
+		durationSeconds(p.MaxRetryInterval) < durationSeconds(p.RetryInterval) {
+		return fmt.Errorf("max_retry_interval must not be shorter than retry_interval")
+	}
+	return nil
+}
+
+// ValidateCampaignName checks an X-Campaign value used as an override key.
+func ValidateCampaignName(name string) error {
+	if !campaignNameRegex.MatchString(name) {
+		return fmt.Errorf("campaign must only contain letters, digits, '.', '_' or '-'")
+	}
+	return nil
+}
+
+// mergeQueuePolicy returns base with every non-empty field of override applied.
+func mergeQueuePolicy(base, override models.QueuePolicy) models.QueuePolicy {
+	if override.RetryInterval != "" {
+		base.RetryInterval = override.RetryInterval
+	}
+	if override.MaxRetryInterval != "" {
+		base.MaxRetryInterval = override.MaxRetryInterval
+	}
+	if override.MaxAge != "" {
+		base.MaxAge = override.MaxAge
+	}
+	return base
+}
+
+// EffectiveQueuePolicy resolves the queue policy of a sender:
+// sender overrides, then domain defaults, then built-in defaults.
+func EffectiveQueuePolicy(d models.Domain, s models.Sender) models.QueuePolicy {
+	p := models.QueuePolicy{RetryInterval: DefaultRetryInterval, MaxAge: DefaultMaxAge}
+	p = mergeQueuePolicy(p, d.QueuePolicy)
+	return mergeQueuePolicy(p, s.QueuePolicy)
+}
+
+// CheckQueuePolicyLayers checks the policies KumoMTA will actually get
+// for a domain: its senders (d.Senders) merged over the domain, and the
+// campaign overrides merged over each sender. Every layer can be valid on
+// its own and still invert the backoff once merged, e.g. a sender
+// retry_interval of 1h under a domain max_retry_interval of 10m.
+func CheckQueuePolicyLayers(d models.Domain, campaigns []models.CampaignQueuePolicy) error {
+	check := func(what string, p models.QueuePolicy) error {
+		if p.RetryInterval != "" && p.MaxRetryInterval != "" &&
+			durationSeconds(p.MaxRetryInterval) < durationSeconds(p.RetryInterval) {
+			return fmt.Errorf("%s: retry_interval %s would be longer than max_retry_interval %s once merged with the domain and sender policies",
+				what, p.RetryInterval, p.MaxRetryInterval)
+		}
+		return nil
+	}
+
+	// Domain-wide campaign overrides are checked even without senders
+	if err := check("domain "+d.Name, EffectiveQueuePolicy(d, models.Sender{})); err != nil {
+		return err
+	}
+	for _, cp := range campaigns {
+		if cp.DomainID == d.ID && cp.SenderID == 0 {
+			if err := check("campaign "+cp.Campaign, mergeQueuePolicy(EffectiveQueuePolicy(d, models.Sender{}), cp.QueuePolicy)); err != nil {
+				return err
+			}
+		}
+	}
+
+	snap := &Snapshot{CampaignPolicies: campaigns}
+	for _, s := range d.Senders {
+		tenant := EffectiveQueuePolicy(d, s)
+		if err := check("sender "+s.Email, tenant); err != nil {
+			return err
+		}
+		for name, p := range campaignPoliciesFor(snap, d, s) {
+			if err := check(fmt.Sprintf("campaign %s of sender %s", name, s.Email), mergeQueuePolicy(tenant, p)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// campaignPoliciesFor returns the campaign overrides that apply to a
+// sender, keyed by campaign. Sender-specific rows win over domain-wide ones.
+func campaignPoliciesFor(snap *Snapshot, d models.Domain, s models.Sender) map[string]models.QueuePolicy {
+	out := map[string]models.QueuePolicy{}
+	for _, cp := range snap.CampaignPolicies {
+		if cp.DomainID == d.ID && cp.SenderID == 0 {
+			out[cp.Campaign] = cp.QueuePolicy
+		}
+	}
+	for _, cp := range snap.CampaignPolicies {
+		if cp.DomainID == d.ID && cp.SenderID == s.ID {
+			out[cp.Campaign] = cp.QueuePolicy
+		}
+	}
+	return out
+}
+
+// writeQueuePolicy writes the non-empty fields of p as TOML lines.
+func writeQueuePolicy(b *strings.Builder, p models.QueuePolicy) {
+	if p.RetryInterval != "" {
+		fmt.Fprintf(b, "retry_interval = \"%s\"\n", p.RetryInterval)
+	}
+	if p.MaxRetryInterval != "" {
+		fmt.Fprintf(b, "max_retry_interval = \"%s\"\n", p.MaxRetryInterval)
+	}
+	if p.MaxAge != "" {
+		fmt.Fprintf(b, "max_age = \"%s\"\n", p.MaxAge)
+	}
+}
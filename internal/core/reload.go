@@ -0,0 +1,109 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ConfigValidator checks a policy before it is swapped in.
+// initLuaPath points at init.lua inside the staging directory.
+type ConfigValidator interface {
+	Validate(initLuaPath string) (log string, err error)
+}
+
+// ServiceReloader makes the running MTA pick up the new policy files.
+type ServiceReloader interface {
+	Reload() (log string, err error)
+}
+
+// KumodValidator runs `kumod --validate` against the staged policy.
+type KumodValidator struct {
+	Binary string // defaults to KumoBinary
+	User   string // defaults to "kumod"
+}
+
+func (v KumodValidator) Validate(initLuaPath string) (string, error) {
+	bin := v.Binary
+	if bin == "" {
+		bin = KumoBinary
+	}
+	user := v.User
+	if user == "" {
+		user = "kumod"
+	}
+
+	out, err := exec.Command(bin, "--policy", initLuaPath, "--validate", "--user", user).CombinedOutput()
+	if err != nil {
+		return string(out), fmt.Errorf("kumod validation failed (check logs): %w", err)
+	}
+	return string(out), nil
+}
+
+// SystemdRestartReloader restarts the unit. Simple, but drops in-flight
+// SMTP sessions.
+type SystemdRestartReloader struct {
+	Unit string // defaults to "kumomta"
+}
+
+func (r SystemdRestartReloader) Reload() (string, error) {
+	out, err := exec.Command("systemctl", "restart", unitOrDefault(r.Unit)).CombinedOutput()
+	if err != nil {
+		return string(out), fmt.Errorf("failed to restart kumomta: %w", err)
+	}
+	return string(out), nil
+}
+
+// KumoHTTPEndpoint is kumod's HTTP listener (see GenerateInitLua).
+const KumoHTTPEndpoint = "http://127.0.0.1:8000"
+
+// ConfigEpochReloader bumps kumod's config epoch through its admin API
+// (what `kcli bump-config-epoch` does). kumod then re-reads its policy
+// without closing connections.
+type ConfigEpochReloader struct {
+	Endpoint string // defaults to KumoHTTPEndpoint
+}
+
+func (r ConfigEpochReloader) Reload() (string, error) {
+	endpoint := r.Endpoint
+	if endpoint == "" {
+		endpoint = KumoHTTPEndpoint
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(strings.TrimRight(endpoint, "/")+"/api/admin/bump-config-epoch", "application/json", nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to reach kumod to bump the config epoch: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode >= 300 {
+		return string(body), fmt.Errorf("kumod refused the config epoch bump: %s", resp.Status)
+	}
+	return string(body), nil
+}
+
+// NoopValidator accepts every policy. Meant for CI and dev boxes without kumod.
+type NoopValidator struct{}
+
+func (NoopValidator) Validate(string) (string, error) { return "validation skipped", nil }
+
+// NoopReloader does nothing but count how often it was asked to reload,
+// which makes it usable as a fake in tests.
+type NoopReloader struct {
+	Calls int
+}
+
+func (r *NoopReloader) Reload() (string, error) {
+	r.Calls++
+	return "reload skipped", nil
+}
+
+func unitOrDefault(unit string) string {
+	if unit == "" {
+		return "kumomta"
+	}
+	return unit
+}
@@ -0,0 +1,176 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+	"github.com/pulak-ranjan/kumomta-ui/internal/store"
+)
+
+// RevisionFileDiff is the unified diff of one policy file between two revisions.
+type RevisionFileDiff struct {
+	Name string `json:"name"`
+	Diff string `json:"diff"` // empty when the file is identical
+}
+
+// Placeholders for the kumod -> panel bearer tokens in init.lua. Revisions
+// and previews only ever hold these; the tokens are derived from
+// KUMO_APP_SECRET again when a revision is rolled back.
+const (
+	redactedIngestToken   = "<redacted:ingest-token>"
+	redactedSMTPAuthToken = "<redacted:smtp-auth-token>"
+)
+
+// RedactSecrets replaces the bearer tokens in a generated file.
+func RedactSecrets(content string) string {
+	if t := IngestToken(); t != "" {
+		content = strings.ReplaceAll(content, t, redactedIngestToken)
+	}
+	if t := SMTPAuthToken(); t != "" {
+		content = strings.ReplaceAll(content, t, redactedSMTPAuthToken)
+	}
+	return content
+}
+
+// restoreSecrets puts the current bearer tokens back into a redacted file.
+func restoreSecrets(content string) string {
+	content = strings.ReplaceAll(content, redactedIngestToken, IngestToken())
+	return strings.ReplaceAll(content, redactedSMTPAuthToken, SMTPAuthToken())
+}
+
+// RedactStoredRevisions removes the bearer tokens from revisions recorded
+// before they were redacted on save.
+func RedactStoredRevisions(st *store.Store) error {
+	for _, token := range []string{IngestToken(), SMTPAuthToken()} {
+		if token == "" {
+			continue
+		}
+		var revs []models.ConfigRevision
+		like := "%" + token + "%"
+		if err := st.DB.Where("files_json LIKE ? OR diff LIKE ?", like, like).Find(&revs).Error; err != nil {
+			return err
+		}
+		for _, rev := range revs {
+			err := st.DB.Model(&rev).Updates(map[string]interface{}{
+				"files_json": RedactSecrets(rev.FilesJSON),
+				"diff":       RedactSecrets(rev.Diff),
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ApplyAndRecord generates configs from the snapshot, applies them through
+// the usual validate-then-restart path and stores the result as a
+// ConfigRevision. The revision is recorded even when apply fails.
+// Only what is assigned to the panel's own host is applied here; remote
+// nodes get theirs through PushNodeConfig.
+func ApplyAndRecord(st *store.Store, snap *Snapshot, appliedBy string) (*ApplyResult, *models.ConfigRevision, error) {
+	rev := &models.ConfigRevision{AppliedBy: appliedBy, Action: "apply"}
+	res, err := applyAndRecord(st, GenerateKumoFiles(snap.ForNode(0)), rev)
+	return res, rev, err
+}
+
+// RollbackToRevision re-applies the files stored in revision id. Files that
+// did not exist when that revision was taken are left as they are.
+func RollbackToRevision(st *store.Store, id uint, appliedBy string) (*ApplyResult, *models.ConfigRevision, error) {
+	target, err := st.GetConfigRevisionByID(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	files, err := RevisionFiles(target)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range files {
+		files[i].Content = restoreSecrets(files[i].Content)
+	}
+
+	rev := &models.ConfigRevision{AppliedBy: appliedBy, Action: "rollback", RollbackOfID: target.ID}
+	res, err := applyAndRecord(st, files, rev)
+	return res, rev, err
+}
+
+func applyAndRecord(st *store.Store, files []KumoConfigFile, rev *models.ConfigRevision) (*ApplyResult, error) {
+	stored := make([]KumoConfigFile, len(files))
+	for i, f := range files {
+		f.Content = RedactSecrets(f.Content)
+		stored[i] = f
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode revision: %w", err)
+	}
+	rev.FilesJSON = string(data)
+	rev.Diff = diffAgainstDisk(files)
+
+	res, applyErr := applyKumoFiles(files)
+	if res != nil {
+		rev.ValidationOK = res.ValidationOK
+		rev.ValidationLog = res.ValidationLog
+		rev.RestartOK = res.RestartOK
+	}
+	if applyErr != nil {
+		rev.Error = applyErr.Error()
+	}
+
+	if err := st.CreateConfigRevision(rev); err != nil {
+		st.LogError(err)
+	}
+	return res, applyErr
+}
+
+// diffAgainstDisk builds one unified diff covering every file that will change.
+func diffAgainstDisk(files []KumoConfigFile) string {
+	current := readCurrentFiles(files)
+	var b strings.Builder
+	for _, f := range files {
+		b.WriteString(UnifiedDiff(f.Name, RedactSecrets(current[f.Name]), RedactSecrets(f.Content)))
+	}
+	return b.String()
+}
+
+// RevisionFiles decodes the policy files stored in a revision.
+func RevisionFiles(rev *models.ConfigRevision) ([]KumoConfigFile, error) {
+	var files []KumoConfigFile
+	if err := json.Unmarshal([]byte(rev.FilesJSON), &files); err != nil {
+		return nil, fmt.Errorf("revision %d has unreadable files: %w", rev.ID, err)
+	}
+	return files, nil
+}
+
+// DiffRevisions returns per-file diffs going from one revision to another.
+func DiffRevisions(from, to *models.ConfigRevision) ([]RevisionFileDiff, error) {
+	fromFiles, err := RevisionFiles(from)
+	if err != nil {
+		return nil, err
+	}
+	toFiles, err := RevisionFiles(to)
+	if err != nil {
+		return nil, err
+	}
+
+	old := make(map[string]string, len(fromFiles))
+	for _, f := range fromFiles {
+		old[f.Name] = f.Content
+	}
+
+	var out []RevisionFileDiff
+	seen := make(map[string]bool, len(toFiles))
+	for _, f := range toFiles {
+		seen[f.Name] = true
+		out = append(out, RevisionFileDiff{Name: f.Name, Diff: UnifiedDiff(f.Name, old[f.Name], f.Content)})
+	}
+	// Files only present in the older revision show as fully removed.
+	for _, f := range fromFiles {
+		if !seen[f.Name] {
+			out = append(out, RevisionFileDiff{Name: f.Name, Diff: UnifiedDiff(f.Name, f.Content, "")})
+		}
+	}
+	return out, nil
+}
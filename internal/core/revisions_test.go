@@ -0,0 +1,56 @@
+package core
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+)
+
+func TestRevisionSecretsRedacted(t *testing.T) {
+	t.Setenv("KUMO_APP_SECRET", "test-secret-that-is-at-least-32-characters")
+	lua := GenerateInitLua(&Snapshot{Settings: &models.AppSettings{MainHostname: "mta.example.net"}})
+	tokens := []string{IngestToken(), SMTPAuthToken()}
+	for _, token := range tokens {
+		if !strings.Contains(lua, token) {
+			t.Fatalf("init.lua does not use token %s", token)
+		}
+	}
+
+	redacted := RedactSecrets(lua)
+	for _, token := range tokens {
+		if strings.Contains(redacted, token) {
+			t.Errorf("token %s left in the redacted file", token)
+		}
+	}
+	if restoreSecrets(redacted) != lua {
+		t.Error("rollback would not restore the tokens")
+	}
+
+	// Preview hunks show the placeholders, on both sides of the diff
+	p := buildPreview([]KumoConfigFile{{Name: "init.lua", Content: lua}}, map[string]string{"init.lua": "-- old\n" + lua})
+	hunks, _ := json.Marshal(p.Files[0].Hunks)
+	if len(p.Files[0].Hunks) == 0 || strings.Contains(string(hunks), tokens[0]) {
+		t.Errorf("preview hunks = %s", hunks)
+	}
+
+	// Revisions stored before redaction are cleaned up
+	st := newCampaignTestService(t).Store
+	files, _ := json.Marshal([]KumoConfigFile{{Name: "init.lua", Content: lua}})
+	old := models.ConfigRevision{Action: "apply", FilesJSON: string(files), Diff: UnifiedDiff("init.lua", "", lua)}
+	st.DB.Create(&old)
+	if err := RedactStoredRevisions(st); err != nil {
+		t.Fatal(err)
+	}
+	st.DB.First(&old, old.ID)
+	for _, token := range tokens {
+		if strings.Contains(old.FilesJSON, token) || strings.Contains(old.Diff, token) {
+			t.Errorf("token %s left in a stored revision", token)
+		}
+	}
+	got, err := RevisionFiles(&old)
+	if err != nil || restoreSecrets(got[0].Content) != lua {
+		t.Errorf("stored files unusable for a rollback: %v", err)
+	}
+}
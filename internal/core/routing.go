@@ -0,0 +1,245 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+)
+
+// Patterns only use '*' as a wildcard, so Go (path.Match) and the
+// generated Lua matcher agree on what they match.
+var (
+	routeDomainPatternRegex = regexp.MustCompile(`^[a-z0-9*][a-z0-9.*-]*$`)
+	routeTenantPatternRegex = regexp.MustCompile(`^[a-z0-9*][a-z0-9._*-]*$`)
+	smarthostNameRegex      = regexp.MustCompile(`^[a-zA-Z0-9.-]+$`)
+)
+
+// RouteSource is one egress source a routed message may leave from.
+type RouteSource struct {
+	Name       string `json:"name"`
+	Address    string `json:"address"`
+	EHLODomain string `json:"ehlo_domain"`
+	Weight     int    `json:"weight"`
+}
+
+// RouteDecision explains how a message from sender to recipient would be routed.
+type RouteDecision struct {
+	Tenant          string        `json:"tenant"`
+	RecipientDomain string        `json:"recipient_domain"`
+	RuleID          uint          `json:"rule_id,omitempty"` // 0 = no rule matched
+	RuleName        string        `json:"rule_name,omitempty"`
+	EgressPool      string        `json:"egress_pool"`
+	Sources         []RouteSource `json:"sources"`
+	Smarthost       string        `json:"smarthost,omitempty"` // host:port, empty = MX delivery
+}
+
+// splitPatterns splits a comma separated pattern list (lowercased).
+func splitPatterns(list string) []string {
+	var out []string
+	for _, p := range strings.Split(list, ",") {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// parseSmarthost splits "host[:port]" (port defaults to 25).
+func parseSmarthost(hostport string) (string, int, error) {
+	host, portStr := hostport, "25"
+	if strings.Contains(hostport, ":") {
+		var err error
+		host, portStr, err = net.SplitHostPort(hostport)
+		if err != nil {
+			return "", 0, fmt.Errorf("smarthost must be host or host:port")
+		}
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid smarthost port")
+	}
+	if net.ParseIP(host) == nil && !smarthostNameRegex.MatchString(host) {
+		return "", 0, fmt.Errorf("invalid smarthost host")
+	}
+	return host, port, nil
+}
+
+// ValidateRoutingRule normalizes and checks a routing rule before it is saved.
+func ValidateRoutingRule(rule *models.RoutingRule) error {
+	rule.Name = strings.TrimSpace(rule.Name)
+	rule.TenantPattern = strings.ToLower(strings.TrimSpace(rule.TenantPattern))
+	rule.Smarthost = strings.TrimSpace(rule.Smarthost)
+
+	if rule.Name == "" || strings.ContainsAny(rule.Name, "\"\\\r\n") {
+		return fmt.Errorf("name is required and must not contain quotes")
+	}
+	if rule.TenantPattern != "" && !routeTenantPatternRegex.MatchString(rule.TenantPattern) {
+		return fmt.Errorf("invalid tenant_pattern (e.g. example.com__* )")
+	}
+
+	domains := splitPatterns(rule.RecipientDomains)
+	if len(domains) == 0 {
+		return fmt.Errorf("at least one recipient domain pattern is required")
+	}
+	for _, d := range domains {
+		if !routeDomainPatternRegex.MatchString(d) {
+			return fmt.Errorf("invalid recipient domain pattern: %s", d)
+		}
+	}
+	rule.RecipientDomains = strings.Join(domains, ",")
+
+	if rule.EgressPoolID == 0 && rule.Smarthost == "" {
+		return fmt.Errorf("a rule needs an egress pool, a smarthost, or both")
+	}
+	if rule.Smarthost != "" {
+		if _, _, err := parseSmarthost(rule.Smarthost); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// activeRoutingRules returns enabled rules that still point somewhere
+// (a rule whose pool was deleted and has no smarthost is dropped).
+func activeRoutingRules(snap *Snapshot) []models.RoutingRule {
+	var out []models.RoutingRule
+	for _, r := range snap.RoutingRules {
+		if !r.Enabled {
+			continue
+		}
+		if r.Smarthost == "" && snap.PoolByID(r.EgressPoolID) == nil {
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// =======================
+// routing.toml generator
+// =======================
+
+func GenerateRoutingTOML(snap *Snapshot) string {
+	var b strings.Builder
+	for _, r := range activeRoutingRules(snap) {
+		tenant := r.TenantPattern
+		if tenant == "" {
+			tenant = "*"
+		}
+		quoted := []string{}
+		for _, d := range splitPatterns(r.RecipientDomains) {
+			quoted = append(quoted, fmt.Sprintf("\"%s\"", d))
+		}
+
+		fmt.Fprintf(&b, "[[rules]]\n")
+		fmt.Fprintf(&b, "name = \"%s\"\n", r.Name)
+		fmt.Fprintf(&b, "tenant = \"%s\"\n", tenant)
+		fmt.Fprintf(&b, "domains = [%s]\n", strings.Join(quoted, ", "))
+		if p := snap.PoolByID(r.EgressPoolID); p != nil {
+			fmt.Fprintf(&b, "egress_pool = \"%s\"\n", EgressPoolName(*p))
+		}
+		if host, port, err := parseSmarthost(r.Smarthost); r.Smarthost != "" && err == nil {
+			fmt.Fprintf(&b, "smarthost = \"%s\"\n", host)
+			fmt.Fprintf(&b, "smarthost_port = %d\n", port)
+		}
+		fmt.Fprintf(&b, "\n")
+	}
+	return b.String()
+}
+
+// matchRoute returns the first active rule matching tenant and recipient domain.
+func matchRoute(snap *Snapshot, tenant, domain string) *models.RoutingRule {
+	tenant = strings.ToLower(tenant)
+	domain = strings.ToLower(domain)
+	for _, r := range activeRoutingRules(snap) {
+		tp := r.TenantPattern
+		if tp == "" {
+			tp = "*"
+		}
+		if ok, _ := path.Match(tp, tenant); !ok {
+			continue
+		}
+		for _, dp := range splitPatterns(r.RecipientDomains) {
+			if ok, _ := path.Match(dp, domain); ok {
+				rule := r
+				return &rule
+			}
+		}
+	}
+	return nil
+}
+
+// ResolveRoute reports which pool, sources and route the generated policy
+// would pick for a message from senderEmail to recipient.
+func ResolveRoute(snap *Snapshot, senderEmail, recipient string) (*RouteDecision, error) {
+	senderEmail = strings.ToLower(strings.TrimSpace(senderEmail))
+	at := strings.LastIndex(recipient, "@")
+	if at < 0 || at == len(recipient)-1 {
+		return nil, fmt.Errorf("invalid recipient address")
+	}
+
+	var dom *models.Domain
+	var snd *models.Sender
+	for i := range snap.Domains {
+		for j := range snap.Domains[i].Senders {
+			if strings.ToLower(snap.Domains[i].Senders[j].Email) == senderEmail {
+				dom, snd = &snap.Domains[i], &snap.Domains[i].Senders[j]
+			}
+		}
+	}
+	if snd == nil {
+		return nil, fmt.Errorf("sender %s is not configured", senderEmail)
+	}
+
+	dec := &RouteDecision{
+		Tenant:          PoolName(*dom, *snd),
+		RecipientDomain: strings.ToLower(recipient[at+1:]),
+		EgressPool:      SenderPoolName(snap, *dom, *snd),
+		Sources:         []RouteSource{},
+	}
+
+	if rule := matchRoute(snap, dec.Tenant, dec.RecipientDomain); rule != nil {
+		dec.RuleID = rule.ID
+		dec.RuleName = rule.Name
+		if p := snap.PoolByID(rule.EgressPoolID); p != nil {
+			dec.EgressPool = EgressPoolName(*p)
+		}
+		if host, port, err := parseSmarthost(rule.Smarthost); rule.Smarthost != "" && err == nil {
+			dec.Smarthost = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+	}
+
+	// Expand the chosen pool into its sources
+	for _, p := range snap.Pools {
+		if EgressPoolName(p) != dec.EgressPool {
+			continue
+		}
+		for _, m := range p.Members {
+			weight := m.Weight
+			if weight <= 0 {
+				weight = 1
+			}
+			dec.Sources = append(dec.Sources, RouteSource{
+				Name:       PoolSourceName(p, m.SystemIP.Value),
+				Address:    m.SystemIP.Value,
+				EHLODomain: poolMemberEHLO(snap, p, m),
+				Weight:     weight,
+			})
+		}
+	}
+	if dec.EgressPool == PoolName(*dom, *snd) {
+		dec.Sources = append(dec.Sources, RouteSource{
+			Name:       SourceName(*dom, *snd),
+			Address:    snd.IP,
+			EHLODomain: senderEHLO(*dom, *snd),
+			Weight:     1,
+		})
+	}
+	return dec, nil
+}
@@ -33,15 +33,22 @@ func BlockIP(ip string) error {
 	if strings.Contains(ip, "/") || strings.Contains(ip, ";") || strings.Contains(ip, " ") {
 		return fmt.Errorf("invalid IP format")
 	}
+	if ip == "::1" {
+		return fmt.Errorf("cannot block localhost")
+	}
+	family := "ipv4"
+	if IsIPv6(ip) {
+		family = "ipv6"
+	}
 
 	// 1. Immediate Block (Runtime)
-	cmd := exec.Command("firewall-cmd", "--add-rich-rule", fmt.Sprintf("rule family='ipv4' source address='%s' drop", ip))
+	cmd := exec.Command("firewall-cmd", "--add-rich-rule", fmt.Sprintf("rule family='%s' source address='%s' drop", family, ip))
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("failed to apply runtime block: %v", err)
 	}
 
 	// 2. Permanent Block (Persist across reboots)
-	cmdPerm := exec.Command("firewall-cmd", "--permanent", "--add-rich-rule", fmt.Sprintf("rule family='ipv4' source address='%s' drop", ip))
+	cmdPerm := exec.Command("firewall-cmd", "--permanent", "--add-rich-rule", fmt.Sprintf("rule family='%s' source address='%s' drop", family, ip))
 	if err := cmdPerm.Run(); err != nil {
 		// Log but don't fail if runtime worked
 		fmt.Printf("Warning: failed to make block permanent for %s: %v\n", ip, err)
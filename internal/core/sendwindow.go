@@ -0,0 +1,467 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // timezone names work without the OS zoneinfo
+
+	"gorm.io/gorm"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+)
+
+// Per-recipient send time: a campaign can deliver at a fixed local time
+// (SendAtLocalTime) and/or only inside a sending window (days and hours),
+// both in each recipient's own timezone. When the campaign starts every
+// recipient gets a NotBefore time; the sending loop only picks recipients
+// that are due and sleeps until the next one is.
+
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// sendSchedule is the parsed timing of a campaign.
+type sendSchedule struct {
+	atLocal  int // minutes after midnight, -1 = whenever allowed
+	days     [7]bool
+	winStart int // minutes after midnight
+	winEnd   int // exclusive; 24*60 = end of day
+	fallback *time.Location
+}
+
+// parseClock parses "HH:MM" into minutes after midnight. "24:00" is
+// allowed when end is set.
+func parseClock(s string, end bool) (int, error) {
+	h, m, ok := strings.Cut(strings.TrimSpace(s), ":")
+	hh, err1 := strconv.Atoi(h)
+	mm, err2 := strconv.Atoi(m)
+	if !ok || err1 != nil || err2 != nil || hh < 0 || mm < 0 || mm > 59 || hh > 24 || (hh == 24 && (!end || mm != 0)) {
+		return 0, fmt.Errorf("%q is not a HH:MM time", s)
+	}
+	return hh*60 + mm, nil
+}
+
+// parseWeekdays parses "mon-fri", "mon,wed,sat", "weekdays" or "weekends"
+// ("" = every day) and returns the normalized form.
+func parseWeekdays(s string) ([7]bool, string, error) {
+	var days [7]bool
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "":
+		for i := range days {
+			days[i] = true
+		}
+		return days, "", nil
+	case "weekdays":
+		s = "mon-fri"
+	case "weekends":
+		s = "sat,sun"
+	}
+	index := func(name string) (int, bool) {
+		name = strings.TrimSpace(name)
+		if len(name) > 3 {
+			name = name[:3]
+		}
+		for i, n := range weekdayNames {
+			if n == name {
+				return i, true
+			}
+		}
+		return 0, false
+	}
+	for _, part := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		a, ok := index(from)
+		if !ok {
+			return days, "", fmt.Errorf("unknown weekday %q", strings.TrimSpace(from))
+		}
+		b := a
+		if isRange {
+			if b, ok = index(to); !ok {
+				return days, "", fmt.Errorf("unknown weekday %q", strings.TrimSpace(to))
+			}
+		}
+		for i := a; ; i = (i + 1) % 7 {
+			days[i] = true
+			if i == b {
+				break
+			}
+		}
+	}
+	var names []string
+	for _, i := range []int{1, 2, 3, 4, 5, 6, 0} { // Monday first
+		if days[i] {
+			names = append(names, weekdayNames[i])
+		}
+	}
+	return days, strings.Join(names, ","), nil
+}
+
+// ValidateSendSchedule normalizes and checks a campaign's local send time,
+// sending window and fallback timezone.
+func ValidateSendSchedule(c *models.Campaign) error {
+	c.SendAtLocalTime = strings.TrimSpace(c.SendAtLocalTime)
+	c.SendWindowStart = strings.TrimSpace(c.SendWindowStart)
+	c.SendWindowEnd = strings.TrimSpace(c.SendWindowEnd)
+	c.Timezone = strings.TrimSpace(c.Timezone)
+
+	_, days, err := parseWeekdays(c.SendWindowDays)
+	if err != nil {
+		return fmt.Errorf("send_window_days: %v", err)
+	}
+	c.SendWindowDays = days
+	if c.Timezone != "" {
+		if _, err := time.LoadLocation(c.Timezone); err != nil {
+			return fmt.Errorf("timezone: unknown timezone %q", c.Timezone)
+		}
+	}
+	if (c.SendWindowStart == "") != (c.SendWindowEnd == "") {
+		return fmt.Errorf("send_window_start and send_window_end go together")
+	}
+	s, err := campaignSchedule(*c)
+	if err != nil {
+		return err
+	}
+	if s != nil && s.atLocal >= 0 && (s.atLocal < s.winStart || s.atLocal >= s.winEnd) {
+		return fmt.Errorf("send_at_local_time must be inside the sending window")
+	}
+	return nil
+}
+
+// campaignSchedule parses the campaign's timing; nil when it has none.
+func campaignSchedule(c models.Campaign) (*sendSchedule, error) {
+	if c.SendAtLocalTime == "" && c.SendWindowDays == "" && c.SendWindowStart == "" {
+		return nil, nil
+	}
+	s := &sendSchedule{atLocal: -1, winEnd: 24 * 60, fallback: time.UTC}
+	var err error
+	if c.SendAtLocalTime != "" {
+		if s.atLocal, err = parseClock(c.SendAtLocalTime, false); err != nil {
+			return nil, fmt.Errorf("send_at_local_time: %v", err)
+		}
+	}
+	if s.days, _, err = parseWeekdays(c.SendWindowDays); err != nil {
+		return nil, fmt.Errorf("send_window_days: %v", err)
+	}
+	if c.SendWindowStart != "" {
+		if s.winStart, err = parseClock(c.SendWindowStart, false); err != nil {
+			return nil, fmt.Errorf("send_window_start: %v", err)
+		}
+		if s.winEnd, err = parseClock(c.SendWindowEnd, true); err != nil {
+			return nil, fmt.Errorf("send_window_end: %v", err)
+		}
+		if s.winEnd <= s.winStart {
+			return nil, fmt.Errorf("send_window_end must be after send_window_start")
+		}
+	}
+	if c.Timezone != "" {
+		if loc, err := time.LoadLocation(c.Timezone); err == nil {
+			s.fallback = loc
+		}
+	}
+	return s, nil
+}
+
+func atMinute(day time.Time, minute int) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), minute/60, minute%60, 0, 0, day.Location())
+}
+
+// open reports whether the window is open at t.
+func (s *sendSchedule) open(t time.Time, loc *time.Location) bool {
+	t = t.In(loc)
+	minute := t.Hour()*60 + t.Minute()
+	return s.days[t.Weekday()] && minute >= s.winStart && minute < s.winEnd
+}
+
+// next returns the earliest time at or after from when a recipient in loc
+// may be sent to: the next local send time, or the window opening.
+func (s *sendSchedule) next(from time.Time, loc *time.Location) time.Time {
+	local := from.In(loc)
+	for d := 0; d <= 7; d++ {
+		day := local.AddDate(0, 0, d)
+		if !s.days[day.Weekday()] {
+			continue
+		}
+		if s.atLocal >= 0 {
+			if t := atMinute(day, s.atLocal); !t.Before(from) {
+				return t
+			}
+			continue
+		}
+		start, end := atMinute(day, s.winStart), atMinute(day, s.winEnd)
+		if from.Before(end) {
+			if from.After(start) {
+				return from
+			}
+			return start
+		}
+	}
+	return from // no allowed day: validation prevents this
+}
+
+// =======================
+// Recipient timezones
+// =======================
+
+// countryTimezones maps country codes (and ccTLDs) to the timezone most
+// of the country's population lives in.
+var countryTimezones = map[string]string{
+	"ae": "Asia/Dubai", "ar": "America/Argentina/Buenos_Aires", "at": "Europe/Vienna",
+	"au": "Australia/Sydney", "be": "Europe/Brussels", "bd": "Asia/Dhaka", "br": "America/Sao_Paulo",
+	"ca": "America/Toronto", "ch": "Europe/Zurich", "cl": "America/Santiago", "cn": "Asia/Shanghai",
+	"co": "America/Bogota", "cz": "Europe/Prague", "de": "Europe/Berlin", "dk": "Europe/Copenhagen",
+	"eg": "Africa/Cairo", "es": "Europe/Madrid", "fi": "Europe/Helsinki", "fr": "Europe/Paris",
+	"gb": "Europe/London", "uk": "Europe/London", "gr": "Europe/Athens", "hk": "Asia/Hong_Kong",
+	"hu": "Europe/Budapest", "id": "Asia/Jakarta", "ie": "Europe/Dublin", "il": "Asia/Jerusalem",
+	"in": "Asia/Kolkata", "it": "Europe/Rome", "jp": "Asia/Tokyo", "ke": "Africa/Nairobi",
+	"kr": "Asia/Seoul", "mx": "America/Mexico_City", "my": "Asia/Kuala_Lumpur", "ng": "Africa/Lagos",
+	"nl": "Europe/Amsterdam", "no": "Europe/Oslo", "nz": "Pacific/Auckland", "pe": "America/Lima",
+	"ph": "Asia/Manila", "pk": "Asia/Karachi", "pl": "Europe/Warsaw", "pt": "Europe/Lisbon",
+	"ro": "Europe/Bucharest", "ru": "Europe/Moscow", "sa": "Asia/Riyadh", "se": "Europe/Stockholm",
+	"sg": "Asia/Singapore", "th": "Asia/Bangkok", "tr": "Europe/Istanbul", "tw": "Asia/Taipei",
+	"ua": "Europe/Kyiv", "us": "America/New_York", "vn": "Asia/Ho_Chi_Minh", "za": "Africa/Johannesburg",
+}
+
+// RecipientTimezone returns the timezone of a recipient: the contact's
+// imported timezone (or a "timezone" attribute), else one inferred from a
+// "country" attribute or the address's country TLD. "" = unknown.
+func RecipientTimezone(email string, contact *models.Contact) string {
+	valid := func(name string) bool {
+		if name == "" || strings.EqualFold(name, "local") {
+			return false
+		}
+		_, err := time.LoadLocation(name)
+		return err == nil
+	}
+	if contact != nil {
+		if valid(contact.Timezone) {
+			return contact.Timezone
+		}
+		data := RecipientMergeData(email, contact)
+		for _, key := range []string{"timezone", "time_zone", "tz"} {
+			if tz := strings.TrimSpace(data[key]); valid(tz) {
+				return tz
+			}
+		}
+		if tz, ok := countryTimezones[strings.ToLower(strings.TrimSpace(data["country"]))]; ok {
+			return tz
+		}
+	}
+	if i := strings.LastIndex(email, "."); i >= 0 && strings.Contains(email[:i], "@") {
+		tld := strings.ToLower(email[i+1:])
+		if tz, ok := countryTimezones[tld]; ok && tld != "co" { // .co is mostly used generically
+			return tz
+		}
+	}
+	return ""
+}
+
+// =======================
+// Releasing recipients
+// =======================
+
+// scheduleRecipients sets Timezone and NotBefore on pending recipients
+// that don't have them yet.
+func (cs *CampaignService) scheduleRecipients(c *models.Campaign, s *sendSchedule) error {
+	now := time.Now()
+	byZone := map[string][]uint{}
+	var batch []models.CampaignRecipient
+	err := cs.Store.DB.Where("campaign_id = ? AND status = 'pending' AND not_before IS NULL", c.ID).
+		FindInBatches(&batch, 1000, func(tx *gorm.DB, _ int) error {
+			contacts, err := cs.recipientContacts(batch)
+			if err != nil {
+				return err
+			}
+			for _, r := range batch {
+				tz := RecipientTimezone(r.Email, contacts[r.ContactID])
+				byZone[tz] = append(byZone[tz], r.ID)
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	zones := make([]string, 0, len(byZone))
+	for tz := range byZone {
+		zones = append(zones, tz)
+	}
+	sort.Strings(zones)
+	return cs.Store.DB.Transaction(func(tx *gorm.DB) error {
+		for _, tz := range zones {
+			loc := s.fallback
+			if tz != "" {
+				loc, _ = time.LoadLocation(tz)
+			}
+			at := s.next(now, loc)
+			ids := byZone[tz]
+			for start := 0; start < len(ids); start += 500 {
+				end := start + 500
+				if end > len(ids) {
+					end = len(ids)
+				}
+				if err := tx.Model(&models.CampaignRecipient{}).Where("id IN ?", ids[start:end]).
+					Updates(map[string]interface{}{"timezone": tz, "not_before": at}).Error; err != nil {
+					return err
+				}
+			}
+			log.Printf("Campaign %d: %d recipients in %s from %s", c.ID, len(ids), loc, at.Format(time.RFC3339))
+		}
+		return nil
+	})
+}
+
+// holdClosedWindow drops recipients whose window has closed since they
+// were released (a slow send, retries) and moves them to the next opening.
+func (cs *CampaignService) holdClosedWindow(s *sendSchedule, recipients []models.CampaignRecipient) []models.CampaignRecipient {
+	now := time.Now()
+	out := recipients[:0]
+	for _, r := range recipients {
+		loc := s.fallback
+		if r.Timezone != "" {
+			if l, err := time.LoadLocation(r.Timezone); err == nil {
+				loc = l
+			}
+		}
+		if s.open(now, loc) {
+			out = append(out, r)
+			continue
+		}
+		cs.Store.DB.Model(&models.CampaignRecipient{}).Where("id = ?", r.ID).
+			Update("not_before", s.next(now, loc))
+	}
+	return out
+}
+
+// nextRelease is when the next pending recipient (of the A/B test cell
+// while testing) becomes due.
+func (cs *CampaignService) nextRelease(id uint, testCell bool) (time.Time, bool) {
+	q := cs.Store.DB.Where("campaign_id = ? AND status = 'pending' AND not_before IS NOT NULL", id)
+	if testCell {
+		q = q.Where("variant_id <> 0")
+	}
+	var r models.CampaignRecipient
+	if err := q.Order("not_before").Limit(1).Find(&r).Error; err != nil || r.NotBefore == nil {
+		return time.Time{}, false
+	}
+	return *r.NotBefore, true
+}
+
+// waitPollInterval is how often a waiting campaign checks for pause/cancel.
+var waitPollInterval = 5 * time.Second
+
+// sleepUntil waits until t. It returns false if the campaign was paused
+// or cancelled meanwhile.
+func (cs *CampaignService) sleepUntil(id uint, t time.Time) bool {
+	for {
+		if !cs.stillSending(id) {
+			return false
+		}
+		remaining := time.Until(t)
+		if remaining <= 0 {
+			return true
+		}
+		if remaining > waitPollInterval {
+			remaining = waitPollInterval
+		}
+		time.Sleep(remaining)
+	}
+}
+
+// =======================
+// Progress
+// =======================
+
+// CampaignProgress is where a campaign stands and, while recipients are
+// left, an estimate of when it will be done.
+type CampaignProgress struct {
+	Total      int64 `json:"total"`
+	Sent       int64 `json:"sent"` // accepted by the MTA (incl. later delivered/bounced)
+	Failed     int64 `json:"failed"`
+	Suppressed int64 `json:"suppressed"`
+	Pending    int64 `json:"pending"`
+	Due        int64 `json:"due"`     // pending and ready to send now
+	Waiting    int64 `json:"waiting"` // pending until their local time/window
+
+	NextReleaseAt        *time.Time `json:"next_release_at,omitempty"`
+	ExpectedCompletionAt *time.Time `json:"expected_completion_at,omitempty"`
+}
+
+// Progress counts the recipients of a campaign by state. The expected
+// completion assumes the current (or target) sending rate and that each
+// recipient goes out when released.
+func (cs *CampaignService) Progress(id uint) (*CampaignProgress, error) {
+	var c models.Campaign
+	if err := cs.Store.DB.First(&c, id).Error; err != nil {
+		return nil, ErrCampaignNotFound
+	}
+	now := time.Now()
+
+	var rows []struct {
+		Status string
+		N      int64
+	}
+	if err := cs.Store.DB.Model(&models.CampaignRecipient{}).Select("status, COUNT(*) AS n").
+		Where("campaign_id = ?", id).Group("status").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	p := &CampaignProgress{}
+	for _, r := range rows {
+		p.Total += r.N
+		switch r.Status {
+		case "pending":
+			p.Pending = r.N
+		case "failed":
+			p.Failed = r.N
+		case "suppressed":
+			p.Suppressed = r.N
+		default:
+			p.Sent += r.N
+		}
+	}
+
+	// Pending recipients by release time
+	var releases []struct {
+		NotBefore *time.Time
+		N         int64
+	}
+	if err := cs.Store.DB.Model(&models.CampaignRecipient{}).Select("not_before, COUNT(*) AS n").
+		Where("campaign_id = ? AND status = 'pending'", id).Group("not_before").Order("not_before").
+		Scan(&releases).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range releases {
+		if r.NotBefore != nil && r.NotBefore.After(now) {
+			p.Waiting += r.N
+			if p.NextReleaseAt == nil {
+				at := *r.NotBefore
+				p.NextReleaseAt = &at
+			}
+		} else {
+			p.Due += r.N
+		}
+	}
+
+	if p.Pending > 0 && c.Status != CampaignCancelled {
+		_, rate := campaignSettings(c)
+		if live := CampaignLiveStats(id); live != nil && live.SentPerSecond > 0 {
+			rate = live.SentPerSecond
+		}
+		start := now
+		if c.ScheduledAt != nil && c.ScheduledAt.After(now) && c.Status == CampaignScheduled {
+			start = *c.ScheduledAt
+		}
+		t := start
+		for _, r := range releases {
+			if r.NotBefore != nil && r.NotBefore.After(t) {
+				t = *r.NotBefore
+			}
+			t = t.Add(time.Duration(float64(r.N) / rate * float64(time.Second)))
+		}
+		t = t.Truncate(time.Second)
+		p.ExpectedCompletionAt = &t
+	}
+	return p, nil
+}
@@ -0,0 +1,144 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+)
+
+func TestValidateSendSchedule(t *testing.T) {
+	c := models.Campaign{SendWindowDays: "Weekdays", SendWindowStart: "8:00", SendWindowEnd: "18:00", SendAtLocalTime: "09:30", Timezone: "Europe/Berlin"}
+	if err := ValidateSendSchedule(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.SendWindowDays != "mon,tue,wed,thu,fri" {
+		t.Errorf("days = %q", c.SendWindowDays)
+	}
+	if err := ValidateSendSchedule(&models.Campaign{SendWindowDays: "fri-mon"}); err != nil {
+		t.Errorf("wrapping range: %v", err)
+	}
+
+	for _, bad := range []models.Campaign{
+		{SendAtLocalTime: "9am"},
+		{SendAtLocalTime: "24:00"},
+		{SendWindowDays: "mon,funday"},
+		{SendWindowStart: "08:00"},
+		{SendWindowStart: "18:00", SendWindowEnd: "08:00"},
+		{SendWindowStart: "08:00", SendWindowEnd: "12:00", SendAtLocalTime: "13:00"},
+		{Timezone: "Mars/Olympus_Mons"},
+	} {
+		bad := bad
+		if err := ValidateSendSchedule(&bad); err == nil {
+			t.Errorf("%+v accepted", bad)
+		}
+	}
+}
+
+func TestSendScheduleNext(t *testing.T) {
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	newYork, _ := time.LoadLocation("America/New_York")
+	// Saturday 2026-05-02 10:00 UTC (12:00 in Berlin, 06:00 in New York)
+	from := time.Date(2026, 5, 2, 10, 0, 0, 0, time.UTC)
+
+	at9, _ := campaignSchedule(models.Campaign{SendAtLocalTime: "09:00"})
+	if got := at9.next(from, berlin); !got.Equal(time.Date(2026, 5, 3, 9, 0, 0, 0, berlin)) {
+		t.Errorf("Berlin 09:00 = %s", got)
+	}
+	if got := at9.next(from, newYork); !got.Equal(time.Date(2026, 5, 2, 9, 0, 0, 0, newYork)) {
+		t.Errorf("New York 09:00 = %s", got)
+	}
+
+	office, _ := campaignSchedule(models.Campaign{SendWindowDays: "mon-fri", SendWindowStart: "08:00", SendWindowEnd: "18:00"})
+	if got := office.next(from, berlin); !got.Equal(time.Date(2026, 5, 4, 8, 0, 0, 0, berlin)) {
+		t.Errorf("weekend -> %s, want Monday 08:00", got)
+	}
+	tuesday := time.Date(2026, 5, 5, 12, 0, 0, 0, berlin)
+	if got := office.next(tuesday, berlin); !got.Equal(tuesday) || !office.open(tuesday, berlin) {
+		t.Errorf("inside the window -> %s", got)
+	}
+	if office.open(time.Date(2026, 5, 5, 18, 0, 0, 0, berlin), berlin) {
+		t.Error("window open at its end")
+	}
+}
+
+func TestRecipientTimezone(t *testing.T) {
+	for _, tc := range []struct {
+		email   string
+		contact *models.Contact
+		want    string
+	}{
+		{"ann@example.com", &models.Contact{Timezone: "Asia/Tokyo", Attributes: `{"country":"DE"}`}, "Asia/Tokyo"},
+		{"ann@example.com", &models.Contact{Attributes: `{"Country":"de"}`}, "Europe/Berlin"},
+		{"ann@example.com", &models.Contact{Attributes: `{"tz":"America/Chicago"}`}, "America/Chicago"},
+		{"bob@example.co.uk", nil, "Europe/London"},
+		{"bob@startup.co", nil, ""},
+		{"bob@example.com", &models.Contact{Timezone: "Nowhere/Special"}, ""},
+	} {
+		if got := RecipientTimezone(tc.email, tc.contact); got != tc.want {
+			t.Errorf("%s %+v = %q, want %q", tc.email, tc.contact, got, tc.want)
+		}
+	}
+}
+
+func TestCampaignReleasesRecipients(t *testing.T) {
+	defer func(d time.Duration) { waitPollInterval = d }(waitPollInterval)
+	waitPollInterval = 10 * time.Millisecond
+
+	cs := newCampaignTestService(t)
+	mta := startFakeMTA(t)
+	cs.Store.UpsertSettings(&models.AppSettings{SMTPListenAddr: mta.ln.Addr().String()})
+	dom := models.Domain{Name: "example.com"}
+	cs.Store.DB.Create(&dom)
+	snd := models.Sender{DomainID: dom.ID, LocalPart: "news", Email: "news@example.com"}
+	cs.Store.DB.Create(&snd)
+
+	// Always-open window, so only the recipient released later waits
+	c := models.Campaign{Name: "tz", Subject: "Hi", Body: "<p>Hi</p>", SenderID: snd.ID, Status: CampaignDraft, RatePerSecond: 2000,
+		SendWindowStart: "00:00", SendWindowEnd: "24:00"}
+	cs.Store.DB.Create(&c)
+	later := time.Now().Add(400 * time.Millisecond)
+	var recipients []models.CampaignRecipient
+	for i := 0; i < 5; i++ {
+		recipients = append(recipients, models.CampaignRecipient{CampaignID: c.ID, Email: fmt.Sprintf("user%d@example.de", i), Status: "pending"})
+	}
+	recipients = append(recipients, models.CampaignRecipient{CampaignID: c.ID, Email: "late@example.net", Status: "pending", NotBefore: &later})
+	cs.Store.DB.Create(&recipients)
+
+	if err := cs.StartCampaign(c.ID); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	var progress *CampaignProgress
+	for time.Now().Before(deadline) {
+		progress, _ = cs.Progress(c.ID)
+		if progress.Sent == 5 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if progress.Sent != 5 || progress.Waiting != 1 || progress.NextReleaseAt == nil || progress.ExpectedCompletionAt == nil ||
+		progress.ExpectedCompletionAt.Before(later.Truncate(time.Second)) {
+		t.Errorf("while waiting: %+v", progress)
+	}
+
+	for campaignStatus(cs, c.ID) == CampaignSending && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if got := campaignStatus(cs, c.ID); got != CampaignCompleted {
+		t.Fatalf("status = %s", got)
+	}
+	if time.Now().Before(later) {
+		t.Error("finished before the last recipient was released")
+	}
+	var first models.CampaignRecipient
+	cs.Store.DB.First(&first, recipients[0].ID)
+	if first.Timezone != "Europe/Berlin" || first.NotBefore == nil || first.Status != "sent" {
+		t.Errorf("recipient = %+v", first)
+	}
+	progress, _ = cs.Progress(c.ID)
+	if progress.Sent != 6 || progress.Pending != 0 || progress.ExpectedCompletionAt != nil {
+		t.Errorf("done: %+v", progress)
+	}
+}
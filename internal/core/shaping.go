@@ -0,0 +1,62 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+)
+
+// Valid values for KumoMTA's egress path `enable_tls` option.
+var validTLSModes = map[string]bool{
+	"Opportunistic":         true,
+	"OpportunisticInsecure": true,
+	"Required":              true,
+	"RequiredInsecure":      true,
+	"Disabled":              true,
+}
+
+// KumoMTA throttle spec, e.g. "10/min", "500/hr", "2/s"
+var throttleRegex = regexp.MustCompile(`^\d+/(s|sec|second|m|min|minute|h|hr|hour|d|day)$`)
+
+// ValidateThrottle checks a KumoMTA rate string such as "100/hr".
+func ValidateThrottle(rate string) bool {
+	return throttleRegex.MatchString(rate)
+}
+
+func isHostname(host string) bool {
+	return len(host) <= 253 && ehloDomainRegex.MatchString(host)
+}
+
+// ValidateShaping normalizes and checks a shaping rule before it is saved.
+func ValidateShaping(sh *models.TrafficShaping) error {
+	sh.Domain = strings.ToLower(strings.TrimSpace(sh.Domain))
+	sh.MXRollup = strings.ToLower(strings.TrimSpace(sh.MXRollup))
+	sh.ConnectionRate = strings.TrimSpace(sh.ConnectionRate)
+	sh.MessageRate = strings.TrimSpace(sh.MessageRate)
+
+	if sh.Domain == "" {
+		return fmt.Errorf("domain is required")
+	}
+	// Both end up quoted in shaping.toml: only plain hostnames
+	if sh.Domain != "default" && !isHostname(sh.Domain) {
+		return fmt.Errorf("domain must be a hostname such as gmail.com, or \"default\"")
+	}
+	if sh.MXRollup != "" && !isHostname(sh.MXRollup) {
+		return fmt.Errorf("mx_rollup must be a hostname such as google.com")
+	}
+	if sh.MaxConnections < 0 || sh.MaxDeliveriesPerConnection < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	if sh.EnableTLS != "" && !validTLSModes[sh.EnableTLS] {
+		return fmt.Errorf("invalid enable_tls (use: Opportunistic, OpportunisticInsecure, Required, RequiredInsecure, Disabled)")
+	}
+	if sh.ConnectionRate != "" && !ValidateThrottle(sh.ConnectionRate) {
+		return fmt.Errorf("invalid connection_rate (e.g. 10/min)")
+	}
+	if sh.MessageRate != "" && !ValidateThrottle(sh.MessageRate) {
+		return fmt.Errorf("invalid message_rate (e.g. 500/hr)")
+	}
+	return nil
+}
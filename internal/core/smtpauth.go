@@ -0,0 +1,122 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+	"github.com/pulak-ranjan/kumomta-ui/internal/store"
+)
+
+// PanelSMTPAuthURL is where the generated smtp_server_auth_plain hook
+// checks credentials.
+const PanelSMTPAuthURL = localPanelURL + "/api/smtp-auth/verify"
+
+// smtpAuthCacheTTL bounds how long kumod caches a verification result, and
+// so how long an old password keeps working after a rotation.
+const smtpAuthCacheTTL = "60 seconds"
+
+// SMTPAuthToken is the bearer token kumod uses for /api/smtp-auth/verify.
+func SMTPAuthToken() string {
+	return internalToken("kumomta-smtp-auth")
+}
+
+// VerifySMTPAuthToken checks a token presented to the verify endpoint.
+func VerifySMTPAuthToken(token string) bool {
+	return verifyInternalToken("kumomta-smtp-auth", token)
+}
+
+// VerifySMTPCredential checks an SMTP AUTH username (the sender email) and
+// password against the stored hash and records the outcome on the sender.
+func VerifySMTPCredential(st *store.Store, username, password string) (bool, error) {
+	snd, err := st.GetSenderByEmail(username)
+	if errors.Is(err, store.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if snd.SMTPPasswordHash == "" {
+		return false, nil
+	}
+
+	ok := bcrypt.CompareHashAndPassword([]byte(snd.SMTPPasswordHash), []byte(password)) == nil
+	if err := st.RecordSMTPAuth(snd.ID, ok); err != nil {
+		return ok, err
+	}
+	return ok, nil
+}
+
+// RotateSMTPPassword gives the sender a new random password, resets its
+// failure counter and returns the plaintext. It is not retrievable later.
+func RotateSMTPPassword(st *store.Store, snd *models.Sender) (string, error) {
+	password := generateRandomPassword(24)
+	snd.SMTPPassword = password
+	snd.SMTPAuthFailures = 0
+	if err := st.UpdateSender(snd); err != nil {
+		return "", err
+	}
+	return password, nil
+}
+
+// =======================
+// SMTP AUTH Lua
+// =======================
+
+// generateSMTPAuthLua renders the smtp_server_auth_plain hook. auth.toml
+// only lists usernames; passwords are checked by the panel, with results
+// memoized briefly so a busy client doesn't hit the API for every session.
+func generateSMTPAuthLua(snap *Snapshot) string {
+	token := SMTPAuthToken()
+	if token == "" {
+		return `-- =====================================================
+-- SMTP AUTHENTICATION (PLAIN)
+-- =====================================================
+-- Disabled: KUMO_APP_SECRET is not set, so kumod cannot reach the panel
+kumo.on('smtp_server_auth_plain', function(authz, authc, password, conn_meta)
+  return false
+end)
+
+`
+	}
+
+	return fmt.Sprintf(`-- =====================================================
+-- SMTP AUTHENTICATION (PLAIN)
+-- =====================================================
+local verify_smtp_credential = kumo.memoize(function(username, password)
+  local client = kumo.http.build_client {}
+  local request = client:post '%s'
+  request:header('Content-Type', 'application/json')
+  request:header('Authorization', 'Bearer %s')
+  request:body(kumo.serde.json_encode { username = username, password = password })
+  local response = request:send()
+  local status = response:status_code()
+  client:close()
+  if status == 200 then
+    return true
+  elseif status == 401 then
+    return false
+  end
+  -- Errors are not memoized, so the next attempt asks the panel again
+  error(string.format('panel smtp auth returned %%d', status))
+end, {
+  name = 'panel_smtp_auth',
+  ttl = '%s',
+  capacity = 1024,
+})
+
+kumo.on('smtp_server_auth_plain', function(authz, authc, password, conn_meta)
+  -- Acting as another identity is not supported
+  if authz ~= '' and authz ~= authc then
+    return false
+  end
+  if not auth_users[authc] then
+    return false
+  end
+  return verify_smtp_credential(authc, password)
+end)
+
+`, panelURL(snap, PanelSMTPAuthURL), token, smtpAuthCacheTTL)
+}
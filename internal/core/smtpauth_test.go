@@ -0,0 +1,110 @@
+package core
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+	"github.com/pulak-ranjan/kumomta-ui/internal/store"
+)
+
+func TestSMTPCredentials(t *testing.T) {
+	st, err := store.NewStore(filepath.Join(t.TempDir(), "panel.db"))
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	dom := models.Domain{Name: "example.com"}
+	st.DB.Create(&dom)
+	snd := models.Sender{DomainID: dom.ID, LocalPart: "news", Email: "news@example.com", SMTPPassword: "s3cret"}
+	if err := st.CreateSender(&snd); err != nil {
+		t.Fatalf("create sender: %v", err)
+	}
+	if snd.SMTPPassword != "" || !strings.HasPrefix(snd.SMTPPasswordHash, "$2") {
+		t.Fatalf("password was not hashed: %+v", snd)
+	}
+
+	domains, _ := st.ListDomains()
+	if len(domains) != 1 || len(domains[0].Senders) != 1 || !domains[0].Senders[0].HasSMTPPassword {
+		t.Fatalf("preloaded sender should report has_smtp_password: %+v", domains)
+	}
+	toml := GenerateAuthTOML(&Snapshot{Domains: domains})
+	if !strings.Contains(toml, "\"news@example.com\" = true") || strings.Contains(toml, "s3cret") {
+		t.Errorf("auth.toml = %s", toml)
+	}
+
+	if ok, _ := VerifySMTPCredential(st, "news@example.com", "wrong"); ok {
+		t.Error("wrong password accepted")
+	}
+	if ok, _ := VerifySMTPCredential(st, "nobody@example.com", "s3cret"); ok {
+		t.Error("unknown user accepted")
+	}
+	got, _ := st.GetSenderByID(snd.ID)
+	if got.SMTPAuthFailures != 1 || got.SMTPLastFailure == nil {
+		t.Errorf("failures = %d, last = %v", got.SMTPAuthFailures, got.SMTPLastFailure)
+	}
+	if ok, _ := VerifySMTPCredential(st, "News@Example.com", "s3cret"); !ok {
+		t.Error("valid password rejected")
+	}
+	got, _ = st.GetSenderByID(snd.ID)
+	if got.SMTPAuthFailures != 0 || got.SMTPLastAuth == nil {
+		t.Errorf("success should reset failures: %d, last auth %v", got.SMTPAuthFailures, got.SMTPLastAuth)
+	}
+
+	password, err := RotateSMTPPassword(st, got)
+	if err != nil || len(password) != 24 {
+		t.Fatalf("rotate: %q %v", password, err)
+	}
+	if ok, _ := VerifySMTPCredential(st, "news@example.com", "s3cret"); ok {
+		t.Error("old password still accepted after rotation")
+	}
+	if ok, _ := VerifySMTPCredential(st, "news@example.com", password); !ok {
+		t.Error("rotated password rejected")
+	}
+}
+
+func TestLegacySMTPPasswordsAreHashed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "panel.db")
+	st, err := store.NewStore(path)
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	// Simulate a database written before passwords were hashed
+	st.DB.Exec("ALTER TABLE senders ADD COLUMN smtp_password text")
+	st.DB.Exec("INSERT INTO senders (domain_id, local_part, email, smtp_password) VALUES (1, 'old', 'old@example.com', 'plain')")
+
+	st, err = store.NewStore(path)
+	if err != nil {
+		t.Fatalf("reopen store: %v", err)
+	}
+	var left int64
+	st.DB.Raw("SELECT COUNT(*) FROM senders WHERE smtp_password <> ''").Scan(&left)
+	if left != 0 {
+		t.Errorf("%d plaintext passwords left", left)
+	}
+	if ok, _ := VerifySMTPCredential(st, "old@example.com", "plain"); !ok {
+		t.Error("migrated password rejected")
+	}
+}
+
+func TestGenerateInitLuaSMTPAuth(t *testing.T) {
+	t.Setenv("KUMO_APP_SECRET", "")
+	if lua := GenerateInitLua(&Snapshot{}); strings.Contains(lua, PanelSMTPAuthURL) {
+		t.Error("auth hook should not call the panel without KUMO_APP_SECRET")
+	}
+
+	t.Setenv("KUMO_APP_SECRET", "test-secret-that-is-at-least-32-characters")
+	lua := GenerateInitLua(&Snapshot{})
+	for _, want := range []string{
+		"kumo.on('smtp_server_auth_plain', function(authz, authc, password, conn_meta)",
+		"request:header('Authorization', 'Bearer " + SMTPAuthToken() + "')",
+		"name = 'panel_smtp_auth',",
+	} {
+		if !strings.Contains(lua, want) {
+			t.Errorf("expected %q in init.lua", want)
+		}
+	}
+	if SMTPAuthToken() == IngestToken() || !VerifySMTPAuthToken(SMTPAuthToken()) {
+		t.Error("smtp auth token must be distinct and verifiable")
+	}
+}
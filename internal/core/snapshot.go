@@ -1,6 +1,8 @@
 package core
 
 import (
+	"time"
+
 	"github.com/pulak-ranjan/kumomta-ui/internal/models"
 	"github.com/pulak-ranjan/kumomta-ui/internal/store"
 )
@@ -8,11 +10,25 @@ import (
 // Snapshot represents a consistent view of configuration
 // used to generate KumoMTA/Dovecot/firewall configs.
 type Snapshot struct {
-	Settings *models.AppSettings
-	Domains  []models.Domain
+	Settings  *models.AppSettings
+	Domains   []models.Domain
+	Shaping   []models.TrafficShaping
+	Pools     []models.EgressPool
+	Listeners []models.Listener
+
+	CampaignPolicies []models.CampaignQueuePolicy
+	RoutingRules     []models.RoutingRule
+	Snippets         []models.PolicySnippet
+	Suppressions     []models.Suppression // active (unexpired) only
+
+	// Node the config is generated for (0 = the panel's own host), set by ForNode
+	NodeID uint
 }
 
-// LoadSnapshot collects app settings + all domains (+ senders).
+// LoadSnapshot collects app settings + all domains (+ senders),
+// the per-destination traffic shaping rules, the egress pools, the
+// SMTP listeners, the per-campaign queue overrides, the routing rules and
+// the custom.lua policy snippets and the active suppressions.
 func LoadSnapshot(st *store.Store) (*Snapshot, error) {
 	settings, err := st.GetSettings()
 	if err != nil && err != store.ErrNotFound {
@@ -25,8 +41,110 @@ func LoadSnapshot(st *store.Store) (*Snapshot, error) {
 		return nil, err
 	}
 
+	shaping, err := st.ListTrafficShaping()
+	if err != nil {
+		return nil, err
+	}
+
+	pools, err := st.ListEgressPools()
+	if err != nil {
+		return nil, err
+	}
+
+	listeners, err := st.ListListeners()
+	if err != nil {
+		return nil, err
+	}
+
+	campaignPolicies, err := st.ListCampaignQueuePolicies()
+	if err != nil {
+		return nil, err
+	}
+
+	routingRules, err := st.ListRoutingRules()
+	if err != nil {
+		return nil, err
+	}
+
+	snippets, err := st.ListPolicySnippets()
+	if err != nil {
+		return nil, err
+	}
+
+	suppressions, err := st.ListActiveSuppressions(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
 	return &Snapshot{
-		Settings: settings,
-		Domains:  domains,
+		Settings:         settings,
+		Domains:          domains,
+		Shaping:          shaping,
+		Pools:            pools,
+		Listeners:        listeners,
+		CampaignPolicies: campaignPolicies,
+		RoutingRules:     routingRules,
+		Snippets:         snippets,
+		Suppressions:     suppressions,
 	}, nil
 }
+
+// PoolByID returns the egress pool with the given ID, or nil.
+func (snap *Snapshot) PoolByID(id uint) *models.EgressPool {
+	if id == 0 {
+		return nil
+	}
+	for i := range snap.Pools {
+		if snap.Pools[i].ID == id {
+			return &snap.Pools[i]
+		}
+	}
+	return nil
+}
+
+// SenderNodeID is the node a sender is assigned to: its own override,
+// otherwise its domain's node.
+func SenderNodeID(d models.Domain, s models.Sender) uint {
+	if s.NodeID != 0 {
+		return s.NodeID
+	}
+	return d.NodeID
+}
+
+// ForNode narrows the snapshot to what one node sends: its senders (with
+// their domains) and the egress pools they use. Pools nobody uses stay on
+// the panel's own host. Everything else (shaping, listeners, routing,
+// snippets, suppressions) is shared by every node.
+func (snap *Snapshot) ForNode(nodeID uint) *Snapshot {
+	out := *snap
+	out.NodeID = nodeID
+	out.Domains = nil
+
+	poolNodes := map[uint]map[uint]bool{}
+	for _, d := range snap.Domains {
+		var senders []models.Sender
+		for _, s := range d.Senders {
+			n := SenderNodeID(d, s)
+			if poolNodes[s.EgressPoolID] == nil {
+				poolNodes[s.EgressPoolID] = map[uint]bool{}
+			}
+			poolNodes[s.EgressPoolID][n] = true
+			if n == nodeID {
+				senders = append(senders, s)
+			}
+		}
+		if d.NodeID != nodeID && len(senders) == 0 {
+			continue
+		}
+		d.Senders = senders
+		out.Domains = append(out.Domains, d)
+	}
+
+	out.Pools = nil
+	for _, p := range snap.Pools {
+		if poolNodes[p.ID][nodeID] || (nodeID == 0 && len(poolNodes[p.ID]) == 0) {
+			out.Pools = append(out.Pools, p)
+		}
+	}
+	return &out
+}
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+	"github.com/pulak-ranjan/kumomta-ui/internal/store"
+)
+
+// First line of every generated custom.lua. A custom.lua without it was
+// written by hand and gets adopted as a snippet on startup.
+const customLuaHeader = "-- Managed by KumoMTA UI (policy snippets). Edits here are overwritten on apply."
+
+// LegacySnippetName is the snippet a hand-written custom.lua is imported as.
+const LegacySnippetName = "legacy-custom-lua"
+
+var snippetNameRegex = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// ValidatePolicySnippet normalizes and checks a snippet before it is saved.
+// Whether the Lua actually loads is checked by the validator on apply.
+func ValidatePolicySnippet(snip *models.PolicySnippet) error {
+	snip.Name = strings.TrimSpace(snip.Name)
+	snip.Description = strings.TrimSpace(snip.Description)
+
+	if !snippetNameRegex.MatchString(snip.Name) {
+		return fmt.Errorf("name must only contain letters, digits, '.', '_' or '-'")
+	}
+	if strings.TrimSpace(snip.Content) == "" {
+		return fmt.Errorf("content is required")
+	}
+	if strings.ContainsRune(snip.Content, 0) {
+		return fmt.Errorf("content must be text")
+	}
+	return nil
+}
+
+// =======================
+// custom.lua generator
+// =======================
+
+// GenerateCustomLua concatenates the enabled snippets in order. Each one
+// runs in its own do ... end block so its locals don't leak into the next.
+func GenerateCustomLua(snap *Snapshot) string {
+	var b strings.Builder
+	b.WriteString(customLuaHeader + "\n")
+	for _, snip := range snap.Snippets {
+		if !snip.Enabled {
+			continue
+		}
+		fmt.Fprintf(&b, "\n-- snippet: %s\n", snip.Name)
+		b.WriteString("do\n")
+		b.WriteString(strings.TrimRight(snip.Content, "\n"))
+		b.WriteString("\nend\n")
+	}
+	return b.String()
+}
+
+// AdoptLegacyCustomLua imports a hand-written custom.lua as a snippet so the
+// first apply doesn't replace it. It only runs while no snippets exist.
+func AdoptLegacyCustomLua(st *store.Store) error {
+	count, err := st.CountPolicySnippets()
+	if err != nil || count > 0 {
+		return err
+	}
+
+	data, err := os.ReadFile(KumoCustomLuaPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	content := string(data)
+	if strings.HasPrefix(content, customLuaHeader) || strings.TrimSpace(content) == "" {
+		return nil
+	}
+
+	return st.CreatePolicySnippet(&models.PolicySnippet{
+		Name:        LegacySnippetName,
+		Description: "Imported from the hand-written custom.lua",
+		Enabled:     true,
+		Content:     content,
+	})
+}
@@ -0,0 +1,189 @@
+package core
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+	"github.com/pulak-ranjan/kumomta-ui/internal/store"
+)
+
+// Suppression types and reasons.
+const (
+	SuppressAddress = "address"
+	SuppressDomain  = "domain"
+
+	ReasonHardBounce  = "hard_bounce"
+	ReasonComplaint   = "complaint"
+	ReasonUnsubscribe = "unsubscribe"
+	ReasonManual      = "manual"
+)
+
+var (
+	suppressAddressRegex = regexp.MustCompile(`^[a-z0-9.!#$%&'*+/=?^_{|}~-]+@[a-z0-9-]+(\.[a-z0-9-]+)+$`)
+	suppressDomainRegex  = regexp.MustCompile(`^[a-z0-9-]+(\.[a-z0-9-]+)+$`)
+	suppressionReasons   = map[string]bool{ReasonHardBounce: true, ReasonComplaint: true, ReasonUnsubscribe: true, ReasonManual: true}
+)
+
+// ValidateSuppression normalizes and checks a suppression before it is saved.
+// The type is derived from the value ("@" = address, otherwise domain).
+func ValidateSuppression(sup *models.Suppression) error {
+	sup.Value = strings.ToLower(strings.TrimSpace(sup.Value))
+	sup.Reason = strings.ToLower(strings.TrimSpace(sup.Reason))
+	sup.Source = strings.TrimSpace(sup.Source)
+
+	if strings.Contains(sup.Value, "@") {
+		sup.Type = SuppressAddress
+		if !suppressAddressRegex.MatchString(sup.Value) {
+			return fmt.Errorf("invalid email address: %s", sup.Value)
+		}
+	} else {
+		sup.Type = SuppressDomain
+		if !suppressDomainRegex.MatchString(sup.Value) {
+			return fmt.Errorf("invalid domain: %s", sup.Value)
+		}
+	}
+
+	if sup.Reason == "" {
+		sup.Reason = ReasonManual
+	}
+	if !suppressionReasons[sup.Reason] {
+		return fmt.Errorf("reason must be one of hard_bounce, complaint, unsubscribe, manual")
+	}
+	if sup.Source == "" {
+		sup.Source = "manual"
+	}
+	if sup.ExpiresAt != nil && !sup.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("expires_at must be in the future")
+	}
+	return nil
+}
+
+// SuppressionImportResult is the outcome of a bulk import.
+type SuppressionImportResult struct {
+	Imported int      `json:"imported"`
+	Errors   []string `json:"errors"`
+}
+
+// ImportSuppressionsCSV reads "value,reason,expires_at" rows (header
+// optional, only the first column is required). expires_at is RFC 3339
+// or YYYY-MM-DD. Existing values are updated in place.
+func ImportSuppressionsCSV(st *store.Store, r io.Reader, source string) (*SuppressionImportResult, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	res := &SuppressionImportResult{Errors: []string{}}
+	line := 0
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return res, fmt.Errorf("line %d: %w", line, err)
+		}
+		if len(record) == 0 {
+			continue
+		}
+
+		value := strings.TrimSpace(strings.TrimPrefix(record[0], "\ufeff"))
+		if line == 1 && isSuppressionHeader(value) {
+			continue
+		}
+		if value == "" {
+			continue
+		}
+
+		sup := models.Suppression{Value: value, Source: source}
+		if len(record) > 1 {
+			sup.Reason = record[1]
+		}
+		if len(record) > 2 && strings.TrimSpace(record[2]) != "" {
+			exp, err := parseExpiry(strings.TrimSpace(record[2]))
+			if err != nil {
+				res.Errors = append(res.Errors, fmt.Sprintf("line %d: %v", line, err))
+				continue
+			}
+			sup.ExpiresAt = &exp
+		}
+
+		if err := ValidateSuppression(&sup); err != nil {
+			res.Errors = append(res.Errors, fmt.Sprintf("line %d: %v", line, err))
+			continue
+		}
+		if err := st.UpsertSuppression(&sup); err != nil {
+			res.Errors = append(res.Errors, fmt.Sprintf("line %d: failed to save %s", line, sup.Value))
+			continue
+		}
+		res.Imported++
+	}
+	return res, nil
+}
+
+func isSuppressionHeader(cell string) bool {
+	switch strings.ToLower(cell) {
+	case "value", "email", "address", "domain":
+		return true
+	}
+	return false
+}
+
+func parseExpiry(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid expires_at %q (use RFC 3339 or YYYY-MM-DD)", v)
+}
+
+// ExportSuppressionsCSV writes suppressions in the format ImportSuppressionsCSV reads.
+func ExportSuppressionsCSV(w io.Writer, list []models.Suppression) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"value", "reason", "expires_at", "type", "source", "created_at"})
+	for _, sup := range list {
+		expires := ""
+		if sup.ExpiresAt != nil {
+			expires = sup.ExpiresAt.UTC().Format(time.RFC3339)
+		}
+		cw.Write([]string{sup.Value, sup.Reason, expires, sup.Type, sup.Source, sup.CreatedAt.UTC().Format(time.RFC3339)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// =======================
+// suppression.toml generator
+// =======================
+
+// GenerateSuppressionTOML renders active suppressions as value = expiry
+// (unix seconds, 0 = never), so entries lapse in Lua without a re-apply.
+func GenerateSuppressionTOML(snap *Snapshot) string {
+	var addresses, domains strings.Builder
+	for _, sup := range snap.Suppressions {
+		var expires int64
+		if sup.ExpiresAt != nil {
+			expires = sup.ExpiresAt.Unix()
+		}
+		line := fmt.Sprintf("\"%s\" = %d\n", sup.Value, expires)
+		if sup.Type == SuppressDomain {
+			domains.WriteString(line)
+		} else {
+			addresses.WriteString(line)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("[addresses]\n")
+	b.WriteString(addresses.String())
+	b.WriteString("\n[domains]\n")
+	b.WriteString(domains.String())
+	return b.String()
+}
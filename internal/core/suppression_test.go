@@ -0,0 +1,72 @@
+package core
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+	"github.com/pulak-ranjan/kumomta-ui/internal/store"
+)
+
+func TestGenerateSuppressionTOML(t *testing.T) {
+	exp := time.Unix(1900000000, 0)
+	snap := &Snapshot{Suppressions: []models.Suppression{
+		{Value: "bounced@example.com", Type: SuppressAddress},
+		{Value: "blocked.example", Type: SuppressDomain, ExpiresAt: &exp},
+	}}
+
+	want := "[addresses]\n\"bounced@example.com\" = 0\n\n[domains]\n\"blocked.example\" = 1900000000\n"
+	if got := GenerateSuppressionTOML(snap); got != want {
+		t.Errorf("suppression.toml =\n%s\nwant\n%s", got, want)
+	}
+
+	lua := GenerateInitLua(snap)
+	for _, want := range []string{
+		"local suppression_data = kumo.toml_load('/opt/kumomta/etc/policy/suppression.toml')",
+		"kumo.on('smtp_server_rcpt_to', function(recipient, conn_meta)\n  if is_suppressed(recipient) then\n    kumo.reject(550, '5.7.1 Recipient address is suppressed')",
+		"msg:set_meta('queue', 'null')",
+	} {
+		if !strings.Contains(lua, want) {
+			t.Errorf("expected %q in init.lua", want)
+		}
+	}
+}
+
+func TestImportAndMatchSuppressions(t *testing.T) {
+	st, err := store.NewStore(filepath.Join(t.TempDir(), "panel.db"))
+	if err != nil {
+		t.Fatalf("store: %v", err)
+	}
+
+	csv := "value,reason,expires_at\n" +
+		"Bounced@Example.com,hard_bounce,\n" +
+		"blocked.example,manual,2999-01-01\n" +
+		"not an address,manual,\n" +
+		"old@example.com,complaint,2000-01-01\n"
+	res, err := ImportSuppressionsCSV(st, strings.NewReader(csv), "import")
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if res.Imported != 2 || len(res.Errors) != 2 {
+		t.Errorf("import result = %+v", res)
+	}
+
+	// Re-importing updates instead of duplicating
+	if _, err := ImportSuppressionsCSV(st, strings.NewReader("bounced@example.com,complaint\n"), "import"); err != nil {
+		t.Fatalf("re-import: %v", err)
+	}
+	list, _ := st.ListSuppressions("")
+	if len(list) != 2 {
+		t.Errorf("expected 2 suppressions, got %d", len(list))
+	}
+
+	got, err := st.SuppressedRecipients([]string{"bounced@example.com", "anyone@blocked.example", "ok@example.com"}, time.Now())
+	if err != nil {
+		t.Fatalf("lookup: %v", err)
+	}
+	if got["bounced@example.com"] != ReasonComplaint || got["anyone@blocked.example"] != ReasonManual || len(got) != 2 {
+		t.Errorf("suppressed = %v", got)
+	}
+}
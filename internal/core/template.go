@@ -0,0 +1,487 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+)
+
+// Personalization templates for campaign subjects and bodies:
+//
+//	Hi {{first_name | default: 'there'}},
+//	{{#if company}}How is everyone at {{company}}?{{else}}Hello!{{/if}}
+//	{{#unless opened}}...{{/unless}}, {{#if plan == 'pro'}}...{{/if}}
+//	Sent {{now | date: '%B %-d, %Y'}}
+//
+// Fields are case-insensitive; unknown fields render empty, so a default
+// filter always has something to fall back from.
+
+// MergeData holds the merge field values for one recipient.
+type MergeData map[string]string
+
+// TemplateError is a syntax error in a template.
+type TemplateError struct {
+	Line int
+	Msg  string
+}
+
+func (e *TemplateError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Template is a parsed personalization template. It is safe for
+// concurrent use.
+type Template struct {
+	nodes  []tmplNode
+	fields []string
+}
+
+type tmplNode interface{}
+
+type textNode string
+
+type fieldNode struct {
+	field   string
+	filters []tmplFilter
+}
+
+type tmplFilter struct {
+	name string
+	arg  string
+}
+
+type ifNode struct {
+	field  string
+	op     string // "", "==" or "!="
+	value  string
+	negate bool // {{#unless}}
+	then   []tmplNode
+	orElse []tmplNode
+}
+
+var (
+	tmplFieldRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+	tmplCondRe  = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_.]*)\s*(?:(==|!=)\s*('[^']*'|"[^"]*"))?$`)
+)
+
+// Filters and whether they take an argument.
+var tmplFilters = map[string]bool{
+	"default":    true,
+	"date":       true,
+	"upper":      false,
+	"lower":      false,
+	"capitalize": false,
+	"trim":       false,
+}
+
+// ParseTemplate parses src, returning a *TemplateError on bad syntax.
+func ParseTemplate(src string) (*Template, error) {
+	p := &tmplParser{src: src, line: 1, seen: map[string]bool{}}
+	nodes, closer, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	if closer != "" {
+		return nil, p.errorf("unexpected {{%s}}", closer)
+	}
+	fields := make([]string, 0, len(p.seen))
+	for f := range p.seen {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return &Template{nodes: nodes, fields: fields}, nil
+}
+
+// ValidateTemplate checks the syntax of a subject or body.
+func ValidateTemplate(src string) error {
+	_, err := ParseTemplate(src)
+	return err
+}
+
+// Fields lists the merge fields the template refers to.
+func (t *Template) Fields() []string {
+	return t.fields
+}
+
+// Render fills in the template. With escapeHTML, field values (not the
+// template text) are HTML-escaped, as they must be in an HTML body.
+func (t *Template) Render(data MergeData, escapeHTML bool) string {
+	var b strings.Builder
+	renderNodes(&b, t.nodes, data, escapeHTML)
+	return b.String()
+}
+
+// RenderTemplate parses and renders src in one go.
+func RenderTemplate(src string, data MergeData, escapeHTML bool) (string, error) {
+	t, err := ParseTemplate(src)
+	if err != nil {
+		return "", err
+	}
+	return t.Render(data, escapeHTML), nil
+}
+
+// =======================
+// Merge data
+// =======================
+
+// RecipientMergeData returns the merge fields for a recipient: email,
+// first_name, last_name, full_name and created_at from the contact (if
+// any), its custom attributes, and now.
+func RecipientMergeData(email string, contact *models.Contact) MergeData {
+	data := MergeData{
+		"email": email,
+		"now":   time.Now().UTC().Format(time.RFC3339),
+	}
+	if contact == nil {
+		return data
+	}
+
+	// Custom attributes first, so the built-in fields can't be shadowed
+	if contact.Attributes != "" {
+		var attrs map[string]interface{}
+		if json.Unmarshal([]byte(contact.Attributes), &attrs) == nil {
+			for k, v := range attrs {
+				switch val := v.(type) {
+				case string:
+					data[strings.ToLower(k)] = val
+				case nil:
+				default:
+					data[strings.ToLower(k)] = fmt.Sprint(val)
+				}
+			}
+		}
+	}
+
+	if contact.Email != "" {
+		data["email"] = contact.Email
+	}
+	data["first_name"] = contact.FirstName
+	data["last_name"] = contact.LastName
+	data["full_name"] = strings.TrimSpace(contact.FirstName + " " + contact.LastName)
+	if !contact.CreatedAt.IsZero() {
+		data["created_at"] = contact.CreatedAt.UTC().Format(time.RFC3339)
+	}
+	return data
+}
+
+// =======================
+// Parser
+// =======================
+
+type tmplParser struct {
+	src  string
+	pos  int
+	line int
+	seen map[string]bool
+}
+
+func (p *tmplParser) errorf(format string, args ...interface{}) error {
+	return &TemplateError{Line: p.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// parse reads nodes up to the end of input or a block tag ("else", "/if",
+// "/unless"), which is returned as closer.
+func (p *tmplParser) parse() ([]tmplNode, string, error) {
+	var nodes []tmplNode
+	for p.pos < len(p.src) {
+		open := strings.Index(p.src[p.pos:], "{{")
+		if open < 0 {
+			nodes = append(nodes, textNode(p.src[p.pos:]))
+			p.line += strings.Count(p.src[p.pos:], "\n")
+			p.pos = len(p.src)
+			break
+		}
+		if open > 0 {
+			text := p.src[p.pos : p.pos+open]
+			nodes = append(nodes, textNode(text))
+			p.line += strings.Count(text, "\n")
+			p.pos += open
+		}
+
+		end := strings.Index(p.src[p.pos:], "}}")
+		if end < 0 {
+			return nil, "", p.errorf("unclosed {{")
+		}
+		tag := strings.TrimSpace(p.src[p.pos+2 : p.pos+end])
+		tagLine := p.line
+		p.line += strings.Count(p.src[p.pos:p.pos+end], "\n")
+		p.pos += end + 2
+
+		switch {
+		case tag == "":
+			return nil, "", p.errorf("empty {{}}")
+		case strings.HasPrefix(tag, "!"):
+			// comment
+		case tag == "else", tag == "/if", tag == "/unless":
+			return nodes, tag, nil
+		case strings.HasPrefix(tag, "#if ") || strings.HasPrefix(tag, "#unless "):
+			node, err := p.parseBlock(tag, tagLine)
+			if err != nil {
+				return nil, "", err
+			}
+			nodes = append(nodes, node)
+		case strings.HasPrefix(tag, "#"), strings.HasPrefix(tag, "/"):
+			return nil, "", p.errorf("unknown block {{%s}}", tag)
+		default:
+			node, err := p.parseField(tag)
+			if err != nil {
+				return nil, "", err
+			}
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, "", nil
+}
+
+func (p *tmplParser) parseBlock(tag string, line int) (tmplNode, error) {
+	kind, cond, _ := strings.Cut(tag[1:], " ")
+	m := tmplCondRe.FindStringSubmatch(strings.TrimSpace(cond))
+	if m == nil {
+		return nil, &TemplateError{Line: line, Msg: fmt.Sprintf("bad condition in {{%s}}", tag)}
+	}
+	node := &ifNode{field: strings.ToLower(m[1]), op: m[2], negate: kind == "unless"}
+	if m[3] != "" {
+		node.value = m[3][1 : len(m[3])-1]
+	}
+	p.seen[node.field] = true
+
+	then, closer, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	node.then = then
+	if closer == "else" {
+		orElse, closer2, err := p.parse()
+		if err != nil {
+			return nil, err
+		}
+		node.orElse = orElse
+		closer = closer2
+	}
+	if closer == "" {
+		return nil, &TemplateError{Line: line, Msg: fmt.Sprintf("{{#%s}} is never closed", kind)}
+	}
+	if closer != "/"+kind {
+		return nil, p.errorf("{{%s}} closes {{#%s}} opened on line %d", closer, kind, line)
+	}
+	return node, nil
+}
+
+func (p *tmplParser) parseField(tag string) (tmplNode, error) {
+	parts := splitFilters(tag)
+	field := strings.TrimSpace(parts[0])
+	if !tmplFieldRe.MatchString(field) {
+		return nil, p.errorf("bad field name %q", field)
+	}
+	node := &fieldNode{field: strings.ToLower(field)}
+	p.seen[node.field] = true
+
+	for _, part := range parts[1:] {
+		name, arg, hasArg := strings.Cut(strings.TrimSpace(part), ":")
+		name = strings.TrimSpace(name)
+		takesArg, ok := tmplFilters[name]
+		if !ok {
+			return nil, p.errorf("unknown filter %q", name)
+		}
+
+		f := tmplFilter{name: name}
+		if hasArg {
+			if !takesArg {
+				return nil, p.errorf("filter %q takes no argument", name)
+			}
+			arg = strings.TrimSpace(arg)
+			if len(arg) < 2 || (arg[0] != '\'' && arg[0] != '"') || arg[len(arg)-1] != arg[0] {
+				return nil, p.errorf("argument of %q must be quoted", name)
+			}
+			f.arg = arg[1 : len(arg)-1]
+		} else if name == "default" {
+			return nil, p.errorf("default needs a value, e.g. default: 'there'")
+		}
+		if name == "date" {
+			if f.arg == "" {
+				f.arg = "%Y-%m-%d"
+			}
+			if err := checkDateFormat(f.arg); err != nil {
+				return nil, p.errorf("%v", err)
+			}
+		}
+		node.filters = append(node.filters, f)
+	}
+	return node, nil
+}
+
+// splitFilters splits on | outside quotes.
+func splitFilters(tag string) []string {
+	var parts []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(tag); i++ {
+		switch c := tag[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '|':
+			parts = append(parts, tag[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, tag[start:])
+}
+
+// =======================
+// Rendering
+// =======================
+
+func renderNodes(b *strings.Builder, nodes []tmplNode, data MergeData, escapeHTML bool) {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case textNode:
+			b.WriteString(string(n))
+		case *fieldNode:
+			v := data[n.field]
+			for _, f := range n.filters {
+				v = applyFilter(f, v)
+			}
+			if escapeHTML {
+				v = html.EscapeString(v)
+			}
+			b.WriteString(v)
+		case *ifNode:
+			if n.eval(data) {
+				renderNodes(b, n.then, data, escapeHTML)
+			} else {
+				renderNodes(b, n.orElse, data, escapeHTML)
+			}
+		}
+	}
+}
+
+func (n *ifNode) eval(data MergeData) bool {
+	v := strings.TrimSpace(data[n.field])
+	var ok bool
+	switch n.op {
+	case "==":
+		ok = strings.EqualFold(v, n.value)
+	case "!=":
+		ok = !strings.EqualFold(v, n.value)
+	default:
+		ok = v != "" && v != "0" && !strings.EqualFold(v, "false")
+	}
+	return ok != n.negate
+}
+
+func applyFilter(f tmplFilter, v string) string {
+	switch f.name {
+	case "default":
+		if strings.TrimSpace(v) == "" {
+			return f.arg
+		}
+	case "upper":
+		return strings.ToUpper(v)
+	case "lower":
+		return strings.ToLower(v)
+	case "capitalize":
+		if r, size := utf8.DecodeRuneInString(v); r != utf8.RuneError {
+			return string(unicode.ToUpper(r)) + v[size:]
+		}
+	case "trim":
+		return strings.TrimSpace(v)
+	case "date":
+		if t, ok := parseMergeDate(v); ok {
+			return formatDate(t, f.arg)
+		}
+	}
+	return v
+}
+
+var mergeDateLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02"}
+
+func parseMergeDate(v string) (time.Time, bool) {
+	v = strings.TrimSpace(v)
+	for _, layout := range mergeDateLayouts {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t, true
+		}
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil && v != "" {
+		return time.Unix(secs, 0).UTC(), true
+	}
+	return time.Time{}, false
+}
+
+// strftime-style directives for the date filter.
+var dateDirectives = map[byte]func(t time.Time) string{
+	'Y': func(t time.Time) string { return strconv.Itoa(t.Year()) },
+	'y': func(t time.Time) string { return fmt.Sprintf("%02d", t.Year()%100) },
+	'm': func(t time.Time) string { return fmt.Sprintf("%02d", int(t.Month())) },
+	'd': func(t time.Time) string { return fmt.Sprintf("%02d", t.Day()) },
+	'e': func(t time.Time) string { return fmt.Sprintf("%2d", t.Day()) },
+	'B': func(t time.Time) string { return t.Month().String() },
+	'b': func(t time.Time) string { return t.Month().String()[:3] },
+	'A': func(t time.Time) string { return t.Weekday().String() },
+	'a': func(t time.Time) string { return t.Weekday().String()[:3] },
+	'H': func(t time.Time) string { return fmt.Sprintf("%02d", t.Hour()) },
+	'I': func(t time.Time) string { return fmt.Sprintf("%02d", (t.Hour()+11)%12+1) },
+	'M': func(t time.Time) string { return fmt.Sprintf("%02d", t.Minute()) },
+	'S': func(t time.Time) string { return fmt.Sprintf("%02d", t.Second()) },
+	'p': func(t time.Time) string { return t.Format("PM") },
+	'Z': func(t time.Time) string { return t.Format("MST") },
+	'%': func(t time.Time) string { return "%" },
+}
+
+func checkDateFormat(format string) error {
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		if i < len(format) && format[i] == '-' {
+			i++
+		}
+		if i >= len(format) {
+			return fmt.Errorf("date format %q ends with %%", format)
+		}
+		if _, ok := dateDirectives[format[i]]; !ok {
+			return fmt.Errorf("unknown date directive %%%c", format[i])
+		}
+	}
+	return nil
+}
+
+// formatDate applies a format checked by checkDateFormat. %-d, %-m etc.
+// drop the leading zero.
+func formatDate(t time.Time, format string) string {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			b.WriteByte(format[i])
+			continue
+		}
+		i++
+		noPad := format[i] == '-'
+		if noPad {
+			i++
+		}
+		s := dateDirectives[format[i]](t)
+		if noPad {
+			s = strings.TrimLeft(s, "0 ")
+			if s == "" {
+				s = "0"
+			}
+		}
+		b.WriteString(s)
+	}
+	return b.String()
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	contact := &models.Contact{
+		Email:      "ann@example.com",
+		FirstName:  "Ann",
+		Attributes: `{"Company": "Acme & Co", "plan": "pro", "renews": "2026-03-05", "seats": 12, "nickname": "élodie"}`,
+		CreatedAt:  time.Date(2025, 7, 4, 10, 0, 0, 0, time.UTC),
+	}
+	data := RecipientMergeData("ann@example.com", contact)
+	anon := RecipientMergeData("bob@example.com", nil)
+
+	cases := []struct {
+		src  string
+		data MergeData
+		html bool
+		want string
+	}{
+		{"Hi {{first_name | default: 'there'}}", data, false, "Hi Ann"},
+		{"Hi {{ first_name | default: 'there' }}", anon, false, "Hi there"},
+		{"{{FIRST_NAME | upper}} {{last_name | default: \"x|y\"}}", data, false, "ANN x|y"},
+		{"{{plan | capitalize}} {{nickname | capitalize}}", data, false, "Pro Élodie"},
+		{"{{#if company}}At {{company}}{{else}}Hello{{/if}}", data, true, "At Acme &amp; Co"},
+		{"{{#if company}}At {{company}}{{else}}Hello{{/if}}", anon, true, "Hello"},
+		{"{{#unless plan == 'PRO'}}Upgrade{{/unless}}{{#if plan != 'free'}}Thanks{{/if}}", data, false, "Thanks"},
+		{"{{#if seats}}{{seats}} seats{{/if}}", data, false, "12 seats"},
+		{"Renews {{renews | date: '%A, %B %-d %Y'}}", data, false, "Renews Thursday, March 5 2026"},
+		{"Since {{created_at | date: '%d/%m/%y %I%p'}}", data, false, "Since 04/07/25 10AM"},
+		{"{{missing | date: '%Y' | default: 'never'}}{{! note }}", data, false, "never"},
+		{"{{email}}", anon, false, "bob@example.com"},
+		{"no tags, 100% plain", data, false, "no tags, 100% plain"},
+	}
+	for _, tc := range cases {
+		got, err := RenderTemplate(tc.src, tc.data, tc.html)
+		if err != nil {
+			t.Errorf("%q: %v", tc.src, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%q = %q, want %q", tc.src, got, tc.want)
+		}
+	}
+}
+
+func TestParseTemplateErrors(t *testing.T) {
+	cases := map[string]string{
+		"Hi {{first_name":           "unclosed",
+		"{{#if a}}\nx\n":            "line 1: {{#if}} is never closed",
+		"{{#if a}}x{{/unless}}":     "closes {{#if}}",
+		"x{{/if}}":                  "unexpected {{/if}}",
+		"{{name | shout}}":          "unknown filter",
+		"{{name | default}}":        "default needs a value",
+		"{{name | upper: 'x'}}":     "takes no argument",
+		"{{name | default: there}}": "must be quoted",
+		"{{when | date: '%Q'}}":     "unknown date directive",
+		"{{first name}}":            "bad field name",
+		"{{#if a = 'b'}}{{/if}}":    "bad condition",
+		"{{#each items}}{{/each}}":  "unknown block",
+		"ok\n\n{{}}":                "line 3: empty",
+	}
+	for src, want := range cases {
+		err := ValidateTemplate(src)
+		var tmplErr *TemplateError
+		if !errors.As(err, &tmplErr) || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: got %v, want %q", src, err, want)
+		}
+	}
+
+	tmpl, err := ParseTemplate("{{#if Company}}{{company}}{{/if}} {{first_name}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(tmpl.Fields(), ","); got != "company,first_name" {
+		t.Errorf("fields = %s", got)
+	}
+}
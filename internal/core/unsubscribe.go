@@ -0,0 +1,213 @@
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+	"github.com/pulak-ranjan/kumomta-ui/internal/store"
+)
+
+// One-click unsubscribe (RFC 8058). Every campaign message carries
+//
+//	List-Unsubscribe: <https://panel/api/unsubscribe/TOKEN>, <mailto:bounce@domain?subject=unsubscribe-TOKEN>
+//	List-Unsubscribe-Post: List-Unsubscribe=One-Click
+//
+// where TOKEN is the recipient id and an HMAC of it, so links can't be
+// guessed for other recipients.
+
+// ErrInvalidUnsubscribeToken is returned for forged or malformed tokens.
+var ErrInvalidUnsubscribeToken = errors.New("invalid unsubscribe link")
+
+func unsubscribeMAC(recipientID uint) string {
+	key, err := GetEncryptionKey()
+	if err != nil {
+		return ""
+	}
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "unsubscribe:%d", recipientID)
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// UnsubscribeToken returns the signed token for a campaign recipient.
+func UnsubscribeToken(recipientID uint) string {
+	return fmt.Sprintf("%d.%s", recipientID, unsubscribeMAC(recipientID))
+}
+
+// ParseUnsubscribeToken verifies a token and returns the recipient id.
+func ParseUnsubscribeToken(token string) (uint, error) {
+	idStr, sig, ok := strings.Cut(strings.TrimSpace(token), ".")
+	if !ok {
+		return 0, ErrInvalidUnsubscribeToken
+	}
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil || id == 0 {
+		return 0, ErrInvalidUnsubscribeToken
+	}
+	expected := unsubscribeMAC(uint(id))
+	if expected == "" || !hmac.Equal([]byte(expected), []byte(strings.ToLower(sig))) {
+		return 0, ErrInvalidUnsubscribeToken
+	}
+	return uint(id), nil
+}
+
+// UnsubscribeURL is the hosted unsubscribe page of a recipient.
+func UnsubscribeURL(baseURL string, recipientID uint) string {
+	return strings.TrimRight(baseURL, "/") + "/api/unsubscribe/" + UnsubscribeToken(recipientID)
+}
+
+// ListUnsubscribeHeaders returns the List-Unsubscribe headers for a
+// campaign message. The mailto goes to the sender's bounce mailbox, which
+// ProcessUnsubscribeMailboxes reads.
+func ListUnsubscribeHeaders(baseURL string, sender models.Sender, recipientID uint) map[string]string {
+	value := "<" + UnsubscribeURL(baseURL, recipientID) + ">"
+	if sender.BounceUsername != "" {
+		if domain := messageIDDomain(sender.Email); domain != "localhost" {
+			value += fmt.Sprintf(", <mailto:%s@%s?subject=unsubscribe-%s>", sender.BounceUsername, domain, UnsubscribeToken(recipientID))
+		}
+	}
+	return map[string]string{
+		"List-Unsubscribe":      value,
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+}
+
+// Unsubscribe records an unsubscribe for a campaign recipient: the
+// recipient and matching contacts are marked, the campaign counter goes
+// up and the address is suppressed. Repeated calls are no-ops.
+func Unsubscribe(st *store.Store, recipientID uint, via string) (*models.CampaignRecipient, error) {
+	var recip models.CampaignRecipient
+	if err := st.DB.First(&recip, recipientID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidUnsubscribeToken
+		}
+		return nil, err
+	}
+	if recip.UnsubscribedAt != nil {
+		return &recip, nil
+	}
+
+	now := time.Now()
+	email := strings.ToLower(strings.TrimSpace(recip.Email))
+	raced := false
+	err := st.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.CampaignRecipient{}).
+			Where("id = ? AND unsubscribed_at IS NULL", recip.ID).
+			Update("unsubscribed_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			raced = true // a concurrent request got there first
+			return nil
+		}
+		if err := tx.Model(&models.Campaign{}).Where("id = ?", recip.CampaignID).
+			Update("total_unsubscribes", gorm.Expr("total_unsubscribes + 1")).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Contact{}).
+			Where("(id = ? OR LOWER(email) = ?) AND unsubscribed_at IS NULL", recip.ContactID, email).
+			Update("unsubscribed_at", now).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	recip.UnsubscribedAt = &now
+	if raced {
+		return &recip, nil
+	}
+
+	sup := models.Suppression{
+		Value:  email,
+		Reason: ReasonUnsubscribe,
+		Source: fmt.Sprintf("campaign:%d", recip.CampaignID),
+	}
+	if err := ValidateSuppression(&sup); err == nil {
+		if err := st.UpsertSuppression(&sup); err != nil {
+			log.Printf("Unsubscribe: failed to suppress %s: %v", email, err)
+		}
+	}
+	log.Printf("Unsubscribe: %s from campaign %d (%s)", email, recip.CampaignID, via)
+
+	triggerForContact(st, NewAutomationService(st), TriggerUnsubscribed, email)
+	return &recip, nil
+}
+
+// =======================
+// mailto: requests
+// =======================
+
+var unsubscribeSubjectRe = regexp.MustCompile(`(?i)unsubscribe-([0-9]+\.[0-9a-f]+)`)
+
+// ProcessUnsubscribeMailboxes handles mailto: unsubscribes that arrived in
+// the senders' bounce mailboxes. Handled messages are marked read (moved
+// to cur/); everything else is left for whoever reads the mailbox.
+func ProcessUnsubscribeMailboxes(st *store.Store) {
+	var users []string
+	if err := st.DB.Model(&models.Sender{}).Where("bounce_username <> ''").
+		Distinct().Pluck("bounce_username", &users).Error; err != nil {
+		return
+	}
+	for _, user := range users {
+		processUnsubscribeMaildir(st, filepath.Join(MaildirBase, user, "Maildir"))
+	}
+}
+
+func processUnsubscribeMaildir(st *store.Store, maildir string) int {
+	entries, err := os.ReadDir(filepath.Join(maildir, "new"))
+	if err != nil {
+		return 0
+	}
+	handled := 0
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		path := filepath.Join(maildir, "new", e.Name())
+		token := unsubscribeTokenFromFile(path)
+		if token == "" {
+			continue
+		}
+		id, err := ParseUnsubscribeToken(token)
+		if err != nil {
+			continue
+		}
+		if _, err := Unsubscribe(st, id, "mailto"); err != nil {
+			log.Printf("Unsubscribe: %s: %v", path, err)
+			continue
+		}
+		os.Rename(path, filepath.Join(maildir, "cur", e.Name()+":2,S"))
+		handled++
+	}
+	return handled
+}
+
+func unsubscribeTokenFromFile(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	m, err := mail.ReadMessage(io.LimitReader(f, 64<<10))
+	if err != nil {
+		return ""
+	}
+	if match := unsubscribeSubjectRe.FindStringSubmatch(m.Header.Get("Subject")); match != nil {
+		return match[1]
+	}
+	return ""
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pulak-ranjan/kumomta-ui/internal/models"
+)
+
+func TestUnsubscribeToken(t *testing.T) {
+	t.Setenv("KUMO_APP_SECRET", "test-secret-that-is-at-least-32-characters")
+
+	token := UnsubscribeToken(42)
+	if id, err := ParseUnsubscribeToken(token); err != nil || id != 42 {
+		t.Fatalf("round trip: %d, %v", id, err)
+	}
+	_, sig, _ := strings.Cut(token, ".")
+	for _, bad := range []string{"43." + sig, "42", "42.00", "x." + sig, ""} {
+		if _, err := ParseUnsubscribeToken(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+
+	h := ListUnsubscribeHeaders("https://panel.example.com/", models.Sender{Email: "news@example.com", BounceUsername: "b-news"}, 42)
+	want := "<https://panel.example.com/api/unsubscribe/" + token + ">, <mailto:b-news@example.com?subject=unsubscribe-" + token + ">"
+	if h["List-Unsubscribe"] != want || h["List-Unsubscribe-Post"] != "List-Unsubscribe=One-Click" {
+		t.Errorf("headers = %v", h)
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	t.Setenv("KUMO_APP_SECRET", "test-secret-that-is-at-least-32-characters")
+	cs := newCampaignTestService(t)
+	st := cs.Store
+
+	c := models.Campaign{Name: "news", Status: CampaignCompleted}
+	st.DB.Create(&c)
+	contact := models.Contact{Email: "Ann@Example.com"}
+	st.DB.Create(&contact)
+	recip := models.CampaignRecipient{CampaignID: c.ID, Email: "Ann@Example.com", ContactID: contact.ID, Status: "delivered"}
+	st.DB.Create(&recip)
+
+	for i := 0; i < 2; i++ {
+		if _, err := Unsubscribe(st, recip.ID, "one-click"); err != nil {
+			t.Fatalf("unsubscribe: %v", err)
+		}
+	}
+
+	st.DB.First(&recip, recip.ID)
+	st.DB.First(&contact, contact.ID)
+	st.DB.First(&c, c.ID)
+	if recip.UnsubscribedAt == nil || recip.Status != "delivered" || contact.UnsubscribedAt == nil {
+		t.Errorf("recipient = %+v, contact = %+v", recip, contact)
+	}
+	if c.TotalUnsubscribes != 1 {
+		t.Errorf("total_unsubscribes = %d, want 1", c.TotalUnsubscribes)
+	}
+	suppressed, _ := st.SuppressedRecipients([]string{"ann@example.com"}, time.Now())
+	if suppressed["ann@example.com"] != ReasonUnsubscribe {
+		t.Errorf("suppressed = %v", suppressed)
+	}
+
+	if _, err := Unsubscribe(st, 9999, "page"); err != ErrInvalidUnsubscribeToken {
+		t.Errorf("unknown recipient: %v", err)
+	}
+}
+
+func TestProcessUnsubscribeMaildir(t *testing.T) {
+	t.Setenv("KUMO_APP_SECRET", "test-secret-that-is-at-least-32-characters")
+	cs := newCampaignTestService(t)
+
+	recip := models.CampaignRecipient{CampaignID: 1, Email: "bob@example.net", Status: "sent"}
+	cs.Store.DB.Create(&recip)
+
+	maildir := t.TempDir()
+	os.MkdirAll(filepath.Join(maildir, "new"), 0o700)
+	os.MkdirAll(filepath.Join(maildir, "cur"), 0o700)
+	write := func(name, subject string) {
+		msg := "From: bob@example.net\r\nSubject: " + subject + "\r\n\r\nplease\r\n"
+		os.WriteFile(filepath.Join(maildir, "new", name), []byte(msg), 0o600)
+	}
+	write("1.unsub", "unsubscribe-"+UnsubscribeToken(recip.ID))
+	write("2.forged", "unsubscribe-"+UnsubscribeToken(recip.ID+1)[:2]+"00")
+	write("3.bounce", "Undelivered Mail Returned to Sender")
+
+	if n := processUnsubscribeMaildir(cs.Store, maildir); n != 1 {
+		t.Fatalf("handled %d messages, want 1", n)
+	}
+	if _, err := os.Stat(filepath.Join(maildir, "cur", "1.unsub:2,S")); err != nil {
+		t.Error("handled message not moved to cur/")
+	}
+	left, _ := os.ReadDir(filepath.Join(maildir, "new"))
+	if len(left) != 2 {
+		t.Errorf("%d messages left in new/, want 2", len(left))
+	}
+	cs.Store.DB.First(&recip, recip.ID)
+	if recip.UnsubscribedAt == nil {
+		t.Error("recipient not unsubscribed")
+	}
+}
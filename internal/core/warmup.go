@@ -83,7 +83,7 @@ func ProcessDailyWarmup(st *store.Store) error {
 		log.Println("[Warmup] Applying new rate limits to KumoMTA...")
 		snap, err := LoadSnapshot(st)
 		if err == nil {
-			if _, err := ApplyKumoConfig(snap); err != nil {
+			if _, _, err := ApplyAndRecord(st, snap, "warmup"); err != nil {
 				return fmt.Errorf("failed to apply warmup config: %v", err)
 			}
 		}
@@ -96,7 +96,7 @@ func ProcessDailyWarmup(st *store.Store) error {
 // This is called by configgen.go
 func GetSenderRate(s models.Sender) string {
 	if !s.WarmupEnabled {
-		return "" // Empty means no limit
+		return s.MessageRate // Empty means no limit
 	}
 	
 	planName := s.WarmupPlan
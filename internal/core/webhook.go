@@ -135,10 +135,13 @@ func (ws *WebhookService) CheckBlacklists(forceReport bool) error {
 		return err
 	}
 
-	rbls := []string{
-		"zen.spamhaus.org",
-		"b.barracudacentral.org",
-		"bl.spamcop.net",
+	rbls := []struct {
+		Zone string
+		IPv6 bool // zone also lists IPv6 addresses
+	}{
+		{"zen.spamhaus.org", true},
+		{"b.barracudacentral.org", false},
+		{"bl.spamcop.net", false},
 	}
 
 	var issues []string
@@ -146,16 +149,19 @@ func (ws *WebhookService) CheckBlacklists(forceReport bool) error {
 
 	for _, ipObj := range ips {
 		ip := ipObj.Value
-		parts := strings.Split(ip, ".")
-		if len(parts) != 4 {
+		reversedIP, err := ReverseIPName(ip)
+		if err != nil {
 			continue
 		}
-		reversedIP := fmt.Sprintf("%s.%s.%s.%s", parts[3], parts[2], parts[1], parts[0])
+		v6 := IsIPv6(ip)
 
 		for _, rbl := range rbls {
-			lookup := fmt.Sprintf("%s.%s", reversedIP, rbl)
+			if v6 && !rbl.IPv6 {
+				continue
+			}
+			lookup := fmt.Sprintf("%s.%s", reversedIP, rbl.Zone)
 			if result, err := net.LookupHost(lookup); err == nil && len(result) > 0 {
-				issues = append(issues, fmt.Sprintf("❌ IP **%s** listed on **%s**", ip, rbl))
+				issues = append(issues, fmt.Sprintf("❌ IP **%s** listed on **%s**", ip, rbl.Zone))
 			}
 		}
 		checkedCount++
@@ -205,6 +211,23 @@ func (ws *WebhookService) RunSecurityAudit() error {
 		risks = append(risks, "AI API Key missing (Log Analysis disabled)")
 	}
 
+	// EHLO / reverse DNS alignment of sending IPs
+	if report, err := RunAlignmentCheck(ws.Store); err == nil {
+		const maxListed = 10
+		listed := 0
+		for _, sa := range report.Senders {
+			for _, issue := range sa.Issues {
+				if listed < maxListed {
+					risks = append(risks, fmt.Sprintf("%s (%s): %s", sa.Email, sa.Source, issue))
+				}
+				listed++
+			}
+		}
+		if listed > maxListed {
+			risks = append(risks, fmt.Sprintf("...and %d more EHLO/PTR alignment issues", listed-maxListed))
+		}
+	}
+
 	if len(risks) > 0 {
 		return ws.sendAlert("🔐 Security Alert", "Security issues detected", risks, 15105570) // Orange
 	}
@@ -76,6 +76,23 @@ func (rl *RateLimiter) Limit(next http.Handler) http.Handler {
 	})
 }
 
+// LimitExcept is Limit for every path except the given ones (e.g. machine
+// endpoints that are authenticated separately and legitimately chatty).
+func (rl *RateLimiter) LimitExcept(paths ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		limited := rl.Limit(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, p := range paths {
+				if r.URL.Path == p {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			limited.ServeHTTP(w, r)
+		})
+	}
+}
+
 // Specific limiters for different endpoints
 var (
 	AuthLimiter    = NewRateLimiter(rate.Every(time.Second), 5)      // 5 req/sec
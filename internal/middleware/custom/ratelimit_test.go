@@ -58,3 +58,32 @@ func TestRateLimiter(t *testing.T) {
 		t.Errorf("expected 200 for different IP, got %d", rr5.Code)
 	}
 }
+
+func TestRateLimiterExcept(t *testing.T) {
+	limiter := NewRateLimiter(rate.Every(time.Second), 1)
+	handler := limiter.LimitExcept("/api/events/ingest")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest("POST", "/api/events/ingest", nil)
+		req.RemoteAddr = "127.0.0.1:12345"
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Errorf("exempt path request %d: expected 200, got %d", i+1, rr.Code)
+		}
+	}
+
+	codes := []int{}
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", "/api/domains", nil)
+		req.RemoteAddr = "127.0.0.1:12345"
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		codes = append(codes, rr.Code)
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Errorf("expected [200 429] for limited path, got %v", codes)
+	}
+}
@@ -1,14 +1,22 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 // Represents global application settings.
 type AppSettings struct {
 	ID uint `gorm:"primaryKey" json:"id"`
 
-	MainHostname string `json:"main_hostname"`
-	MainServerIP string `json:"main_server_ip"`
-	MailWizzIP   string `json:"mailwizz_ip"` // optional relay IP
+	MainHostname   string `json:"main_hostname"`
+	MainServerIP   string `json:"main_server_ip"`
+	MainServerIPv6 string `json:"main_server_ipv6"` // optional, published as AAAA
+	MailWizzIP     string `json:"mailwizz_ip"`      // optional relay IP
+
+	// Base URL remote nodes use to reach the panel API (log events, SMTP AUTH)
+	PanelURL string `json:"panel_url"`
 
 	// NEW: Listener Binding (e.g., "127.0.0.1:25" or "0.0.0.0:25")
 	SMTPListenAddr string `json:"smtp_listen_addr"`
@@ -47,9 +55,36 @@ type Domain struct {
 	DMARCRuf        string `json:"dmarc_ruf"`        // Forensic report email
 	DMARCPercentage int    `json:"dmarc_percentage"` // 0-100
 
+	// Queue defaults for every sender of this domain
+	QueuePolicy QueuePolicy `gorm:"embedded;embeddedPrefix:queue_" json:"queue_policy"`
+
+	// MTA node that sends for this domain (0 = the panel's own host)
+	NodeID uint `gorm:"index" json:"node_id"`
+
 	Senders []Sender `gorm:"constraint:OnDelete:CASCADE" json:"senders"`
 }
 
+// QueuePolicy holds KumoMTA queue tunables rendered into queues.toml.
+// Empty fields inherit: campaign -> sender -> domain -> built-in defaults.
+type QueuePolicy struct {
+	RetryInterval    string `json:"retry_interval"`     // first retry delay, e.g. "1m"
+	MaxRetryInterval string `json:"max_retry_interval"` // cap for the exponential backoff, e.g. "2h"
+	MaxAge           string `json:"max_age"`            // give up (bounce) after, e.g. "3d"
+}
+
+// CampaignQueuePolicy overrides the queue policy for messages carrying a
+// given X-Campaign value, for one sender or every sender of a domain.
+type CampaignQueuePolicy struct {
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	DomainID uint   `gorm:"index" json:"domain_id"`
+	SenderID uint   `gorm:"index" json:"sender_id"` // 0 = all senders of the domain
+	Campaign string `json:"campaign"`               // X-Campaign header value
+
+	QueuePolicy QueuePolicy `gorm:"embedded;embeddedPrefix:queue_" json:"queue_policy"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
 // AdminUser represents a panel admin account
 type AdminUser struct {
 	ID           uint   `gorm:"primaryKey" json:"id"`
@@ -92,8 +127,35 @@ type Sender struct {
 
 	LocalPart    string `json:"local_part"`
 	Email        string `json:"email"`
-	IP           string `json:"ip"` // specific IP for this sender
-	SMTPPassword string `json:"smtp_password,omitempty"`
+	DisplayName  string `json:"display_name"` // From display name, e.g. "Acme Support"
+	IP           string `json:"ip"`          // specific IP for this sender
+	EHLODomain   string `json:"ehlo_domain"` // empty = "localpart.domain"
+
+	// SMTP AUTH. smtp_password is write-only: the store replaces it with a
+	// bcrypt hash on save, so it is never persisted or returned.
+	SMTPPassword     string     `gorm:"-" json:"smtp_password,omitempty"`
+	SMTPPasswordHash string     `json:"-"`
+	HasSMTPPassword  bool       `gorm:"-" json:"has_smtp_password"`
+	SMTPAuthFailures int        `json:"smtp_auth_failures"`
+	SMTPLastFailure  *time.Time `json:"smtp_last_failure"`
+	SMTPLastAuth     *time.Time `json:"smtp_last_auth"`
+
+	// Optional shared multi-IP pool (0 = use the single IP above)
+	EgressPoolID uint `gorm:"index" json:"egress_pool_id"`
+
+	// MTA node override (0 = the domain's node)
+	NodeID uint `gorm:"index" json:"node_id"`
+
+	// Per-sender queue overrides (empty fields inherit from the domain)
+	QueuePolicy QueuePolicy `gorm:"embedded;embeddedPrefix:queue_" json:"queue_policy"`
+
+	// Fixed max_message_rate (e.g. "500/hr") used while warmup is off
+	MessageRate string `json:"message_rate"`
+
+	// DKIM identity; empty = selector is the local part and the key lives
+	// at <dkim dir>/<domain>/<localpart>.key (as generated by the panel)
+	DKIMSelector string `json:"dkim_selector"`
+	DKIMKeyPath  string `json:"dkim_key_path"`
 	
 	BounceUsername string `json:"bounce_username"`
 
@@ -107,18 +169,191 @@ type Sender struct {
 	HasDKIM bool `gorm:"-" json:"has_dkim"` 
 }
 
+// AfterFind fills in HasSMTPPassword for every loaded sender (preloads too).
+func (s *Sender) AfterFind(tx *gorm.DB) error {
+	s.HasSMTPPassword = s.SMTPPasswordHash != ""
+	return nil
+}
+
 // Inventory of IPs available on the server
 type SystemIP struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
-	Value     string    `gorm:"uniqueIndex" json:"value"` // IPv4 address
+	Value     string    `gorm:"uniqueIndex" json:"value"` // IPv4 or IPv6 address (canonical form)
 	Netmask   string    `json:"netmask"`                  // e.g. /24
 	Interface string    `json:"interface"`                // e.g. eth0 (optional)
+	Hostname  string    `json:"hostname"`                 // PTR name, used as EHLO inside egress pools
 	CreatedAt time.Time `json:"created_at"`
 
 	// Virtual Field: True if this IP is actually configured on the OS
 	IsActive  bool      `gorm:"-" json:"is_active"` 
 }
 
+// EgressPool groups several SystemIPs with weights so one sender
+// can spread its traffic across many source addresses.
+type EgressPool struct {
+	ID         uint               `gorm:"primaryKey" json:"id"`
+	Name       string             `gorm:"uniqueIndex" json:"name"`
+	EHLODomain string             `json:"ehlo_domain"` // fallback EHLO when a member IP has no hostname
+	Members    []EgressPoolMember `gorm:"foreignKey:PoolID" json:"members"`
+	CreatedAt  time.Time          `json:"created_at"`
+}
+
+// EgressPoolMember is one weighted IP inside an EgressPool
+type EgressPoolMember struct {
+	ID         uint     `gorm:"primaryKey" json:"id"`
+	PoolID     uint     `gorm:"index" json:"pool_id"`
+	SystemIPID uint     `gorm:"index" json:"system_ip_id"`
+	SystemIP   SystemIP `gorm:"foreignKey:SystemIPID" json:"system_ip"`
+	Weight     int      `json:"weight"` // relative share of traffic (default 1)
+}
+
+// RoutingRule sends matching traffic through a dedicated pool and/or a
+// smarthost. Rules are evaluated in Position order; the first match wins.
+type RoutingRule struct {
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	Position int    `gorm:"index" json:"position"`
+	Name     string `json:"name"`
+	Enabled  bool   `json:"enabled"`
+
+	TenantPattern    string `json:"tenant_pattern"`    // e.g. "example.com__*"; empty = any tenant
+	RecipientDomains string `json:"recipient_domains"` // comma separated, e.g. "outlook.com,hotmail.com,*.internal"
+
+	EgressPoolID uint   `json:"egress_pool_id"` // 0 = keep the tenant's own pool
+	Smarthost    string `json:"smarthost"`      // e.g. "relay.corp:25"; empty = normal MX delivery
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PolicySnippet is a named Lua fragment appended to the generated custom.lua.
+// Enabled snippets are concatenated in Position order.
+type PolicySnippet struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	Position    int    `gorm:"index" json:"position"`
+	Name        string `gorm:"uniqueIndex" json:"name"`
+	Description string `json:"description"`
+	Enabled     bool   `json:"enabled"`
+	Content     string `json:"content"` // raw Lua
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Node is a remote KumoMTA host driven through its agent
+// ("kumomta-ui agent"). Domains and senders are assigned to nodes and
+// each node gets its own generated config.
+type Node struct {
+	ID      uint   `gorm:"primaryKey" json:"id"`
+	Name    string `gorm:"uniqueIndex" json:"name"`
+	URL     string `json:"url"` // agent base URL, e.g. https://mta2.example.com:9100
+	Secret  string `json:"-"`   // shared signing key, encrypted with KUMO_APP_SECRET
+	Enabled bool   `json:"enabled"`
+
+	LastSeenAt     *time.Time `json:"last_seen_at"`
+	LastError      string     `json:"last_error"`
+	LastReport     string     `json:"-"` // JSON of the last agent report
+	LastApplyAt    *time.Time `json:"last_apply_at"`
+	LastApplyError string     `json:"last_apply_error"`
+	AppliedHash    string     `json:"applied_hash"` // hash of the last config pushed successfully
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Suppression blocks mail to an address or a whole recipient domain.
+// It is enforced inside KumoMTA (suppression.toml) and by campaigns.
+type Suppression struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	Value     string     `gorm:"uniqueIndex" json:"value"` // lowercased address or domain
+	Type      string     `json:"type"`                     // "address" or "domain"
+	Reason    string     `json:"reason"`                   // "hard_bounce", "complaint", "unsubscribe", "manual"
+	Source    string     `json:"source"`                   // where it came from, e.g. "manual", "import", "campaign:12"
+	ExpiresAt *time.Time `json:"expires_at"`               // nil = permanent
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// DeliveryEvent is one KumoMTA log record (Reception, Delivery, Bounce,
+// TransientFailure, Feedback) pushed to the panel by the generated log hook.
+type DeliveryEvent struct {
+	ID           uint   `gorm:"primaryKey" json:"id"`
+	MessageID    string `gorm:"index" json:"message_id"`
+	Type         string `gorm:"index" json:"type"`
+	Tenant       string `gorm:"index" json:"tenant"`
+	Campaign     string `gorm:"index" json:"campaign"` // X-Campaign value
+	Sender       string `json:"sender"`
+	Recipient    string `gorm:"index" json:"recipient"`
+	Queue        string `json:"queue"`
+	Site         string `json:"site"`
+	EgressPool   string `json:"egress_pool"`
+	EgressSource string `json:"egress_source"`
+	PeerAddress  string `json:"peer_address"`
+
+	ResponseCode int    `json:"response_code"`
+	ResponseText string `json:"response_text"`
+	BounceClass  string `json:"bounce_class"`
+	NumAttempts  int    `json:"num_attempts"`
+
+	EventTime time.Time `gorm:"index" json:"event_time"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TrafficShaping holds per-destination delivery limits rendered into shaping.toml.
+// Domain is the recipient domain (e.g. "gmail.com") or "default" for the fallback.
+type TrafficShaping struct {
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	Domain   string `gorm:"uniqueIndex" json:"domain"`
+	MXRollup string `json:"mx_rollup"` // optional: match MX site name, e.g. "google.com"
+
+	MaxConnections             int    `json:"max_connections"`               // connection_limit
+	MaxDeliveriesPerConnection int    `json:"max_deliveries_per_connection"` // messages per connection
+	EnableTLS                  string `json:"enable_tls"`                    // Opportunistic, OpportunisticInsecure, Required, RequiredInsecure, Disabled
+	ConnectionRate             string `json:"connection_rate"`               // e.g. "10/min"
+	MessageRate                string `json:"message_rate"`                  // e.g. "500/hr" (optional)
+
+	Notes     string    `json:"notes"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Listener is one SMTP listener rendered into init.lua.
+// With no rows configured, the legacy 25/587/465 set is generated.
+type Listener struct {
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	ListenAddr string `gorm:"uniqueIndex" json:"listen_addr"` // e.g. "0.0.0.0:587"
+	Hostname   string `json:"hostname"`                       // defaults to MainHostname
+	Banner     string `json:"banner"`                         // defaults to "220 <hostname>"
+
+	TLSCertificate string `json:"tls_certificate"` // PEM path
+	TLSPrivateKey  string `json:"tls_private_key"` // PEM path
+	ImplicitTLS    bool   `json:"implicit_tls"`    // TLS from the first byte (SMTPS/465)
+
+	RequireAuth    bool   `json:"require_auth"`     // reject MAIL FROM before AUTH
+	RelayHosts     string `json:"relay_hosts"`      // comma separated IPs/CIDRs; empty = default relay list
+	MaxMessageSize int64  `json:"max_message_size"` // bytes, 0 = KumoMTA default
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ConfigRevision records one applied (or rolled back) generation of the
+// Kumo policy files, so any earlier good config can be restored.
+type ConfigRevision struct {
+	ID           uint   `gorm:"primaryKey" json:"id"`
+	AppliedBy    string `json:"applied_by"`
+	Action       string `json:"action"`                   // "apply" or "rollback"
+	RollbackOfID uint   `json:"rollback_of_id,omitempty"` // revision restored by a rollback
+
+	FilesJSON string `gorm:"type:text" json:"-"`    // []core.KumoConfigFile as JSON
+	Diff      string `gorm:"type:text" json:"diff"` // unified diff vs. what was on disk
+
+	ValidationOK  bool   `json:"validation_ok"`
+	ValidationLog string `gorm:"type:text" json:"validation_log"`
+	RestartOK     bool   `json:"restart_ok"`
+	Error         string `json:"error,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
 // EmailStats stores aggregated sending statistics
 type EmailStats struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
@@ -189,6 +424,8 @@ type Contact struct {
 	Email     string    `gorm:"index" json:"email"`
 	FirstName string    `json:"first_name"`
 	LastName  string    `json:"last_name"`
+	Attributes string   `gorm:"type:text" json:"attributes"` // JSON object of custom merge fields, e.g. {"company":"Acme"}
+	Timezone  string    `json:"timezone"` // IANA name, e.g. "Europe/Berlin"; "" = inferred at send time
 
 	// Validation Status
 	IsValid   bool      `json:"is_valid"`
@@ -199,8 +436,25 @@ type Contact struct {
 	Score     int       `json:"score"`      // Lead Score
 	TotalOpens int      `json:"total_opens"`
 	TotalClicks int     `json:"total_clicks"`
+	LastOpenedAt *time.Time `json:"last_opened_at"`
+	UnsubscribedAt *time.Time `json:"unsubscribed_at"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Segment is a saved contact query. A contact matches when it meets every
+// condition that is set.
+type Segment struct {
+	ID   uint   `gorm:"primaryKey" json:"id"`
+	Name string `json:"name"`
+
+	ValidOnly        bool   `json:"valid_only"`                          // verified as valid by list cleaning
+	MinScore         *int   `json:"min_score"`                           // lead score above this; nil = any
+	OpenedWithinDays int    `json:"opened_within_days"`                  // opened a campaign in the last N days; 0 = any
+	AttributeFilters string `gorm:"type:text" json:"attribute_filters"` // JSON array of core.SegmentFilter
 
 	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 // Campaign represents a bulk email job
@@ -212,32 +466,97 @@ type Campaign struct {
 	SenderID    uint      `json:"sender_id"`     // From which Sender identity
 	Sender      Sender    `json:"-" gorm:"foreignKey:SenderID"`
 
-	Status      string    `json:"status"`        // "draft", "scheduled", "sending", "completed", "failed"
+	Status      string    `json:"status"`        // "draft", "scheduled", "sending", "paused", "cancelled", "completed", "failed" (see core.Campaign*)
 	ScheduledAt *time.Time `json:"scheduled_at"` // Nullable
 
+	// Audience: contacts of these lists and/or matching the segment are
+	// added as recipients when the campaign starts (see core.materializeAudience)
+	ListIDs              string     `json:"list_ids"`   // comma separated ContactList ids, e.g. "3,7"
+	SegmentID            uint       `json:"segment_id"` // 0 = none
+	RecipientsResolvedAt *time.Time `json:"recipients_resolved_at"`
+
+	// Per-recipient timing, in each recipient's timezone (see core.ValidateSendSchedule)
+	SendAtLocalTime string `json:"send_at_local_time"` // "09:00" = deliver at 9 local; "" = as soon as allowed
+	SendWindowDays  string `json:"send_window_days"`   // e.g. "mon,tue,wed,thu,fri"; "" = every day
+	SendWindowStart string `json:"send_window_start"`  // e.g. "08:00"; "" = any hour
+	SendWindowEnd   string `json:"send_window_end"`    // e.g. "18:00"
+	Timezone        string `json:"timezone"`           // for recipients with an unknown timezone; "" = UTC
+
+	// Assets sent as attachments; inline images are referenced from the
+	// body as <img src="cid:asset-ID">
+	AttachmentIDs string `json:"attachment_ids"` // comma separated Asset ids
+
+	// Sending speed (0 = core defaults)
+	Concurrency   int     `json:"concurrency"`     // parallel SMTP connections
+	RatePerSecond float64 `json:"rate_per_second"` // target messages per second
+
 	TotalSent   int       `json:"total_sent"`
 	TotalFailed int       `json:"total_failed"`
 	TotalOpens  int       `json:"total_opens"`
 	TotalClicks int       `json:"total_clicks"`
+	TotalUnsubscribes int `json:"total_unsubscribes"`
+
+	// A/B test (with 2-5 Variants): ABTestPercent of the recipients are
+	// split across the variants, then after ABWaitMinutes the rest get the
+	// variant with the best ABWinnerMetric rate.
+	ABTestPercent   int        `json:"ab_test_percent"`
+	ABWinnerMetric  string     `json:"ab_winner_metric"` // "opens", "clicks" or "unique_clicks"
+	ABWaitMinutes   int        `json:"ab_wait_minutes"`
+	ABStatus        string     `json:"ab_status"`        // "", "testing", "waiting", "decided" (see core.AB*)
+	ABTestEndsAt    *time.Time `json:"ab_test_ends_at"`
+	WinnerVariantID uint       `json:"winner_variant_id"`
+	Variants        []CampaignVariant `json:"variants,omitempty" gorm:"foreignKey:CampaignID"`
 
 	CreatedAt   time.Time `json:"created_at"`
 	Recipients  []CampaignRecipient `json:"recipients,omitempty" gorm:"foreignKey:CampaignID"`
 }
 
+// CampaignVariant is one version of a campaign in an A/B test. Empty
+// subject/body fall back to the campaign's.
+type CampaignVariant struct {
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	CampaignID uint   `gorm:"index" json:"campaign_id"`
+	Name       string `json:"name"` // "A", "B", ...
+	Subject    string `json:"subject"`
+	Body       string `json:"body"`
+
+	// Counters, from the sender and the tracking handlers
+	Sent         int `json:"sent"`
+	Opens        int `json:"opens"`         // unique opens
+	Clicks       int `json:"clicks"`        // every click
+	UniqueClicks int `json:"unique_clicks"` // recipients who clicked
+}
+
 // CampaignRecipient tracks individual status in a campaign
 type CampaignRecipient struct {
 	ID         uint      `gorm:"primaryKey" json:"id"`
 	CampaignID uint      `gorm:"index" json:"campaign_id"`
 	Email      string    `gorm:"index" json:"email"`
 	ContactID  uint      `gorm:"index" json:"contact_id"` // Optional link to persistent contact
+	VariantID  uint      `gorm:"index" json:"variant_id"` // A/B variant sent (0 = the campaign itself)
+	Timezone   string     `json:"timezone,omitempty"`        // resolved when the campaign starts
+	NotBefore  *time.Time `gorm:"index" json:"not_before"` // not sent before this (local send time / window)
 
-	Status     string    `json:"status"` // "pending", "sent", "failed"
+	Status     string    `json:"status"` // "pending", "sent", "failed", "suppressed", then from delivery events "delivered", "bounced", "complained"
 	Error      string    `json:"error,omitempty"`
+	Attempts   int       `json:"attempts"` // deferrals (4xx) so far
 	SentAt     time.Time `json:"sent_at,omitempty"`
 
 	// Tracking
 	OpenedAt   *time.Time `json:"opened_at"`
 	ClickedAt  *time.Time `json:"clicked_at"`
+	UnsubscribedAt *time.Time `json:"unsubscribed_at"`
+}
+
+// Asset is an uploaded file for attachments and inline images. The
+// content is stored on disk under its SHA256 (see core.SaveAsset).
+type Asset struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `json:"name"`         // original file name
+	ContentType string    `json:"content_type"` // sniffed from the content
+	Size        int64     `json:"size"`
+	SHA256      string    `gorm:"index" json:"sha256"`
+	CreatedAt   time.Time `json:"created_at"`
 }
 
 // AutomationWorkflow represents a visual automation flow
@@ -3,8 +3,10 @@ package store
 import (
 	"errors"
 	"log"
+	"strings"
 	"time"
 
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -30,21 +32,39 @@ func NewStore(path string) (*Store, error) {
 		&models.AuthSession{},
 		&models.BounceAccount{},
 		&models.SystemIP{},
+		&models.EgressPool{},
+		&models.EgressPoolMember{},
+		&models.TrafficShaping{},
+		&models.ConfigRevision{},
+		&models.Listener{},
+		&models.CampaignQueuePolicy{},
+		&models.RoutingRule{},
+		&models.PolicySnippet{},
+		&models.Suppression{},
+		&models.DeliveryEvent{},
+		&models.Node{},
 		&models.EmailStats{},
 		&models.WebhookLog{},
 		&models.APIKey{},
 		&models.ChatLog{},
 		&models.ContactList{}, // NEW
 		&models.Contact{},     // NEW
+		&models.Segment{},
 		&models.Campaign{},    // NEW
 		&models.CampaignRecipient{}, // NEW
+		&models.CampaignVariant{},
+		&models.Asset{},
 		&models.AutomationWorkflow{}, // NEW
 		&models.WhatsAppMessage{}, // NEW
 	); err != nil {
 		return nil, err
 	}
 
-	return &Store{DB: db}, nil
+	st := &Store{DB: db}
+	if err := st.hashLegacySMTPPasswords(); err != nil {
+		return nil, err
+	}
+	return st, nil
 }
 
 func (s *Store) LogError(err error) {
@@ -176,7 +196,12 @@ func (s *Store) UpdateDomain(d *models.Domain) error {
 }
 
 func (s *Store) DeleteDomain(id uint) error {
-	return s.DB.Delete(&models.Domain{}, id).Error
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("domain_id = ?", id).Delete(&models.CampaignQueuePolicy{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Domain{}, id).Error
+	})
 }
 
 func (s *Store) CountDomains() (int64, error) {
@@ -207,16 +232,99 @@ func (s *Store) GetSenderByID(id uint) (*models.Sender, error) {
 	return &snd, nil
 }
 
+func (s *Store) GetSenderByEmail(email string) (*models.Sender, error) {
+	var snd models.Sender
+	err := s.DB.Where("LOWER(email) = ?", strings.ToLower(email)).First(&snd).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &snd, nil
+}
+
 func (s *Store) CreateSender(snd *models.Sender) error {
+	if err := hashSMTPPassword(snd); err != nil {
+		return err
+	}
 	return s.DB.Create(snd).Error
 }
 
+// UpdateSender saves the sender; a non-empty SMTPPassword replaces the
+// stored hash.
 func (s *Store) UpdateSender(snd *models.Sender) error {
+	if err := hashSMTPPassword(snd); err != nil {
+		return err
+	}
 	return s.DB.Save(snd).Error
 }
 
+// hashSMTPPassword swaps a plaintext SMTPPassword for its bcrypt hash.
+func hashSMTPPassword(snd *models.Sender) error {
+	if snd.SMTPPassword == "" {
+		return nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(snd.SMTPPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	snd.SMTPPasswordHash = string(hash)
+	snd.SMTPPassword = ""
+	snd.HasSMTPPassword = true
+	return nil
+}
+
+// RecordSMTPAuth updates a sender's SMTP AUTH counters. A success resets
+// the consecutive failure count.
+func (s *Store) RecordSMTPAuth(id uint, ok bool) error {
+	now := time.Now()
+	q := s.DB.Model(&models.Sender{}).Where("id = ?", id)
+	if ok {
+		return q.Updates(map[string]interface{}{"smtp_last_auth": now, "smtp_auth_failures": 0}).Error
+	}
+	return q.Updates(map[string]interface{}{
+		"smtp_last_failure":  now,
+		"smtp_auth_failures": gorm.Expr("smtp_auth_failures + 1"),
+	}).Error
+}
+
+// hashLegacySMTPPasswords hashes passwords left in the old plaintext
+// smtp_password column and blanks it.
+func (s *Store) hashLegacySMTPPasswords() error {
+	if !s.DB.Migrator().HasColumn(&models.Sender{}, "smtp_password") {
+		return nil
+	}
+
+	var rows []struct {
+		ID           uint
+		SMTPPassword string
+	}
+	if err := s.DB.Raw("SELECT id, smtp_password FROM senders WHERE smtp_password IS NOT NULL AND smtp_password <> ''").Scan(&rows).Error; err != nil {
+		return err
+	}
+	for _, row := range rows {
+		hash, err := bcrypt.GenerateFromPassword([]byte(row.SMTPPassword), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		if err := s.DB.Exec("UPDATE senders SET smtp_password_hash = ?, smtp_password = '' WHERE id = ?", string(hash), row.ID).Error; err != nil {
+			return err
+		}
+	}
+	if len(rows) > 0 {
+		log.Printf("Store: hashed %d plaintext SMTP passwords", len(rows))
+	}
+	return nil
+}
+
 func (s *Store) DeleteSender(id uint) error {
-	return s.DB.Delete(&models.Sender{}, id).Error
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("sender_id = ?", id).Delete(&models.CampaignQueuePolicy{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Sender{}, id).Error
+	})
 }
 
 func (s *Store) CountSenders() (int64, error) {
@@ -319,8 +427,548 @@ func (s *Store) CreateSystemIPs(ips []models.SystemIP) error {
 	return s.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&ips).Error
 }
 
+func (s *Store) GetSystemIPByID(id uint) (*models.SystemIP, error) {
+	var ip models.SystemIP
+	err := s.DB.First(&ip, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ip, nil
+}
+
+func (s *Store) UpdateSystemIP(ip *models.SystemIP) error {
+	return s.DB.Save(ip).Error
+}
+
 func (s *Store) DeleteSystemIP(id uint) error {
-	return s.DB.Delete(&models.SystemIP{}, id).Error
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		// Drop the IP from any egress pool it belongs to
+		if err := tx.Where("system_ip_id = ?", id).Delete(&models.EgressPoolMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.SystemIP{}, id).Error
+	})
+}
+
+// ----------------------
+// Egress Pools
+// ----------------------
+
+func (s *Store) ListEgressPools() ([]models.EgressPool, error) {
+	var pools []models.EgressPool
+	err := s.DB.Preload("Members").Preload("Members.SystemIP").Order("name asc").Find(&pools).Error
+	return pools, err
+}
+
+func (s *Store) GetEgressPoolByID(id uint) (*models.EgressPool, error) {
+	var p models.EgressPool
+	err := s.DB.Preload("Members").Preload("Members.SystemIP").First(&p, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *Store) CreateEgressPool(p *models.EgressPool) error {
+	return s.DB.Omit("Members.SystemIP").Create(p).Error
+}
+
+// UpdateEgressPool saves pool fields and replaces the member list.
+func (s *Store) UpdateEgressPool(p *models.EgressPool) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("pool_id = ?", p.ID).Delete(&models.EgressPoolMember{}).Error; err != nil {
+			return err
+		}
+		members := p.Members
+		p.Members = nil
+		if err := tx.Save(p).Error; err != nil {
+			return err
+		}
+		for i := range members {
+			members[i].ID = 0
+			members[i].PoolID = p.ID
+		}
+		if len(members) > 0 {
+			if err := tx.Omit("SystemIP").Create(&members).Error; err != nil {
+				return err
+			}
+		}
+		p.Members = members
+		return nil
+	})
+}
+
+// DeleteEgressPool removes the pool, its members, and unassigns its senders.
+func (s *Store) DeleteEgressPool(id uint) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Sender{}).Where("egress_pool_id = ?", id).Update("egress_pool_id", 0).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("pool_id = ?", id).Delete(&models.EgressPoolMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.RoutingRule{}).Where("egress_pool_id = ?", id).Update("egress_pool_id", 0).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.EgressPool{}, id).Error
+	})
+}
+
+// AssignSendersToPool points the given senders at a pool (0 = unassign).
+func (s *Store) AssignSendersToPool(poolID uint, senderIDs []uint) error {
+	if len(senderIDs) == 0 {
+		return nil
+	}
+	return s.DB.Model(&models.Sender{}).Where("id IN ?", senderIDs).Update("egress_pool_id", poolID).Error
+}
+
+// ----------------------
+// Routing Rules
+// ----------------------
+
+func (s *Store) ListRoutingRules() ([]models.RoutingRule, error) {
+	var list []models.RoutingRule
+	err := s.DB.Order("position asc, id asc").Find(&list).Error
+	return list, err
+}
+
+func (s *Store) GetRoutingRuleByID(id uint) (*models.RoutingRule, error) {
+	var rule models.RoutingRule
+	err := s.DB.First(&rule, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// CreateRoutingRule appends the rule at the end of the list.
+func (s *Store) CreateRoutingRule(rule *models.RoutingRule) error {
+	var maxPos int
+	s.DB.Model(&models.RoutingRule{}).Select("COALESCE(MAX(position), 0)").Scan(&maxPos)
+	rule.Position = maxPos + 1
+	return s.DB.Create(rule).Error
+}
+
+func (s *Store) UpdateRoutingRule(rule *models.RoutingRule) error {
+	return s.DB.Save(rule).Error
+}
+
+func (s *Store) DeleteRoutingRule(id uint) error {
+	return s.DB.Delete(&models.RoutingRule{}, id).Error
+}
+
+// ReorderRoutingRules sets positions following the order of ids.
+func (s *Store) ReorderRoutingRules(ids []uint) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		for i, id := range ids {
+			if err := tx.Model(&models.RoutingRule{}).Where("id = ?", id).Update("position", i+1).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ----------------------
+// Policy Snippets
+// ----------------------
+
+func (s *Store) ListPolicySnippets() ([]models.PolicySnippet, error) {
+	var list []models.PolicySnippet
+	err := s.DB.Order("position asc, id asc").Find(&list).Error
+	return list, err
+}
+
+func (s *Store) GetPolicySnippetByID(id uint) (*models.PolicySnippet, error) {
+	var snip models.PolicySnippet
+	err := s.DB.First(&snip, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &snip, nil
+}
+
+// CreatePolicySnippet appends the snippet at the end of custom.lua.
+func (s *Store) CreatePolicySnippet(snip *models.PolicySnippet) error {
+	var maxPos int
+	s.DB.Model(&models.PolicySnippet{}).Select("COALESCE(MAX(position), 0)").Scan(&maxPos)
+	snip.Position = maxPos + 1
+	return s.DB.Create(snip).Error
+}
+
+func (s *Store) UpdatePolicySnippet(snip *models.PolicySnippet) error {
+	return s.DB.Save(snip).Error
+}
+
+func (s *Store) DeletePolicySnippet(id uint) error {
+	return s.DB.Delete(&models.PolicySnippet{}, id).Error
+}
+
+func (s *Store) CountPolicySnippets() (int64, error) {
+	var count int64
+	err := s.DB.Model(&models.PolicySnippet{}).Count(&count).Error
+	return count, err
+}
+
+// ReorderPolicySnippets sets positions following the order of ids.
+func (s *Store) ReorderPolicySnippets(ids []uint) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		for i, id := range ids {
+			if err := tx.Model(&models.PolicySnippet{}).Where("id = ?", id).Update("position", i+1).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ----------------------
+// Suppressions
+// ----------------------
+
+// ListSuppressions returns suppressions whose value contains search
+// (all of them when search is empty), newest first.
+func (s *Store) ListSuppressions(search string) ([]models.Suppression, error) {
+	var list []models.Suppression
+	q := s.DB.Order("created_at desc, id desc")
+	if search != "" {
+		q = q.Where("value LIKE ?", "%"+strings.ToLower(search)+"%")
+	}
+	err := q.Find(&list).Error
+	return list, err
+}
+
+// ListActiveSuppressions returns suppressions that have not expired at now.
+func (s *Store) ListActiveSuppressions(now time.Time) ([]models.Suppression, error) {
+	var list []models.Suppression
+	err := s.DB.Where("expires_at IS NULL OR expires_at > ?", now).Order("value asc").Find(&list).Error
+	return list, err
+}
+
+func (s *Store) GetSuppressionByID(id uint) (*models.Suppression, error) {
+	var sup models.Suppression
+	err := s.DB.First(&sup, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sup, nil
+}
+
+// UpsertSuppression creates the suppression or, if the value is already
+// suppressed, replaces its reason, source and expiry.
+func (s *Store) UpsertSuppression(sup *models.Suppression) error {
+	return s.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "value"}},
+		DoUpdates: clause.AssignmentColumns([]string{"type", "reason", "source", "expires_at"}),
+	}).Create(sup).Error
+}
+
+func (s *Store) DeleteSuppression(id uint) error {
+	return s.DB.Delete(&models.Suppression{}, id).Error
+}
+
+// SuppressedRecipients returns the reason for every address in emails that
+// is suppressed at now, either directly or through its domain.
+func (s *Store) SuppressedRecipients(emails []string, now time.Time) (map[string]string, error) {
+	out := map[string]string{}
+	if len(emails) == 0 {
+		return out, nil
+	}
+
+	values := make([]string, 0, len(emails)*2)
+	for _, e := range emails {
+		e = strings.ToLower(strings.TrimSpace(e))
+		values = append(values, e)
+		if at := strings.LastIndex(e, "@"); at >= 0 {
+			values = append(values, e[at+1:])
+		}
+	}
+
+	var list []models.Suppression
+	err := s.DB.Where("value IN ? AND (expires_at IS NULL OR expires_at > ?)", values, now).Find(&list).Error
+	if err != nil {
+		return nil, err
+	}
+	reasons := make(map[string]string, len(list))
+	for _, sup := range list {
+		reasons[sup.Value] = sup.Reason
+	}
+
+	for _, e := range emails {
+		key := strings.ToLower(strings.TrimSpace(e))
+		if reason, ok := reasons[key]; ok {
+			out[key] = reason
+		} else if at := strings.LastIndex(key, "@"); at >= 0 {
+			if reason, ok := reasons[key[at+1:]]; ok {
+				out[key] = reason
+			}
+		}
+	}
+	return out, nil
+}
+
+// ----------------------
+// Delivery Events
+// ----------------------
+
+// DeliveryEventFilter narrows ListDeliveryEvents; empty fields match anything.
+type DeliveryEventFilter struct {
+	MessageID string
+	Recipient string
+	Campaign  string
+	Type      string
+	Limit     int
+}
+
+func (s *Store) CreateDeliveryEvents(events []models.DeliveryEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	return s.DB.Create(&events).Error
+}
+
+// ListDeliveryEvents returns matching events, newest first.
+func (s *Store) ListDeliveryEvents(f DeliveryEventFilter) ([]models.DeliveryEvent, error) {
+	q := s.DB.Order("event_time desc, id desc")
+	if f.MessageID != "" {
+		q = q.Where("message_id = ?", f.MessageID)
+	}
+	if f.Recipient != "" {
+		q = q.Where("recipient = ?", strings.ToLower(f.Recipient))
+	}
+	if f.Campaign != "" {
+		q = q.Where("campaign = ?", f.Campaign)
+	}
+	if f.Type != "" {
+		q = q.Where("type = ?", f.Type)
+	}
+	if f.Limit <= 0 || f.Limit > 1000 {
+		f.Limit = 100
+	}
+
+	var list []models.DeliveryEvent
+	err := q.Limit(f.Limit).Find(&list).Error
+	return list, err
+}
+
+// ----------------------
+// Nodes
+// ----------------------
+
+func (s *Store) ListNodes() ([]models.Node, error) {
+	var nodes []models.Node
+	err := s.DB.Order("name asc").Find(&nodes).Error
+	return nodes, err
+}
+
+func (s *Store) GetNodeByID(id uint) (*models.Node, error) {
+	var n models.Node
+	err := s.DB.First(&n, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+func (s *Store) CreateNode(n *models.Node) error {
+	return s.DB.Create(n).Error
+}
+
+func (s *Store) UpdateNode(n *models.Node) error {
+	return s.DB.Save(n).Error
+}
+
+func (s *Store) DeleteNode(id uint) error {
+	return s.DB.Delete(&models.Node{}, id).Error
+}
+
+// CountNodeAssignments counts the domains and senders assigned to a node.
+func (s *Store) CountNodeAssignments(id uint) (int64, error) {
+	var domains, senders int64
+	if err := s.DB.Model(&models.Domain{}).Where("node_id = ?", id).Count(&domains).Error; err != nil {
+		return 0, err
+	}
+	if err := s.DB.Model(&models.Sender{}).Where("node_id = ?", id).Count(&senders).Error; err != nil {
+		return 0, err
+	}
+	return domains + senders, nil
+}
+
+// RecordNodeStatus stores the outcome of polling a node's agent.
+func (s *Store) RecordNodeStatus(id uint, report string, pollErr error) error {
+	if pollErr != nil {
+		return s.DB.Model(&models.Node{}).Where("id = ?", id).Update("last_error", pollErr.Error()).Error
+	}
+	return s.DB.Model(&models.Node{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"last_seen_at": time.Now(),
+		"last_error":   "",
+		"last_report":  report,
+	}).Error
+}
+
+// RecordNodeApply stores the outcome of pushing config to a node. hash is
+// only kept when the push succeeded.
+func (s *Store) RecordNodeApply(id uint, hash string, applyErr error) error {
+	updates := map[string]interface{}{"last_apply_at": time.Now(), "last_apply_error": ""}
+	if applyErr != nil {
+		updates["last_apply_error"] = applyErr.Error()
+	} else {
+		updates["applied_hash"] = hash
+	}
+	return s.DB.Model(&models.Node{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// ----------------------
+// Traffic Shaping
+// ----------------------
+
+func (s *Store) ListTrafficShaping() ([]models.TrafficShaping, error) {
+	var list []models.TrafficShaping
+	err := s.DB.Order("domain asc").Find(&list).Error
+	return list, err
+}
+
+func (s *Store) GetTrafficShapingByID(id uint) (*models.TrafficShaping, error) {
+	var sh models.TrafficShaping
+	err := s.DB.First(&sh, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sh, nil
+}
+
+func (s *Store) CreateTrafficShaping(sh *models.TrafficShaping) error {
+	return s.DB.Create(sh).Error
+}
+
+func (s *Store) UpdateTrafficShaping(sh *models.TrafficShaping) error {
+	return s.DB.Save(sh).Error
+}
+
+func (s *Store) DeleteTrafficShaping(id uint) error {
+	return s.DB.Delete(&models.TrafficShaping{}, id).Error
+}
+
+// ----------------------
+// Campaign Queue Policies
+// ----------------------
+
+func (s *Store) ListCampaignQueuePolicies() ([]models.CampaignQueuePolicy, error) {
+	var list []models.CampaignQueuePolicy
+	err := s.DB.Order("domain_id asc, campaign asc").Find(&list).Error
+	return list, err
+}
+
+func (s *Store) ListCampaignQueuePoliciesByDomain(domainID uint) ([]models.CampaignQueuePolicy, error) {
+	var list []models.CampaignQueuePolicy
+	err := s.DB.Where("domain_id = ?", domainID).Order("campaign asc").Find(&list).Error
+	return list, err
+}
+
+func (s *Store) GetCampaignQueuePolicyByID(id uint) (*models.CampaignQueuePolicy, error) {
+	var p models.CampaignQueuePolicy
+	err := s.DB.First(&p, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *Store) CreateCampaignQueuePolicy(p *models.CampaignQueuePolicy) error {
+	return s.DB.Create(p).Error
+}
+
+func (s *Store) UpdateCampaignQueuePolicy(p *models.CampaignQueuePolicy) error {
+	return s.DB.Save(p).Error
+}
+
+func (s *Store) DeleteCampaignQueuePolicy(id uint) error {
+	return s.DB.Delete(&models.CampaignQueuePolicy{}, id).Error
+}
+
+// ----------------------
+// SMTP Listeners
+// ----------------------
+
+func (s *Store) ListListeners() ([]models.Listener, error) {
+	var list []models.Listener
+	err := s.DB.Order("id asc").Find(&list).Error
+	return list, err
+}
+
+func (s *Store) GetListenerByID(id uint) (*models.Listener, error) {
+	var l models.Listener
+	err := s.DB.First(&l, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+func (s *Store) CreateListener(l *models.Listener) error {
+	return s.DB.Create(l).Error
+}
+
+func (s *Store) UpdateListener(l *models.Listener) error {
+	return s.DB.Save(l).Error
+}
+
+func (s *Store) DeleteListener(id uint) error {
+	return s.DB.Delete(&models.Listener{}, id).Error
+}
+
+// ----------------------
+// Config Revisions
+// ----------------------
+
+func (s *Store) CreateConfigRevision(rev *models.ConfigRevision) error {
+	return s.DB.Create(rev).Error
+}
+
+// ListConfigRevisions returns revisions newest first, without the file bodies.
+func (s *Store) ListConfigRevisions(limit int) ([]models.ConfigRevision, error) {
+	var list []models.ConfigRevision
+	err := s.DB.Omit("files_json", "diff").Order("id desc").Limit(limit).Find(&list).Error
+	return list, err
+}
+
+func (s *Store) GetConfigRevisionByID(id uint) (*models.ConfigRevision, error) {
+	var rev models.ConfigRevision
+	err := s.DB.First(&rev, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rev, nil
 }
 
 // ----------------------
@@ -143,6 +143,40 @@ export function deleteSender(id) {
   return apiRequest(`/senders/${id}`, { method: "DELETE" });
 }
 
+// Returns { username, password, requires_apply }; the password is shown only once
+export function rotateSenderPassword(id) {
+  return apiRequest(`/senders/${id}/rotate-password`, { method: "POST" });
+}
+
+// Nodes
+export function listNodes() {
+  return apiRequest("/nodes");
+}
+
+export function createNode(data) {
+  return apiRequest("/nodes", { method: "POST", body: data });
+}
+
+export function updateNode(id, data) {
+  return apiRequest(`/nodes/${id}`, { method: "PUT", body: data });
+}
+
+export function deleteNode(id) {
+  return apiRequest(`/nodes/${id}`, { method: "DELETE" });
+}
+
+export function rotateNodeSecret(id) {
+  return apiRequest(`/nodes/${id}/rotate-secret`, { method: "POST" });
+}
+
+export function applyNodeConfig(id) {
+  return apiRequest(`/nodes/${id}/apply`, { method: "POST" });
+}
+
+export function refreshNode(id) {
+  return apiRequest(`/nodes/${id}/refresh`, { method: "POST" });
+}
+
 // Config
 export function previewConfig() {
   return apiRequest("/config/preview");
@@ -225,6 +259,10 @@ export function checkSecurity() {
   return apiRequest("/system/check-security", { method: "POST" });
 }
 
+export function checkAlignment() {
+  return apiRequest("/system/alignment");
+}
+
 // --- Warmup ---
 export function getWarmupList() {
   return apiRequest("/warmup");
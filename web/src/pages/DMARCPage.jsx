@@ -185,6 +185,12 @@ export default function DMARCPage() {
                 icon={Server} color="text-blue-500" 
                 onCopy={copyToClipboard} copied={copied}
               />
+              <DNSSect title="AAAA Records" 
+                recs={dnsData.generated.aaaa} 
+                live={dnsData.live.aaaa} 
+                icon={Server} color="text-blue-500" 
+                onCopy={copyToClipboard} copied={copied}
+              />
               <DNSSect title="MX Records" 
                 recs={dnsData.generated.mx} 
                 live={dnsData.live.mx} 
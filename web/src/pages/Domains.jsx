@@ -16,7 +16,8 @@ import {
   Shield,
   X,
   Eye,
-  EyeOff
+  EyeOff,
+  KeyRound
 } from "lucide-react";
 import {
   listDomains,
@@ -24,6 +25,7 @@ import {
   deleteDomain,
   saveSender,
   deleteSender,
+  rotateSenderPassword,
   getSettings,
   getSystemIPs,
   importSenders
@@ -48,6 +50,8 @@ export default function Domains() {
     local_part: "",
     email: "",
     ip: "",
+    ehlo_domain: "",
+    display_name: "",
     smtp_password: ""
   });
   
@@ -108,7 +112,7 @@ export default function Domains() {
     e.preventDefault();
     try {
       await saveSender(senderForm.domainID, senderForm);
-      setSenderForm({ domainID: null, id: 0, local_part: "", email: "", ip: "", smtp_password: "" });
+      setSenderForm({ domainID: null, id: 0, local_part: "", email: "", ip: "", ehlo_domain: "", display_name: "", smtp_password: "" });
       setShowPassword(false);
       await load();
     } catch (err) { setMsg(err.message); }
@@ -119,6 +123,18 @@ export default function Domains() {
     try { await deleteSender(id); await load(); } catch (err) { setMsg(err.message); }
   };
 
+  const handleRotatePassword = async (s) => {
+    if (!confirm(`Generate a new SMTP password for ${s.email}? The old one stops working.`)) return;
+    try {
+      const res = await rotateSenderPassword(s.id);
+      window.prompt(
+        "New SMTP password (shown only once)" + (res.requires_apply ? " - apply the config to enable SMTP AUTH" : ""),
+        res.password
+      );
+      await load();
+    } catch (err) { setMsg(err.message); }
+  };
+
   // --- Copy Helper ---
   const [copied, setCopied] = useState("");
   const copy = (text, id) => {
@@ -130,17 +146,28 @@ export default function Domains() {
   // --- DNS Logic ---
   const dnsHelpers = (d) => {
     const mainIp = settings?.main_server_ip || "SERVER_IP";
+    const mainIpv6 = settings?.main_server_ipv6;
     const ips = new Set();
     d.senders?.forEach(s => s.ip && ips.add(s.ip));
     ips.add(mainIp);
+    if (mainIpv6) ips.add(mainIpv6);
     
-    const ipParts = Array.from(ips).map(ip => `ip4:${ip}`).join(" ");
+    const ipParts = Array.from(ips).map(ip => ip.includes(":") ? `ip6:${ip}` : `ip4:${ip}`).join(" ");
     const spfValue = `v=spf1 ${ipParts} ~all`;
     const root = d.name;
     
-    return [
+    const records = [
       { label: "A (Mail)", value: `${d.mail_host} 3600 IN A ${mainIp}` },
       { label: "A (Bounce)", value: `${d.bounce_host} 3600 IN A ${mainIp}` },
+    ];
+    if (mainIpv6) {
+      records.push(
+        { label: "AAAA (Mail)", value: `${d.mail_host} 3600 IN AAAA ${mainIpv6}` },
+        { label: "AAAA (Bounce)", value: `${d.bounce_host} 3600 IN AAAA ${mainIpv6}` }
+      );
+    }
+    return [
+      ...records,
       { label: "MX", value: `${root} 3600 IN MX 10 ${d.mail_host}.` },
       { label: "SPF", value: `${root} 3600 IN TXT "${spfValue}"` }
     ];
@@ -229,7 +256,7 @@ export default function Domains() {
                     <h4 className="text-xs font-semibold text-muted-foreground uppercase tracking-wider">Senders</h4>
                     <button 
                       onClick={() => {
-                        setSenderForm({ domainID: d.id, id: 0, local_part: "", email: "", ip: "", smtp_password: "" });
+                        setSenderForm({ domainID: d.id, id: 0, local_part: "", email: "", ip: "", ehlo_domain: "", display_name: "", smtp_password: "" });
                         setShowPassword(false);
                       }} 
                       className="text-xs flex items-center gap-1 text-primary hover:underline"
@@ -251,19 +278,21 @@ export default function Domains() {
                               <div className="text-xs text-muted-foreground flex gap-2">
                                 <span>IP: {s.ip || "Default"}</span>
                                 {s.has_dkim && <span className="text-green-600 flex items-center gap-0.5"><ShieldCheck className="w-3 h-3" /> DKIM</span>}
+                                {s.has_smtp_password && <span>SMTP AUTH{s.smtp_auth_failures > 0 && ` (${s.smtp_auth_failures} failed)`}</span>}
                               </div>
                             </div>
                           </div>
                           <div className="flex gap-1">
                             <button 
                               onClick={() => {
-                                setSenderForm({ domainID: d.id, ...s });
+                                setSenderForm({ domainID: d.id, ...s, smtp_password: "" });
                                 setShowPassword(false);
                               }} 
                               className="p-1.5 hover:bg-muted rounded text-muted-foreground"
                             >
                               <Edit2 className="w-3 h-3" />
                             </button>
+                            <button onClick={() => handleRotatePassword(s)} title="Rotate SMTP password" className="p-1.5 hover:bg-muted rounded text-muted-foreground"><KeyRound className="w-3 h-3" /></button>
                             <button onClick={() => handleDeleteSender(s.id)} className="p-1.5 hover:bg-destructive/10 hover:text-destructive rounded text-muted-foreground"><Trash2 className="w-3 h-3" /></button>
                           </div>
                         </div>
@@ -375,6 +404,10 @@ export default function Domains() {
                 <label className="text-sm font-medium">Email Address</label>
                 <input className="w-full h-10 px-3 rounded-md border bg-background" value={senderForm.email} onChange={e => setSenderForm({...senderForm, email: e.target.value})} placeholder="news@example.com" />
               </div>
+              <div className="space-y-2">
+                <label className="text-sm font-medium">From Name (optional)</label>
+                <input className="w-full h-10 px-3 rounded-md border bg-background" value={senderForm.display_name || ""} onChange={e => setSenderForm({...senderForm, display_name: e.target.value})} placeholder="Acme Newsletter" />
+              </div>
               <div className="space-y-2">
                 <label className="text-sm font-medium">IP Address</label>
                 <select className="w-full h-10 px-3 rounded-md border bg-background" value={senderForm.ip} onChange={e => setSenderForm({...senderForm, ip: e.target.value})}>
@@ -382,6 +415,11 @@ export default function Domains() {
                   {systemIPs.map(ip => <option key={ip.id} value={ip.value}>{ip.value} ({ip.interface})</option>)}
                 </select>
               </div>
+              <div className="space-y-2">
+                <label className="text-sm font-medium">EHLO Hostname (optional)</label>
+                <input className="w-full h-10 px-3 rounded-md border bg-background" value={senderForm.ehlo_domain || ""} onChange={e => setSenderForm({...senderForm, ehlo_domain: e.target.value})} placeholder={senderForm.local_part ? `${senderForm.local_part}.<domain>` : "mta1.example.com"} />
+                <p className="text-xs text-muted-foreground">Should match the IP's PTR record.</p>
+              </div>
               
               {/* UPDATED: Password Field with Eye Toggle */}
               <div className="space-y-2">
@@ -409,7 +447,7 @@ export default function Domains() {
                 <button 
                   type="button" 
                   onClick={() => {
-                    setSenderForm({ domainID: null, id: 0, local_part: "", email: "", ip: "", smtp_password: "" });
+                    setSenderForm({ domainID: null, id: 0, local_part: "", email: "", ip: "", ehlo_domain: "", display_name: "", smtp_password: "" });
                     setShowPassword(false);
                   }} 
                   className="px-4 py-2 text-sm rounded-md hover:bg-muted"
@@ -15,6 +15,8 @@ export default function Settings() {
   const [form, setForm] = useState({
     main_hostname: "",
     main_server_ip: "",
+    main_server_ipv6: "",
+    panel_url: "",
     relay_ips: "",
     ai_provider: "",
     ai_api_key: ""
@@ -97,6 +99,34 @@ export default function Settings() {
               </div>
             </div>
 
+            <div className="space-y-2">
+              <label className="text-sm font-medium">Main Server IPv6 (optional)</label>
+              <div className="relative">
+                <Network className="absolute left-3 top-2.5 h-4 w-4 text-muted-foreground" />
+                <input
+                  name="main_server_ipv6"
+                  value={form.main_server_ipv6}
+                  onChange={onChange}
+                  className="w-full pl-9 h-10 rounded-md border bg-background px-3 text-sm focus:ring-2 focus:ring-ring"
+                  placeholder="2001:db8::1"
+                />
+              </div>
+            </div>
+
+            <div className="space-y-2">
+              <label className="text-sm font-medium">Panel URL (for remote nodes)</label>
+              <div className="relative">
+                <Globe className="absolute left-3 top-2.5 h-4 w-4 text-muted-foreground" />
+                <input
+                  name="panel_url"
+                  value={form.panel_url}
+                  onChange={onChange}
+                  className="w-full pl-9 h-10 rounded-md border bg-background px-3 text-sm focus:ring-2 focus:ring-ring"
+                  placeholder="https://panel.example.com"
+                />
+              </div>
+            </div>
+
             <div className="space-y-2">
               <label className="text-sm font-medium">Relay IPs (CSV)</label>
               <input